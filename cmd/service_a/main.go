@@ -38,6 +38,16 @@ func main() {
 		"starting server "+serviceName,
 		slog.String("env", cfg.Env),
 		slog.String("version", cfg.Version),
+		slog.Int("data_shards", cfg.DataShards),
+		slog.Int("parity_shards", cfg.ParityShards),
+		slog.Int("replicas", cfg.Replicas),
+		slog.Bool("s3_api", cfg.S3AccessKey != ""),
+		slog.String("s3_region", cfg.S3Region),
+		slog.Bool("api_auth", cfg.APIAdminKey != ""),
+		slog.Bool("service_tls", cfg.TLSCertFile != "" || cfg.TLSCAFile != ""),
+		slog.Bool("service_auth", cfg.ServiceSecret != ""),
+		slog.Bool("presigned_urls", cfg.PresignSecret != ""),
+		slog.Bool("encryption", cfg.EncryptionKeyFile != ""),
 		slog.Bool("use_tracing", cfg.UseTracing),
 		slog.String("tracing_address", cfg.TracingAddress),
 	)
@@ -51,7 +61,7 @@ func main() {
 func run(log *slog.Logger, cfg *config.Config) error {
 	log.Debug("starting db connect ", "connect", cfg.DBConnect)
 
-	application, err := app.NewServiceA(log, cfg.DBConnect, cfg.Port, cfg.UseTracing, cfg.TracingAddress, serviceName)
+	application, err := app.NewServiceA(log, cfg, serviceName)
 	defer application.Stop()
 	if err != nil {
 		return err
@@ -40,6 +40,8 @@ func main() {
 		slog.String("version", cfg.Version),
 		slog.Bool("use_tracing", cfg.UseTracing),
 		slog.String("tracing_address", cfg.TracingAddress),
+		slog.Bool("service_tls", cfg.TLSCertFile != ""),
+		slog.Bool("service_auth", cfg.ServiceSecret != ""),
 	)
 
 	if err := run(log, cfg); err != nil {
@@ -54,7 +56,7 @@ func run(log *slog.Logger, cfg *config.Config) error {
 		"port", cfg.Port,
 		"redis_db", cfg.RedisDB,
 	)
-	application, err := app.NewServiceB(log, cfg.DBConnect, cfg.Port, cfg.RedisDB, cfg.UseTracing, cfg.TracingAddress, serviceName)
+	application, err := app.NewServiceB(log, cfg, serviceName)
 	defer application.Stop()
 	if err != nil {
 		return err
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS api_key (
+    id VARCHAR(64) PRIMARY KEY,
+    secret TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    namespaces TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+COMMENT ON TABLE api_key IS 'Table for storing keys of the REST API';
+COMMENT ON COLUMN api_key.id IS 'Public identifier of the key';
+COMMENT ON COLUMN api_key.secret IS 'Secret of the key; kept in plain form because HMAC signatures are verified with it';
+COMMENT ON COLUMN api_key.scopes IS 'Allowed operations: read, write, delete, admin';
+COMMENT ON COLUMN api_key.namespaces IS 'Namespaces whose objects the key can access; empty - all';
+COMMENT ON COLUMN api_key.created_at IS 'Date and time of the record creation';
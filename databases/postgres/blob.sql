@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS blob (
+    id UUID PRIMARY KEY,
+    checksum VARCHAR(64) NOT NULL UNIQUE,
+    bucket_ids BIGINT[],
+    manifest JSONB NOT NULL DEFAULT '[]',
+    size BIGINT NOT NULL DEFAULT 0,
+    data_shards INT NOT NULL,
+    parity_shards INT NOT NULL,
+    key_id VARCHAR(64),
+    wrapped_key BYTEA,
+    refcount INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP   NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+-- Index for filtering and sorting the list of files by size.
+CREATE INDEX IF NOT EXISTS blob_size_idx ON blob (size);
+-- Index for finding contents whose data keys are wrapped by an old master key (key rotation).
+CREATE INDEX IF NOT EXISTS blob_key_id_idx ON blob (key_id);
+
+COMMENT ON TABLE blob IS 'Table for storing file contents: one record per unique content shared by all files with that content';
+COMMENT ON COLUMN blob.id IS 'Unique identifier of the content in UUID format, used as the key of the shards in buckets';
+COMMENT ON COLUMN blob.checksum IS 'Unique hash of the content as a string';
+COMMENT ON COLUMN blob.bucket_ids IS 'Array of bucket ids where copies of the content shards are stored, in the manifest order';
+COMMENT ON COLUMN blob.manifest IS 'Ordered list of the content shards: index, bucket ids of the shard copies, offset in the content, length and SHA-256 checksum';
+COMMENT ON COLUMN blob.size IS 'Size of the content in bytes';
+COMMENT ON COLUMN blob.data_shards IS 'Number of data shards of the Reed-Solomon coding';
+COMMENT ON COLUMN blob.parity_shards IS 'Number of parity shards of the Reed-Solomon coding';
+COMMENT ON COLUMN blob.key_id IS 'ID of the master key that wraps the data key of the content; NULL if the content is not encrypted';
+COMMENT ON COLUMN blob.wrapped_key IS 'Data key of the content (AES-256-GCM) encrypted by the master key key_id';
+COMMENT ON COLUMN blob.refcount IS 'Number of files referencing the content; shards are deleted when it reaches zero';
+COMMENT ON COLUMN blob.created_at IS 'Date and time of the record creation';
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS file (
+    uuid UUID PRIMARY KEY,
+    blob_id UUID NOT NULL REFERENCES blob (id),
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    owner_key VARCHAR(64),
+    created_at TIMESTAMP   NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+CREATE INDEX IF NOT EXISTS file_blob_id_idx ON file (blob_id);
+-- Indexes for listing files (GET /api/files): filters and keyset pagination by the sort column and uuid.
+CREATE INDEX IF NOT EXISTS file_created_at_idx ON file (created_at, uuid);
+CREATE INDEX IF NOT EXISTS file_filename_idx ON file (filename COLLATE "C", uuid);
+CREATE INDEX IF NOT EXISTS file_content_type_idx ON file (content_type, created_at);
+CREATE INDEX IF NOT EXISTS file_owner_key_idx ON file (owner_key, created_at);
+
+COMMENT ON TABLE file IS 'Table for storing files: user-facing records referencing stored content';
+COMMENT ON COLUMN file.uuid IS 'Unique identifier of the file in UUID format';
+COMMENT ON COLUMN file.blob_id IS 'ID of the file content';
+COMMENT ON COLUMN file.filename IS 'Name of the file';
+COMMENT ON COLUMN file.content_type IS 'Content Type of the file';
+COMMENT ON COLUMN file.owner_key IS 'ID of the API key that uploaded the file; NULL if uploaded without authentication';
+COMMENT ON COLUMN file.created_at IS 'Date and time of the record creation';
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS lifecycle_rule (
+    id BIGSERIAL PRIMARY KEY,
+    namespace VARCHAR(63) NOT NULL REFERENCES namespace (name),
+    prefix TEXT COLLATE "C" NOT NULL DEFAULT '',
+    expire_days INTEGER CHECK (expire_days > 0),
+    expire_at TIMESTAMP,
+    keep_versions INTEGER CHECK (keep_versions > 0),
+    created_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+CREATE INDEX IF NOT EXISTS lifecycle_rule_namespace_idx ON lifecycle_rule (namespace);
+
+-- Index for finding objects that expired by the time of their last change.
+CREATE INDEX IF NOT EXISTS object_updated_at_idx ON object (namespace, updated_at);
+
+COMMENT ON TABLE lifecycle_rule IS 'Table for storing lifecycle rules that expire objects and purge old versions';
+COMMENT ON COLUMN lifecycle_rule.id IS 'Unique identifier of the rule; rules of a namespace are kept in insertion order';
+COMMENT ON COLUMN lifecycle_rule.namespace IS 'Name of the namespace';
+COMMENT ON COLUMN lifecycle_rule.prefix IS 'Key prefix of the objects the rule applies to; empty for the whole namespace';
+COMMENT ON COLUMN lifecycle_rule.expire_days IS 'Objects are deleted this many days after the last change; NULL - never';
+COMMENT ON COLUMN lifecycle_rule.expire_at IS 'Objects last changed before this date and time are deleted at it; NULL - never';
+COMMENT ON COLUMN lifecycle_rule.keep_versions IS 'Number of the latest versions of an object to keep, older ones are purged; NULL - all';
+COMMENT ON COLUMN lifecycle_rule.created_at IS 'Date and time of the record creation';
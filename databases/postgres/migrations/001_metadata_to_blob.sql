@@ -0,0 +1,23 @@
+-- Migration of a database created before content deduplication: the metadata table is split into blob and file.
+-- Run once after creating the new tables (blob.sql, file.sql). Shards in buckets are stored by the id of
+-- the metadata record, so the content keeps that id, and the file keeps it too so that its links still work.
+BEGIN;
+
+-- Checksums in metadata are unique, so every content is referenced by exactly one file.
+INSERT INTO blob (id, checksum, bucket_ids, manifest, size, data_shards, parity_shards, refcount, created_at)
+SELECT uuid, checksum, bucket_ids, manifest, size, data_shards, parity_shards, 1, created_at
+FROM metadata
+ON CONFLICT DO NOTHING;
+
+INSERT INTO file (uuid, blob_id, filename, content_type, created_at)
+SELECT uuid, uuid, filename, content_type, created_at
+FROM metadata
+ON CONFLICT DO NOTHING;
+
+-- Shards waiting to be deleted are now referenced by the content id (equal to the old file id).
+ALTER TABLE pending_delete RENAME COLUMN uuid TO blob_id;
+COMMENT ON COLUMN pending_delete.blob_id IS 'ID of the deleted content';
+
+DROP TABLE metadata;
+
+COMMIT;
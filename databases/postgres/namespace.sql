@@ -0,0 +1,47 @@
+CREATE TABLE IF NOT EXISTS namespace (
+    name VARCHAR(63) PRIMARY KEY,
+    versioning BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+COMMENT ON TABLE namespace IS 'Table for storing namespaces (S3 buckets) that group objects';
+COMMENT ON COLUMN namespace.name IS 'Unique name of the namespace';
+COMMENT ON COLUMN namespace.versioning IS 'Whether every write of an object keeps the previous versions';
+COMMENT ON COLUMN namespace.created_at IS 'Date and time of the record creation';
+
+CREATE TABLE IF NOT EXISTS object (
+    namespace VARCHAR(63) NOT NULL REFERENCES namespace (name),
+    key TEXT COLLATE "C" NOT NULL,
+    file_uuid UUID NOT NULL REFERENCES file (uuid) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now()),
+    updated_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now()),
+    PRIMARY KEY (namespace, key)
+);
+
+CREATE INDEX IF NOT EXISTS object_file_uuid_idx ON object (file_uuid);
+
+COMMENT ON TABLE object IS 'Table for storing objects: named files inside namespaces';
+COMMENT ON COLUMN object.namespace IS 'Name of the namespace';
+COMMENT ON COLUMN object.key IS 'Key of the object; compared byte-wise so that listing order matches S3';
+COMMENT ON COLUMN object.file_uuid IS 'ID of the file with the current object content';
+COMMENT ON COLUMN object.created_at IS 'Date and time of the record creation';
+COMMENT ON COLUMN object.updated_at IS 'Date and time of the last content change';
+
+CREATE TABLE IF NOT EXISTS object_version (
+    id UUID PRIMARY KEY,
+    seq BIGSERIAL NOT NULL,
+    namespace VARCHAR(63) NOT NULL REFERENCES namespace (name),
+    key TEXT COLLATE "C" NOT NULL,
+    file_uuid UUID UNIQUE REFERENCES file (uuid) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+CREATE INDEX IF NOT EXISTS object_version_key_idx ON object_version (namespace, key, seq);
+
+COMMENT ON TABLE object_version IS 'Table for storing versions of objects in namespaces with versioning enabled';
+COMMENT ON COLUMN object_version.id IS 'Unique identifier of the version in UUID format';
+COMMENT ON COLUMN object_version.seq IS 'Order of the version among the versions of the object; the greatest one is the latest';
+COMMENT ON COLUMN object_version.namespace IS 'Name of the namespace';
+COMMENT ON COLUMN object_version.key IS 'Key of the object';
+COMMENT ON COLUMN object_version.file_uuid IS 'ID of the file with the version content; NULL for a delete marker';
+COMMENT ON COLUMN object_version.created_at IS 'Date and time the version was written';
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS pending_delete (
+    blob_id UUID NOT NULL,
+    bucket_id BIGINT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now()),
+    created_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now()),
+    PRIMARY KEY (blob_id, bucket_id)
+);
+
+COMMENT ON TABLE pending_delete IS 'Table for storing content shards waiting to be deleted from buckets';
+COMMENT ON COLUMN pending_delete.blob_id IS 'ID of the deleted content';
+COMMENT ON COLUMN pending_delete.bucket_id IS 'ID of the bucket where the part is stored';
+COMMENT ON COLUMN pending_delete.attempts IS 'Number of failed delete attempts';
+COMMENT ON COLUMN pending_delete.last_error IS 'Error of the last failed delete attempt';
+COMMENT ON COLUMN pending_delete.next_attempt_at IS 'Date and time of the next delete attempt';
+COMMENT ON COLUMN pending_delete.created_at IS 'Date and time of the record creation';
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS presigned_upload (
+    id VARCHAR(64) PRIMARY KEY,
+    owner_key VARCHAR(64),
+    max_size BIGINT NOT NULL CHECK (max_size > 0),
+    content_type TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+CREATE INDEX IF NOT EXISTS presigned_upload_expires_at_idx ON presigned_upload (expires_at);
+
+COMMENT ON TABLE presigned_upload IS 'Table for storing permissions to upload a single file by a presigned URL; a row is deleted when it is used and restored if the upload fails';
+COMMENT ON COLUMN presigned_upload.id IS 'Unique identifier of the permission, signed into the URL';
+COMMENT ON COLUMN presigned_upload.owner_key IS 'API key that created the URL, recorded as the owner of the uploaded file; NULL without authentication';
+COMMENT ON COLUMN presigned_upload.max_size IS 'Maximum size of the uploaded file in bytes';
+COMMENT ON COLUMN presigned_upload.content_type IS 'Allowed media type of the file (type/subtype or type/*); empty - any';
+COMMENT ON COLUMN presigned_upload.expires_at IS 'Date and time after which the URL cannot be used';
+COMMENT ON COLUMN presigned_upload.created_at IS 'Date and time of the record creation';
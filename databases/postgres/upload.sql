@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS upload (
+    id UUID PRIMARY KEY,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL DEFAULT '',
+    owner_key VARCHAR(64),
+    completing BOOL NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now()),
+    updated_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+COMMENT ON TABLE upload IS 'Table for storing multipart uploads in progress';
+COMMENT ON COLUMN upload.id IS 'Unique identifier of the upload in UUID format';
+COMMENT ON COLUMN upload.filename IS 'Name of the file being uploaded';
+COMMENT ON COLUMN upload.content_type IS 'Content Type of the file; detected from the content on completion if empty';
+COMMENT ON COLUMN upload.owner_key IS 'ID of the API key that created the upload; NULL if created without authentication';
+COMMENT ON COLUMN upload.completing IS 'Is the upload being assembled into a file? Parts cannot be changed meanwhile';
+COMMENT ON COLUMN upload.created_at IS 'Date and time of the record creation';
+COMMENT ON COLUMN upload.updated_at IS 'Date and time of the last change; expired uploads are aborted';
+
+CREATE TABLE IF NOT EXISTS upload_part (
+    upload_id UUID NOT NULL REFERENCES upload (id) ON DELETE CASCADE,
+    part_number INT NOT NULL,
+    size BIGINT NOT NULL,
+    checksum VARCHAR(64) NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now()),
+    PRIMARY KEY (upload_id, part_number)
+);
+
+COMMENT ON TABLE upload_part IS 'Table for storing uploaded parts of multipart uploads';
+COMMENT ON COLUMN upload_part.upload_id IS 'ID of the upload';
+COMMENT ON COLUMN upload_part.part_number IS 'Number of the part; parts are assembled in ascending order';
+COMMENT ON COLUMN upload_part.size IS 'Size of the part in bytes';
+COMMENT ON COLUMN upload_part.checksum IS 'SHA-256 checksum of the part';
+COMMENT ON COLUMN upload_part.filename IS 'Name of the part file in the service_a upload directory';
+COMMENT ON COLUMN upload_part.created_at IS 'Date and time of the record creation';
@@ -51,19 +51,219 @@ COMMENT ON COLUMN cache.checksum IS 'Unique hash of the file as a string';
 COMMENT ON COLUMN cache.filename IS 'Name of the file';
 COMMENT ON COLUMN cache.expired_at IS 'Date and time of the record expiration';
 
-CREATE TABLE IF NOT EXISTS metadata (
-                                        uuid UUID PRIMARY KEY,
+CREATE TABLE IF NOT EXISTS blob (
+                                        id UUID PRIMARY KEY,
                                         checksum VARCHAR(64) NOT NULL UNIQUE,
+                                        bucket_ids BIGINT[],
+                                        manifest JSONB NOT NULL DEFAULT '[]',
+                                        size BIGINT NOT NULL DEFAULT 0,
+                                        data_shards INT NOT NULL,
+                                        parity_shards INT NOT NULL,
+                                        key_id VARCHAR(64),
+                                        wrapped_key BYTEA,
+                                        refcount INT NOT NULL DEFAULT 0,
+                                        created_at TIMESTAMP   NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+-- Index for filtering and sorting the list of files by size.
+CREATE INDEX IF NOT EXISTS blob_size_idx ON blob (size);
+-- Index for finding contents whose data keys are wrapped by an old master key (key rotation).
+CREATE INDEX IF NOT EXISTS blob_key_id_idx ON blob (key_id);
+
+COMMENT ON TABLE blob IS 'Table for storing file contents: one record per unique content shared by all files with that content';
+COMMENT ON COLUMN blob.id IS 'Unique identifier of the content in UUID format, used as the key of the shards in buckets';
+COMMENT ON COLUMN blob.checksum IS 'Unique hash of the content as a string';
+COMMENT ON COLUMN blob.bucket_ids IS 'Array of bucket ids where copies of the content shards are stored, in the manifest order';
+COMMENT ON COLUMN blob.manifest IS 'Ordered list of the content shards: index, bucket ids of the shard copies, offset in the content, length and SHA-256 checksum';
+COMMENT ON COLUMN blob.size IS 'Size of the content in bytes';
+COMMENT ON COLUMN blob.data_shards IS 'Number of data shards of the Reed-Solomon coding';
+COMMENT ON COLUMN blob.parity_shards IS 'Number of parity shards of the Reed-Solomon coding';
+COMMENT ON COLUMN blob.key_id IS 'ID of the master key that wraps the data key of the content; NULL if the content is not encrypted';
+COMMENT ON COLUMN blob.wrapped_key IS 'Data key of the content (AES-256-GCM) encrypted by the master key key_id';
+COMMENT ON COLUMN blob.refcount IS 'Number of files referencing the content; shards are deleted when it reaches zero';
+COMMENT ON COLUMN blob.created_at IS 'Date and time of the record creation';
+
+CREATE TABLE IF NOT EXISTS file (
+                                        uuid UUID PRIMARY KEY,
+                                        blob_id UUID NOT NULL REFERENCES blob (id),
                                         filename VARCHAR(255) NOT NULL,
                                         content_type VARCHAR(255) NOT NULL,
-                                        bucket_ids BIGINT[],
+                                        owner_key VARCHAR(64),
                                         created_at TIMESTAMP   NOT NULL DEFAULT timezone('utc'::text, now())
 );
 
-COMMENT ON TABLE metadata IS 'Table for storing metadata of files';
-COMMENT ON COLUMN metadata.uuid IS 'Unique identifier of the file in UUID format';
-COMMENT ON COLUMN metadata.checksum IS 'Unique hash of the file as a string';
-COMMENT ON COLUMN metadata.filename IS 'Name of the file';
-COMMENT ON COLUMN metadata.content_type IS 'Content Type of the file';
-COMMENT ON COLUMN metadata.bucket_ids IS 'Array of bucket ids where the file is stored';
-COMMENT ON COLUMN metadata.created_at IS 'Date and time of the record creation';
+CREATE INDEX IF NOT EXISTS file_blob_id_idx ON file (blob_id);
+-- Indexes for listing files (GET /api/files): filters and keyset pagination by the sort column and uuid.
+CREATE INDEX IF NOT EXISTS file_created_at_idx ON file (created_at, uuid);
+CREATE INDEX IF NOT EXISTS file_filename_idx ON file (filename COLLATE "C", uuid);
+CREATE INDEX IF NOT EXISTS file_content_type_idx ON file (content_type, created_at);
+CREATE INDEX IF NOT EXISTS file_owner_key_idx ON file (owner_key, created_at);
+
+COMMENT ON TABLE file IS 'Table for storing files: user-facing records referencing stored content';
+COMMENT ON COLUMN file.uuid IS 'Unique identifier of the file in UUID format';
+COMMENT ON COLUMN file.blob_id IS 'ID of the file content';
+COMMENT ON COLUMN file.filename IS 'Name of the file';
+COMMENT ON COLUMN file.content_type IS 'Content Type of the file';
+COMMENT ON COLUMN file.owner_key IS 'ID of the API key that uploaded the file; NULL if uploaded without authentication';
+COMMENT ON COLUMN file.created_at IS 'Date and time of the record creation';
+
+CREATE TABLE IF NOT EXISTS pending_delete (
+                                          blob_id UUID NOT NULL,
+                                          bucket_id BIGINT NOT NULL,
+                                          attempts INT NOT NULL DEFAULT 0,
+                                          last_error TEXT NOT NULL DEFAULT '',
+                                          next_attempt_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now()),
+                                          created_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now()),
+                                          PRIMARY KEY (blob_id, bucket_id)
+);
+
+COMMENT ON TABLE pending_delete IS 'Table for storing content shards waiting to be deleted from buckets';
+COMMENT ON COLUMN pending_delete.blob_id IS 'ID of the deleted content';
+COMMENT ON COLUMN pending_delete.bucket_id IS 'ID of the bucket where the part is stored';
+COMMENT ON COLUMN pending_delete.attempts IS 'Number of failed delete attempts';
+COMMENT ON COLUMN pending_delete.last_error IS 'Error of the last failed delete attempt';
+COMMENT ON COLUMN pending_delete.next_attempt_at IS 'Date and time of the next delete attempt';
+COMMENT ON COLUMN pending_delete.created_at IS 'Date and time of the record creation';
+
+CREATE TABLE IF NOT EXISTS upload (
+                                    id UUID PRIMARY KEY,
+                                    filename VARCHAR(255) NOT NULL,
+                                    content_type VARCHAR(255) NOT NULL DEFAULT '',
+                                    owner_key VARCHAR(64),
+                                    completing BOOL NOT NULL DEFAULT false,
+                                    created_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now()),
+                                    updated_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+COMMENT ON TABLE upload IS 'Table for storing multipart uploads in progress';
+COMMENT ON COLUMN upload.id IS 'Unique identifier of the upload in UUID format';
+COMMENT ON COLUMN upload.filename IS 'Name of the file being uploaded';
+COMMENT ON COLUMN upload.content_type IS 'Content Type of the file; detected from the content on completion if empty';
+COMMENT ON COLUMN upload.owner_key IS 'ID of the API key that created the upload; NULL if created without authentication';
+COMMENT ON COLUMN upload.completing IS 'Is the upload being assembled into a file? Parts cannot be changed meanwhile';
+COMMENT ON COLUMN upload.created_at IS 'Date and time of the record creation';
+COMMENT ON COLUMN upload.updated_at IS 'Date and time of the last change; expired uploads are aborted';
+
+CREATE TABLE IF NOT EXISTS upload_part (
+                                    upload_id UUID NOT NULL REFERENCES upload (id) ON DELETE CASCADE,
+                                    part_number INT NOT NULL,
+                                    size BIGINT NOT NULL,
+                                    checksum VARCHAR(64) NOT NULL,
+                                    filename VARCHAR(255) NOT NULL,
+                                    created_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now()),
+                                    PRIMARY KEY (upload_id, part_number)
+);
+
+COMMENT ON TABLE upload_part IS 'Table for storing uploaded parts of multipart uploads';
+COMMENT ON COLUMN upload_part.upload_id IS 'ID of the upload';
+COMMENT ON COLUMN upload_part.part_number IS 'Number of the part; parts are assembled in ascending order';
+COMMENT ON COLUMN upload_part.size IS 'Size of the part in bytes';
+COMMENT ON COLUMN upload_part.checksum IS 'SHA-256 checksum of the part';
+COMMENT ON COLUMN upload_part.filename IS 'Name of the part file in the service_a upload directory';
+COMMENT ON COLUMN upload_part.created_at IS 'Date and time of the record creation';
+
+CREATE TABLE IF NOT EXISTS namespace (
+                                    name VARCHAR(63) PRIMARY KEY,
+                                    versioning BOOLEAN NOT NULL DEFAULT false,
+                                    created_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+COMMENT ON TABLE namespace IS 'Table for storing namespaces (S3 buckets) that group objects';
+COMMENT ON COLUMN namespace.name IS 'Unique name of the namespace';
+COMMENT ON COLUMN namespace.versioning IS 'Whether every write of an object keeps the previous versions';
+COMMENT ON COLUMN namespace.created_at IS 'Date and time of the record creation';
+
+CREATE TABLE IF NOT EXISTS object (
+                                    namespace VARCHAR(63) NOT NULL REFERENCES namespace (name),
+                                    key TEXT COLLATE "C" NOT NULL,
+                                    file_uuid UUID NOT NULL REFERENCES file (uuid) ON DELETE CASCADE,
+                                    created_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now()),
+                                    updated_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now()),
+                                    PRIMARY KEY (namespace, key)
+);
+
+CREATE INDEX IF NOT EXISTS object_file_uuid_idx ON object (file_uuid);
+
+COMMENT ON TABLE object IS 'Table for storing objects: named files inside namespaces';
+COMMENT ON COLUMN object.namespace IS 'Name of the namespace';
+COMMENT ON COLUMN object.key IS 'Key of the object; compared byte-wise so that listing order matches S3';
+COMMENT ON COLUMN object.file_uuid IS 'ID of the file with the current object content';
+COMMENT ON COLUMN object.created_at IS 'Date and time of the record creation';
+COMMENT ON COLUMN object.updated_at IS 'Date and time of the last content change';
+
+CREATE TABLE IF NOT EXISTS object_version (
+                                    id UUID PRIMARY KEY,
+                                    seq BIGSERIAL NOT NULL,
+                                    namespace VARCHAR(63) NOT NULL REFERENCES namespace (name),
+                                    key TEXT COLLATE "C" NOT NULL,
+                                    file_uuid UUID UNIQUE REFERENCES file (uuid) ON DELETE CASCADE,
+                                    created_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+CREATE INDEX IF NOT EXISTS object_version_key_idx ON object_version (namespace, key, seq);
+
+COMMENT ON TABLE object_version IS 'Table for storing versions of objects in namespaces with versioning enabled';
+COMMENT ON COLUMN object_version.id IS 'Unique identifier of the version in UUID format';
+COMMENT ON COLUMN object_version.seq IS 'Order of the version among the versions of the object; the greatest one is the latest';
+COMMENT ON COLUMN object_version.namespace IS 'Name of the namespace';
+COMMENT ON COLUMN object_version.key IS 'Key of the object';
+COMMENT ON COLUMN object_version.file_uuid IS 'ID of the file with the version content; NULL for a delete marker';
+COMMENT ON COLUMN object_version.created_at IS 'Date and time the version was written';
+
+CREATE TABLE IF NOT EXISTS lifecycle_rule (
+                                    id BIGSERIAL PRIMARY KEY,
+                                    namespace VARCHAR(63) NOT NULL REFERENCES namespace (name),
+                                    prefix TEXT COLLATE "C" NOT NULL DEFAULT '',
+                                    expire_days INTEGER CHECK (expire_days > 0),
+                                    expire_at TIMESTAMP,
+                                    keep_versions INTEGER CHECK (keep_versions > 0),
+                                    created_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+CREATE INDEX IF NOT EXISTS lifecycle_rule_namespace_idx ON lifecycle_rule (namespace);
+
+-- Index for finding objects that expired by the time of their last change.
+CREATE INDEX IF NOT EXISTS object_updated_at_idx ON object (namespace, updated_at);
+
+COMMENT ON TABLE lifecycle_rule IS 'Table for storing lifecycle rules that expire objects and purge old versions';
+COMMENT ON COLUMN lifecycle_rule.id IS 'Unique identifier of the rule; rules of a namespace are kept in insertion order';
+COMMENT ON COLUMN lifecycle_rule.namespace IS 'Name of the namespace';
+COMMENT ON COLUMN lifecycle_rule.prefix IS 'Key prefix of the objects the rule applies to; empty for the whole namespace';
+COMMENT ON COLUMN lifecycle_rule.expire_days IS 'Objects are deleted this many days after the last change; NULL - never';
+COMMENT ON COLUMN lifecycle_rule.expire_at IS 'Objects last changed before this date and time are deleted at it; NULL - never';
+COMMENT ON COLUMN lifecycle_rule.keep_versions IS 'Number of the latest versions of an object to keep, older ones are purged; NULL - all';
+COMMENT ON COLUMN lifecycle_rule.created_at IS 'Date and time of the record creation';
+
+CREATE TABLE IF NOT EXISTS api_key (
+                                    id VARCHAR(64) PRIMARY KEY,
+                                    secret TEXT NOT NULL,
+                                    scopes TEXT[] NOT NULL,
+                                    namespaces TEXT[] NOT NULL DEFAULT '{}',
+                                    created_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+COMMENT ON TABLE api_key IS 'Table for storing keys of the REST API';
+COMMENT ON COLUMN api_key.id IS 'Public identifier of the key';
+COMMENT ON COLUMN api_key.secret IS 'Secret of the key; kept in plain form because HMAC signatures are verified with it';
+COMMENT ON COLUMN api_key.scopes IS 'Allowed operations: read, write, delete, admin';
+COMMENT ON COLUMN api_key.namespaces IS 'Namespaces whose objects the key can access; empty - all';
+COMMENT ON COLUMN api_key.created_at IS 'Date and time of the record creation';
+
+CREATE TABLE IF NOT EXISTS presigned_upload (
+                                    id VARCHAR(64) PRIMARY KEY,
+                                    owner_key VARCHAR(64),
+                                    max_size BIGINT NOT NULL CHECK (max_size > 0),
+                                    content_type TEXT NOT NULL DEFAULT '',
+                                    expires_at TIMESTAMP NOT NULL,
+                                    created_at TIMESTAMP NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+CREATE INDEX IF NOT EXISTS presigned_upload_expires_at_idx ON presigned_upload (expires_at);
+
+COMMENT ON TABLE presigned_upload IS 'Table for storing permissions to upload a single file by a presigned URL; a row is deleted when it is used and restored if the upload fails';
+COMMENT ON COLUMN presigned_upload.id IS 'Unique identifier of the permission, signed into the URL';
+COMMENT ON COLUMN presigned_upload.owner_key IS 'API key that created the URL, recorded as the owner of the uploaded file; NULL without authentication';
+COMMENT ON COLUMN presigned_upload.max_size IS 'Maximum size of the uploaded file in bytes';
+COMMENT ON COLUMN presigned_upload.content_type IS 'Allowed media type of the file (type/subtype or type/*); empty - any';
+COMMENT ON COLUMN presigned_upload.expires_at IS 'Date and time after which the URL cannot be used';
+COMMENT ON COLUMN presigned_upload.created_at IS 'Date and time of the record creation';
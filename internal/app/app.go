@@ -8,9 +8,14 @@ import (
 
 	"karma8/internal/app/handler"
 	"karma8/internal/app/health"
+	"karma8/internal/app/processes"
 	"karma8/internal/app/services"
 	"karma8/internal/app/web"
+	"karma8/internal/config"
+	"karma8/internal/lib/encryption"
 	"karma8/internal/lib/middleware"
+	"karma8/internal/lib/presign"
+	"karma8/internal/lib/serviceauth"
 
 	"github.com/gorilla/mux"
 )
@@ -23,45 +28,129 @@ type App struct {
 	health.ReadinessChecker
 }
 
-// NewServiceA создает новый экземпляр сервиса A.
-func NewServiceA(
-	log *slog.Logger,
-	connectString string,
-	port int,
-	useTracing bool,
-	tracingAddress string,
-	serviceName string,
-) (*App, error) {
+// NewServiceA создает новый экземпляр сервиса A с настройками из cfg.
+func NewServiceA(log *slog.Logger, cfg *config.Config, serviceName string) (*App, error) {
 	const op = "app.NewServiceA"
 	ctx := context.Background()
 
 	app := &App{}
-	srv, err := services.NewServiceA(log, connectString)
+	coding := processes.ErasureCoding{DataShards: cfg.DataShards, ParityShards: cfg.ParityShards}
+	// Запросы к бакетам выполняются с клиентским сертификатом и подписью, если они заданы в конфиге.
+	tlsConfig, err := serviceauth.ClientConfig(cfg.ServiceTLS())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	// Содержимое файлов шифруется перед записью в бакеты, если задан файл мастер-ключей.
+	var keys encryption.KeyProvider
+	if cfg.EncryptionKeyFile != "" {
+		keyFile, err := encryption.LoadKeyFile(cfg.EncryptionKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		keys = keyFile
+	}
+	srv, err := services.NewServiceA(
+		log, cfg.DBConnect, coding, cfg.Replicas, services.NewBucketClient(tlsConfig, cfg.ServiceSecret), keys,
+	)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	telemetryMiddleware, err := addTelemetryMiddleware(ctx, useTracing, tracingAddress, serviceName)
+	telemetryMiddleware, err := addTelemetryMiddleware(ctx, cfg.UseTracing, cfg.TracingAddress, serviceName)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
 	router := mux.NewRouter()
+	// Ключи объектов могут содержать "//" и "/./": такие пути не должны перенаправляться.
+	router.SkipClean(true)
 	router.Use(middleware.RequestID)
 	router.Use(telemetryMiddleware)
+	// Подписанные ссылки включаются, если задан секрет подписи; они проверяются до аутентификации по ключу API.
+	var signer *presign.Signer
+	if cfg.PresignSecret != "" {
+		signer = presign.NewSigner(cfg.PresignSecret)
+		router.Use(handler.PresignedURLs(srv, signer))
+	}
+	// Аутентификация запросов к REST API включается, если задан ключ администратора.
+	var apiKeys handler.APIKeyLookup
+	if cfg.APIAdminKey != "" {
+		apiKeys = handler.APIKeys(srv, cfg.APIAdminKey, cfg.APIAdminSecret)
+		router.Use(handler.APIAuth(srv, apiKeys, cfg.S3Region))
+	}
 
 	router.HandleFunc("/live", health.LivenessHandler(app)).Methods("GET")
 	router.HandleFunc("/ready", health.ReadinessHandler(app)).Methods("GET")
 
 	router.HandleFunc("/api/file/{id}", handler.GetFileItem(srv)).Methods("GET")
+	router.HandleFunc("/api/file/{id}", handler.HeadFileItem(srv)).Methods("HEAD")
+	router.HandleFunc("/api/file/{id}/meta", handler.GetFileMetadata(srv)).Methods("GET")
+	router.HandleFunc("/api/file/{id}", handler.DeleteFileItem(srv)).Methods("DELETE")
 	router.HandleFunc("/api/file", handler.PutFileItem(srv)).Methods("PUT")
-	server, err := web.New(log, port, router)
+	router.HandleFunc("/api/files", handler.ListFiles(srv)).Methods("GET")
+	if signer != nil {
+		router.HandleFunc("/api/file/{id}/presign", handler.PresignFileItem(srv, signer)).Methods("POST")
+		router.HandleFunc("/api/file/presign", handler.PresignUpload(srv, signer)).Methods("POST")
+	}
+	router.HandleFunc("/api/uploads", handler.CreateUpload(srv)).Methods("POST")
+	router.HandleFunc("/api/uploads/{uploadId}", handler.GetUpload(srv)).Methods("GET")
+	router.HandleFunc("/api/uploads/{uploadId}", handler.AbortUpload(srv)).Methods("DELETE")
+	router.HandleFunc("/api/uploads/{uploadId}/parts/{n}", handler.PutUploadPart(srv)).Methods("PUT")
+	router.HandleFunc("/api/uploads/{uploadId}/complete", handler.CompleteUpload(srv)).Methods("POST")
+	router.HandleFunc("/api/ns/{ns}", handler.CreateNamespace(srv)).Methods("PUT")
+	router.HandleFunc("/api/ns/{ns}/objects/{key:.+}", handler.GetObject(srv)).Methods("GET")
+	router.HandleFunc("/api/ns/{ns}/objects/{key:.+}", handler.PutObject(srv)).Methods("PUT")
+	router.HandleFunc("/api/ns/{ns}/objects/{key:.+}", handler.DeleteObject(srv)).Methods("DELETE")
+	router.HandleFunc("/api/ns/{ns}/versioning", handler.EnableVersioning(srv)).Methods("PUT")
+	router.HandleFunc("/api/ns/{ns}/versions/{key:.+}", handler.ListObjectVersions(srv)).Methods("GET")
+	router.HandleFunc("/api/ns/{ns}/restore/{key:.+}", handler.RestoreObjectVersion(srv)).Methods("POST")
+	router.HandleFunc("/api/ns/{ns}/lifecycle", handler.PutLifecycleRules(srv)).Methods("PUT")
+	router.HandleFunc("/api/ns/{ns}/lifecycle", handler.GetLifecycleRules(srv)).Methods("GET")
+	router.HandleFunc("/api/admin/buckets", handler.PutBucket(srv)).Methods("POST")
+	router.HandleFunc("/api/admin/rebalance", handler.GetRebalanceStatus(srv)).Methods("GET")
+	router.HandleFunc("/api/admin/scrub", handler.GetScrubStatus(srv)).Methods("GET")
+	if keys != nil {
+		router.HandleFunc("/api/admin/encryption/rotate", handler.RotateDataKeys(srv)).Methods("POST")
+	}
+	// Ключи API нужны только при включённой аутентификации: без ключа администратора управление ключами
+	// не регистрируется, чтобы его нельзя было вызвать без аутентификации.
+	if cfg.APIAdminKey != "" {
+		router.HandleFunc("/api/admin/keys", handler.CreateAPIKey(srv)).Methods("POST")
+		router.HandleFunc("/api/admin/keys", handler.ListAPIKeys(srv)).Methods("GET")
+		router.HandleFunc("/api/admin/keys/{id}", handler.DeleteAPIKey(srv)).Methods("DELETE")
+	}
+
+	// S3-совместимый API включается, если задан ключ доступа.
+	if cfg.S3AccessKey != "" {
+		s3Keys := handler.S3Keys(apiKeys, cfg.S3AccessKey, cfg.S3SecretKey)
+		handler.RegisterS3Routes(router.PathPrefix("/s3").Subrouter(), srv, s3Keys, cfg.S3Region)
+	}
+
+	server, err := web.New(log, cfg.Port, router, nil)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
 	// Запуск фоновой задачи по очистке кэша.
 	go srv.ClearCache(3 * time.Minute) // TODO: Передавать значение из конфига.
+	// Запуск фоновой задачи по повторному удалению частей файлов из бакетов.
+	go srv.RetryPendingDeletes(time.Minute)
+	// Запуск фоновой задачи по обновлению списка бакетов.
+	go srv.WatchBuckets(time.Minute)
+	// Запуск фоновой задачи по обновлению статистики заполненности бакетов.
+	go srv.RefreshBucketStats(30 * time.Second)
+	// Запуск фоновой задачи по переносу частей файлов в менее заполненные бакеты.
+	go srv.Rebalance(10 * time.Minute)
+	// Запуск фоновой задачи по проверке и восстановлению частей файлов в бакетах.
+	go srv.Scrub(time.Hour)
+	// Запуск фоновой задачи по прерыванию заброшенных загрузок файлов по частям.
+	go srv.ExpireUploads(time.Hour)
+	// Запуск фоновой задачи по применению правил жизненного цикла объектов.
+	go srv.ApplyLifecycle(time.Hour)
+	if keys != nil {
+		// Запуск фоновой задачи по перешифрованию ключей данных текущим мастер-ключом.
+		go srv.RotateKeys(time.Hour)
+	}
 
 	app.HTTPServer = server
 	app.service = srv
@@ -69,26 +158,23 @@ func NewServiceA(
 	return app, nil
 }
 
-// NewServiceB создает новый экземпляр сервиса B.
-func NewServiceB(
-	log *slog.Logger,
-	connectString string,
-	port int,
-	redisDB int,
-	useTracing bool,
-	tracingAddress string,
-	serviceName string,
-) (*App, error) {
+// NewServiceB создает новый экземпляр сервиса B с настройками из cfg.
+func NewServiceB(log *slog.Logger, cfg *config.Config, serviceName string) (*App, error) {
 	const op = "app.NewServiceB"
 	ctx := context.Background()
 
 	app := &App{}
-	srv, err := services.NewServiceB(log, connectString, redisDB)
+	srv, err := services.NewServiceB(log, cfg.DBConnect, cfg.RedisDB)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	telemetryMiddleware, err := addTelemetryMiddleware(ctx, useTracing, tracingAddress, serviceName)
+	tlsConfig, err := serviceauth.ServerConfig(cfg.ServiceTLS())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	telemetryMiddleware, err := addTelemetryMiddleware(ctx, cfg.UseTracing, cfg.TracingAddress, serviceName)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -96,13 +182,20 @@ func NewServiceB(
 	router := mux.NewRouter()
 	router.Use(middleware.RequestID)
 	router.Use(telemetryMiddleware)
+	// Проверка подписи запросов от service_a включается, если задан общий секрет.
+	if cfg.ServiceSecret != "" {
+		router.Use(handler.ServiceAuth(srv, cfg.ServiceSecret))
+	}
 
 	router.HandleFunc("/live", health.LivenessHandler(app)).Methods("GET")
 	router.HandleFunc("/ready", health.ReadinessHandler(app)).Methods("GET")
 
 	router.HandleFunc("/api/filepart/{id}", handler.GetBucketItem(srv)).Methods("GET")
+	router.HandleFunc("/api/filepart/{id}", handler.HeadBucketItem(srv)).Methods("HEAD")
+	router.HandleFunc("/api/filepart/{id}", handler.DeleteBucketItem(srv)).Methods("DELETE")
 	router.HandleFunc("/api/filepart", handler.PutBucketItem(srv)).Methods("PUT")
-	server, err := web.New(log, port, router)
+	router.HandleFunc("/api/stats", handler.GetBucketStats(srv)).Methods("GET")
+	server, err := web.New(log, cfg.Port, router, tlsConfig)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -0,0 +1,302 @@
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"karma8/internal/app/services"
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/lib/logger/sl"
+	"karma8/internal/lib/serviceauth"
+	"karma8/internal/lib/sigv4"
+	"karma8/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// HeaderAPIKey - заголовок с ключом API в виде <ID>:<секрет>.
+	HeaderAPIKey = "X-Api-Key"
+	// APISigningService - сервис в области действия подписи AWS Signature Version 4 запросов к REST API.
+	APISigningService = "karma8"
+)
+
+// adminRoutes - маршруты REST API, которые меняют настройки пространств имён: для них нужна область admin.
+var adminRoutes = map[string]bool{
+	"/api/ns/{ns}":            true,
+	"/api/ns/{ns}/versioning": true,
+	"/api/ns/{ns}/lifecycle":  true,
+}
+
+// readRoutes - маршруты REST API с методом POST, для которых достаточно области read.
+var readRoutes = map[string]bool{
+	"/api/file/{id}/presign": true,
+}
+
+// APIKeyLookup возвращает ключ API с секретом по его ID или sigv4.ErrUnknownAccessKey, если такого ключа нет.
+type APIKeyLookup func(ctx context.Context, id string) (*models.APIKey, error)
+
+// APIKeys возвращает APIKeyLookup, который ищет ключи в БД, а также ключ администратора adminKey/adminSecret
+// из конфига (с областью admin), чтобы можно было создать первые ключи.
+func APIKeys(service services.IServiceA, adminKey, adminSecret string) APIKeyLookup {
+	return func(ctx context.Context, id string) (*models.APIKey, error) {
+		if adminKey != "" && hmac.Equal([]byte(id), []byte(adminKey)) {
+			return &models.APIKey{
+				ID:     adminKey,
+				Secret: adminSecret,
+				Scopes: []string{models.ScopeAdmin},
+			}, nil
+		}
+
+		key, err := service.GetAPIKey(ctx, id)
+		if errors.Is(err, services.ErrNotFound) {
+			return nil, sigv4.ErrUnknownAccessKey
+		}
+
+		return key, err
+	}
+}
+
+// S3Keys возвращает APIKeyLookup для S3 API: ключ доступа accessKey/secretKey из конфига (с областью admin)
+// и, если аутентификация REST API включена (lookup не nil), ключи API с теми же правами, что и в REST API.
+func S3Keys(lookup APIKeyLookup, accessKey, secretKey string) APIKeyLookup {
+	return func(ctx context.Context, id string) (*models.APIKey, error) {
+		if accessKey != "" && hmac.Equal([]byte(id), []byte(accessKey)) {
+			return &models.APIKey{
+				ID:     accessKey,
+				Secret: secretKey,
+				Scopes: []string{models.ScopeAdmin},
+			}, nil
+		}
+		if lookup == nil {
+			return nil, sigv4.ErrUnknownAccessKey
+		}
+
+		return lookup(ctx, id)
+	}
+}
+
+type ctxKeyAPIKey struct{}
+
+// apiKeyFromContext возвращает ключ API, которым аутентифицирован запрос (если аутентификация включена).
+func apiKeyFromContext(ctx context.Context) (*models.APIKey, bool) {
+	key, ok := ctx.Value(ctxKeyAPIKey{}).(*models.APIKey)
+
+	return key, ok
+}
+
+// canAccessFile сообщает, есть ли у ключа запроса доступ к файлу; без аутентификации доступ есть всегда.
+func canAccessFile(ctx context.Context, metadata *models.MetadataItem) bool {
+	key, ok := apiKeyFromContext(ctx)
+
+	return !ok || key.CanAccessFile(metadata.Owner)
+}
+
+// canAccessUpload сообщает, есть ли у ключа запроса доступ к загрузке файла по частям;
+// без аутентификации доступ есть всегда.
+func canAccessUpload(ctx context.Context, upload *models.UploadInfo) bool {
+	key, ok := apiKeyFromContext(ctx)
+
+	return !ok || key.CanAccessFile(upload.Owner)
+}
+
+// authErrorStatus возвращает код ответа и код ошибки для ошибки аутентификации запроса к REST API.
+func authErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, sigv4.ErrMalformed), errors.Is(err, sigv4.ErrUnsupportedPayload):
+		return http.StatusBadRequest, models.ErrorCodeBadRequest
+	case errors.Is(err, sigv4.ErrMissingAuth), errors.Is(err, sigv4.ErrUnknownAccessKey),
+		errors.Is(err, sigv4.ErrSignatureMismatch), errors.Is(err, sigv4.ErrTimeSkewed):
+		return http.StatusUnauthorized, models.ErrorCodeUnauthorized
+	default:
+		return http.StatusInternalServerError, models.ErrorCodeInternal
+	}
+}
+
+// requiredScope возвращает область действия ключа, которая нужна для запроса r.
+func requiredScope(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, "/api/admin/") {
+		return models.ScopeAdmin
+	}
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			if adminRoutes[template] {
+				return models.ScopeAdmin
+			}
+			if readRoutes[template] {
+				return models.ScopeRead
+			}
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return models.ScopeRead
+	case http.MethodDelete:
+		return models.ScopeDelete
+	default:
+		return models.ScopeWrite
+	}
+}
+
+// authenticate проверяет ключ API запроса: заголовок X-Api-Key или подпись AWS Signature Version 4
+// (регион region, сервис APISigningService), и возвращает ключ.
+func authenticate(r *http.Request, lookup APIKeyLookup, region string) (*models.APIKey, error) {
+	if value := r.Header.Get(HeaderAPIKey); value != "" {
+		id, secret, found := strings.Cut(value, ":")
+		if !found {
+			return nil, fmt.Errorf("%w: %s must be <id>:<secret>", sigv4.ErrMalformed, HeaderAPIKey)
+		}
+
+		key, err := lookup(r.Context(), id)
+		if err != nil {
+			return nil, err
+		}
+		if !hmac.Equal([]byte(secret), []byte(key.Secret)) {
+			return nil, fmt.Errorf("%w: invalid secret", sigv4.ErrSignatureMismatch)
+		}
+
+		return key, nil
+	}
+
+	var key *models.APIKey
+	verifier := &sigv4.Verifier{
+		Region:  region,
+		Service: APISigningService,
+		Lookup: func(ctx context.Context, id string) (string, error) {
+			var err error
+			key, err = lookup(ctx, id)
+			if err != nil {
+				return "", err
+			}
+
+			return key.Secret, nil
+		},
+	}
+	if _, err := verifier.Verify(r); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// APIAuth проверяет ключ API запросов к REST API (пути /api/...) и его права на запрос:
+// область действия (read, write, delete, admin) и доступ к пространству имён из пути.
+// Ключ сохраняется в контексте запроса: по нему проверяется доступ к файлам и записывается их владелец.
+// Запросы по подписанным ссылкам (см. PresignedURLs) не проверяются.
+func APIAuth(service services.IServiceA, lookup APIKeyLookup, region string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/api/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			// Запрос по подписанной ссылке уже проверен PresignedURLs.
+			if _, ok := presignedFromContext(r.Context()); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key, err := authenticate(r, lookup, region)
+			if err != nil {
+				status, code := authErrorStatus(err)
+				if status == http.StatusInternalServerError {
+					service.Logger().Error("APIAuth: key lookup failed", sl.Err(err))
+					writeError(w, status, code, "error in APIAuth")
+
+					return
+				}
+				service.Logger().Warn("APIAuth: request is rejected", sl.Err(err))
+				writeError(w, status, code, err.Error())
+
+				return
+			}
+
+			if scope := requiredScope(r); !key.HasScope(scope) {
+				writeError(w, http.StatusForbidden, models.ErrorCodeForbidden, "API key has no scope "+scope)
+				return
+			}
+			if ns, ok := mux.Vars(r)["ns"]; ok && !key.AllowsNamespace(ns) {
+				writeError(w, http.StatusForbidden, models.ErrorCodeForbidden, "API key has no access to namespace "+ns)
+				return
+			}
+
+			// Хеш тела подписанного запроса сверяется только в конце тела, а обработчики форм не дочитывают
+			// тело после файла: тело читается целиком и проверяется до обработки запроса.
+			if r.Header.Get(HeaderAPIKey) == "" && r.ContentLength != 0 &&
+				r.Header.Get(sigv4.HeaderContentSHA256) != sigv4.UnsignedPayload {
+				cleanup, err := bufferSignedBody(r)
+				if errors.Is(err, sigv4.ErrContentSHA256Mismatch) {
+					writeError(w, http.StatusBadRequest, models.ErrorCodeBadRequest, err.Error())
+					return
+				}
+				if err != nil {
+					service.Logger().Error("APIAuth: bufferSignedBody failed", sl.Err(err))
+					writeError(w, http.StatusInternalServerError, models.ErrorCodeInternal, "error in APIAuth")
+
+					return
+				}
+				defer cleanup()
+			}
+
+			ctx := trccontext.WithAPIKeyID(r.Context(), key.ID)
+			ctx = context.WithValue(ctx, ctxKeyAPIKey{}, key)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// bufferSignedBody читает тело подписанного запроса во временный файл (при этом sigv4.Verifier сверяет хеш тела)
+// и подставляет файл вместо тела. Возвращает функцию, которая удаляет временный файл.
+func bufferSignedBody(r *http.Request) (func(), error) {
+	file, err := os.CreateTemp("", "karma8-body-*")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}
+
+	if _, err = io.Copy(file, r.Body); err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	_ = r.Body.Close()
+	r.Body = file
+
+	return cleanup, nil
+}
+
+// ServiceAuth проверяет подпись запросов service_a к service_b общим секретом secret
+// (заголовок serviceauth.HeaderToken). /live и /ready проверкой не закрыты.
+func ServiceAuth(service services.IService, secret string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/api/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if err := serviceauth.Verify(secret, r, time.Now()); err != nil {
+				service.Logger().Warn("ServiceAuth: request is rejected", sl.Err(err))
+				writeError(w, http.StatusUnauthorized, models.ErrorCodeUnauthorized, err.Error())
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
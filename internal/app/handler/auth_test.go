@@ -0,0 +1,300 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/lib/serviceauth"
+	"karma8/internal/lib/sigv4"
+	"karma8/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIAuth(t *testing.T) {
+	keys := map[string]*models.APIKey{
+		"admin":   {ID: "admin", Secret: "admin-secret", Scopes: []string{models.ScopeAdmin}},
+		"reader":  {ID: "reader", Secret: "reader-secret", Scopes: []string{models.ScopeRead}},
+		"reports": {ID: "reports", Secret: "reports-secret", Scopes: []string{models.ScopeRead}, Namespaces: []string{"reports"}},
+	}
+	lookup := func(_ context.Context, id string) (*models.APIKey, error) {
+		key, ok := keys[id]
+		if !ok {
+			return nil, sigv4.ErrUnknownAccessKey
+		}
+
+		return key, nil
+	}
+
+	own := &models.MetadataItem{UUID: uuid.New(), Owner: "reader", CreatedAt: time.Now().UTC()}
+	foreign := &models.MetadataItem{UUID: uuid.New(), Owner: "writer", CreatedAt: time.Now().UTC()}
+	unowned := &models.MetadataItem{UUID: uuid.New(), CreatedAt: time.Now().UTC()}
+	service := &fakeFileService{t: t, files: map[uuid.UUID]*models.MetadataItem{
+		own.UUID:     own,
+		foreign.UUID: foreign,
+		unowned.UUID: unowned,
+	}}
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		// Ключ запроса передаётся сервису для записи владельца файлов.
+		if id, found := trccontext.APIKeyIDFromContext(r.Context()); found {
+			w.Header().Set("X-Key-Id", id)
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+
+	router := mux.NewRouter()
+	router.Use(APIAuth(service, lookup, testRegion))
+	router.HandleFunc("/live", ok).Methods("GET")
+	router.HandleFunc("/api/file/{id}/meta", GetFileMetadata(service)).Methods("GET")
+	router.HandleFunc("/api/ns/{ns}", ok).Methods("PUT")
+	router.HandleFunc("/api/ns/{ns}/objects/{key:.+}", ok).Methods("GET")
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		apiKey     string
+		sign       *models.APIKey
+		wantStatus int
+	}{
+		{name: "Health check without key", method: "GET", path: "/live", wantStatus: http.StatusOK},
+		{name: "Missing key", method: "GET", path: "/api/file/" + own.UUID.String() + "/meta", wantStatus: http.StatusUnauthorized},
+		{
+			name:       "Unknown key",
+			method:     "GET",
+			path:       "/api/file/" + own.UUID.String() + "/meta",
+			apiKey:     "unknown:secret",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Invalid secret",
+			method:     "GET",
+			path:       "/api/file/" + own.UUID.String() + "/meta",
+			apiKey:     "reader:admin-secret",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Malformed key",
+			method:     "GET",
+			path:       "/api/file/" + own.UUID.String() + "/meta",
+			apiKey:     "reader",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Own file",
+			method:     "GET",
+			path:       "/api/file/" + own.UUID.String() + "/meta",
+			apiKey:     "reader:reader-secret",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "File of another key",
+			method:     "GET",
+			path:       "/api/file/" + foreign.UUID.String() + "/meta",
+			apiKey:     "reader:reader-secret",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "File without owner",
+			method:     "GET",
+			path:       "/api/file/" + unowned.UUID.String() + "/meta",
+			apiKey:     "reader:reader-secret",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Admin reads file without owner",
+			method:     "GET",
+			path:       "/api/file/" + unowned.UUID.String() + "/meta",
+			apiKey:     "admin:admin-secret",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Admin reads any file",
+			method:     "GET",
+			path:       "/api/file/" + foreign.UUID.String() + "/meta",
+			apiKey:     "admin:admin-secret",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Namespace settings require admin",
+			method:     "PUT",
+			path:       "/api/ns/reports",
+			apiKey:     "reader:reader-secret",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Allowed namespace",
+			method:     "GET",
+			path:       "/api/ns/reports/objects/q3.csv",
+			apiKey:     "reports:reports-secret",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Other namespace",
+			method:     "GET",
+			path:       "/api/ns/finance/objects/q3.csv",
+			apiKey:     "reports:reports-secret",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Signed request",
+			method:     "GET",
+			path:       "/api/file/" + own.UUID.String() + "/meta",
+			sign:       keys["reader"],
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Signed with wrong secret",
+			method:     "GET",
+			path:       "/api/file/" + own.UUID.String() + "/meta",
+			sign:       &models.APIKey{ID: "reader", Secret: "wrong"},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL+tt.path, http.NoBody)
+			require.NoError(t, err)
+			if tt.apiKey != "" {
+				req.Header.Set(HeaderAPIKey, tt.apiKey)
+			}
+			if tt.sign != nil {
+				sigv4.Sign(req, tt.sign.ID, tt.sign.Secret, testRegion, APISigningService, time.Now(), sigv4.EmptyPayloadHash)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+
+	req, err := http.NewRequest("GET", server.URL+"/api/ns/reports/objects/q3.csv", http.NoBody)
+	require.NoError(t, err)
+	req.Header.Set(HeaderAPIKey, "reports:reports-secret")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "reports", resp.Header.Get("X-Key-Id"))
+}
+
+func TestAPIAuthSignedBody(t *testing.T) {
+	writer := &models.APIKey{ID: "writer", Secret: "writer-secret", Scopes: []string{models.ScopeWrite}}
+	lookup := func(_ context.Context, id string) (*models.APIKey, error) {
+		if id != writer.ID {
+			return nil, sigv4.ErrUnknownAccessKey
+		}
+
+		return writer, nil
+	}
+	service := &fakePresignService{fakeFileService: fakeFileService{t: t}, stored: make(map[string]string)}
+
+	router := mux.NewRouter()
+	router.Use(APIAuth(service, lookup, testRegion))
+	router.HandleFunc("/api/file", PutFileItem(service)).Methods("PUT")
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	form := func(data string) ([]byte, string) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", "report.txt")
+		require.NoError(t, err)
+		_, err = part.Write([]byte(data))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		return body.Bytes(), writer.FormDataContentType()
+	}
+	// upload отправляет body с подписью, вычисленной для signed.
+	upload := func(signed, body []byte, contentType string) int {
+		req, err := http.NewRequest("PUT", server.URL+"/api/file", bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+		hash := sha256.Sum256(signed)
+		sigv4.Sign(req, writer.ID, writer.Secret, testRegion, APISigningService, time.Now(), hex.EncodeToString(hash[:]))
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	body, contentType := form("signed content")
+	assert.Equal(t, http.StatusOK, upload(body, body, contentType))
+	assert.Equal(t, writer.ID, service.stored["signed content"])
+
+	// Обработчик не читает тело после файла, поэтому подменённая часть после файла тоже должна отклоняться.
+	tampered := bytes.Replace(body, []byte("signed content"), []byte("forged content"), 1)
+	assert.Equal(t, http.StatusBadRequest, upload(body, tampered, contentType))
+	trailing := append(bytes.Clone(body), "tail"...)
+	assert.Equal(t, http.StatusBadRequest, upload(body, trailing, contentType))
+	assert.Len(t, service.stored, 1)
+}
+
+func TestAPIKeysAdmin(t *testing.T) {
+	lookup := APIKeys(nil, "root", "root-secret")
+
+	key, err := lookup(context.Background(), "root")
+	require.NoError(t, err)
+	assert.Equal(t, "root-secret", key.Secret)
+	assert.True(t, key.HasScope(models.ScopeDelete))
+	assert.True(t, key.AllowsNamespace("reports"))
+	assert.True(t, key.CanAccessFile("someone"))
+}
+
+func TestServiceAuth(t *testing.T) {
+	const secret = "service-secret"
+
+	router := mux.NewRouter()
+	router.Use(ServiceAuth(&fakeFileService{t: t}, secret))
+	ok := func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }
+	router.HandleFunc("/live", ok).Methods("GET")
+	router.HandleFunc("/api/filepart/{id}", ok).Methods("GET")
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	signed := &http.Client{Transport: &serviceauth.Transport{Base: http.DefaultTransport, Secret: secret}}
+	forged := &http.Client{Transport: &serviceauth.Transport{Base: http.DefaultTransport, Secret: "other"}}
+
+	tests := []struct {
+		name   string
+		client *http.Client
+		path   string
+		status int
+	}{
+		{name: "signed", client: signed, path: "/api/filepart/1", status: http.StatusOK},
+		{name: "unsigned", client: http.DefaultClient, path: "/api/filepart/1", status: http.StatusUnauthorized},
+		{name: "wrong secret", client: forged, path: "/api/filepart/1", status: http.StatusUnauthorized},
+		{name: "health check", client: http.DefaultClient, path: "/live", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := tt.client.Get(server.URL + tt.path)
+			require.NoError(t, err)
+			defer response.Body.Close()
+
+			assert.Equal(t, tt.status, response.StatusCode)
+		})
+	}
+}
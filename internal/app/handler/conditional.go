@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"karma8/internal/models"
+)
+
+// etagListMatch сообщает, есть ли etag в списке ETag заголовка If-Match или If-None-Match ("*" совпадает с любым).
+// При strong сравнение строгое: слабые ETag (W/"...") не совпадают ни с чем.
+func etagListMatch(header, etag string, strong bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+
+		if weak, ok := strings.CutPrefix(tag, "W/"); ok {
+			if strong {
+				continue
+			}
+			tag = weak
+		}
+
+		if tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkPreconditions проверяет условия If-Match, If-None-Match и If-Modified-Since запроса на чтение файла
+// с ETag etag и временем изменения modified (порядок проверки - RFC 9110, раздел 13.2.2).
+// Возвращает http.StatusPreconditionFailed или http.StatusNotModified, если файл отдавать не нужно, иначе 0.
+// If-Modified-Since не проверяется, если задан If-None-Match; дата сравнивается с точностью до секунды.
+func checkPreconditions(r *http.Request, etag string, modified time.Time) int {
+	if value := r.Header.Get("If-Match"); value != "" && !etagListMatch(value, etag, true) {
+		return http.StatusPreconditionFailed
+	}
+
+	if value := r.Header.Get("If-None-Match"); value != "" {
+		if etagListMatch(value, etag, false) {
+			return http.StatusNotModified
+		}
+
+		return 0
+	}
+
+	if value := r.Header.Get("If-Modified-Since"); value != "" {
+		t, err := http.ParseTime(value)
+		if err == nil && !modified.Truncate(time.Second).After(t) {
+			return http.StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+// writeNotModified отправляет ответ 304 Not Modified с валидаторами файла.
+func writeNotModified(w http.ResponseWriter, etag string, modified time.Time) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// parseIfMatch возвращает условие If-Match запроса на изменение объекта или файла (nil, если заголовка нет).
+// Слабые ETag не совпадают ни с каким содержимым и пропускаются.
+func parseIfMatch(r *http.Request) models.IfMatch {
+	value := r.Header.Get("If-Match")
+	if value == "" {
+		return nil
+	}
+
+	ifMatch := make(models.IfMatch, 0)
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			ifMatch = append(ifMatch, tag)
+			continue
+		}
+		if strings.HasPrefix(tag, `"`) {
+			ifMatch = append(ifMatch, strings.Trim(tag, `"`))
+		}
+	}
+
+	return ifMatch
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"karma8/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPreconditions(t *testing.T) {
+	modified := time.Date(2023, 11, 28, 10, 20, 30, 500, time.UTC)
+	etag := `"75ea73570e0b8b7558304d292594017afa3ff4deef02e1dad40e8bb81863ac14"`
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{name: "No headers", header: http.Header{}, want: 0},
+		{name: "If-None-Match same ETag", header: http.Header{"If-None-Match": {`"other", ` + etag}}, want: http.StatusNotModified},
+		{name: "If-None-Match weak ETag", header: http.Header{"If-None-Match": {"W/" + etag}}, want: http.StatusNotModified},
+		{name: "If-None-Match any", header: http.Header{"If-None-Match": {"*"}}, want: http.StatusNotModified},
+		{name: "If-None-Match other ETag", header: http.Header{"If-None-Match": {`"other"`}}, want: 0},
+		{
+			name:   "If-Modified-Since same date",
+			header: http.Header{"If-Modified-Since": {modified.Format(http.TimeFormat)}},
+			want:   http.StatusNotModified,
+		},
+		{
+			name:   "If-Modified-Since earlier date",
+			header: http.Header{"If-Modified-Since": {modified.Add(-time.Hour).Format(http.TimeFormat)}},
+			want:   0,
+		},
+		{
+			name: "If-None-Match takes precedence",
+			header: http.Header{
+				"If-None-Match":     {`"other"`},
+				"If-Modified-Since": {modified.Format(http.TimeFormat)},
+			},
+			want: 0,
+		},
+		{name: "If-Match same ETag", header: http.Header{"If-Match": {etag}}, want: 0},
+		{name: "If-Match weak ETag", header: http.Header{"If-Match": {"W/" + etag}}, want: http.StatusPreconditionFailed},
+		{name: "If-Match other ETag", header: http.Header{"If-Match": {`"other"`}}, want: http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r, err := http.NewRequest("GET", "/api/file/id", http.NoBody)
+			assert.NoError(t, err)
+			r.Header = tt.header
+			assert.Equal(t, tt.want, checkPreconditions(r, etag, modified))
+		})
+	}
+}
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   models.IfMatch
+	}{
+		{name: "No header", header: "", want: nil},
+		{name: "ETags", header: `"abc", "def"`, want: models.IfMatch{"abc", "def"}},
+		{name: "Any", header: "*", want: models.IfMatch{"*"}},
+		{name: "Weak ETag never matches", header: `W/"abc"`, want: models.IfMatch{}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r, err := http.NewRequest("PUT", "/api/ns/ns/objects/key", http.NoBody)
+			assert.NoError(t, err)
+			if tt.header != "" {
+				r.Header.Set("If-Match", tt.header)
+			}
+			got := parseIfMatch(r)
+			assert.Equal(t, tt.want, got)
+			assert.False(t, got != nil && got.Matches(""), "condition must not match a missing object")
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"karma8/internal/app/services"
+	"karma8/internal/lib/sigv4"
+	"karma8/internal/models"
+)
+
+// writeError отправляет ответ об ошибке с телом models.ResponseError.
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(models.ResponseError{
+		Code:    code,
+		Message: message,
+	})
+}
+
+// fileErrorStatus возвращает код ответа и код ошибки для ошибки чтения файла.
+// Ошибки частей файла объединены (errors.Join), поэтому проверяются по приоритету:
+// временная недоступность бакета важнее повреждения и отсутствия части, так как запрос можно повторить.
+func fileErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrBucketTimeout):
+		return http.StatusServiceUnavailable, models.ErrorCodeBucketTimeout
+	case errors.Is(err, services.ErrBucketUnreachable):
+		return http.StatusServiceUnavailable, models.ErrorCodeBucketUnreachable
+	case errors.Is(err, services.ErrCorrupted):
+		return http.StatusBadGateway, models.ErrorCodeCorrupted
+	case errors.Is(err, sigv4.ErrContentSHA256Mismatch):
+		return http.StatusBadRequest, models.ErrorCodeBadRequest
+	case errors.Is(err, services.ErrPartNotFound), errors.Is(err, services.ErrNotFound):
+		return http.StatusNotFound, models.ErrorCodeNotFound
+	default:
+		return http.StatusInternalServerError, models.ErrorCodeInternal
+	}
+}
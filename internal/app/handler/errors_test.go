@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"karma8/internal/app/services"
+	"karma8/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileErrorStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "Part not found",
+			err:        &services.BucketError{BucketID: 1, Err: services.ErrPartNotFound},
+			wantStatus: http.StatusNotFound,
+			wantCode:   models.ErrorCodeNotFound,
+		},
+		{
+			name:       "Part corrupted",
+			err:        fmt.Errorf("op: %w", &services.BucketError{BucketID: 2, Err: services.ErrCorrupted}),
+			wantStatus: http.StatusBadGateway,
+			wantCode:   models.ErrorCodeCorrupted,
+		},
+		{
+			name: "Unreachable bucket wins over missing part",
+			err: errors.Join(
+				&services.BucketError{BucketID: 1, Err: services.ErrPartNotFound},
+				&services.BucketError{BucketID: 3, Err: services.ErrBucketUnreachable},
+			),
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   models.ErrorCodeBucketUnreachable,
+		},
+		{
+			name:       "Bucket timeout",
+			err:        &services.BucketError{BucketID: 4, Err: services.ErrBucketTimeout},
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   models.ErrorCodeBucketTimeout,
+		},
+		{
+			name:       "Other error",
+			err:        errors.New("some error"),
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   models.ErrorCodeInternal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code := fileErrorStatus(tt.err)
+			assert.Equal(t, tt.wantStatus, status)
+			assert.Equal(t, tt.wantCode, code)
+		})
+	}
+}
+
+func TestUploadErrorStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "Invalid upload",
+			err:        fmt.Errorf("op: %w: part 2 is missing", services.ErrInvalidUpload),
+			wantStatus: http.StatusBadRequest,
+			wantCode:   models.ErrorCodeBadRequest,
+		},
+		{
+			name:       "Upload is being completed",
+			err:        fmt.Errorf("op: %w", services.ErrUploadCompleting),
+			wantStatus: http.StatusConflict,
+			wantCode:   models.ErrorCodeConflict,
+		},
+		{
+			name:       "Upload not found",
+			err:        fmt.Errorf("op: %w", services.ErrNotFound),
+			wantStatus: http.StatusNotFound,
+			wantCode:   models.ErrorCodeNotFound,
+		},
+		{
+			name:       "Bucket unreachable on completion",
+			err:        &services.BucketError{BucketID: 3, Err: services.ErrBucketUnreachable},
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   models.ErrorCodeBucketUnreachable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code := uploadErrorStatus(tt.err)
+			assert.Equal(t, tt.wantStatus, status)
+			assert.Equal(t, tt.wantCode, code)
+		})
+	}
+}
+
+func TestObjectErrorStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "Invalid namespace",
+			err:        fmt.Errorf("op: %w", services.ErrInvalidNamespace),
+			wantStatus: http.StatusBadRequest,
+			wantCode:   models.ErrorCodeBadRequest,
+		},
+		{
+			name:       "Invalid object key",
+			err:        fmt.Errorf("op: %w", services.ErrInvalidObjectKey),
+			wantStatus: http.StatusBadRequest,
+			wantCode:   models.ErrorCodeBadRequest,
+		},
+		{
+			name:       "Invalid version ID",
+			err:        fmt.Errorf("op: %w", services.ErrInvalidVersionID),
+			wantStatus: http.StatusBadRequest,
+			wantCode:   models.ErrorCodeBadRequest,
+		},
+		{
+			name:       "Invalid lifecycle rule",
+			err:        fmt.Errorf("op: %w", services.ErrInvalidLifecycleRule),
+			wantStatus: http.StatusBadRequest,
+			wantCode:   models.ErrorCodeBadRequest,
+		},
+		{
+			name:       "Version is a delete marker",
+			err:        fmt.Errorf("op: %w", services.ErrDeleteMarker),
+			wantStatus: http.StatusNotFound,
+			wantCode:   models.ErrorCodeNotFound,
+		},
+		{
+			name:       "Namespace already exists",
+			err:        fmt.Errorf("op: %w", services.ErrNamespaceExists),
+			wantStatus: http.StatusConflict,
+			wantCode:   models.ErrorCodeConflict,
+		},
+		{
+			name:       "Namespace not found",
+			err:        fmt.Errorf("op: %w", services.ErrNamespaceNotFound),
+			wantStatus: http.StatusNotFound,
+			wantCode:   models.ErrorCodeNotFound,
+		},
+		{
+			name:       "Precondition failed",
+			err:        fmt.Errorf("op: %w", services.ErrPreconditionFailed),
+			wantStatus: http.StatusPreconditionFailed,
+			wantCode:   models.ErrorCodePreconditionFailed,
+		},
+		{
+			name:       "Object not found",
+			err:        fmt.Errorf("op: %w", services.ErrNotFound),
+			wantStatus: http.StatusNotFound,
+			wantCode:   models.ErrorCodeNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code := objectErrorStatus(tt.err)
+			assert.Equal(t, tt.wantStatus, status)
+			assert.Equal(t, tt.wantCode, code)
+		})
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeError(w, http.StatusNotFound, models.ErrorCodeNotFound, "File not found")
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"code":"not_found","message":"File not found"}`, w.Body.String())
+}
@@ -1,10 +1,12 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
+	"mime"
 	"net/http"
 	"strconv"
 
@@ -12,71 +14,314 @@ import (
 	"karma8/internal/app/services"
 	trccontext "karma8/internal/lib/context"
 	"karma8/internal/lib/logger/sl"
+	"karma8/internal/lib/monitoring/telemetry"
 	"karma8/internal/models"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
-func GetFileItem(service services.IService) http.HandlerFunc {
+func GetFileItem(service services.IServiceA) http.HandlerFunc {
 	// swagger:operation GET /api/file/{id} GetFileItem
 	// Get file from server by ID.
 	// ---
-	// description: Get file from server by ID.
+	// description: Get file from server by ID. The file is streamed; a single byte range can be requested with Range/If-Range.
 	// parameters:
 	// - name: id
 	//   in: path
 	//   description: The ID of the file.
 	//   required: true
 	//   type: string
+	// - name: Range
+	//   in: header
+	//   description: Byte range of the file, e.g. bytes=0-1023.
+	//   required: false
+	//   type: string
+	// - name: If-Range
+	//   in: header
+	//   description: ETag or Last-Modified value; the range is served only if the file has not changed.
+	//   required: false
+	//   type: string
+	// - name: If-None-Match
+	//   in: header
+	//   description: ETag values; if the file ETag (its SHA-256 checksum) is one of them, 304 is returned.
+	//   required: false
+	//   type: string
+	// - name: If-Modified-Since
+	//   in: header
+	//   description: HTTP date; if the file was not created after it, 304 is returned. Ignored with If-None-Match.
+	//   required: false
+	//   type: string
+	// - name: If-Match
+	//   in: header
+	//   description: ETag values; if the file ETag is not one of them, 412 is returned.
+	//   required: false
+	//   type: string
 	// responses:
 	//   '200':
 	//     description: OK
+	//   '206':
+	//     description: Partial Content
+	//   '304':
+	//     description: Not Modified
 	//   '400':
 	//     description: Bad User Request Error
 	//   '404':
 	//     description: File Not Found Error
+	//   '416':
+	//     description: Range Not Satisfiable Error
 	//   '500':
 	//     description: Internal Server Error
+	//   '502':
+	//     description: File part is corrupted and cannot be reconstructed
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '503':
+	//     description: Bucket with a file part is unreachable or timed out
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
 	return func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
-		id := vars["id"]
-
 		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "GetFileItem")
 		defer span.End()
 
-		// r = r.WithContext(ctx)
+		// Подпись ссылки проверена PresignedURLs; без него запросы с подписью отклоняются.
+		if !checkPresigned(w, r) {
+			return
+		}
 
-		span.SetTag("id", id)
+		metadata, ok := fileMetadata(w, r.WithContext(ctx), service, span, "GetFileItem")
+		if !ok {
+			return
+		}
 
-		parsedUUID, err := uuid.Parse(id)
-		if err != nil {
-			service.Logger().Error("error in GetFileItem uuid.Parse: ", sl.Err(err))
-			http.Error(w, "Error parsing UUID", http.StatusBadRequest)
+		serveFile(w, r.WithContext(ctx), service, metadata, span)
+	}
+}
+
+func HeadFileItem(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation HEAD /api/file/{id} HeadFileItem
+	// Get file headers by ID.
+	// ---
+	// description: Returns the headers of GET /api/file/{id} (Content-Length, Content-Type, ETag - the SHA-256 checksum,
+	//   Last-Modified) without the content. Only the metadata is read, the buckets are not requested.
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: The ID of the file.
+	//   required: true
+	//   type: string
+	// - name: If-None-Match
+	//   in: header
+	//   description: ETag values; if the file ETag is one of them, 304 is returned.
+	//   required: false
+	//   type: string
+	// - name: If-Modified-Since
+	//   in: header
+	//   description: HTTP date; if the file was not created after it, 304 is returned. Ignored with If-None-Match.
+	//   required: false
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK
+	//   '304':
+	//     description: Not Modified
+	//   '400':
+	//     description: Bad User Request Error
+	//   '404':
+	//     description: File Not Found Error
+	//   '500':
+	//     description: Internal Server Error
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "HeadFileItem")
+		defer span.End()
 
+		metadata, ok := fileMetadata(w, r.WithContext(ctx), service, span, "HeadFileItem")
+		if !ok || !checkFilePreconditions(w, r, metadata) {
 			return
 		}
 
-		data, err := service.GetFileItem(ctx, parsedUUID)
+		setFileHeaders(w, metadata)
+		w.Header().Set("Content-Length", strconv.FormatInt(metadata.Size, 10))
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func GetFileMetadata(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation GET /api/file/{id}/meta GetFileMetadata
+	// Get file metadata by ID.
+	// ---
+	// description: Returns the metadata of the file, including the buckets and the manifest of its parts.
+	//   Only the metadata is read, the buckets are not requested.
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: The ID of the file.
+	//   required: true
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/MetadataItem"
+	//   '400':
+	//     description: Bad User Request Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '404':
+	//     description: File Not Found Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "GetFileMetadata")
+		defer span.End()
+
+		metadata, ok := fileMetadata(w, r.WithContext(ctx), service, span, "GetFileMetadata")
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(metadata)
+	}
+}
+
+// fileMetadata возвращает метаданные файла с ID из пути запроса; при ошибке отправляет ответ об ошибке.
+// name - имя обработчика для журнала.
+func fileMetadata(
+	w http.ResponseWriter,
+	r *http.Request,
+	service services.IServiceA,
+	span telemetry.Span,
+	name string,
+) (*models.MetadataItem, bool) {
+	id := mux.Vars(r)["id"]
+	span.SetTag("id", id)
+
+	parsedUUID, err := uuid.Parse(id)
+	if err != nil {
+		service.Logger().Error("error in "+name+" uuid.Parse: ", sl.Err(err))
+		writeError(w, http.StatusBadRequest, models.ErrorCodeBadRequest, "Error parsing UUID")
+
+		return nil, false
+	}
+
+	metadata, err := service.GetFileMetadata(r.Context(), parsedUUID)
+	if errors.Is(err, services.ErrNotFound) {
+		writeError(w, http.StatusNotFound, models.ErrorCodeNotFound, "File not found")
+
+		return nil, false
+	}
+	if err != nil {
+		service.Logger().Error("error in "+name+" service.GetFileMetadata: ", sl.Err(err))
+		writeError(w, http.StatusInternalServerError, models.ErrorCodeInternal, "error in "+name+": "+err.Error())
+		span.SetError(err)
+
+		return nil, false
+	}
+	if !canAccessFile(r.Context(), metadata) {
+		writeError(w, http.StatusForbidden, models.ErrorCodeForbidden, "API key has no access to the file")
+
+		return nil, false
+	}
+
+	return metadata, true
+}
+
+// checkFilePreconditions проверяет условия запроса на чтение файла (If-Match, If-None-Match, If-Modified-Since).
+// Если файл отдавать не нужно, отправляет ответ 304 или 412 и возвращает false.
+func checkFilePreconditions(w http.ResponseWriter, r *http.Request, metadata *models.MetadataItem) bool {
+	etag := fmt.Sprintf(`"%s"`, metadata.Checksum)
+
+	switch checkPreconditions(r, etag, metadata.CreatedAt) {
+	case http.StatusNotModified:
+		writeNotModified(w, etag, metadata.CreatedAt)
+
+		return false
+	case http.StatusPreconditionFailed:
+		writeError(w, http.StatusPreconditionFailed, models.ErrorCodePreconditionFailed, "Precondition failed")
+
+		return false
+	default:
+		return true
+	}
+}
+
+// setFileHeaders устанавливает заголовки ответа с содержимым файла, кроме Content-Length.
+func setFileHeaders(w http.ResponseWriter, metadata *models.MetadataItem) {
+	// Имя файла экранируется (кавычки, не-ASCII символы по RFC 2231), чтобы оно не ломало заголовок.
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": metadata.FileName}))
+	w.Header().Set("Content-Type", metadata.ContentType)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, metadata.Checksum))
+	w.Header().Set("Last-Modified", metadata.CreatedAt.UTC().Format(http.TimeFormat))
+}
+
+// serveFile отправляет содержимое файла потоком: целиком или один диапазон байт из заголовка Range/If-Range.
+func serveFile(
+	w http.ResponseWriter,
+	r *http.Request,
+	service services.IServiceA,
+	metadata *models.MetadataItem,
+	span telemetry.Span,
+) {
+	ctx := r.Context()
+	etag := fmt.Sprintf(`"%s"`, metadata.Checksum)
+
+	if !checkFilePreconditions(w, r, metadata) {
+		return
+	}
+
+	// Определяем запрошенный диапазон (по умолчанию - файл целиком).
+	var fileRange *byteRange
+	if checkIfRange(r, etag, metadata.CreatedAt) {
+		var err error
+		fileRange, err = parseRange(r.Header.Get("Range"), metadata.Size)
 		if err != nil {
-			service.Logger().Error("error in GetFileItem service.GetFileItem: ", sl.Err(err))
-			http.Error(w, "error in GetFileItem: "+err.Error(), http.StatusInternalServerError)
-			span.SetError(err)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", metadata.Size))
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, models.ErrorCodeRangeNotSatisfiable, "Requested range not satisfiable")
 
 			return
 		}
+	}
 
-		// Устанавливаем заголовки.
-		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, data.FileName))
-		w.Header().Set("Content-Type", data.FileContentType)
-		w.Header().Set("Content-Length", strconv.Itoa(len(data.FileContent)))
+	offset, length, status := int64(0), metadata.Size, http.StatusOK
+	if fileRange != nil {
+		offset, length, status = fileRange.start, fileRange.length, http.StatusPartialContent
+		span.SetTag("range", fileRange.contentRange(metadata.Size))
+	}
+
+	reader, err := service.OpenFile(ctx, metadata, offset, length)
+	if err != nil {
+		service.Logger().Error("error in serveFile service.OpenFile: ", sl.Err(err))
+		status, code := fileErrorStatus(err)
+		writeError(w, status, code, "error in serveFile: "+err.Error())
+		span.SetError(err)
 
-		// Отправляем содержимое файла.
-		_, _ = w.Write(data.FileContent)
+		return
+	}
+	defer reader.Close()
+
+	// Устанавливаем заголовки.
+	setFileHeaders(w, metadata)
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	if fileRange != nil {
+		w.Header().Set("Content-Range", fileRange.contentRange(metadata.Size))
+	}
+	w.WriteHeader(status)
+
+	// Отправляем содержимое файла потоком.
+	// При ошибке ответ обрывается раньше Content-Length, и клиент не примет его как целый файл.
+	if _, err = io.Copy(w, reader); err != nil {
+		service.Logger().Error("error in serveFile io.Copy: ", sl.Err(err))
+		span.SetError(err)
 	}
 }
 
-func PutFileItem(service services.IService) http.HandlerFunc {
+func PutFileItem(service services.IServiceA) http.HandlerFunc {
 	// swagger:operation PUT /api/file PutFileItem
 	// Upload a file.
 	// ---
@@ -99,76 +344,83 @@ func PutFileItem(service services.IService) http.HandlerFunc {
 	//   '500':
 	//     description: Internal Server Error
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Парсинг формы с файлом
-		err := r.ParseMultipartForm(10 << 20) // TODO (в настройки) 10 MB максимальный размер файла.
-		if err != nil {
-			service.Logger().Error("error in PutFileItem ParseMultipartForm: ", sl.Err(err))
-			http.Error(w, "Unable to parse form", http.StatusBadRequest)
-
-			return
-		}
-
 		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "PutFileItem")
 		defer span.End()
 
 		r = r.WithContext(ctx)
 
-		// TODO debug
-		span.AddEvent("установим event")
-		span.SetTag("label1", "значение label1")
+		if !checkPresigned(w, r) {
+			return
+		}
+		// Загрузка по подписанной ссылке ограничена размером и типом содержимого из разрешения.
+		// Разрешение использовано до загрузки (см. PresignedURLs): если файл не сохранён, оно возвращается.
+		presigned, _ := presignedFromContext(ctx)
+		var stored bool
+		if presigned.upload != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, presigned.upload.MaxSize+presignFormOverhead)
+			defer func() {
+				if stored {
+					return
+				}
+				if err := service.RestorePresignedUpload(context.WithoutCancel(ctx), presigned.upload); err != nil {
+					service.Logger().Error("error in PutFileItem RestorePresignedUpload: ", sl.Err(err))
+				}
+			}()
+		}
 
-		// Получение файла из формы.
-		file, handler, err := r.FormFile("file")
+		// Получение файла из формы (файл читается потоком, форма целиком не разбирается).
+		file, err := readFormFile(r, "file")
 		if err != nil {
-			service.Logger().Error("error in PutFileItem FormFile: ", sl.Err(err))
+			service.Logger().Error("error in PutFileItem readFormFile: ", sl.Err(err))
 			http.Error(w, "Failed to retrieve file from form", http.StatusBadRequest)
 			span.SetError(err)
 
 			return
 		}
-		defer func(file multipart.File) {
-			err := file.Close()
-			if err != nil {
-				service.Logger().Error("error in PutFileItem Close: ", sl.Err(err))
-				http.Error(w, "Failed to close file", http.StatusInternalServerError)
-				span.SetError(err)
+		defer file.Close()
 
-				return
-			}
-		}(file)
-
-		// Получение содержимого файла из формы.
-		fileContent, err := io.ReadAll(file)
+		// Определение типа содержимого по первым байтам файла.
+		contentType, content, err := processes.SniffContentType(file)
 		if err != nil {
-			service.Logger().Error("error in PutFileItem ReadAll: ", sl.Err(err))
-			http.Error(w, "Failed to read file content", http.StatusInternalServerError)
+			service.Logger().Error("error in PutFileItem SniffContentType: ", sl.Err(err))
+			http.Error(w, "Failed to read file content", http.StatusBadRequest)
 			span.SetError(err)
 
 			return
 		}
-		// Запись файла на диск.
-		_, err = processes.WriteFile(fileContent, handler.Filename)
-		if err != nil {
-			service.Logger().Error("error in PutFileItem WriteFile: ", sl.Err(err))
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			span.SetError(err)
 
-			return
+		var limited *limitedFile
+		if presigned.upload != nil {
+			if !presigned.upload.AllowsContentType(contentType) {
+				writeError(w, http.StatusUnsupportedMediaType, models.ErrorCodeUnsupportedMedia,
+					"content type "+contentType+" is not allowed by the presigned URL")
+
+				return
+			}
+			limited = &limitedFile{reader: content, remaining: presigned.upload.MaxSize}
+			content = limited
 		}
 
 		source := &models.FileItem{
-			FileName:        handler.Filename,
-			FileContentType: http.DetectContentType(fileContent),
-			FileContent:     fileContent,
+			FileName:        file.FileName(),
+			FileContentType: contentType,
+			Content:         content,
 		}
 
 		newID, err := service.PutFileItem(ctx, source)
+		if limited != nil && limited.exceeded {
+			writeError(w, http.StatusRequestEntityTooLarge, models.ErrorCodeTooLarge, errFileTooLarge.Error())
+			span.SetError(errFileTooLarge)
+
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			span.SetError(err)
 
 			return
 		}
+		stored = true
 		span.SetTag("id", newID.String())
 
 		w.Header().Set("Content-Type", "application/json")
@@ -185,3 +437,100 @@ func PutFileItem(service services.IService) http.HandlerFunc {
 		}
 	}
 }
+
+func DeleteFileItem(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation DELETE /api/file/{id} DeleteFileItem
+	// Delete file from server by ID.
+	// ---
+	// description: Deletes file metadata, cache and file parts in all buckets.
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: The ID of the file.
+	//   required: true
+	//   type: string
+	// - name: If-Match
+	//   in: header
+	//   description: ETag values; the file is deleted only if its ETag (SHA-256 checksum) is one of them.
+	//   required: false
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/ResponseSuccess"
+	//   '202':
+	//     description: File deleted, some parts are pending deletion and will be retried
+	//     schema:
+	//       "$ref": "#/definitions/ResponsePendingDelete"
+	//   '400':
+	//     description: Bad User Request Error
+	//   '404':
+	//     description: File Not Found Error
+	//   '412':
+	//     description: Precondition Failed
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id := vars["id"]
+
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "DeleteFileItem")
+		defer span.End()
+
+		span.SetTag("id", id)
+
+		parsedUUID, err := uuid.Parse(id)
+		if err != nil {
+			service.Logger().Error("error in DeleteFileItem uuid.Parse: ", sl.Err(err))
+			http.Error(w, "Error parsing UUID", http.StatusBadRequest)
+
+			return
+		}
+
+		// Содержимое и владелец файла не меняются, поэтому условие If-Match и доступ к файлу
+		// достаточно проверить перед удалением.
+		if _, authenticated := apiKeyFromContext(ctx); authenticated || r.Header.Get("If-Match") != "" {
+			metadata, err := service.GetFileMetadata(ctx, parsedUUID)
+			if err == nil && !canAccessFile(ctx, metadata) {
+				writeError(w, http.StatusForbidden, models.ErrorCodeForbidden, "API key has no access to the file")
+
+				return
+			}
+			if err == nil && !parseIfMatch(r).Matches(metadata.Checksum) {
+				writeError(w, http.StatusPreconditionFailed, models.ErrorCodePreconditionFailed, "Precondition failed")
+
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		var partialErr *services.PartialDeleteError
+
+		err = service.DeleteFileItem(ctx, parsedUUID)
+		switch {
+		case err == nil:
+			_ = json.NewEncoder(w).Encode(models.ResponseSuccess{
+				ID: parsedUUID.String(),
+			})
+		case errors.As(err, &partialErr):
+			service.Logger().Warn("DeleteFileItem: parts are pending deletion", sl.Err(err))
+			span.SetError(err)
+
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(models.ResponsePendingDelete{
+				ID:               parsedUUID.String(),
+				PendingBucketIDs: partialErr.BucketIDs,
+			})
+		case errors.Is(err, services.ErrNotFound):
+			http.Error(w, "File not found", http.StatusNotFound)
+		default:
+			service.Logger().Error("error in DeleteFileItem service.DeleteFileItem: ", sl.Err(err))
+			http.Error(w, "error in DeleteFileItem: "+err.Error(), http.StatusInternalServerError)
+			span.SetError(err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"karma8/internal/app/services"
+	"karma8/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFileService - сервис A с метаданными файлов в памяти; чтение содержимого (из бакетов) запрещено.
+type fakeFileService struct {
+	services.IServiceA
+
+	t     *testing.T
+	files map[uuid.UUID]*models.MetadataItem
+}
+
+func (s *fakeFileService) Logger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func (s *fakeFileService) GetFileMetadata(_ context.Context, id uuid.UUID) (*models.MetadataItem, error) {
+	metadata, ok := s.files[id]
+	if !ok {
+		return nil, services.ErrNotFound
+	}
+
+	return metadata, nil
+}
+
+func (s *fakeFileService) OpenFile(context.Context, *models.MetadataItem, int64, int64) (io.ReadCloser, error) {
+	s.t.Fatal("file content must not be read")
+
+	return nil, nil
+}
+
+func newFileServer(t *testing.T, metadata *models.MetadataItem) *httptest.Server {
+	service := &fakeFileService{t: t, files: map[uuid.UUID]*models.MetadataItem{metadata.UUID: metadata}}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/file/{id}", HeadFileItem(service)).Methods("HEAD")
+	router.HandleFunc("/api/file/{id}/meta", GetFileMetadata(service)).Methods("GET")
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestFileMetadataHandlers(t *testing.T) {
+	metadata := &models.MetadataItem{
+		UUID:        uuid.New(),
+		BlobID:      uuid.New(),
+		Checksum:    "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		FileName:    "report.csv",
+		ContentType: "text/csv",
+		BucketIDs:   []int64{1, 2, 3},
+		Parts:       []models.PartItem{{Index: 0, BucketID: 1, Length: 4}},
+		Size:        4,
+		DataShards:  2,
+		CreatedAt:   time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC),
+	}
+	server := newFileServer(t, metadata)
+
+	resp, err := http.Head(server.URL + "/api/file/" + metadata.UUID.String())
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int64(4), resp.ContentLength)
+	assert.Equal(t, "text/csv", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `"`+metadata.Checksum+`"`, resp.Header.Get("ETag"))
+	assert.Equal(t, "Sun, 18 Oct 2026 10:00:00 GMT", resp.Header.Get("Last-Modified"))
+
+	// Файл не изменился с прошлого запроса.
+	req, err := http.NewRequest("HEAD", server.URL+"/api/file/"+metadata.UUID.String(), http.NoBody)
+	require.NoError(t, err)
+	req.Header.Set("If-None-Match", `"`+metadata.Checksum+`"`)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Equal(t, `"`+metadata.Checksum+`"`, resp.Header.Get("ETag"))
+
+	resp, err = http.Head(server.URL + "/api/file/" + uuid.NewString())
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/api/file/" + metadata.UUID.String() + "/meta")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var got models.MetadataItem
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	assert.Equal(t, *metadata, got)
+
+	resp, err = http.Get(server.URL + "/api/file/not-a-uuid/meta")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestSetFileHeadersContentDisposition(t *testing.T) {
+	for _, name := range []string{"report.csv", `quarterly "final" report.csv`, "отчёт за 2026.csv", "a;b=c.txt"} {
+		w := httptest.NewRecorder()
+		setFileHeaders(w, &models.MetadataItem{FileName: name})
+
+		disposition, params, err := mime.ParseMediaType(w.Header().Get("Content-Disposition"))
+		require.NoError(t, err, name)
+		assert.Equal(t, "attachment", disposition)
+		assert.Equal(t, name, params["filename"])
+	}
+}
@@ -0,0 +1,313 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"karma8/internal/app/services"
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/lib/logger/sl"
+	"karma8/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// maxAdminBodySize - максимальный размер тела запроса к административному API.
+const maxAdminBodySize = 1 << 20
+
+func PutBucket(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation POST /api/admin/buckets PutBucket
+	// Register a bucket.
+	// ---
+	// description: Adds a new bucket (service_b instance) or changes the address of an existing one.
+	//   The bucket starts receiving file parts immediately, without restarting service_a.
+	// consumes:
+	// - application/json
+	// parameters:
+	// - name: bucket
+	//   in: body
+	//   description: ID and address of the bucket.
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/ServerBucketInfo"
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/ResponseSuccess"
+	//   '400':
+	//     description: Bad User Request Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "PutBucket")
+		defer span.End()
+
+		var bucket models.ServerBucketInfo
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodySize)).Decode(&bucket)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, models.ErrorCodeBadRequest, "Error parsing bucket: "+err.Error())
+			span.SetError(err)
+
+			return
+		}
+		span.SetTag("bucketID", strconv.FormatInt(bucket.ID, 10))
+
+		err = service.RegisterBucket(ctx, &bucket)
+		if errors.Is(err, services.ErrInvalidBucket) {
+			writeError(w, http.StatusBadRequest, models.ErrorCodeBadRequest, err.Error())
+			span.SetError(err)
+
+			return
+		}
+		if err != nil {
+			service.Logger().Error("error in PutBucket service.RegisterBucket: ", sl.Err(err))
+			writeError(w, http.StatusInternalServerError, models.ErrorCodeInternal, "error in PutBucket")
+			span.SetError(err)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(models.ResponseSuccess{
+			ID: strconv.FormatInt(bucket.ID, 10),
+		})
+	}
+}
+
+func GetRebalanceStatus(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation GET /api/admin/rebalance GetRebalanceStatus
+	// Get rebalance status.
+	// ---
+	// description: Returns the state and progress of moving file parts from the fullest buckets to underused ones.
+	//   Counters refer to the current pass or, if no pass is running, to the last finished one.
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/RebalanceStatus"
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, span := trccontext.WithTelemetrySpan(r.Context(), "GetRebalanceStatus")
+		defer span.End()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(service.GetRebalanceStatus())
+	}
+}
+
+func GetScrubStatus(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation GET /api/admin/scrub GetScrubStatus
+	// Get scrub status.
+	// ---
+	// description: Returns the state and counters of checking file parts in buckets and repairing missing or corrupted copies.
+	//   Counters refer to the current pass or, if no pass is running, to the last finished one.
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/ScrubStatus"
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, span := trccontext.WithTelemetrySpan(r.Context(), "GetScrubStatus")
+		defer span.End()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(service.GetScrubStatus())
+	}
+}
+
+func RotateDataKeys(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation POST /api/admin/encryption/rotate RotateDataKeys
+	// Rotate data keys.
+	// ---
+	// description: Re-encrypts the data keys of stored contents with the current master key (the last key
+	//   of the key file). File parts in buckets are not changed. When no key has failed, old master keys
+	//   can be removed from the key file. The same rotation runs in the background every hour.
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/KeyRotation"
+	//   '409':
+	//     description: Encryption is disabled
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "RotateDataKeys")
+		defer span.End()
+
+		result, err := service.RotateDataKeys(ctx)
+		if errors.Is(err, services.ErrEncryptionDisabled) {
+			writeError(w, http.StatusConflict, models.ErrorCodeConflict, err.Error())
+			span.SetError(err)
+
+			return
+		}
+		if err != nil {
+			service.Logger().Error("error in RotateDataKeys service.RotateDataKeys: ", sl.Err(err))
+			writeError(w, http.StatusInternalServerError, models.ErrorCodeInternal, "error in RotateDataKeys")
+			span.SetError(err)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(result)
+	}
+}
+
+func CreateAPIKey(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation POST /api/admin/keys CreateAPIKey
+	// Create an API key.
+	// ---
+	// description: Creates a key of the REST API with the scopes (read, write, delete, admin) and, optionally,
+	//   the namespaces it can access. The secret is returned only in this response.
+	// consumes:
+	// - application/json
+	// parameters:
+	// - name: key
+	//   in: body
+	//   description: Scopes and namespaces of the key; an empty list of namespaces - all namespaces.
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/CreateAPIKeyRequest"
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/APIKey"
+	//   '400':
+	//     description: Bad User Request Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "CreateAPIKey")
+		defer span.End()
+
+		var request models.CreateAPIKeyRequest
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodySize)).Decode(&request)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, models.ErrorCodeBadRequest, "Error parsing API key: "+err.Error())
+			span.SetError(err)
+
+			return
+		}
+
+		key, err := service.CreateAPIKey(ctx, &request)
+		if errors.Is(err, services.ErrInvalidAPIKey) {
+			writeError(w, http.StatusBadRequest, models.ErrorCodeBadRequest, err.Error())
+			span.SetError(err)
+
+			return
+		}
+		if err != nil {
+			service.Logger().Error("error in CreateAPIKey service.CreateAPIKey: ", sl.Err(err))
+			writeError(w, http.StatusInternalServerError, models.ErrorCodeInternal, "error in CreateAPIKey")
+			span.SetError(err)
+
+			return
+		}
+		span.SetTag("keyID", key.ID)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(key)
+	}
+}
+
+func ListAPIKeys(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation GET /api/admin/keys ListAPIKeys
+	// List API keys.
+	// ---
+	// description: Returns the keys of the REST API without secrets.
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/APIKeyList"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "ListAPIKeys")
+		defer span.End()
+
+		list, err := service.ListAPIKeys(ctx)
+		if err != nil {
+			service.Logger().Error("error in ListAPIKeys service.ListAPIKeys: ", sl.Err(err))
+			writeError(w, http.StatusInternalServerError, models.ErrorCodeInternal, "error in ListAPIKeys")
+			span.SetError(err)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(list)
+	}
+}
+
+func DeleteAPIKey(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation DELETE /api/admin/keys/{id} DeleteAPIKey
+	// Delete an API key.
+	// ---
+	// description: Deletes the key of the REST API; requests with it are rejected. Files uploaded with the key are kept.
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: The ID of the key.
+	//   required: true
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/ResponseSuccess"
+	//   '404':
+	//     description: Key Not Found Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "DeleteAPIKey")
+		defer span.End()
+
+		span.SetTag("keyID", id)
+
+		err := service.DeleteAPIKey(ctx, id)
+		if errors.Is(err, services.ErrNotFound) {
+			writeError(w, http.StatusNotFound, models.ErrorCodeNotFound, "API key not found")
+
+			return
+		}
+		if err != nil {
+			service.Logger().Error("error in DeleteAPIKey service.DeleteAPIKey: ", sl.Err(err))
+			writeError(w, http.StatusInternalServerError, models.ErrorCodeInternal, "error in DeleteAPIKey")
+			span.SetError(err)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(models.ResponseSuccess{
+			ID: id,
+		})
+	}
+}
@@ -1,14 +1,17 @@
 package handler
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"karma8/internal/app/services"
 	libcontext "karma8/internal/lib/context"
+	"karma8/internal/lib/logger/sl"
 	"karma8/internal/models"
 
 	"github.com/google/uuid"
@@ -29,15 +32,27 @@ func GetBucketItem(service services.IService) http.HandlerFunc {
 
 		parsedUUID, err := uuid.Parse(id)
 		if err != nil {
-			http.Error(w, "Error parsing UUID", http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, models.ErrorCodeBadRequest, "Error parsing UUID")
 			span.SetError(err)
 
 			return
 		}
 
 		data, err := service.GetFileItem(ctx, parsedUUID)
+		if errors.Is(err, services.ErrNotFound) {
+			writeError(w, http.StatusNotFound, models.ErrorCodeNotFound, "File part not found")
+
+			return
+		}
+		if errors.Is(err, services.ErrCorrupted) {
+			writeError(w, http.StatusInternalServerError, models.ErrorCodeCorrupted, "File part is corrupted")
+			service.Logger().Error("error in GetBucketItem: ", sl.Err(err))
+			span.SetError(err)
+
+			return
+		}
 		if err != nil {
-			http.Error(w, "error in GetFileItem", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, models.ErrorCodeInternal, "error in GetFileItem")
 			span.SetError(err)
 
 			return
@@ -46,55 +61,78 @@ func GetBucketItem(service services.IService) http.HandlerFunc {
 		// Устанавливаем заголовки.
 		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, data.FileName))
 		w.Header().Set("Content-Type", "application/octet-stream")
-		w.Header().Set("Content-Length", strconv.Itoa(len(data.FileContent)))
+		if data.Checksum != "" {
+			w.Header().Set(services.HeaderChecksum, data.Checksum)
+		}
 
-		// Отправляем содержимое файла.
-		_, _ = w.Write(data.FileContent)
+		// Отправляем содержимое части файла (с поддержкой заголовка Range).
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data.FileContent))
 	}
 }
 
-func PutBucketItem(service services.IService) http.HandlerFunc {
+// HeadBucketItem сообщает, хранится ли часть файла в бакете: размер части и контрольную сумму её данных,
+// вычисленную заново при запросе (заголовок X-Checksum-Sha256).
+func HeadBucketItem(service services.IServiceB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx, span := libcontext.WithTelemetrySpan(r.Context(), "PutBucketItem")
+		vars := mux.Vars(r)
+		id := vars["id"]
+
+		ctx, span := libcontext.WithTelemetrySpan(r.Context(), "HeadBucketItem")
 		defer span.End()
 
-		r = r.WithContext(ctx)
+		span.SetTag("id", id)
 
-		// Парсинг формы с файлом
-		err := r.ParseMultipartForm(10 << 20) // TODO (в настройки) 10 MB максимальный размер файла.
+		parsedUUID, err := uuid.Parse(id)
 		if err != nil {
-			http.Error(w, "Unable to parse form", http.StatusBadRequest)
+			w.WriteHeader(http.StatusBadRequest)
 			span.SetError(err)
 
 			return
 		}
 
-		// Получение файла из формы.
-		file, handler, err := r.FormFile("file")
+		size, checksum, err := service.CheckFileItem(ctx, parsedUUID)
+		if errors.Is(err, services.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
 		if err != nil {
-			http.Error(w, "Failed to retrieve file from form", http.StatusBadRequest)
+			service.Logger().Error("error in HeadBucketItem: ", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
 			span.SetError(err)
 
 			return
 		}
-		defer file.Close()
 
-		// Получение содержимого файла из формы.
-		fileContent, err := io.ReadAll(file)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.Header().Set(services.HeaderChecksum, checksum)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func PutBucketItem(service services.IService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := libcontext.WithTelemetrySpan(r.Context(), "PutBucketItem")
+		defer span.End()
+
+		r = r.WithContext(ctx)
+
+		// Получение части файла из формы (часть читается потоком).
+		file, err := readFormFile(r, "file")
 		if err != nil {
-			http.Error(w, "Failed to read file content", http.StatusInternalServerError)
+			http.Error(w, "Failed to retrieve file from form", http.StatusBadRequest)
 			span.SetError(err)
 
 			return
 		}
-		// Получение ID файла из формы.
-		fileID := r.FormValue("id")
+		defer file.Close()
 
 		source := &models.FileItem{
-			ID:              fileID,
-			FileName:        handler.Filename,
-			FileContentType: http.DetectContentType(fileContent),
-			FileContent:     fileContent,
+			// ID файла передаётся в форме до части файла.
+			ID:       file.values["id"],
+			FileName: file.FileName(),
+			Content:  file,
 		}
 
 		newID, err := service.PutFileItem(ctx, source)
@@ -107,6 +145,8 @@ func PutBucketItem(service services.IService) http.HandlerFunc {
 
 		span.SetTag("id", newID.String())
 
+		// Возвращаем контрольную сумму сохранённой части, чтобы сервис A мог сверить её со своей.
+		w.Header().Set(services.HeaderChecksum, source.Checksum)
 		w.Header().Set("Content-Type", "application/json")
 		result := models.ResponseSuccess{
 			ID: newID.String(),
@@ -120,3 +160,56 @@ func PutBucketItem(service services.IService) http.HandlerFunc {
 		}
 	}
 }
+
+func GetBucketStats(service services.IServiceB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := libcontext.WithTelemetrySpan(r.Context(), "GetBucketStats")
+		defer span.End()
+
+		stats, err := service.GetStats(ctx)
+		if err != nil {
+			service.Logger().Error("error in GetBucketStats: ", sl.Err(err))
+			writeError(w, http.StatusInternalServerError, models.ErrorCodeInternal, "error in GetStats")
+			span.SetError(err)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(stats)
+	}
+}
+
+func DeleteBucketItem(service services.IService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id := vars["id"]
+
+		ctx, span := libcontext.WithTelemetrySpan(r.Context(), "DeleteBucketItem")
+		defer span.End()
+
+		span.SetTag("id", id)
+
+		parsedUUID, err := uuid.Parse(id)
+		if err != nil {
+			http.Error(w, "Error parsing UUID", http.StatusBadRequest)
+			span.SetError(err)
+
+			return
+		}
+
+		err = service.DeleteFileItem(ctx, parsedUUID)
+		if err != nil {
+			http.Error(w, "error in DeleteFileItem", http.StatusInternalServerError)
+			span.SetError(err)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		result := models.ResponseSuccess{
+			ID: parsedUUID.String(),
+		}
+		_ = json.NewEncoder(w).Encode(result)
+	}
+}
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"karma8/internal/app/services"
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/lib/logger/sl"
+	"karma8/internal/models"
+)
+
+// parseFileFilter возвращает условия списка файлов из параметров запроса.
+// Границы created_from и created_to задаются в формате RFC 3339.
+func parseFileFilter(query url.Values) (*models.FileFilter, error) {
+	filter := &models.FileFilter{
+		FileNamePrefix: query.Get("filename_prefix"),
+		ContentType:    query.Get("content_type"),
+		Sort:           query.Get("sort"),
+		Cursor:         query.Get("cursor"),
+	}
+
+	switch order := query.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		filter.Desc = true
+	default:
+		return nil, fmt.Errorf("invalid order %q: must be asc or desc", order)
+	}
+
+	for name, field := range map[string]*time.Time{
+		"created_from": &filter.CreatedFrom,
+		"created_to":   &filter.CreatedTo,
+	} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: must be RFC 3339 date and time", name)
+			}
+			*field = t
+		}
+	}
+
+	for name, field := range map[string]*int64{
+		"min_size": &filter.MinSize,
+		"max_size": &filter.MaxSize,
+	} {
+		if value := query.Get(name); value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid %s: must be a non-negative integer", name)
+			}
+			*field = n
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid limit: must be a positive integer")
+		}
+		filter.Limit = n
+	}
+
+	return filter, nil
+}
+
+func ListFiles(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation GET /api/files ListFiles
+	// List files.
+	// ---
+	// description: Returns a page of stored files matching the filters, in the requested order.
+	//   The next page is requested with the same filters and the cursor from next_cursor.
+	// parameters:
+	// - name: filename_prefix
+	//   in: query
+	//   description: Only files whose name starts with the prefix (case-sensitive).
+	//   required: false
+	//   type: string
+	// - name: content_type
+	//   in: query
+	//   description: Only files with the content type.
+	//   required: false
+	//   type: string
+	// - name: created_from
+	//   in: query
+	//   description: Only files created at or after the time (RFC 3339).
+	//   required: false
+	//   type: string
+	//   format: date-time
+	// - name: created_to
+	//   in: query
+	//   description: Only files created before the time (RFC 3339).
+	//   required: false
+	//   type: string
+	//   format: date-time
+	// - name: min_size
+	//   in: query
+	//   description: Only files of at least the size in bytes.
+	//   required: false
+	//   type: integer
+	// - name: max_size
+	//   in: query
+	//   description: Only files of at most the size in bytes.
+	//   required: false
+	//   type: integer
+	// - name: sort
+	//   in: query
+	//   description: Sort field.
+	//   required: false
+	//   type: string
+	//   enum: [created_at, filename, size]
+	//   default: created_at
+	// - name: order
+	//   in: query
+	//   description: Sort order.
+	//   required: false
+	//   type: string
+	//   enum: [asc, desc]
+	//   default: asc
+	// - name: limit
+	//   in: query
+	//   description: Page size, from 1 to 1000.
+	//   required: false
+	//   type: integer
+	//   default: 100
+	// - name: cursor
+	//   in: query
+	//   description: The next_cursor value of the previous page.
+	//   required: false
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/FileList"
+	//   '400':
+	//     description: Invalid filter or cursor
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "ListFiles")
+		defer span.End()
+
+		filter, err := parseFileFilter(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, models.ErrorCodeBadRequest, err.Error())
+
+			return
+		}
+		// Ключ без области admin видит только свои файлы.
+		if key, ok := apiKeyFromContext(ctx); ok && !key.HasScope(models.ScopeAdmin) {
+			filter.Owner = key.ID
+		}
+
+		list, err := service.ListFiles(ctx, filter)
+		if errors.Is(err, services.ErrInvalidFileFilter) {
+			writeError(w, http.StatusBadRequest, models.ErrorCodeBadRequest, err.Error())
+
+			return
+		}
+		if err != nil {
+			service.Logger().Error("error in ListFiles service.ListFiles: ", sl.Err(err))
+			writeError(w, http.StatusInternalServerError, models.ErrorCodeInternal, "error in ListFiles: "+err.Error())
+			span.SetError(err)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(list)
+	}
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"karma8/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFileFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    *models.FileFilter
+		wantErr bool
+	}{
+		{
+			name:  "Defaults",
+			query: "",
+			want:  &models.FileFilter{},
+		},
+		{
+			name: "All filters",
+			query: "filename_prefix=report&content_type=text%2Fcsv" +
+				"&created_from=2026-01-01T00:00:00Z&created_to=2026-02-01T03:00:00%2B03:00" +
+				"&min_size=10&max_size=2048&sort=size&order=desc&limit=20&cursor=abc",
+			want: &models.FileFilter{
+				FileNamePrefix: "report",
+				ContentType:    "text/csv",
+				CreatedFrom:    time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+				CreatedTo:      time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+				MinSize:        10,
+				MaxSize:        2048,
+				Sort:           models.FileSortSize,
+				Desc:           true,
+				Cursor:         "abc",
+				Limit:          20,
+			},
+		},
+		{
+			name:    "Invalid order",
+			query:   "order=up",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid date",
+			query:   "created_from=2026-01-01",
+			wantErr: true,
+		},
+		{
+			name:    "Negative size",
+			query:   "min_size=-1",
+			wantErr: true,
+		},
+		{
+			name:    "Zero limit",
+			query:   "limit=0",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+
+			filter, err := parseFileFilter(query)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want.CreatedFrom.Unix(), filter.CreatedFrom.Unix())
+			assert.Equal(t, tt.want.CreatedTo.Unix(), filter.CreatedTo.Unix())
+			filter.CreatedFrom, filter.CreatedTo = tt.want.CreatedFrom, tt.want.CreatedTo
+			assert.Equal(t, tt.want, filter)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"karma8/internal/app/services"
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/lib/logger/sl"
+	"karma8/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// maxLifecycleRequestSize - максимальный размер тела запроса с правилами жизненного цикла.
+const maxLifecycleRequestSize = 256 << 10
+
+func PutLifecycleRules(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation PUT /api/ns/{ns}/lifecycle PutLifecycleRules
+	// Set lifecycle rules of a namespace.
+	// ---
+	// description: Replaces the lifecycle rules of the namespace; an empty list removes all rules.
+	//   A rule applies to the objects whose keys start with the prefix (empty - the whole namespace, a full key - one object)
+	//   and has at least one action - expire_days: delete objects this many days after the last change;
+	//   expire_at: delete objects changed before this time once it comes; keep_versions: keep this many latest versions
+	//   of an object and permanently delete older ones. In a namespace with versioning, expiring an object creates
+	//   a delete marker. Rules are applied by a background task once an hour.
+	// consumes:
+	// - application/json
+	// parameters:
+	// - name: ns
+	//   in: path
+	//   description: The name of the namespace.
+	//   required: true
+	//   type: string
+	// - name: rules
+	//   in: body
+	//   description: The lifecycle rules.
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/LifecycleConfiguration"
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/LifecycleConfiguration"
+	//   '400':
+	//     description: Invalid lifecycle rules
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '404':
+	//     description: Namespace Not Found Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		ns := mux.Vars(r)["ns"]
+
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "PutLifecycleRules")
+		defer span.End()
+
+		span.SetTag("ns", ns)
+
+		var config models.LifecycleConfiguration
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxLifecycleRequestSize)).Decode(&config)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, models.ErrorCodeBadRequest, "Error parsing lifecycle rules: "+err.Error())
+			span.SetError(err)
+
+			return
+		}
+
+		result, err := service.PutLifecycleRules(ctx, ns, &config)
+		if err != nil {
+			status, code := objectErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				service.Logger().Error("error in PutLifecycleRules service.PutLifecycleRules: ", sl.Err(err))
+				span.SetError(err)
+			}
+			writeError(w, status, code, "error in PutLifecycleRules: "+err.Error())
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(result)
+	}
+}
+
+func GetLifecycleRules(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation GET /api/ns/{ns}/lifecycle GetLifecycleRules
+	// Get lifecycle rules of a namespace.
+	// ---
+	// description: Returns the lifecycle rules of the namespace in the order they were set.
+	// parameters:
+	// - name: ns
+	//   in: path
+	//   description: The name of the namespace.
+	//   required: true
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/LifecycleConfiguration"
+	//   '404':
+	//     description: Namespace Not Found Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		ns := mux.Vars(r)["ns"]
+
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "GetLifecycleRules")
+		defer span.End()
+
+		span.SetTag("ns", ns)
+
+		config, err := service.GetLifecycleRules(ctx, ns)
+		if err != nil {
+			status, code := objectErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				service.Logger().Error("error in GetLifecycleRules service.GetLifecycleRules: ", sl.Err(err))
+				span.SetError(err)
+			}
+			writeError(w, status, code, "error in GetLifecycleRules: "+err.Error())
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(config)
+	}
+}
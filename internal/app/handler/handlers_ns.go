@@ -0,0 +1,578 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"karma8/internal/app/processes"
+	"karma8/internal/app/services"
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/lib/logger/sl"
+	"karma8/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// objectErrorStatus возвращает код ответа и код ошибки для ошибки работы с пространством имён или объектом.
+func objectErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidNamespace), errors.Is(err, services.ErrInvalidObjectKey),
+		errors.Is(err, services.ErrInvalidVersionID), errors.Is(err, services.ErrInvalidLifecycleRule):
+		return http.StatusBadRequest, models.ErrorCodeBadRequest
+	case errors.Is(err, services.ErrNamespaceExists):
+		return http.StatusConflict, models.ErrorCodeConflict
+	case errors.Is(err, services.ErrNamespaceNotFound), errors.Is(err, services.ErrDeleteMarker):
+		return http.StatusNotFound, models.ErrorCodeNotFound
+	case errors.Is(err, services.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed, models.ErrorCodePreconditionFailed
+	default:
+		return fileErrorStatus(err)
+	}
+}
+
+func CreateNamespace(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation PUT /api/ns/{ns} CreateNamespace
+	// Create a namespace.
+	// ---
+	// description: Creates a namespace - a logical container of objects addressed by keys.
+	//   The name must be 3 to 63 characters long and consist of lowercase letters, digits, dots and hyphens.
+	// parameters:
+	// - name: ns
+	//   in: path
+	//   description: The name of the namespace.
+	//   required: true
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/NamespaceItem"
+	//   '400':
+	//     description: Invalid namespace name
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '409':
+	//     description: Namespace already exists
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		ns := mux.Vars(r)["ns"]
+
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "CreateNamespace")
+		defer span.End()
+
+		span.SetTag("ns", ns)
+
+		namespace, err := service.CreateNamespace(ctx, ns)
+		if err != nil {
+			status, code := objectErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				service.Logger().Error("error in CreateNamespace service.CreateNamespace: ", sl.Err(err))
+				span.SetError(err)
+			}
+			writeError(w, status, code, "error in CreateNamespace: "+err.Error())
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(namespace)
+	}
+}
+
+func GetObject(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation GET /api/ns/{ns}/objects/{key} GetObject
+	// Get object content by key.
+	// ---
+	// description: Get the content of the object with the key in the namespace. The content is streamed;
+	//   a single byte range can be requested with Range/If-Range.
+	// parameters:
+	// - name: ns
+	//   in: path
+	//   description: The name of the namespace.
+	//   required: true
+	//   type: string
+	// - name: key
+	//   in: path
+	//   description: The key of the object, may contain slashes, e.g. reports/2026/q3.csv.
+	//   required: true
+	//   type: string
+	// - name: version
+	//   in: query
+	//   description: The ID of the object version; by default the current content is returned.
+	//   required: false
+	//   type: string
+	// - name: Range
+	//   in: header
+	//   description: Byte range of the object, e.g. bytes=0-1023.
+	//   required: false
+	//   type: string
+	// - name: If-None-Match
+	//   in: header
+	//   description: ETag values; if the object ETag (SHA-256 checksum) is one of them, 304 is returned.
+	//   required: false
+	//   type: string
+	// - name: If-Modified-Since
+	//   in: header
+	//   description: HTTP date; if the object was not changed after it, 304 is returned. Ignored with If-None-Match.
+	//   required: false
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK
+	//   '206':
+	//     description: Partial Content
+	//   '304':
+	//     description: Not Modified
+	//   '400':
+	//     description: Invalid version ID
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '404':
+	//     description: Namespace, Object or Version Not Found Error, or the version is a delete marker
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '416':
+	//     description: Range Not Satisfiable Error
+	//   '500':
+	//     description: Internal Server Error
+	//   '502':
+	//     description: Object part is corrupted and cannot be reconstructed
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '503':
+	//     description: Bucket with an object part is unreachable or timed out
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ns, key := vars["ns"], vars["key"]
+
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "GetObject")
+		defer span.End()
+
+		span.SetTag("ns", ns)
+		span.SetTag("key", key)
+
+		fileID, err := objectFileID(ctx, service, ns, key, r.URL.Query().Get("version"))
+		if err != nil {
+			status, code := objectErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				service.Logger().Error("error in GetObject objectFileID: ", sl.Err(err))
+				span.SetError(err)
+			}
+			writeError(w, status, code, "error in GetObject: "+err.Error())
+
+			return
+		}
+		span.SetTag("id", fileID.String())
+
+		metadata, err := service.GetFileMetadata(ctx, fileID)
+		if err != nil {
+			status, code := objectErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				service.Logger().Error("error in GetObject service.GetFileMetadata: ", sl.Err(err))
+				span.SetError(err)
+			}
+			writeError(w, status, code, "error in GetObject: "+err.Error())
+
+			return
+		}
+
+		serveFile(w, r.WithContext(ctx), service, metadata, span)
+	}
+}
+
+// objectFileID возвращает ID файла текущего содержимого объекта или, если задан versionID, его версии.
+func objectFileID(ctx context.Context, service services.IServiceA, ns, key, versionID string) (uuid.UUID, error) {
+	if versionID == "" {
+		object, err := service.GetObject(ctx, ns, key)
+		if err != nil {
+			return uuid.Nil, err
+		}
+
+		return object.FileID, nil
+	}
+
+	version, err := service.GetObjectVersion(ctx, ns, key, versionID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if version.DeleteMarker {
+		return uuid.Nil, services.ErrDeleteMarker
+	}
+
+	return version.FileID, nil
+}
+
+func PutObject(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation PUT /api/ns/{ns}/objects/{key} PutObject
+	// Upload an object.
+	// ---
+	// description: Stores the request body as the object with the key in the namespace.
+	//   If the object already exists, its content is replaced. If Content-Type is not set,
+	//   it is detected from the content.
+	// consumes:
+	// - application/octet-stream
+	// parameters:
+	// - name: ns
+	//   in: path
+	//   description: The name of the namespace.
+	//   required: true
+	//   type: string
+	// - name: key
+	//   in: path
+	//   description: The key of the object (1 to 1024 bytes), may contain slashes, e.g. reports/2026/q3.csv.
+	//   required: true
+	//   type: string
+	// - name: If-Match
+	//   in: header
+	//   description: ETag values; the object is replaced only if it exists and its ETag is one of them ("*" - any).
+	//   required: false
+	//   type: string
+	// - name: body
+	//   in: body
+	//   description: The content of the object.
+	//   required: true
+	//   schema:
+	//     type: string
+	//     format: binary
+	// responses:
+	//   '200':
+	//     description: OK, ETag is the SHA-256 checksum of the content
+	//     schema:
+	//       "$ref": "#/definitions/ObjectItem"
+	//   '400':
+	//     description: Invalid object key
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '404':
+	//     description: Namespace Not Found Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '412':
+	//     description: Object does not match If-Match
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ns, key := vars["ns"], vars["key"]
+
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "PutObject")
+		defer span.End()
+
+		span.SetTag("ns", ns)
+		span.SetTag("key", key)
+
+		var content io.Reader = r.Body
+		contentType := r.Header.Get("Content-Type")
+		if contentType == "" {
+			var err error
+			contentType, content, err = processes.SniffContentType(r.Body)
+			if err != nil {
+				service.Logger().Error("error in PutObject SniffContentType: ", sl.Err(err))
+				writeError(w, http.StatusBadRequest, models.ErrorCodeBadRequest, "Failed to read object content")
+				span.SetError(err)
+
+				return
+			}
+		}
+
+		object, err := service.PutObject(ctx, ns, key, &models.FileItem{
+			FileContentType: contentType,
+			Content:         content,
+		}, parseIfMatch(r))
+		if err != nil {
+			status, code := objectErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				service.Logger().Error("error in PutObject service.PutObject: ", sl.Err(err))
+				span.SetError(err)
+			}
+			writeError(w, status, code, "error in PutObject: "+err.Error())
+
+			return
+		}
+		span.SetTag("id", object.FileID.String())
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", fmt.Sprintf(`"%s"`, object.Checksum))
+		_ = json.NewEncoder(w).Encode(object)
+	}
+}
+
+func DeleteObject(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation DELETE /api/ns/{ns}/objects/{key} DeleteObject
+	// Delete an object.
+	// ---
+	// description: Deletes the object with the key in the namespace together with its file.
+	//   If versioning is enabled in the namespace, the versions are kept and a delete marker is created instead.
+	// parameters:
+	// - name: ns
+	//   in: path
+	//   description: The name of the namespace.
+	//   required: true
+	//   type: string
+	// - name: key
+	//   in: path
+	//   description: The key of the object.
+	//   required: true
+	//   type: string
+	// - name: If-Match
+	//   in: header
+	//   description: ETag values; the object is deleted only if its ETag is one of them.
+	//   required: false
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK, the ID of the deleted file or, with versioning, the delete marker
+	//     schema:
+	//       "$ref": "#/definitions/ResponseSuccess"
+	//   '202':
+	//     description: Object deleted, some parts are pending deletion and will be retried
+	//     schema:
+	//       "$ref": "#/definitions/ResponsePendingDelete"
+	//   '404':
+	//     description: Namespace or Object Not Found Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '412':
+	//     description: Object does not match If-Match
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ns, key := vars["ns"], vars["key"]
+
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "DeleteObject")
+		defer span.End()
+
+		span.SetTag("ns", ns)
+		span.SetTag("key", key)
+
+		var partialErr *services.PartialDeleteError
+
+		deleted, err := service.DeleteObject(ctx, ns, key, parseIfMatch(r))
+		switch {
+		case err == nil && deleted.DeleteMarker:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(deleted)
+		case err == nil:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(models.ResponseSuccess{
+				ID: deleted.FileID.String(),
+			})
+		case errors.As(err, &partialErr):
+			service.Logger().Warn("DeleteObject: parts are pending deletion", sl.Err(err))
+			span.SetError(err)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(models.ResponsePendingDelete{
+				ID:               deleted.FileID.String(),
+				PendingBucketIDs: partialErr.BucketIDs,
+			})
+		default:
+			status, code := objectErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				service.Logger().Error("error in DeleteObject service.DeleteObject: ", sl.Err(err))
+				span.SetError(err)
+			}
+			writeError(w, status, code, "error in DeleteObject: "+err.Error())
+		}
+	}
+}
+
+func EnableVersioning(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation PUT /api/ns/{ns}/versioning EnableVersioning
+	// Enable object versioning in a namespace.
+	// ---
+	// description: After versioning is enabled, every write of an object creates a new immutable version
+	//   and deleting an object creates a delete marker, the previous versions are kept.
+	//   Versioning cannot be disabled.
+	// parameters:
+	// - name: ns
+	//   in: path
+	//   description: The name of the namespace.
+	//   required: true
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/NamespaceItem"
+	//   '404':
+	//     description: Namespace Not Found Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		ns := mux.Vars(r)["ns"]
+
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "EnableVersioning")
+		defer span.End()
+
+		span.SetTag("ns", ns)
+
+		namespace, err := service.EnableVersioning(ctx, ns)
+		if err != nil {
+			status, code := objectErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				service.Logger().Error("error in EnableVersioning service.EnableVersioning: ", sl.Err(err))
+				span.SetError(err)
+			}
+			writeError(w, status, code, "error in EnableVersioning: "+err.Error())
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(namespace)
+	}
+}
+
+func ListObjectVersions(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation GET /api/ns/{ns}/versions/{key} ListObjectVersions
+	// List versions of an object.
+	// ---
+	// description: Returns the versions of the object with the key, newest first, including delete markers.
+	//   Objects written before versioning was enabled have no versions.
+	// parameters:
+	// - name: ns
+	//   in: path
+	//   description: The name of the namespace.
+	//   required: true
+	//   type: string
+	// - name: key
+	//   in: path
+	//   description: The key of the object.
+	//   required: true
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/ObjectVersionList"
+	//   '404':
+	//     description: Namespace Not Found Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ns, key := vars["ns"], vars["key"]
+
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "ListObjectVersions")
+		defer span.End()
+
+		span.SetTag("ns", ns)
+		span.SetTag("key", key)
+
+		list, err := service.ListObjectVersions(ctx, ns, key)
+		if err != nil {
+			status, code := objectErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				service.Logger().Error("error in ListObjectVersions service.ListObjectVersions: ", sl.Err(err))
+				span.SetError(err)
+			}
+			writeError(w, status, code, "error in ListObjectVersions: "+err.Error())
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(list)
+	}
+}
+
+func RestoreObjectVersion(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation POST /api/ns/{ns}/restore/{key} RestoreObjectVersion
+	// Restore a version of an object.
+	// ---
+	// description: Makes the content of the version the current content of the object by writing it
+	//   as a new version. The content is not copied, the new version refers to the same data.
+	// parameters:
+	// - name: ns
+	//   in: path
+	//   description: The name of the namespace.
+	//   required: true
+	//   type: string
+	// - name: key
+	//   in: path
+	//   description: The key of the object.
+	//   required: true
+	//   type: string
+	// - name: version
+	//   in: query
+	//   description: The ID of the version to restore.
+	//   required: true
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK, ETag is the SHA-256 checksum of the content
+	//     schema:
+	//       "$ref": "#/definitions/ObjectItem"
+	//   '400':
+	//     description: Invalid version ID
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '404':
+	//     description: Namespace or Version Not Found Error, or the version is a delete marker
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ns, key := vars["ns"], vars["key"]
+		versionID := r.URL.Query().Get("version")
+
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "RestoreObjectVersion")
+		defer span.End()
+
+		span.SetTag("ns", ns)
+		span.SetTag("key", key)
+		span.SetTag("version", versionID)
+
+		object, err := service.RestoreObjectVersion(ctx, ns, key, versionID)
+		if err != nil {
+			status, code := objectErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				service.Logger().Error("error in RestoreObjectVersion service.RestoreObjectVersion: ", sl.Err(err))
+				span.SetError(err)
+			}
+			writeError(w, status, code, "error in RestoreObjectVersion: "+err.Error())
+
+			return
+		}
+		span.SetTag("id", object.FileID.String())
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", fmt.Sprintf(`"%s"`, object.Checksum))
+		_ = json.NewEncoder(w).Encode(object)
+	}
+}
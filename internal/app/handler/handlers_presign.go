@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"karma8/internal/app/services"
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/lib/logger/sl"
+	"karma8/internal/lib/monitoring/telemetry"
+	"karma8/internal/lib/presign"
+	"karma8/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxPresignRequestSize - максимальный размер тела запроса на создание подписанной ссылки.
+	maxPresignRequestSize = 4 << 10
+	// presignFormOverhead - допустимый размер тела запроса на загрузку по подписанной ссылке сверх размера файла
+	// (границы и заголовки multipart-формы).
+	presignFormOverhead = 64 << 10
+)
+
+var errFileTooLarge = errors.New("file is larger than allowed by the presigned URL")
+
+type ctxKeyPresigned struct{}
+
+// presignedRequest - запрос по подписанной ссылке; upload - разрешение на загрузку файла (для PUT /api/file).
+type presignedRequest struct {
+	upload *models.PresignedUpload
+}
+
+// presignedFromContext возвращает подписанную ссылку, по которой выполняется запрос.
+func presignedFromContext(ctx context.Context) (presignedRequest, bool) {
+	request, ok := ctx.Value(ctxKeyPresigned{}).(presignedRequest)
+
+	return request, ok
+}
+
+// checkPresigned отклоняет запрос с подписью в параметрах, если подпись не проверена (подписанные ссылки выключены).
+func checkPresigned(w http.ResponseWriter, r *http.Request) bool {
+	if !r.URL.Query().Has(presign.QuerySignature) {
+		return true
+	}
+	if _, ok := presignedFromContext(r.Context()); ok {
+		return true
+	}
+	writeError(w, http.StatusForbidden, models.ErrorCodeForbidden, "presigned URLs are disabled")
+
+	return false
+}
+
+// presignErrorStatus возвращает код ответа и код ошибки для ошибки проверки подписанной ссылки.
+func presignErrorStatus(err error) (int, string) {
+	if errors.Is(err, presign.ErrMalformed) {
+		return http.StatusBadRequest, models.ErrorCodeBadRequest
+	}
+
+	return http.StatusForbidden, models.ErrorCodeForbidden
+}
+
+// PresignedURLs проверяет подписанные ссылки signer: на скачивание файла (GET /api/file/{id}) и на однократную
+// загрузку файла (PUT /api/file). Запрос с верной подписью выполняется без ключа API (см. APIAuth), файл,
+// загруженный по ссылке, записывается за ключом, который её создал.
+func PresignedURLs(service services.IServiceA, signer *presign.Signer) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			if !query.Has(presign.QuerySignature) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var template string
+			if route := mux.CurrentRoute(r); route != nil {
+				template, _ = route.GetPathTemplate()
+			}
+
+			var request presignedRequest
+			switch {
+			case r.Method == http.MethodGet && template == "/api/file/{id}":
+				if err := signer.Verify(http.MethodGet, r.URL.Path, query, time.Now()); err != nil {
+					status, code := presignErrorStatus(err)
+					writeError(w, status, code, err.Error())
+
+					return
+				}
+			case r.Method == http.MethodPut && template == "/api/file":
+				if err := signer.Verify(http.MethodPut, r.URL.Path, query, time.Now()); err != nil {
+					status, code := presignErrorStatus(err)
+					writeError(w, status, code, err.Error())
+
+					return
+				}
+
+				upload, err := service.ConsumePresignedUpload(r.Context(), query.Get(presign.QueryUpload))
+				if errors.Is(err, services.ErrNotFound) {
+					writeError(w, http.StatusForbidden, models.ErrorCodeForbidden, "presigned URL is already used or expired")
+					return
+				}
+				if err != nil {
+					service.Logger().Error("PresignedURLs: ConsumePresignedUpload failed", sl.Err(err))
+					writeError(w, http.StatusInternalServerError, models.ErrorCodeInternal, "error in PresignedURLs")
+
+					return
+				}
+				request.upload = upload
+			default:
+				writeError(w, http.StatusForbidden, models.ErrorCodeForbidden, "request cannot be presigned")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), ctxKeyPresigned{}, request)
+			if request.upload != nil && request.upload.Owner != "" {
+				ctx = trccontext.WithAPIKeyID(ctx, request.upload.Owner)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// decodePresignRequest читает параметры подписанной ссылки из тела запроса; пустое тело - параметры по умолчанию.
+func decodePresignRequest(w http.ResponseWriter, r *http.Request, span telemetry.Span) (*models.PresignRequest, bool) {
+	var request models.PresignRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPresignRequestSize)).Decode(&request)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, models.ErrorCodeBadRequest, "Error parsing presign request: "+err.Error())
+		span.SetError(err)
+
+		return nil, false
+	}
+
+	return &request, true
+}
+
+// requestBaseURL возвращает схему и адрес сервиса, по которым клиент выполнил запрос r.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host
+}
+
+func writePresignedURL(w http.ResponseWriter, presigned *models.PresignedURL) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(presigned)
+}
+
+func PresignFileItem(service services.IServiceA, signer *presign.Signer) http.HandlerFunc {
+	// swagger:operation POST /api/file/{id}/presign PresignFileItem
+	// Create a presigned download URL.
+	// ---
+	// description: Returns a URL of GET /api/file/{id} signed with HMAC-SHA256 that can be used without an API key
+	//   until it expires (15 minutes by default, 7 days at most).
+	// consumes:
+	// - application/json
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: The ID of the file.
+	//   required: true
+	//   type: string
+	// - name: request
+	//   in: body
+	//   description: Lifetime of the URL in seconds (expires_in); the body can be empty.
+	//   required: false
+	//   schema:
+	//     "$ref": "#/definitions/PresignRequest"
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/PresignedURL"
+	//   '400':
+	//     description: Bad User Request Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '403':
+	//     description: API key has no access to the file
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '404':
+	//     description: File Not Found Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "PresignFileItem")
+		defer span.End()
+
+		request, ok := decodePresignRequest(w, r, span)
+		if !ok {
+			return
+		}
+
+		expiresAt, err := services.PresignExpiresAt(request.ExpiresIn, time.Now())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, models.ErrorCodeBadRequest, err.Error())
+			span.SetError(err)
+
+			return
+		}
+
+		metadata, ok := fileMetadata(w, r.WithContext(ctx), service, span, "PresignFileItem")
+		if !ok {
+			return
+		}
+
+		path := "/api/file/" + metadata.UUID.String()
+		query := signer.Query(http.MethodGet, path, "", expiresAt)
+		writePresignedURL(w, &models.PresignedURL{
+			URL:       requestBaseURL(r) + path + "?" + query.Encode(),
+			Method:    http.MethodGet,
+			ExpiresAt: expiresAt,
+		})
+	}
+}
+
+func PresignUpload(service services.IServiceA, signer *presign.Signer) http.HandlerFunc {
+	// swagger:operation POST /api/file/presign PresignUpload
+	// Create a presigned upload URL.
+	// ---
+	// description: Returns a URL of PUT /api/file signed with HMAC-SHA256 that can be used without an API key
+	//   to upload a single file not larger than max_size bytes with the content type content_type (type/subtype
+	//   or type/*, detected from the file content) until it expires. The URL is invalidated by the first upload.
+	// consumes:
+	// - application/json
+	// parameters:
+	// - name: request
+	//   in: body
+	//   description: Lifetime of the URL in seconds and constraints of the file.
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/PresignRequest"
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/PresignedURL"
+	//   '400':
+	//     description: Bad User Request Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "PresignUpload")
+		defer span.End()
+
+		request, ok := decodePresignRequest(w, r, span)
+		if !ok {
+			return
+		}
+
+		upload, err := service.CreatePresignedUpload(ctx, request)
+		if errors.Is(err, services.ErrInvalidPresign) {
+			writeError(w, http.StatusBadRequest, models.ErrorCodeBadRequest, err.Error())
+			span.SetError(err)
+
+			return
+		}
+		if err != nil {
+			service.Logger().Error("error in PresignUpload service.CreatePresignedUpload: ", sl.Err(err))
+			writeError(w, http.StatusInternalServerError, models.ErrorCodeInternal, "error in PresignUpload")
+			span.SetError(err)
+
+			return
+		}
+
+		query := signer.Query(http.MethodPut, "/api/file", upload.ID, upload.ExpiresAt)
+		writePresignedURL(w, &models.PresignedURL{
+			URL:         requestBaseURL(r) + "/api/file?" + query.Encode(),
+			Method:      http.MethodPut,
+			ExpiresAt:   upload.ExpiresAt,
+			MaxSize:     upload.MaxSize,
+			ContentType: upload.ContentType,
+		})
+	}
+}
+
+// limitedFile - содержимое файла, загружаемого по подписанной ссылке: при превышении допустимого размера
+// чтение завершается ошибкой errFileTooLarge.
+type limitedFile struct {
+	reader    io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (f *limitedFile) Read(p []byte) (int, error) {
+	if int64(len(p)) > f.remaining+1 {
+		p = p[:f.remaining+1]
+	}
+
+	n, err := f.reader.Read(p)
+	f.remaining -= int64(n)
+	if f.remaining < 0 {
+		f.exceeded = true
+
+		return n, errFileTooLarge
+	}
+
+	return n, err
+}
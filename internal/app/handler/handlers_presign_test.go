@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"karma8/internal/app/services"
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/lib/presign"
+	"karma8/internal/lib/sigv4"
+	"karma8/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePresignService - сервис A с разрешениями на загрузку в памяти; загруженные файлы читаются целиком.
+type fakePresignService struct {
+	fakeFileService
+
+	uploads map[string]*models.PresignedUpload
+	stored  map[string]string
+}
+
+func (s *fakePresignService) CreatePresignedUpload(ctx context.Context, request *models.PresignRequest) (*models.PresignedUpload, error) {
+	if request.MaxSize <= 0 {
+		return nil, services.ErrInvalidPresign
+	}
+	owner, _ := trccontext.APIKeyIDFromContext(ctx)
+	upload := &models.PresignedUpload{
+		ID:          uuid.NewString(),
+		Owner:       owner,
+		MaxSize:     request.MaxSize,
+		ContentType: request.ContentType,
+		ExpiresAt:   time.Now().Add(time.Minute).UTC().Truncate(time.Second),
+	}
+	s.uploads[upload.ID] = upload
+
+	return upload, nil
+}
+
+func (s *fakePresignService) ConsumePresignedUpload(_ context.Context, id string) (*models.PresignedUpload, error) {
+	upload, ok := s.uploads[id]
+	if !ok {
+		return nil, services.ErrNotFound
+	}
+	delete(s.uploads, id)
+
+	return upload, nil
+}
+
+func (s *fakePresignService) RestorePresignedUpload(_ context.Context, upload *models.PresignedUpload) error {
+	s.uploads[upload.ID] = upload
+
+	return nil
+}
+
+func (s *fakePresignService) PutFileItem(ctx context.Context, source *models.FileItem) (uuid.UUID, error) {
+	data, err := io.ReadAll(source.Content)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	owner, _ := trccontext.APIKeyIDFromContext(ctx)
+	s.stored[string(data)] = owner
+
+	return uuid.New(), nil
+}
+
+func TestPresignedURLs(t *testing.T) {
+	keys := map[string]*models.APIKey{
+		"reader": {ID: "reader", Secret: "reader-secret", Scopes: []string{models.ScopeRead}},
+		"writer": {ID: "writer", Secret: "writer-secret", Scopes: []string{models.ScopeWrite}},
+	}
+	lookup := func(_ context.Context, id string) (*models.APIKey, error) {
+		key, ok := keys[id]
+		if !ok {
+			return nil, sigv4.ErrUnknownAccessKey
+		}
+
+		return key, nil
+	}
+
+	file := &models.MetadataItem{UUID: uuid.New(), Owner: "reader", CreatedAt: time.Now().UTC()}
+	service := &fakePresignService{
+		fakeFileService: fakeFileService{t: t, files: map[uuid.UUID]*models.MetadataItem{file.UUID: file}},
+		uploads:         make(map[string]*models.PresignedUpload),
+		stored:          make(map[string]string),
+	}
+	signer := presign.NewSigner("presign-secret")
+
+	router := mux.NewRouter()
+	router.Use(PresignedURLs(service, signer))
+	router.Use(APIAuth(service, lookup, testRegion))
+	router.HandleFunc("/api/file/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if !checkPresigned(w, r) {
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+	router.HandleFunc("/api/file/{id}", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("DELETE")
+	router.HandleFunc("/api/file/{id}/presign", PresignFileItem(service, signer)).Methods("POST")
+	router.HandleFunc("/api/file/presign", PresignUpload(service, signer)).Methods("POST")
+	router.HandleFunc("/api/file", PutFileItem(service)).Methods("PUT")
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	do := func(method, url, apiKey string, body io.Reader, contentType string) *http.Response {
+		req, err := http.NewRequest(method, url, body)
+		require.NoError(t, err)
+		if apiKey != "" {
+			req.Header.Set(HeaderAPIKey, apiKey)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = resp.Body.Close() })
+
+		return resp
+	}
+	presignURL := func(path, apiKey, body string) models.PresignedURL {
+		resp := do("POST", server.URL+path, apiKey, strings.NewReader(body), "application/json")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var presigned models.PresignedURL
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&presigned))
+
+		return presigned
+	}
+	upload := func(url string, data string) *http.Response {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", "note.txt")
+		require.NoError(t, err)
+		_, err = part.Write([]byte(data))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		return do("PUT", url, "", &body, writer.FormDataContentType())
+	}
+
+	t.Run("download", func(t *testing.T) {
+		// Ссылку на скачивание можно создать с областью read.
+		presigned := presignURL("/api/file/"+file.UUID.String()+"/presign", "reader:reader-secret", "")
+		assert.Equal(t, http.MethodGet, presigned.Method)
+		assert.True(t, strings.HasPrefix(presigned.URL, server.URL+"/api/file/"+file.UUID.String()+"?"))
+		assert.WithinDuration(t, time.Now().Add(services.DefaultPresignTTL), presigned.ExpiresAt, 5*time.Second)
+
+		assert.Equal(t, http.StatusOK, do("GET", presigned.URL, "", nil, "").StatusCode)
+		assert.Equal(t, http.StatusUnauthorized, do("GET", server.URL+"/api/file/"+file.UUID.String(), "", nil, "").StatusCode)
+
+		// Подпись не переносится на другой файл, метод или срок действия.
+		other := strings.Replace(presigned.URL, file.UUID.String(), uuid.NewString(), 1)
+		assert.Equal(t, http.StatusForbidden, do("GET", other, "", nil, "").StatusCode)
+		assert.Equal(t, http.StatusForbidden, do("DELETE", presigned.URL, "", nil, "").StatusCode)
+		extended := strings.Replace(presigned.URL, presign.QueryExpires+"=", presign.QueryExpires+"=9", 1)
+		assert.Equal(t, http.StatusForbidden, do("GET", extended, "", nil, "").StatusCode)
+	})
+
+	t.Run("download of foreign file", func(t *testing.T) {
+		resp := do("POST", server.URL+"/api/file/"+file.UUID.String()+"/presign", "writer:writer-secret", http.NoBody, "")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("invalid expiry", func(t *testing.T) {
+		resp := do("POST", server.URL+"/api/file/"+file.UUID.String()+"/presign", "reader:reader-secret",
+			strings.NewReader(`{"expires_in": 99999999}`), "application/json")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("upload once", func(t *testing.T) {
+		presigned := presignURL("/api/file/presign", "writer:writer-secret", `{"max_size": 64, "content_type": "text/*"}`)
+		assert.Equal(t, http.MethodPut, presigned.Method)
+		assert.Equal(t, int64(64), presigned.MaxSize)
+
+		assert.Equal(t, http.StatusOK, upload(presigned.URL, "first note\n").StatusCode)
+		// Файл записан за ключом, который создал ссылку.
+		assert.Equal(t, "writer", service.stored["first note\n"])
+
+		assert.Equal(t, http.StatusForbidden, upload(presigned.URL, "second note\n").StatusCode)
+	})
+
+	t.Run("upload constraints", func(t *testing.T) {
+		presigned := presignURL("/api/file/presign", "writer:writer-secret", `{"max_size": 8}`)
+		resp := upload(presigned.URL, "more than eight bytes\n")
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+		// Неудачная загрузка не использует разрешение: по ссылке можно загрузить файл ещё раз.
+		assert.Equal(t, http.StatusOK, upload(presigned.URL, "short\n").StatusCode)
+		assert.Equal(t, http.StatusForbidden, upload(presigned.URL, "short\n").StatusCode)
+
+		presigned = presignURL("/api/file/presign", "writer:writer-secret", `{"max_size": 1024, "content_type": "image/*"}`)
+		resp = upload(presigned.URL, "plain text\n")
+		assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+		assert.Len(t, service.uploads, 1)
+
+		resp = do("POST", server.URL+"/api/file/presign", "writer:writer-secret", strings.NewReader(`{}`), "application/json")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestPresignedURLsDisabled(t *testing.T) {
+	id := uuid.New()
+	service := &fakeFileService{t: t, files: map[uuid.UUID]*models.MetadataItem{id: {UUID: id}}}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/file/{id}", GetFileItem(service)).Methods("GET")
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	query := presign.NewSigner("secret").Query(http.MethodGet, "/api/file/"+id.String(), "", time.Now().Add(time.Minute))
+	resp, err := http.Get(server.URL + "/api/file/" + id.String() + "?" + query.Encode())
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
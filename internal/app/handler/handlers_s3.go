@@ -0,0 +1,665 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"karma8/internal/app/processes"
+	"karma8/internal/app/services"
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/lib/logger/sl"
+	"karma8/internal/lib/sigv4"
+	"karma8/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// s3Namespace - пространство имён XML ответов S3.
+	s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+	// s3MaxKeys - максимальное количество записей в ответе ListObjectsV2.
+	s3MaxKeys = 1000
+	// s3TimeFormat - формат времени в XML ответах S3.
+	s3TimeFormat = "2006-01-02T15:04:05.000Z"
+)
+
+// s3Error - ответ S3 об ошибке.
+type s3Error struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// s3Object - объект в ответе ListObjectsV2.
+type s3Object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+// s3CommonPrefix - общий префикс ключей в ответе ListObjectsV2.
+type s3CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// s3ListBucketResult - ответ ListObjectsV2.
+type s3ListBucketResult struct {
+	XMLName               xml.Name         `xml:"ListBucketResult"`
+	Xmlns                 string           `xml:"xmlns,attr"`
+	Name                  string           `xml:"Name"`
+	Prefix                string           `xml:"Prefix"`
+	Delimiter             string           `xml:"Delimiter,omitempty"`
+	MaxKeys               int              `xml:"MaxKeys"`
+	KeyCount              int              `xml:"KeyCount"`
+	IsTruncated           bool             `xml:"IsTruncated"`
+	ContinuationToken     string           `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string           `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string           `xml:"StartAfter,omitempty"`
+	EncodingType          string           `xml:"EncodingType,omitempty"`
+	Contents              []s3Object       `xml:"Contents"`
+	CommonPrefixes        []s3CommonPrefix `xml:"CommonPrefixes"`
+}
+
+// s3LocationConstraint - ответ GetBucketLocation.
+type s3LocationConstraint struct {
+	XMLName  xml.Name `xml:"LocationConstraint"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:",chardata"`
+}
+
+// writeS3Error отправляет ответ об ошибке в формате S3.
+// Для HEAD-запросов тело не отправляется: клиенты S3 определяют ошибку по коду ответа.
+func writeS3Error(w http.ResponseWriter, r *http.Request, status int, code string, message string) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+
+	requestID, _ := trccontext.RequestIDFromContext(r.Context())
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	_, _ = io.WriteString(w, xml.Header)
+	_ = xml.NewEncoder(w).Encode(s3Error{
+		Code:      code,
+		Message:   message,
+		Resource:  r.URL.Path,
+		RequestID: requestID,
+	})
+}
+
+// writeS3XML отправляет успешный ответ S3 с телом value в XML.
+func writeS3XML(w http.ResponseWriter, value any) error {
+	w.Header().Set("Content-Type", "application/xml")
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	return xml.NewEncoder(w).Encode(value)
+}
+
+// s3ErrorStatus возвращает код ответа и код ошибки S3 для ошибки проверки подписи или операции с объектом.
+func s3ErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, sigv4.ErrMissingAuth):
+		return http.StatusForbidden, "AccessDenied"
+	case errors.Is(err, sigv4.ErrMalformed):
+		return http.StatusBadRequest, "AuthorizationHeaderMalformed"
+	case errors.Is(err, sigv4.ErrUnknownAccessKey):
+		return http.StatusForbidden, "InvalidAccessKeyId"
+	case errors.Is(err, sigv4.ErrSignatureMismatch):
+		return http.StatusForbidden, "SignatureDoesNotMatch"
+	case errors.Is(err, sigv4.ErrTimeSkewed):
+		return http.StatusForbidden, "RequestTimeTooSkewed"
+	case errors.Is(err, sigv4.ErrContentSHA256Mismatch):
+		return http.StatusBadRequest, "XAmzContentSHA256Mismatch"
+	case errors.Is(err, sigv4.ErrUnsupportedPayload):
+		return http.StatusNotImplemented, "NotImplemented"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return http.StatusBadRequest, "IncompleteBody"
+	case errors.Is(err, services.ErrInvalidNamespace):
+		return http.StatusBadRequest, "InvalidBucketName"
+	case errors.Is(err, services.ErrInvalidObjectKey):
+		return http.StatusBadRequest, "KeyTooLongError"
+	case errors.Is(err, services.ErrNamespaceExists):
+		return http.StatusConflict, "BucketAlreadyOwnedByYou"
+	case errors.Is(err, services.ErrNamespaceNotFound):
+		return http.StatusNotFound, "NoSuchBucket"
+	case errors.Is(err, services.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed, "PreconditionFailed"
+	case errors.Is(err, services.ErrBucketTimeout), errors.Is(err, services.ErrBucketUnreachable):
+		return http.StatusServiceUnavailable, "ServiceUnavailable"
+	case errors.Is(err, services.ErrCorrupted), errors.Is(err, services.ErrPartNotFound):
+		return http.StatusInternalServerError, "InternalError"
+	case errors.Is(err, services.ErrNotFound):
+		return http.StatusNotFound, "NoSuchKey"
+	default:
+		return http.StatusInternalServerError, "InternalError"
+	}
+}
+
+// RegisterS3Routes регистрирует маршруты S3 API в router (например, в подмаршрутизаторе с префиксом /s3).
+// Бакеты S3 адресуются в пути запроса (path-style): /{bucket} и /{bucket}/{key}; все запросы должны быть
+// подписаны AWS Signature Version 4 для региона region ключом, который возвращает lookup.
+func RegisterS3Routes(router *mux.Router, service services.IServiceA, lookup APIKeyLookup, region string) {
+	router.Use(S3Auth(service, lookup, region))
+
+	router.HandleFunc("/{bucket}", S3CreateBucket(service)).Methods("PUT")
+	router.HandleFunc("/{bucket}", S3HeadBucket(service)).Methods("HEAD")
+	router.HandleFunc("/{bucket}", S3GetBucket(service, region)).Methods("GET")
+	router.HandleFunc("/{bucket}/", S3GetBucket(service, region)).Methods("GET")
+	router.HandleFunc("/{bucket}/{key:.+}", S3PutObject(service)).Methods("PUT")
+	router.HandleFunc("/{bucket}/{key:.+}", S3GetObject(service)).Methods("GET")
+	router.HandleFunc("/{bucket}/{key:.+}", S3HeadObject(service)).Methods("HEAD")
+	router.HandleFunc("/{bucket}/{key:.+}", S3DeleteObject(service)).Methods("DELETE")
+	router.PathPrefix("/").HandlerFunc(S3NotImplemented)
+}
+
+// requiredS3Scope возвращает область действия ключа, которая нужна для запроса r к S3 API:
+// создание бакета (пространства имён) требует области admin, как и в REST API.
+func requiredS3Scope(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil && r.Method == http.MethodPut {
+		if template, err := route.GetPathTemplate(); err == nil && strings.HasSuffix(template, "/{bucket}") {
+			return models.ScopeAdmin
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return models.ScopeRead
+	case http.MethodDelete:
+		return models.ScopeDelete
+	default:
+		return models.ScopeWrite
+	}
+}
+
+// S3Auth проверяет подпись AWS Signature Version 4 запросов к S3 API и права ключа на запрос:
+// область действия и доступ к бакету (пространству имён). Ключ сохраняется в контексте запроса,
+// по нему записывается владелец файлов объектов.
+func S3Auth(service services.IServiceA, lookup APIKeyLookup, region string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var key *models.APIKey
+			verifier := &sigv4.Verifier{
+				Region:  region,
+				Service: "s3",
+				Lookup: func(ctx context.Context, id string) (string, error) {
+					var err error
+					key, err = lookup(ctx, id)
+					if err != nil {
+						return "", err
+					}
+
+					return key.Secret, nil
+				},
+			}
+			if _, err := verifier.Verify(r); err != nil {
+				service.Logger().Warn("S3Auth: request is rejected", sl.Err(err))
+				status, code := s3ErrorStatus(err)
+				writeS3Error(w, r, status, code, err.Error())
+
+				return
+			}
+
+			if scope := requiredS3Scope(r); !key.HasScope(scope) {
+				writeS3Error(w, r, http.StatusForbidden, "AccessDenied", "Access key has no scope "+scope)
+				return
+			}
+			if bucket, ok := mux.Vars(r)["bucket"]; ok && !key.AllowsNamespace(bucket) {
+				writeS3Error(w, r, http.StatusForbidden, "AccessDenied", "Access key has no access to bucket "+bucket)
+				return
+			}
+
+			ctx := trccontext.WithAPIKeyID(r.Context(), key.ID)
+			ctx = context.WithValue(ctx, ctxKeyAPIKey{}, key)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// S3NotImplemented отвечает на запросы к операциям S3, которые не поддерживаются.
+func S3NotImplemented(w http.ResponseWriter, r *http.Request) {
+	writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented", "The requested S3 operation is not implemented")
+}
+
+// S3CreateBucket - операция S3 CreateBucket: создаёт пространство имён объектов.
+// Тело запроса (CreateBucketConfiguration) не используется.
+func S3CreateBucket(service services.IServiceA) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bucket := mux.Vars(r)["bucket"]
+
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "S3CreateBucket")
+		defer span.End()
+
+		span.SetTag("bucket", bucket)
+
+		if _, err := service.CreateNamespace(ctx, bucket); err != nil {
+			status, code := s3ErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				service.Logger().Error("error in S3CreateBucket service.CreateNamespace: ", sl.Err(err))
+				span.SetError(err)
+			}
+			writeS3Error(w, r, status, code, err.Error())
+
+			return
+		}
+
+		w.Header().Set("Location", "/"+bucket)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// S3HeadBucket - операция S3 HeadBucket: проверяет, что пространство имён есть.
+func S3HeadBucket(service services.IServiceA) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bucket := mux.Vars(r)["bucket"]
+
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "S3HeadBucket")
+		defer span.End()
+
+		span.SetTag("bucket", bucket)
+
+		if _, err := service.GetNamespace(ctx, bucket); err != nil {
+			status, code := s3ErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				service.Logger().Error("error in S3HeadBucket service.GetNamespace: ", sl.Err(err))
+				span.SetError(err)
+			}
+			writeS3Error(w, r, status, code, err.Error())
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// S3GetBucket - запросы GET к пространству имён: операции S3 ListObjectsV2 (list-type=2)
+// и GetBucketLocation (location). Остальные операции (в том числе ListObjects первой версии) не поддерживаются.
+func S3GetBucket(service services.IServiceA, region string) http.HandlerFunc {
+	listObjects := s3ListObjectsV2(service)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		switch {
+		case query.Has("location"):
+			if _, err := service.GetNamespace(r.Context(), mux.Vars(r)["bucket"]); err != nil {
+				status, code := s3ErrorStatus(err)
+				writeS3Error(w, r, status, code, err.Error())
+
+				return
+			}
+
+			// Для региона us-east-1 S3 возвращает пустое значение.
+			location := region
+			if location == "us-east-1" {
+				location = ""
+			}
+			_ = writeS3XML(w, s3LocationConstraint{Xmlns: s3Namespace, Location: location})
+		case query.Get("list-type") == "2":
+			listObjects(w, r)
+		default:
+			S3NotImplemented(w, r)
+		}
+	}
+}
+
+// s3ListObjectsV2 - операция S3 ListObjectsV2: список объектов пространства имён
+// с параметрами prefix, delimiter, max-keys, continuation-token, start-after и encoding-type.
+func s3ListObjectsV2(service services.IServiceA) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bucket := mux.Vars(r)["bucket"]
+		query := r.URL.Query()
+
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "S3ListObjectsV2")
+		defer span.End()
+
+		span.SetTag("bucket", bucket)
+
+		maxKeys := s3MaxKeys
+		if value := query.Get("max-keys"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Invalid max-keys")
+
+				return
+			}
+			maxKeys = min(n, s3MaxKeys)
+		}
+
+		encodingType := query.Get("encoding-type")
+		if encodingType != "" && encodingType != "url" {
+			writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Invalid encoding-type")
+
+			return
+		}
+
+		// Продолжение списка - последний ключ или общий префикс предыдущей страницы.
+		after := query.Get("start-after")
+		token := query.Get("continuation-token")
+		if query.Has("continuation-token") {
+			value, err := base64.StdEncoding.DecodeString(token)
+			if err != nil || len(value) == 0 {
+				writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "The continuation token provided is incorrect")
+
+				return
+			}
+			after = string(value)
+		}
+
+		prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+
+		list, err := service.ListObjects(ctx, bucket, prefix, delimiter, after, maxKeys)
+		if err != nil {
+			status, code := s3ErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				service.Logger().Error("error in S3ListObjectsV2 service.ListObjects: ", sl.Err(err))
+				span.SetError(err)
+			}
+			writeS3Error(w, r, status, code, err.Error())
+
+			return
+		}
+
+		encode := func(s string) string {
+			if encodingType == "url" {
+				return sigv4.URIEncode(s, false)
+			}
+			return s
+		}
+
+		result := s3ListBucketResult{
+			Xmlns:             s3Namespace,
+			Name:              bucket,
+			Prefix:            encode(prefix),
+			Delimiter:         encode(delimiter),
+			MaxKeys:           maxKeys,
+			KeyCount:          len(list.Objects) + len(list.CommonPrefixes),
+			IsTruncated:       list.IsTruncated,
+			ContinuationToken: token,
+			StartAfter:        encode(query.Get("start-after")),
+			EncodingType:      encodingType,
+			Contents:          make([]s3Object, 0, len(list.Objects)),
+			CommonPrefixes:    make([]s3CommonPrefix, 0, len(list.CommonPrefixes)),
+		}
+		if list.IsTruncated {
+			result.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(list.NextAfter))
+		}
+		for _, object := range list.Objects {
+			result.Contents = append(result.Contents, s3Object{
+				Key:          encode(object.Key),
+				LastModified: object.UpdatedAt.UTC().Format(s3TimeFormat),
+				ETag:         fmt.Sprintf(`"%s"`, object.Checksum),
+				Size:         object.Size,
+				StorageClass: "STANDARD",
+			})
+		}
+		for _, cp := range list.CommonPrefixes {
+			result.CommonPrefixes = append(result.CommonPrefixes, s3CommonPrefix{Prefix: encode(cp)})
+		}
+
+		if err = writeS3XML(w, result); err != nil {
+			service.Logger().Error("error in S3ListObjectsV2 writeS3XML: ", sl.Err(err))
+			span.SetError(err)
+		}
+	}
+}
+
+// S3PutObject - операция S3 PutObject: сохраняет тело запроса как объект.
+// Если Content-Type не задан, тип содержимого определяется по первым байтам.
+func S3PutObject(service services.IServiceA) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		bucket, key := vars["bucket"], vars["key"]
+
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "S3PutObject")
+		defer span.End()
+
+		span.SetTag("bucket", bucket)
+		span.SetTag("key", key)
+
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			S3NotImplemented(w, r)
+
+			return
+		}
+
+		var content io.Reader = r.Body
+		contentType := r.Header.Get("Content-Type")
+		if contentType == "" {
+			var err error
+			contentType, content, err = processes.SniffContentType(r.Body)
+			if err != nil {
+				status, code := s3ErrorStatus(err)
+				writeS3Error(w, r, status, code, err.Error())
+
+				return
+			}
+		}
+
+		object, err := service.PutObject(ctx, bucket, key, &models.FileItem{
+			FileContentType: contentType,
+			Content:         content,
+		}, parseIfMatch(r))
+		if err != nil {
+			status, code := s3ErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				service.Logger().Error("error in S3PutObject service.PutObject: ", sl.Err(err))
+				span.SetError(err)
+			}
+			writeS3Error(w, r, status, code, err.Error())
+
+			return
+		}
+		span.SetTag("id", object.FileID.String())
+
+		w.Header().Set("ETag", fmt.Sprintf(`"%s"`, object.Checksum))
+		if object.VersionID != "" {
+			w.Header().Set("x-amz-version-id", object.VersionID)
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// setS3ObjectHeaders устанавливает заголовки ответа с метаданными объекта.
+func setS3ObjectHeaders(w http.ResponseWriter, object *models.ObjectItem) {
+	w.Header().Set("Content-Type", object.ContentType)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, object.Checksum))
+	w.Header().Set("Last-Modified", object.UpdatedAt.UTC().Format(http.TimeFormat))
+	if object.VersionID != "" {
+		w.Header().Set("x-amz-version-id", object.VersionID)
+	}
+}
+
+// checkS3Preconditions проверяет условия запроса на чтение объекта (If-Match, If-None-Match, If-Modified-Since).
+// Если объект отдавать не нужно, отправляет ответ 304 или 412 и возвращает false.
+func checkS3Preconditions(w http.ResponseWriter, r *http.Request, object *models.ObjectItem) bool {
+	etag := fmt.Sprintf(`"%s"`, object.Checksum)
+
+	switch checkPreconditions(r, etag, object.UpdatedAt) {
+	case http.StatusNotModified:
+		writeNotModified(w, etag, object.UpdatedAt)
+
+		return false
+	case http.StatusPreconditionFailed:
+		writeS3Error(w, r, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+
+		return false
+	default:
+		return true
+	}
+}
+
+// S3HeadObject - операция S3 HeadObject: метаданные объекта без содержимого.
+func S3HeadObject(service services.IServiceA) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		bucket, key := vars["bucket"], vars["key"]
+
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "S3HeadObject")
+		defer span.End()
+
+		span.SetTag("bucket", bucket)
+		span.SetTag("key", key)
+
+		object, err := service.GetObject(ctx, bucket, key)
+		if err != nil {
+			status, code := s3ErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				service.Logger().Error("error in S3HeadObject service.GetObject: ", sl.Err(err))
+				span.SetError(err)
+			}
+			writeS3Error(w, r, status, code, err.Error())
+
+			return
+		}
+
+		if !checkS3Preconditions(w, r, object) {
+			return
+		}
+
+		setS3ObjectHeaders(w, object)
+		w.Header().Set("Content-Length", strconv.FormatInt(object.Size, 10))
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// S3GetObject - операция S3 GetObject: содержимое объекта потоком; поддерживается один диапазон Range/If-Range.
+func S3GetObject(service services.IServiceA) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		bucket, key := vars["bucket"], vars["key"]
+
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "S3GetObject")
+		defer span.End()
+
+		span.SetTag("bucket", bucket)
+		span.SetTag("key", key)
+
+		object, err := service.GetObject(ctx, bucket, key)
+		if err == nil {
+			var metadata *models.MetadataItem
+			metadata, err = service.GetFileMetadata(ctx, object.FileID)
+			if err == nil {
+				serveS3Object(w, r, service, object, metadata)
+				return
+			}
+		}
+
+		status, code := s3ErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			service.Logger().Error("error in S3GetObject: ", sl.Err(err))
+			span.SetError(err)
+		}
+		writeS3Error(w, r, status, code, err.Error())
+	}
+}
+
+// serveS3Object отправляет содержимое объекта (или запрошенный диапазон) потоком.
+func serveS3Object(
+	w http.ResponseWriter,
+	r *http.Request,
+	service services.IServiceA,
+	object *models.ObjectItem,
+	metadata *models.MetadataItem,
+) {
+	ctx := r.Context()
+	etag := fmt.Sprintf(`"%s"`, metadata.Checksum)
+
+	if !checkS3Preconditions(w, r, object) {
+		return
+	}
+
+	var objectRange *byteRange
+	if checkIfRange(r, etag, object.UpdatedAt) {
+		var err error
+		objectRange, err = parseRange(r.Header.Get("Range"), metadata.Size)
+		if err != nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", metadata.Size))
+			writeS3Error(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+
+			return
+		}
+	}
+
+	offset, length, status := int64(0), metadata.Size, http.StatusOK
+	if objectRange != nil {
+		offset, length, status = objectRange.start, objectRange.length, http.StatusPartialContent
+	}
+
+	reader, err := service.OpenFile(ctx, metadata, offset, length)
+	if err != nil {
+		service.Logger().Error("error in S3GetObject service.OpenFile: ", sl.Err(err))
+		status, code := s3ErrorStatus(err)
+		writeS3Error(w, r, status, code, err.Error())
+
+		return
+	}
+	defer reader.Close()
+
+	setS3ObjectHeaders(w, object)
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	if objectRange != nil {
+		w.Header().Set("Content-Range", objectRange.contentRange(metadata.Size))
+	}
+	w.WriteHeader(status)
+
+	// При ошибке ответ обрывается раньше Content-Length, и клиент не примет его как целый объект.
+	if _, err = io.Copy(w, reader); err != nil {
+		service.Logger().Error("error in S3GetObject io.Copy: ", sl.Err(err))
+	}
+}
+
+// S3DeleteObject - операция S3 DeleteObject: удаляет объект. Как и в S3, удаление отсутствующего объекта успешно.
+func S3DeleteObject(service services.IServiceA) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		bucket, key := vars["bucket"], vars["key"]
+
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "S3DeleteObject")
+		defer span.End()
+
+		span.SetTag("bucket", bucket)
+		span.SetTag("key", key)
+
+		var partialErr *services.PartialDeleteError
+
+		deleted, err := service.DeleteObject(ctx, bucket, key, parseIfMatch(r))
+		switch {
+		case err == nil && deleted.DeleteMarker:
+			w.Header().Set("x-amz-delete-marker", "true")
+			w.Header().Set("x-amz-version-id", deleted.VersionID)
+			w.WriteHeader(http.StatusNoContent)
+		case err == nil, errors.Is(err, services.ErrNotFound):
+			w.WriteHeader(http.StatusNoContent)
+		case errors.As(err, &partialErr):
+			// Объект удалён, оставшиеся части будут удалены повторными попытками.
+			service.Logger().Warn("S3DeleteObject: parts are pending deletion", sl.Err(err))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			status, code := s3ErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				service.Logger().Error("error in S3DeleteObject service.DeleteObject: ", sl.Err(err))
+				span.SetError(err)
+			}
+			writeS3Error(w, r, status, code, err.Error())
+		}
+	}
+}
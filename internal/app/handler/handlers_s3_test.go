@@ -0,0 +1,479 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"karma8/internal/app/services"
+	"karma8/internal/lib/sigv4"
+	"karma8/internal/models"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAccessKey = "test-access-key"
+	testSecretKey = "test-secret-key"
+	testRegion    = "us-east-1"
+)
+
+// fakeObjectService - сервис A с объектами в памяти (без ключей-разделителей в списке).
+type fakeObjectService struct {
+	services.IServiceA
+
+	namespaces map[string]bool
+	objects    map[string]*models.ObjectItem
+	contents   map[uuid.UUID][]byte
+}
+
+func newFakeObjectService() *fakeObjectService {
+	return &fakeObjectService{
+		namespaces: make(map[string]bool),
+		objects:    make(map[string]*models.ObjectItem),
+		contents:   make(map[uuid.UUID][]byte),
+	}
+}
+
+func (s *fakeObjectService) Logger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func (s *fakeObjectService) CreateNamespace(_ context.Context, name string) (*models.NamespaceItem, error) {
+	if s.namespaces[name] {
+		return nil, services.ErrNamespaceExists
+	}
+	s.namespaces[name] = true
+
+	return &models.NamespaceItem{Name: name}, nil
+}
+
+func (s *fakeObjectService) GetNamespace(_ context.Context, name string) (*models.NamespaceItem, error) {
+	if !s.namespaces[name] {
+		return nil, services.ErrNamespaceNotFound
+	}
+
+	return &models.NamespaceItem{Name: name}, nil
+}
+
+func (s *fakeObjectService) PutObject(
+	_ context.Context,
+	namespace, key string,
+	source *models.FileItem,
+	ifMatch models.IfMatch,
+) (*models.ObjectItem, error) {
+	if !s.namespaces[namespace] {
+		return nil, services.ErrNamespaceNotFound
+	}
+
+	var current string
+	if object, ok := s.objects[namespace+"/"+key]; ok {
+		current = object.Checksum
+	}
+	if !ifMatch.Matches(current) {
+		return nil, services.ErrPreconditionFailed
+	}
+
+	data, err := io.ReadAll(source.Content)
+	if err != nil {
+		return nil, err
+	}
+	checksum := sha256.Sum256(data)
+
+	object := &models.ObjectItem{
+		Namespace:   namespace,
+		Key:         key,
+		FileID:      uuid.New(),
+		Size:        int64(len(data)),
+		Checksum:    hex.EncodeToString(checksum[:]),
+		ContentType: source.FileContentType,
+		UpdatedAt:   time.Now().UTC(),
+	}
+	s.objects[namespace+"/"+key] = object
+	s.contents[object.FileID] = data
+
+	return object, nil
+}
+
+func (s *fakeObjectService) GetObject(_ context.Context, namespace, key string) (*models.ObjectItem, error) {
+	if !s.namespaces[namespace] {
+		return nil, services.ErrNamespaceNotFound
+	}
+
+	object, ok := s.objects[namespace+"/"+key]
+	if !ok {
+		return nil, services.ErrNotFound
+	}
+
+	return object, nil
+}
+
+func (s *fakeObjectService) GetFileMetadata(_ context.Context, id uuid.UUID) (*models.MetadataItem, error) {
+	for _, object := range s.objects {
+		if object.FileID == id {
+			return &models.MetadataItem{UUID: id, Checksum: object.Checksum, Size: object.Size}, nil
+		}
+	}
+
+	return nil, services.ErrNotFound
+}
+
+func (s *fakeObjectService) OpenFile(_ context.Context, metadata *models.MetadataItem, offset, length int64) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(s.contents[metadata.UUID][offset : offset+length])), nil
+}
+
+func (s *fakeObjectService) DeleteObject(
+	ctx context.Context,
+	namespace, key string,
+	ifMatch models.IfMatch,
+) (*models.ObjectVersion, error) {
+	object, err := s.GetObject(ctx, namespace, key)
+	if err != nil {
+		return nil, err
+	}
+	if !ifMatch.Matches(object.Checksum) {
+		return nil, services.ErrPreconditionFailed
+	}
+	delete(s.objects, namespace+"/"+key)
+
+	return &models.ObjectVersion{Namespace: namespace, Key: key, FileID: object.FileID}, nil
+}
+
+func (s *fakeObjectService) ListObjects(
+	_ context.Context,
+	namespace, prefix, _, after string,
+	limit int,
+) (*models.ObjectList, error) {
+	if !s.namespaces[namespace] {
+		return nil, services.ErrNamespaceNotFound
+	}
+
+	keys := make([]string, 0)
+	for _, object := range s.objects {
+		if object.Namespace == namespace && strings.HasPrefix(object.Key, prefix) && object.Key > after {
+			keys = append(keys, object.Key)
+		}
+	}
+	sort.Strings(keys)
+
+	list := &models.ObjectList{}
+	for _, key := range keys {
+		if len(list.Objects) == limit {
+			list.IsTruncated = true
+			break
+		}
+		list.Objects = append(list.Objects, s.objects[namespace+"/"+key])
+		list.NextAfter = key
+	}
+
+	return list, nil
+}
+
+// s3Client отправляет подписанные запросы к S3 API тестового сервера.
+// По умолчанию запросы подписываются ключом доступа testAccessKey.
+type s3Client struct {
+	t         *testing.T
+	baseURL   string
+	accessKey string
+	secretKey string
+}
+
+func newS3Server(t *testing.T, service services.IServiceA) *httptest.Server {
+	router := mux.NewRouter()
+	router.SkipClean(true)
+	RegisterS3Routes(router.PathPrefix("/s3").Subrouter(), service, S3Keys(nil, testAccessKey, testSecretKey), testRegion)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func (c *s3Client) do(method, path string, body []byte, header http.Header) *http.Response {
+	req, err := http.NewRequest(method, c.baseURL+path, bytes.NewReader(body))
+	require.NoError(c.t, err)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	accessKey := c.accessKey
+	if accessKey == "" {
+		accessKey = testAccessKey
+	}
+	hash := sha256.Sum256(body)
+	sigv4.Sign(req, accessKey, c.secretKey, testRegion, "s3", time.Now(), hex.EncodeToString(hash[:]))
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(c.t, err)
+	c.t.Cleanup(func() { _ = resp.Body.Close() })
+
+	return resp
+}
+
+func readS3Error(t *testing.T, resp *http.Response) string {
+	var body s3Error
+	require.NoError(t, xml.NewDecoder(resp.Body).Decode(&body))
+
+	return body.Code
+}
+
+func TestS3API(t *testing.T) {
+	server := newS3Server(t, newFakeObjectService())
+	client := &s3Client{t: t, baseURL: server.URL + "/s3", secretKey: testSecretKey}
+
+	content := []byte("hello, s3 object")
+	hash := sha256.Sum256(content)
+	etag := `"` + hex.EncodeToString(hash[:]) + `"`
+	key := "/docs/" + url.PathEscape("hello world.txt")
+
+	// Объект в несуществующем бакете.
+	resp := client.do("PUT", "/photos"+key, content, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "NoSuchBucket", readS3Error(t, resp))
+
+	resp = client.do("PUT", "/photos", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = client.do("PUT", "/photos", nil, nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, "BucketAlreadyOwnedByYou", readS3Error(t, resp))
+
+	resp = client.do("HEAD", "/photos", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = client.do("PUT", "/photos"+key, content, http.Header{"Content-Type": {"text/plain"}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, etag, resp.Header.Get("ETag"))
+
+	resp = client.do("HEAD", "/photos"+key, nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, etag, resp.Header.Get("ETag"))
+	assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	assert.Equal(t, int64(len(content)), resp.ContentLength)
+
+	resp = client.do("GET", "/photos"+key, nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+
+	resp = client.do("GET", "/photos"+key, nil, http.Header{"Range": {"bytes=7-8"}})
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	data, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "s3", string(data))
+
+	resp = client.do("GET", "/photos"+key, nil, http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	// Перезапись с устаревшим ETag отклоняется.
+	resp = client.do("PUT", "/photos"+key, []byte("stale"), http.Header{"If-Match": {`"stale"`}})
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	assert.Equal(t, "PreconditionFailed", readS3Error(t, resp))
+
+	resp = client.do("DELETE", "/photos"+key, nil, http.Header{"If-Match": {`"stale"`}})
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp = client.do("GET", "/photos/docs/missing.txt", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "NoSuchKey", readS3Error(t, resp))
+
+	resp = client.do("PUT", "/photos/docs/second.txt", []byte("second"), nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Первая страница списка с одним объектом и её продолжение.
+	resp = client.do("GET", "/photos?list-type=2&prefix=docs%2F&max-keys=1&encoding-type=url", nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var list s3ListBucketResult
+	require.NoError(t, xml.NewDecoder(resp.Body).Decode(&list))
+	assert.True(t, list.IsTruncated)
+	assert.Equal(t, 1, list.KeyCount)
+	require.Len(t, list.Contents, 1)
+	assert.Equal(t, "docs/hello%20world.txt", list.Contents[0].Key)
+	assert.Equal(t, etag, list.Contents[0].ETag)
+	require.NotEmpty(t, list.NextContinuationToken)
+
+	resp = client.do("GET", "/photos?list-type=2&prefix=docs%2F&continuation-token="+url.QueryEscape(list.NextContinuationToken), nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	list = s3ListBucketResult{}
+	require.NoError(t, xml.NewDecoder(resp.Body).Decode(&list))
+	assert.False(t, list.IsTruncated)
+	require.Len(t, list.Contents, 1)
+	assert.Equal(t, "docs/second.txt", list.Contents[0].Key)
+
+	resp = client.do("DELETE", "/photos"+key, nil, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// Удаление отсутствующего объекта успешно, как в S3.
+	resp = client.do("DELETE", "/photos"+key, nil, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp = client.do("GET", "/photos"+key, nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = client.do("GET", "/photos?versioning", nil, nil)
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+}
+
+func TestS3EmptyObject(t *testing.T) {
+	server := newS3Server(t, newFakeObjectService())
+	client := &s3Client{t: t, baseURL: server.URL + "/s3", secretKey: testSecretKey}
+
+	require.Equal(t, http.StatusOK, client.do("PUT", "/photos", nil, nil).StatusCode)
+
+	// aws-cli и rclone загружают пустые файлы и метки каталогов ("dir/") пустыми объектами.
+	for _, key := range []string{"/empty.txt", "/docs/"} {
+		resp := client.do("PUT", "/photos"+key, nil, nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode, key)
+		assert.Equal(t, `"`+sigv4.EmptyPayloadHash+`"`, resp.Header.Get("ETag"), key)
+
+		resp = client.do("HEAD", "/photos"+key, nil, nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, key)
+		assert.Equal(t, int64(0), resp.ContentLength, key)
+
+		resp = client.do("GET", "/photos"+key, nil, nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, key)
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Empty(t, data, key)
+	}
+}
+
+func TestS3Auth(t *testing.T) {
+	server := newS3Server(t, newFakeObjectService())
+
+	client := &s3Client{t: t, baseURL: server.URL + "/s3", secretKey: "wrong-secret-key"}
+	resp := client.do("PUT", "/photos", nil, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, "SignatureDoesNotMatch", readS3Error(t, resp))
+
+	resp, err := http.Get(server.URL + "/s3/photos?list-type=2")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, "AccessDenied", readS3Error(t, resp))
+
+	// Тело не совпадает с подписанным хешем.
+	client = &s3Client{t: t, baseURL: server.URL + "/s3", secretKey: testSecretKey}
+	require.Equal(t, http.StatusOK, client.do("PUT", "/photos", nil, nil).StatusCode)
+
+	req, err := http.NewRequest("PUT", server.URL+"/s3/photos/key", strings.NewReader("tampered"))
+	require.NoError(t, err)
+	hash := sha256.Sum256([]byte("original"))
+	sigv4.Sign(req, testAccessKey, testSecretKey, testRegion, "s3", time.Now(), hex.EncodeToString(hash[:]))
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "XAmzContentSHA256Mismatch", readS3Error(t, resp))
+}
+
+func TestS3APIKeys(t *testing.T) {
+	keys := map[string]*models.APIKey{
+		"reader": {ID: "reader", Secret: "reader-secret", Scopes: []string{models.ScopeRead}, Namespaces: []string{"photos"}},
+		"writer": {ID: "writer", Secret: "writer-secret", Scopes: []string{models.ScopeRead, models.ScopeWrite}},
+	}
+	lookup := func(_ context.Context, id string) (*models.APIKey, error) {
+		key, ok := keys[id]
+		if !ok {
+			return nil, sigv4.ErrUnknownAccessKey
+		}
+
+		return key, nil
+	}
+
+	service := newFakeObjectService()
+	service.namespaces["photos"] = true
+	service.namespaces["docs"] = true
+	router := mux.NewRouter()
+	RegisterS3Routes(router.PathPrefix("/s3").Subrouter(), service, S3Keys(lookup, testAccessKey, testSecretKey), testRegion)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	admin := &s3Client{t: t, baseURL: server.URL + "/s3", secretKey: testSecretKey}
+	reader := &s3Client{t: t, baseURL: server.URL + "/s3", accessKey: "reader", secretKey: "reader-secret"}
+	writer := &s3Client{t: t, baseURL: server.URL + "/s3", accessKey: "writer", secretKey: "writer-secret"}
+
+	// Ключ без области write не загружает объекты, без области admin - не создаёт бакеты.
+	resp := reader.do("PUT", "/photos/cat.jpg", []byte("cat"), nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, "AccessDenied", readS3Error(t, resp))
+	resp = writer.do("PUT", "/videos", nil, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = writer.do("PUT", "/photos/cat.jpg", []byte("cat"), nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = reader.do("GET", "/photos/cat.jpg", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Ключ с ограниченным списком пространств имён не видит другие бакеты.
+	resp = reader.do("GET", "/docs?list-type=2", nil, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, "AccessDenied", readS3Error(t, resp))
+
+	// Ключ доступа из конфига имеет все права.
+	resp = admin.do("PUT", "/videos", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// TestS3SignedByAWSSDK проверяет запросы, подписанные так же, как их подписывает S3-клиент AWS SDK:
+// путь не экранируется повторно, поэтому "//" и пробелы в ключе попадают в подпись как есть.
+func TestS3SignedByAWSSDK(t *testing.T) {
+	service := newFakeObjectService()
+	service.namespaces["photos"] = true
+	server := newS3Server(t, service)
+
+	signer := v4.NewSigner(func(o *v4.SignerOptions) {
+		o.DisableURIPathEscaping = true
+	})
+	credentials := aws.Credentials{AccessKeyID: testAccessKey, SecretAccessKey: testSecretKey}
+
+	do := func(method, path string, body []byte) *http.Response {
+		req, err := http.NewRequest(method, server.URL+"/s3"+path, bytes.NewReader(body))
+		require.NoError(t, err)
+		hash := sha256.Sum256(body)
+		payloadHash := hex.EncodeToString(hash[:])
+		req.Header.Set(sigv4.HeaderContentSHA256, payloadHash)
+		require.NoError(t, signer.SignHTTP(context.Background(), credentials, req, payloadHash, "s3", testRegion, time.Now()))
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = resp.Body.Close() })
+
+		return resp
+	}
+
+	content := []byte("quarterly report")
+	resp := do("PUT", "/photos/docs//2026%20q3/report%20final.csv", content)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, service.objects, "photos/docs//2026 q3/report final.csv")
+
+	resp = do("GET", "/photos/docs//2026%20q3/report%20final.csv", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+
+	resp = do("GET", "/photos?list-type=2&prefix=docs%2F%2F2026%20q3%2F", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var list s3ListBucketResult
+	require.NoError(t, xml.NewDecoder(resp.Body).Decode(&list))
+	require.Len(t, list.Contents, 1)
+	assert.Equal(t, "docs//2026 q3/report final.csv", list.Contents[0].Key)
+}
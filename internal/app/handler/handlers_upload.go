@@ -0,0 +1,410 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"karma8/internal/app/services"
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/lib/logger/sl"
+	"karma8/internal/lib/monitoring/telemetry"
+	"karma8/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// maxUploadRequestSize - максимальный размер тела запроса на создание загрузки файла по частям.
+const maxUploadRequestSize = 4 << 10
+
+// uploadErrorStatus возвращает код ответа и код ошибки для ошибки загрузки файла по частям.
+func uploadErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidUpload):
+		return http.StatusBadRequest, models.ErrorCodeBadRequest
+	case errors.Is(err, services.ErrUploadCompleting):
+		return http.StatusConflict, models.ErrorCodeConflict
+	default:
+		return fileErrorStatus(err)
+	}
+}
+
+// parseUploadID возвращает ID загрузки из пути запроса; при ошибке отправляет ответ 400.
+func parseUploadID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["uploadId"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, models.ErrorCodeBadRequest, "Error parsing upload ID")
+
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
+
+// accessibleUpload возвращает загрузку с ID из пути запроса, если у ключа запроса есть к ней доступ;
+// при ошибке отправляет ответ об ошибке. name - имя обработчика для журнала.
+func accessibleUpload(
+	w http.ResponseWriter,
+	r *http.Request,
+	service services.IServiceA,
+	span telemetry.Span,
+	name string,
+) (*models.UploadInfo, bool) {
+	id, ok := parseUploadID(w, r)
+	if !ok {
+		return nil, false
+	}
+	span.SetTag("uploadID", id.String())
+
+	upload, err := service.GetUpload(r.Context(), id)
+	if err != nil {
+		status, code := uploadErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			service.Logger().Error("error in "+name+" service.GetUpload: ", sl.Err(err))
+			span.SetError(err)
+		}
+		writeError(w, status, code, "error in "+name+": "+err.Error())
+
+		return nil, false
+	}
+	if !canAccessUpload(r.Context(), upload) {
+		writeError(w, http.StatusForbidden, models.ErrorCodeForbidden, "API key has no access to the upload")
+
+		return nil, false
+	}
+
+	return upload, true
+}
+
+func CreateUpload(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation POST /api/uploads CreateUpload
+	// Initiate a multipart upload.
+	// ---
+	// description: Creates an upload of a file in parts. Parts are uploaded separately and can be re-sent after a failure;
+	//   the upload is assembled into a file on completion. Uploads not changed for 24 hours are aborted.
+	// consumes:
+	// - application/json
+	// parameters:
+	// - name: upload
+	//   in: body
+	//   description: Name and content type of the file. If the content type is empty, it is detected from the file content.
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/CreateUploadRequest"
+	// responses:
+	//   '200':
+	//     description: OK, the ID of the upload
+	//     schema:
+	//       "$ref": "#/definitions/ResponseSuccess"
+	//   '400':
+	//     description: Bad User Request Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "CreateUpload")
+		defer span.End()
+
+		var request models.CreateUploadRequest
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUploadRequestSize)).Decode(&request)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, models.ErrorCodeBadRequest, "Error parsing upload: "+err.Error())
+			span.SetError(err)
+
+			return
+		}
+
+		id, err := service.CreateUpload(ctx, request.FileName, request.ContentType)
+		if err != nil {
+			service.Logger().Error("error in CreateUpload service.CreateUpload: ", sl.Err(err))
+			status, code := uploadErrorStatus(err)
+			writeError(w, status, code, "error in CreateUpload: "+err.Error())
+			span.SetError(err)
+
+			return
+		}
+		span.SetTag("uploadID", id.String())
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(models.ResponseSuccess{
+			ID: id.String(),
+		})
+	}
+}
+
+func GetUpload(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation GET /api/uploads/{uploadId} GetUpload
+	// Get a multipart upload.
+	// ---
+	// description: Returns the upload and its uploaded parts, so that an interrupted upload can be resumed.
+	// parameters:
+	// - name: uploadId
+	//   in: path
+	//   description: The ID of the upload.
+	//   required: true
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/UploadInfo"
+	//   '400':
+	//     description: Bad User Request Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '403':
+	//     description: API key has no access to the upload
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '404':
+	//     description: Upload Not Found Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "GetUpload")
+		defer span.End()
+
+		upload, ok := accessibleUpload(w, r.WithContext(ctx), service, span, "GetUpload")
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(upload)
+	}
+}
+
+func PutUploadPart(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation PUT /api/uploads/{uploadId}/parts/{n} PutUploadPart
+	// Upload a part of a multipart upload.
+	// ---
+	// description: Stores the request body as part n of the upload. A part with the same number replaces the previous one.
+	//   The ETag of the response is the SHA-256 checksum of the part.
+	// consumes:
+	// - application/octet-stream
+	// parameters:
+	// - name: uploadId
+	//   in: path
+	//   description: The ID of the upload.
+	//   required: true
+	//   type: string
+	// - name: n
+	//   in: path
+	//   description: The number of the part, from 1 to 10000. Parts are assembled in ascending order.
+	//   required: true
+	//   type: integer
+	// - name: part
+	//   in: body
+	//   description: Content of the part.
+	//   required: true
+	//   schema:
+	//     type: string
+	//     format: binary
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/UploadPartItem"
+	//   '400':
+	//     description: Bad User Request Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '403':
+	//     description: API key has no access to the upload
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '404':
+	//     description: Upload Not Found Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '409':
+	//     description: The upload is being completed
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "PutUploadPart")
+		defer span.End()
+
+		upload, ok := accessibleUpload(w, r.WithContext(ctx), service, span, "PutUploadPart")
+		if !ok {
+			return
+		}
+		id := upload.ID
+
+		partNumber, err := strconv.Atoi(mux.Vars(r)["n"])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, models.ErrorCodeBadRequest, "Error parsing part number")
+
+			return
+		}
+		span.SetTag("part", strconv.Itoa(partNumber))
+
+		// Тело запроса записывается потоком.
+		part, err := service.PutUploadPart(ctx, id, partNumber, r.Body)
+		if err != nil {
+			status, code := uploadErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				service.Logger().Error("error in PutUploadPart service.PutUploadPart: ", sl.Err(err))
+			}
+			writeError(w, status, code, "error in PutUploadPart: "+err.Error())
+			span.SetError(err)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", fmt.Sprintf(`"%s"`, part.Checksum))
+		_ = json.NewEncoder(w).Encode(part)
+	}
+}
+
+func CompleteUpload(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation POST /api/uploads/{uploadId}/complete CompleteUpload
+	// Complete a multipart upload.
+	// ---
+	// description: Assembles the parts of the upload in ascending order into a file and deletes the upload.
+	//   Part numbers must be consecutive starting from 1. If the file cannot be stored, the upload is kept
+	//   and completion can be retried.
+	// parameters:
+	// - name: uploadId
+	//   in: path
+	//   description: The ID of the upload.
+	//   required: true
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK, the ID of the stored file
+	//     schema:
+	//       "$ref": "#/definitions/ResponseSuccess"
+	//   '400':
+	//     description: Bad User Request Error (no parts or a part is missing)
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '403':
+	//     description: API key has no access to the upload
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '404':
+	//     description: Upload Not Found Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '409':
+	//     description: The upload is already being completed
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '503':
+	//     description: Bucket is unreachable or timed out
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "CompleteUpload")
+		defer span.End()
+
+		upload, ok := accessibleUpload(w, r.WithContext(ctx), service, span, "CompleteUpload")
+		if !ok {
+			return
+		}
+		id := upload.ID
+
+		newID, err := service.CompleteUpload(ctx, id)
+		if err != nil {
+			status, code := uploadErrorStatus(err)
+			if status >= http.StatusInternalServerError {
+				service.Logger().Error("error in CompleteUpload service.CompleteUpload: ", sl.Err(err))
+			}
+			writeError(w, status, code, "error in CompleteUpload: "+err.Error())
+			span.SetError(err)
+
+			return
+		}
+		span.SetTag("id", newID.String())
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(models.ResponseSuccess{
+			ID: newID.String(),
+		})
+	}
+}
+
+func AbortUpload(service services.IServiceA) http.HandlerFunc {
+	// swagger:operation DELETE /api/uploads/{uploadId} AbortUpload
+	// Abort a multipart upload.
+	// ---
+	// description: Deletes the upload and its uploaded parts.
+	// parameters:
+	// - name: uploadId
+	//   in: path
+	//   description: The ID of the upload.
+	//   required: true
+	//   type: string
+	// responses:
+	//   '200':
+	//     description: OK
+	//     schema:
+	//       "$ref": "#/definitions/ResponseSuccess"
+	//   '400':
+	//     description: Bad User Request Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '403':
+	//     description: API key has no access to the upload
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '404':
+	//     description: Upload Not Found Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '409':
+	//     description: The upload is being completed
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	//   '500':
+	//     description: Internal Server Error
+	//     schema:
+	//       "$ref": "#/definitions/ResponseError"
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := trccontext.WithTelemetrySpan(r.Context(), "AbortUpload")
+		defer span.End()
+
+		upload, ok := accessibleUpload(w, r.WithContext(ctx), service, span, "AbortUpload")
+		if !ok {
+			return
+		}
+		id := upload.ID
+
+		err := service.AbortUpload(ctx, id)
+		if err != nil {
+			status, code := uploadErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				service.Logger().Error("error in AbortUpload service.AbortUpload: ", sl.Err(err))
+				span.SetError(err)
+			}
+			writeError(w, status, code, "error in AbortUpload: "+err.Error())
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(models.ResponseSuccess{
+			ID: id.String(),
+		})
+	}
+}
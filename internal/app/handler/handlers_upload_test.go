@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"karma8/internal/app/services"
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/lib/sigv4"
+	"karma8/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeUploadService - сервис A с загрузками файлов по частям в памяти.
+type fakeUploadService struct {
+	fakeFileService
+
+	uploads map[uuid.UUID]*models.UploadInfo
+}
+
+func (s *fakeUploadService) CreateUpload(ctx context.Context, fileName, contentType string) (uuid.UUID, error) {
+	owner, _ := trccontext.APIKeyIDFromContext(ctx)
+	upload := &models.UploadInfo{ID: uuid.New(), FileName: fileName, ContentType: contentType, Owner: owner}
+	s.uploads[upload.ID] = upload
+
+	return upload.ID, nil
+}
+
+func (s *fakeUploadService) GetUpload(_ context.Context, id uuid.UUID) (*models.UploadInfo, error) {
+	upload, ok := s.uploads[id]
+	if !ok {
+		return nil, services.ErrNotFound
+	}
+
+	return upload, nil
+}
+
+func (s *fakeUploadService) PutUploadPart(
+	_ context.Context,
+	id uuid.UUID,
+	partNumber int,
+	source io.Reader,
+) (*models.UploadPartItem, error) {
+	data, err := io.ReadAll(source)
+	if err != nil {
+		return nil, err
+	}
+	part := models.UploadPartItem{PartNumber: partNumber, Size: int64(len(data))}
+	s.uploads[id].Parts = append(s.uploads[id].Parts, part)
+
+	return &part, nil
+}
+
+func (s *fakeUploadService) CompleteUpload(_ context.Context, id uuid.UUID) (uuid.UUID, error) {
+	delete(s.uploads, id)
+
+	return uuid.New(), nil
+}
+
+func (s *fakeUploadService) AbortUpload(_ context.Context, id uuid.UUID) error {
+	delete(s.uploads, id)
+
+	return nil
+}
+
+func TestUploadOwner(t *testing.T) {
+	keys := map[string]*models.APIKey{
+		"admin":  {ID: "admin", Secret: "admin-secret", Scopes: []string{models.ScopeAdmin}},
+		"alice":  {ID: "alice", Secret: "alice-secret", Scopes: []string{models.ScopeRead, models.ScopeWrite, models.ScopeDelete}},
+		"mallet": {ID: "mallet", Secret: "mallet-secret", Scopes: []string{models.ScopeRead, models.ScopeWrite, models.ScopeDelete}},
+	}
+	lookup := func(_ context.Context, id string) (*models.APIKey, error) {
+		key, ok := keys[id]
+		if !ok {
+			return nil, sigv4.ErrUnknownAccessKey
+		}
+
+		return key, nil
+	}
+	service := &fakeUploadService{
+		fakeFileService: fakeFileService{t: t},
+		uploads:         make(map[uuid.UUID]*models.UploadInfo),
+	}
+
+	router := mux.NewRouter()
+	router.Use(APIAuth(service, lookup, testRegion))
+	router.HandleFunc("/api/uploads", CreateUpload(service)).Methods("POST")
+	router.HandleFunc("/api/uploads/{uploadId}", GetUpload(service)).Methods("GET")
+	router.HandleFunc("/api/uploads/{uploadId}", AbortUpload(service)).Methods("DELETE")
+	router.HandleFunc("/api/uploads/{uploadId}/parts/{n}", PutUploadPart(service)).Methods("PUT")
+	router.HandleFunc("/api/uploads/{uploadId}/complete", CompleteUpload(service)).Methods("POST")
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	do := func(method, path, apiKey, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set(HeaderAPIKey, apiKey)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = resp.Body.Close() })
+
+		return resp
+	}
+
+	resp := do("POST", "/api/uploads", "alice:alice-secret", `{"filename": "video.mp4"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var created models.ResponseSuccess
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	path := "/api/uploads/" + created.ID
+
+	// Чужая загрузка недоступна ключу с теми же областями действия.
+	for _, request := range []struct{ method, path, body string }{
+		{"GET", path, ""},
+		{"PUT", path + "/parts/1", "forged part"},
+		{"POST", path + "/complete", ""},
+		{"DELETE", path, ""},
+	} {
+		resp = do(request.method, request.path, "mallet:mallet-secret", request.body)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "%s %s", request.method, request.path)
+	}
+
+	resp = do("PUT", path+"/parts/1", "alice:alice-secret", "part one")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Ключ администратора видит любые загрузки.
+	resp = do("GET", path, "admin:admin-secret", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var upload models.UploadInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&upload))
+	assert.Equal(t, "alice", upload.Owner)
+	assert.Len(t, upload.Parts, 1)
+
+	resp = do("POST", path+"/complete", "alice:alice-secret", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// maxFormValueSize - максимальный размер значения обычного поля формы.
+const maxFormValueSize = 1 << 10
+
+var errFormFileNotFound = errors.New("form file not found")
+
+// formFile - поток файла из multipart-формы и значения полей, переданных до него.
+type formFile struct {
+	*multipart.Part
+	values map[string]string
+}
+
+// readFormFile читает multipart-форму до поля с файлом name.
+// Значения обычных полей, встретившихся до файла, сохраняются, а содержимое файла не читается:
+// его нужно читать из возвращаемого потока.
+func readFormFile(r *http.Request, name string) (*formFile, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, errFormFileNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if part.FormName() == name && part.FileName() != "" {
+			return &formFile{Part: part, values: values}, nil
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, maxFormValueSize))
+		_ = part.Close()
+		if err != nil {
+			return nil, err
+		}
+		values[part.FormName()] = string(value)
+	}
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errInvalidRange = errors.New("invalid range")
+
+// byteRange - диапазон байт файла из заголовка Range.
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+// contentRange возвращает значение заголовка Content-Range для файла размера size.
+func (r *byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// parseRange разбирает заголовок Range для файла размера size.
+// Поддерживается один диапазон: при нескольких диапазонах возвращается nil, и файл отдаётся целиком.
+// Для некорректного заголовка или диапазона за пределами файла возвращается errInvalidRange.
+func parseRange(header string, size int64) (*byteRange, error) {
+	if header == "" {
+		return nil, nil
+	}
+
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil, errInvalidRange
+	}
+	if strings.Contains(spec, ",") {
+		return nil, nil
+	}
+
+	startValue, endValue, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, errInvalidRange
+	}
+	startValue = strings.TrimSpace(startValue)
+	endValue = strings.TrimSpace(endValue)
+
+	// Диапазон вида "-N" - последние N байт файла.
+	if startValue == "" {
+		n, err := strconv.ParseInt(endValue, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, errInvalidRange
+		}
+		n = min(n, size)
+
+		return &byteRange{start: size - n, length: n}, nil
+	}
+
+	start, err := strconv.ParseInt(startValue, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return nil, errInvalidRange
+	}
+
+	end := size - 1
+	if endValue != "" {
+		end, err = strconv.ParseInt(endValue, 10, 64)
+		if err != nil || end < start {
+			return nil, errInvalidRange
+		}
+		end = min(end, size-1)
+	}
+
+	return &byteRange{start: start, length: end - start + 1}, nil
+}
+
+// checkIfRange проверяет условие If-Range: диапазон отдаётся, только если файл не изменился.
+// ETag сравнивается строго, дата - с точностью до секунды.
+func checkIfRange(r *http.Request, etag string, modified time.Time) bool {
+	value := r.Header.Get("If-Range")
+	if value == "" {
+		return true
+	}
+
+	if strings.HasPrefix(value, `"`) {
+		return value == etag
+	}
+	if strings.HasPrefix(value, "W/") {
+		return false
+	}
+
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return false
+	}
+
+	return modified.Truncate(time.Second).Equal(t)
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		size    int64
+		want    *byteRange
+		wantErr error
+	}{
+		{name: "No header", header: "", size: 100, want: nil},
+		{name: "Closed range", header: "bytes=10-19", size: 100, want: &byteRange{start: 10, length: 10}},
+		{name: "Open range", header: "bytes=90-", size: 100, want: &byteRange{start: 90, length: 10}},
+		{name: "Suffix range", header: "bytes=-30", size: 100, want: &byteRange{start: 70, length: 30}},
+		{name: "Suffix longer than file", header: "bytes=-300", size: 100, want: &byteRange{start: 0, length: 100}},
+		{name: "End after file", header: "bytes=50-500", size: 100, want: &byteRange{start: 50, length: 50}},
+		{name: "Multiple ranges", header: "bytes=0-1,5-6", size: 100, want: nil},
+		{name: "Start after file", header: "bytes=100-", size: 100, wantErr: errInvalidRange},
+		{name: "End before start", header: "bytes=20-10", size: 100, wantErr: errInvalidRange},
+		{name: "Other unit", header: "items=1-2", size: 100, wantErr: errInvalidRange},
+		{name: "Empty suffix", header: "bytes=-0", size: 100, wantErr: errInvalidRange},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseRange(tt.header, tt.size)
+			assert.ErrorIs(t, err, tt.wantErr)
+
+			diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(byteRange{}))
+			if diff != "" {
+				t.Fatal("parseRange() mismatch\n", diff)
+			}
+		})
+	}
+}
+
+func TestCheckIfRange(t *testing.T) {
+	modified := time.Date(2023, 11, 28, 10, 20, 30, 500, time.UTC)
+	etag := `"75ea73570e0b8b7558304d292594017afa3ff4deef02e1dad40e8bb81863ac14"`
+
+	tests := []struct {
+		name    string
+		ifRange string
+		want    bool
+	}{
+		{name: "No header", ifRange: "", want: true},
+		{name: "Same ETag", ifRange: etag, want: true},
+		{name: "Other ETag", ifRange: `"other"`, want: false},
+		{name: "Weak ETag", ifRange: "W/" + etag, want: false},
+		{name: "Same date", ifRange: modified.Format(http.TimeFormat), want: true},
+		{name: "Other date", ifRange: modified.Add(-time.Hour).Format(http.TimeFormat), want: false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r, err := http.NewRequest("GET", "/api/file/id", http.NoBody)
+			assert.NoError(t, err)
+			if tt.ifRange != "" {
+				r.Header.Set("If-Range", tt.ifRange)
+			}
+			assert.Equal(t, tt.want, checkIfRange(r, etag, modified))
+		})
+	}
+}
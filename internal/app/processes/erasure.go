@@ -0,0 +1,217 @@
+package processes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/reedsolomon"
+)
+
+// erasureBlockSize - размер блока, которым части файла кодируются и восстанавливаются.
+// Коды Рида-Соломона работают побайтно, поэтому размер блока влияет только на расход памяти.
+const erasureBlockSize = 256 << 10
+
+// ErasureCoding - схема кодирования файла кодом Рида-Соломона:
+// файл делится на DataShards частей с данными, к которым добавляется ParityShards частей чётности.
+// Файл можно восстановить по любым DataShards частям.
+type ErasureCoding struct {
+	DataShards   int
+	ParityShards int
+}
+
+// Shards возвращает общее количество частей файла.
+func (c ErasureCoding) Shards() int {
+	return c.DataShards + c.ParityShards
+}
+
+// Validate проверяет корректность схемы кодирования.
+func (c ErasureCoding) Validate() error {
+	if c.DataShards <= 0 || c.ParityShards < 0 || c.Shards() > 256 {
+		return fmt.Errorf("invalid erasure coding %d+%d", c.DataShards, c.ParityShards)
+	}
+
+	return nil
+}
+
+// ShardSize возвращает размер части чётности (равен размеру самой большой части с данными).
+func (c ErasureCoding) ShardSize(fileSize int64) int64 {
+	return SplitLayout(fileSize, c.DataShards)[0].Length
+}
+
+// Layout возвращает расположение всех частей файла размера fileSize: сначала части с данными
+// (диапазоны файла из SplitLayout), затем части чётности размера ShardSize со смещением 0.
+func (c ErasureCoding) Layout(fileSize int64) []FilePart {
+	layout := SplitLayout(fileSize, c.DataShards)
+	shardSize := layout[0].Length
+	for i := 0; i < c.ParityShards; i++ {
+		layout = append(layout, FilePart{Offset: 0, Length: shardSize})
+	}
+
+	return layout
+}
+
+// EncodeParity вычисляет части чётности файла размера fileSize и записывает их потоком в parity.
+// Части с данными - это диапазоны файла из SplitLayout(fileSize, DataShards); более короткие части
+// при кодировании дополняются нулями. Файл читается блоками, поэтому расход памяти не зависит от его размера.
+func EncodeParity(source io.ReaderAt, fileSize int64, coding ErasureCoding, parity []io.Writer) error {
+	if len(parity) != coding.ParityShards {
+		return errors.New("parity writers count mismatch")
+	}
+	if coding.ParityShards == 0 {
+		return nil
+	}
+
+	enc, err := reedsolomon.New(coding.DataShards, coding.ParityShards)
+	if err != nil {
+		return err
+	}
+
+	layout := SplitLayout(fileSize, coding.DataShards)
+	shardSize := coding.ShardSize(fileSize)
+	buffers := newShardBuffers(coding.Shards(), shardSize)
+	shards := make([][]byte, coding.Shards())
+
+	for offset := int64(0); offset < shardSize; offset += erasureBlockSize {
+		n := min(erasureBlockSize, shardSize-offset)
+
+		for i := range shards {
+			shards[i] = buffers[i][:n]
+		}
+
+		for i, part := range layout {
+			available := max(0, min(n, part.Length-offset))
+			if available > 0 {
+				if _, err = source.ReadAt(shards[i][:available], part.Offset+offset); err != nil {
+					return err
+				}
+			}
+			clear(shards[i][available:])
+		}
+
+		if err = enc.Encode(shards); err != nil {
+			return err
+		}
+
+		for j, writer := range parity {
+			if _, err = writer.Write(shards[coding.DataShards+j]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// shardReader восстанавливает диапазон одной части файла по другим частям.
+type shardReader struct {
+	enc     reedsolomon.Encoder
+	sources []io.Reader
+	index   int
+	data    bool
+
+	buffers [][]byte
+	shards  [][]byte
+
+	remaining int64
+	pending   []byte
+}
+
+// NewShardReader возвращает поток length байт части index, восстановленной по другим частям.
+// sources - потоки остальных частей начиная с того же смещения (по одному на каждую часть схемы);
+// для недоступных частей и самой части index передаётся nil. Потоки частей с данными, которые короче
+// запрошенного диапазона, должны быть дополнены нулями. Нужно не меньше DataShards доступных потоков.
+func NewShardReader(coding ErasureCoding, sources []io.Reader, index int, length int64) (io.Reader, error) {
+	if len(sources) != coding.Shards() || index < 0 || index >= coding.Shards() {
+		return nil, errors.New("invalid shard sources")
+	}
+
+	available := 0
+	for i, source := range sources {
+		if source != nil && i != index {
+			available++
+		}
+	}
+	if available < coding.DataShards {
+		return nil, fmt.Errorf("not enough shards to reconstruct: %d of %d", available, coding.DataShards)
+	}
+
+	enc, err := reedsolomon.New(coding.DataShards, coding.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+
+	sources[index] = nil
+
+	return &shardReader{
+		enc:       enc,
+		sources:   sources,
+		index:     index,
+		data:      index < coding.DataShards,
+		buffers:   newShardBuffers(coding.Shards(), length),
+		shards:    make([][]byte, coding.Shards()),
+		remaining: length,
+	}, nil
+}
+
+func (r *shardReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		if r.remaining == 0 {
+			return 0, io.EOF
+		}
+		if err := r.nextBlock(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+
+	return n, nil
+}
+
+// nextBlock читает следующий блок доступных частей и восстанавливает по нему блок нужной части.
+func (r *shardReader) nextBlock() error {
+	n := min(erasureBlockSize, r.remaining)
+
+	for i, source := range r.sources {
+		if source == nil {
+			r.shards[i] = r.buffers[i][:0]
+			continue
+		}
+
+		r.shards[i] = r.buffers[i][:n]
+		if _, err := io.ReadFull(source, r.shards[i]); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+
+	var err error
+	if r.data {
+		err = r.enc.ReconstructData(r.shards)
+	} else {
+		err = r.enc.Reconstruct(r.shards)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.pending = r.shards[r.index][:n]
+	r.remaining -= n
+
+	return nil
+}
+
+// newShardBuffers возвращает буферы блоков для count частей; для коротких частей буферы меньше блока.
+func newShardBuffers(count int, length int64) [][]byte {
+	size := min(erasureBlockSize, length)
+	buffers := make([][]byte, count)
+	for i := range buffers {
+		buffers[i] = make([]byte, size)
+	}
+
+	return buffers
+}
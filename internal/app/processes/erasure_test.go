@@ -0,0 +1,132 @@
+package processes
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeParityAndReconstruct(t *testing.T) {
+	fixture, err := os.ReadFile(readFixture(t, "Checksum.csv"))
+	require.NoError(t, err)
+
+	large := make([]byte, 2*erasureBlockSize+12345)
+	rand.New(rand.NewSource(1)).Read(large)
+
+	tests := []struct {
+		name   string
+		data   []byte
+		coding ErasureCoding
+	}{
+		{name: "Text file 4+2", data: fixture, coding: ErasureCoding{DataShards: 4, ParityShards: 2}},
+		{name: "Small file 6+3", data: []byte("somedata"), coding: ErasureCoding{DataShards: 6, ParityShards: 3}},
+		{name: "Several blocks 3+2", data: large, coding: ErasureCoding{DataShards: 3, ParityShards: 2}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			shards := encodeShards(t, tt.data, tt.coding)
+			shardSize := tt.coding.ShardSize(int64(len(tt.data)))
+
+			// Теряем по две части и восстанавливаем каждую из них по остальным.
+			for lost1 := 0; lost1 < tt.coding.Shards(); lost1++ {
+				for lost2 := lost1 + 1; lost2 < tt.coding.Shards(); lost2++ {
+					for _, index := range []int{lost1, lost2} {
+						// Восстанавливаем часть с середины, как при запросе диапазона.
+						offset := shardSize / 3
+						length := int64(len(shards[index])) - offset
+
+						sources := make([]io.Reader, tt.coding.Shards())
+						for i, shard := range shards {
+							if i == lost1 || i == lost2 {
+								continue
+							}
+							sources[i] = bytes.NewReader(padShard(shard, shardSize)[offset:])
+						}
+
+						reader, err := NewShardReader(tt.coding, sources, index, length)
+						require.NoError(t, err)
+
+						got, err := io.ReadAll(reader)
+						require.NoError(t, err)
+
+						if !bytes.Equal(shards[index][offset:], got) {
+							t.Fatalf("shard %d mismatch (lost %d, %d)", index, lost1, lost2)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestErasureCodingLayout(t *testing.T) {
+	coding := ErasureCoding{DataShards: 3, ParityShards: 2}
+
+	want := []FilePart{
+		{Offset: 0, Length: 4},
+		{Offset: 4, Length: 4},
+		{Offset: 8, Length: 2},
+		{Offset: 0, Length: 4},
+		{Offset: 0, Length: 4},
+	}
+	assert.Equal(t, want, coding.Layout(10))
+}
+
+func TestNewShardReaderTooFewShards(t *testing.T) {
+	coding := ErasureCoding{DataShards: 4, ParityShards: 2}
+	shards := encodeShards(t, []byte("some data to encode"), coding)
+
+	sources := make([]io.Reader, coding.Shards())
+	for i := 0; i < coding.DataShards-1; i++ {
+		sources[i] = bytes.NewReader(shards[i])
+	}
+
+	_, err := NewShardReader(coding, sources, coding.DataShards, int64(len(shards[coding.DataShards])))
+	assert.EqualError(t, err, "not enough shards to reconstruct: 3 of 4")
+}
+
+// encodeShards возвращает части с данными и части чётности файла.
+func encodeShards(t *testing.T, data []byte, coding ErasureCoding) [][]byte {
+	t.Helper()
+
+	require.NoError(t, coding.Validate())
+
+	shards := make([][]byte, 0, coding.Shards())
+	for _, part := range SplitLayout(int64(len(data)), coding.DataShards) {
+		shards = append(shards, data[part.Offset:part.Offset+part.Length])
+	}
+
+	buffers := make([]*bytes.Buffer, coding.ParityShards)
+	writers := make([]io.Writer, coding.ParityShards)
+	for i := range buffers {
+		buffers[i] = &bytes.Buffer{}
+		writers[i] = buffers[i]
+	}
+
+	err := EncodeParity(bytes.NewReader(data), int64(len(data)), coding, writers)
+	require.NoError(t, err)
+
+	shardSize := coding.ShardSize(int64(len(data)))
+	for _, buffer := range buffers {
+		require.Equal(t, shardSize, int64(buffer.Len()))
+		shards = append(shards, buffer.Bytes())
+	}
+
+	return shards
+}
+
+// padShard дополняет часть нулями до размера shardSize.
+func padShard(shard []byte, shardSize int64) []byte {
+	padded := make([]byte, shardSize)
+	copy(padded, shard)
+
+	return padded
+}
@@ -1,16 +1,22 @@
 package processes
 
 import (
+	"bufio"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 )
 
 const (
 	pathCache = "/cache"
+	// sniffLen - количество байт, по которым определяется тип содержимого (см. http.DetectContentType).
+	sniffLen = 512
+	// pathUploads - каталог частей загрузок файлов по частям (внутри каталога кэша, чтобы переживать перезапуск).
+	pathUploads = "/cache/uploads"
 )
 
 // GetFileNameWithPathCache - возвращает путь к файлу в директории pathCache.
@@ -18,55 +24,157 @@ func GetFileNameWithPathCache(filename string) string {
 	return filepath.Join(".", pathCache, filename)
 }
 
-// ReadFile - читает содержимое файла.
-func ReadFile(filename string) ([]byte, error) {
-	filePath := GetFileNameWithPathCache(filename)
+// WriteFileStream - записывает поток в кэш, вычисляя контрольную сумму на лету.
+// Поток читается один раз, в памяти держится только буфер копирования.
+// Файл сохраняется в кэше под именем, равным его контрольной сумме; результат - контрольная сумма и размер файла.
+func WriteFileStream(source io.Reader) (string, int64, error) {
+	path := filepath.Join(".", pathCache)
+	// Создание директории, если её нет.
+	if err := os.MkdirAll(path, os.ModePerm); err != nil {
+		return "", 0, errors.New("failed to create cache directory")
+	}
 
-	data, err := os.ReadFile(filePath)
+	file, err := os.CreateTemp(path, "upload-*")
 	if err != nil {
-		return nil, err
+		return "", 0, errors.New("failed to create cache file: " + err.Error())
+	}
+	tmpPath := file.Name()
+	defer os.Remove(tmpPath)
+
+	hash := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(file, hash), source)
+	if err != nil {
+		_ = file.Close()
+		return "", 0, errors.New("failed to save file content: " + err.Error())
+	}
+	if err = file.Close(); err != nil {
+		return "", 0, errors.New("failed to save file content: " + err.Error())
 	}
 
-	return data, nil
+	checksum := hex.EncodeToString(hash.Sum(nil))
+
+	err = os.Rename(tmpPath, GetFileNameWithPathCache(checksum))
+	if err != nil {
+		return "", 0, errors.New("failed to save file content: " + err.Error())
+	}
+
+	return checksum, size, nil
 }
 
-// WriteFile - записывает содержимое файла, результат - путь к файлу.
-func WriteFile(fileContent []byte, fileName string) (string, error) {
-	path := filepath.Join(".", pathCache)
+// GetUploadPartPath - возвращает путь к файлу части загрузки в директории pathUploads.
+func GetUploadPartPath(filename string) string {
+	return filepath.Join(".", pathUploads, filename)
+}
+
+// WriteUploadPart - записывает поток части загрузки в директорию pathUploads, вычисляя контрольную сумму на лету.
+// Имя файла начинается с prefix и уникально, поэтому повторная загрузка части не затирает файл, который может читаться.
+// Результат - имя файла, контрольная сумма и размер части.
+func WriteUploadPart(source io.Reader, prefix string) (string, string, int64, error) {
+	path := filepath.Join(".", pathUploads)
 	// Создание директории, если её нет.
 	if err := os.MkdirAll(path, os.ModePerm); err != nil {
-		return "", errors.New("failed to create cache directory")
+		return "", "", 0, errors.New("failed to create uploads directory")
 	}
 
-	// Создание пути для сохранения файла в директории pathCache
-	savePath := filepath.Join(path, fileName)
+	file, err := os.CreateTemp(path, prefix+"-*")
+	if err != nil {
+		return "", "", 0, errors.New("failed to create upload part file: " + err.Error())
+	}
 
-	err := os.WriteFile(savePath, fileContent, os.ModePerm)
+	hash := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(file, hash), source)
+	if err == nil {
+		err = file.Close()
+	} else {
+		_ = file.Close()
+	}
 	if err != nil {
-		return "", errors.New("failed to save file content: " + err.Error())
+		_ = os.Remove(file.Name())
+		return "", "", 0, errors.New("failed to save upload part: " + err.Error())
 	}
 
-	return savePath, nil
+	return filepath.Base(file.Name()), hex.EncodeToString(hash.Sum(nil)), size, nil
 }
 
-// CalculateChecksum - вычисляет контрольную сумму файла.
-func CalculateChecksum(filePath string) (string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", err
+// uploadPartsReader - последовательное чтение файлов частей загрузки; файлы открываются по одному.
+type uploadPartsReader struct {
+	fileNames []string
+	current   *os.File
+}
+
+// OpenUploadParts - открывает на чтение файлы частей загрузки как один поток в заданном порядке.
+func OpenUploadParts(fileNames []string) io.ReadCloser {
+	return &uploadPartsReader{fileNames: fileNames}
+}
+
+func (r *uploadPartsReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.fileNames) == 0 {
+				return 0, io.EOF
+			}
+
+			file, err := os.Open(GetUploadPartPath(r.fileNames[0]))
+			if err != nil {
+				return 0, err
+			}
+			r.current = file
+			r.fileNames = r.fileNames[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if errors.Is(err, io.EOF) {
+			_ = r.current.Close()
+			r.current = nil
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
 	}
-	defer file.Close()
+}
 
-	hash := sha256.New()
+func (r *uploadPartsReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
 
-	if _, err = io.Copy(hash, file); err != nil {
-		return "", err
+	err := r.current.Close()
+	r.current = nil
+
+	return err
+}
+
+// DeleteUploadPart - удаляет файл части загрузки.
+func DeleteUploadPart(filename string) error {
+	err := os.Remove(GetUploadPartPath(filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// SniffContentType - определяет тип содержимого потока по его первым байтам.
+// Возвращает тип и поток, из которого можно прочитать все данные, включая просмотренные.
+func SniffContentType(source io.Reader) (string, io.Reader, error) {
+	buffered := bufio.NewReaderSize(source, sniffLen)
+
+	head, err := buffered.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return "", nil, err
 	}
 
-	hashInBytes := hash.Sum(nil)
-	checksum := hex.EncodeToString(hashInBytes)
+	return http.DetectContentType(head), buffered, nil
+}
+
+// CalculateChecksumBytes - вычисляет контрольную сумму данных в памяти.
+func CalculateChecksumBytes(data []byte) string {
+	hashInBytes := sha256.Sum256(data)
 
-	return checksum, nil
+	return hex.EncodeToString(hashInBytes[:])
 }
 
 // DeleteFile - удаляет файл.
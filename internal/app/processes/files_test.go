@@ -1,6 +1,9 @@
 package processes
 
 import (
+	"bytes"
+	"io"
+	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
@@ -10,7 +13,7 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestCalculateChecksum(t *testing.T) {
+func TestCalculateChecksumBytes(t *testing.T) {
 	tests := []struct {
 		name     string
 		filePath string
@@ -38,21 +41,73 @@ func TestCalculateChecksum(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			path := readFixture(t, tt.filePath)
-			got, err := CalculateChecksum(path)
+			data, err := os.ReadFile(readFixture(t, tt.filePath))
 			assert.NoError(t, err)
+			got := CalculateChecksumBytes(data)
+
 			if tt.wantDiff {
 				assert.NotEqual(t, tt.want, got)
 			} else {
 				diff := cmp.Diff(tt.want, got)
 				if diff != "" {
-					t.Fatal("CalculateChecksum() mismatch\n", diff)
+					t.Fatal("CalculateChecksumBytes() mismatch\n", diff)
 				}
 			}
 		})
 	}
 }
 
+func TestWriteFileStream(t *testing.T) {
+	source, err := os.Open(readFixture(t, "Checksum.csv"))
+	require.NoError(t, err)
+	defer source.Close()
+
+	checksum, size, err := WriteFileStream(source)
+	require.NoError(t, err)
+	defer os.Remove(GetFileNameWithPathCache(checksum))
+
+	assert.Equal(t, "75ea73570e0b8b7558304d292594017afa3ff4deef02e1dad40e8bb81863ac14", checksum)
+	assert.Equal(t, int64(573), size)
+
+	data, err := os.ReadFile(GetFileNameWithPathCache(checksum))
+	require.NoError(t, err)
+	assert.Len(t, data, 573)
+}
+
+func TestUploadParts(t *testing.T) {
+	data, err := os.ReadFile(readFixture(t, "Checksum.csv"))
+	require.NoError(t, err)
+
+	// Делим файл на части, включая пустую.
+	chunks := [][]byte{data[:100], {}, data[100:400], data[400:]}
+	fileNames := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		fileName, checksum, size, err := WriteUploadPart(bytes.NewReader(chunk), "test")
+		require.NoError(t, err)
+		defer DeleteUploadPart(fileName)
+
+		assert.Equal(t, CalculateChecksumBytes(chunk), checksum)
+		assert.Equal(t, int64(len(chunk)), size)
+		fileNames[i] = fileName
+	}
+	assert.NotEqual(t, fileNames[0], fileNames[1])
+
+	reader := OpenUploadParts(fileNames)
+	got, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+
+	diff := cmp.Diff(data, got)
+	if diff != "" {
+		t.Fatal("OpenUploadParts() mismatch\n", diff)
+	}
+
+	// Отсутствующая часть - ошибка чтения.
+	require.NoError(t, DeleteUploadPart(fileNames[2]))
+	_, err = io.ReadAll(OpenUploadParts(fileNames))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
 func readFixture(t *testing.T, name string) string {
 	t.Helper()
 
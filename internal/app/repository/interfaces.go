@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"io"
 
 	"karma8/internal/models"
 
@@ -24,6 +25,7 @@ type IBucketInfo interface {
 }
 
 type IBucket interface {
-	PutBucketItem(ctx context.Context, id string, source []byte) error
-	GetBucketItem(ctx context.Context, id string) ([]byte, error)
+	PutBucketItem(ctx context.Context, id string, source io.Reader) (string, error)
+	GetBucketItem(ctx context.Context, id string) ([]byte, string, error)
+	DeleteBucketItem(ctx context.Context, id string) error
 }
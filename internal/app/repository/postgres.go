@@ -3,7 +3,12 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"karma8/internal/app/processes"
@@ -14,8 +19,32 @@ import (
 	"github.com/lib/pq"
 )
 
+var (
+	// ErrNotFound - запись не найдена в БД.
+	ErrNotFound = errors.New("not found")
+	// ErrManifestChanged - манифест файла изменился, пока выполнялась операция над его частью.
+	ErrManifestChanged = errors.New("manifest changed")
+	// ErrUploadCompleting - загрузка файла по частям уже собирается в файл.
+	ErrUploadCompleting = errors.New("upload is being completed")
+	// ErrAlreadyExists - запись с таким ключом уже есть в БД.
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrNamespaceNotFound - пространство имён не найдено в БД.
+	ErrNamespaceNotFound = errors.New("namespace not found")
+	// ErrPreconditionFailed - текущее содержимое объекта не удовлетворяет условию If-Match.
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+const (
+	// BucketChangedChannel - канал LISTEN/NOTIFY, в который сообщается об изменении списка бакетов.
+	BucketChangedChannel = "bucket_changed"
+	// listenerMinReconnect и listenerMaxReconnect - интервалы переподключения слушателя уведомлений.
+	listenerMinReconnect = 10 * time.Second
+	listenerMaxReconnect = time.Minute
+)
+
 type Storage struct {
-	db *sql.DB
+	db            *sql.DB
+	connectString string
 }
 
 func (s *Storage) Close() error {
@@ -48,7 +77,7 @@ func New(path string) (*Storage, error) {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &Storage{db: db}, nil
+	return &Storage{db: db, connectString: path}, nil
 }
 
 // PutCacheItem сохраняет информацию о файле в кэше в БД.
@@ -81,167 +110,2076 @@ func (s *Storage) GetCacheItem(ctx context.Context, checksum string) string {
 	return fileName
 }
 
-// GetFileMetadata возвращает метаданные файла по UUID.
+// fileColumns - поля файла и его содержимого в порядке, который ожидает scanFile.
+const fileColumns = `f.uuid, b.id, b.checksum, f.filename, f.content_type, COALESCE(f.owner_key, ''),
+	b.bucket_ids, b.manifest, b.size, b.data_shards, b.parity_shards, COALESCE(b.key_id, ''), b.wrapped_key,
+	f.created_at`
+
+// blobColumns - поля таблицы blob в порядке, который ожидает scanBlob.
+const blobColumns = `id, checksum, bucket_ids, manifest, size, data_shards, parity_shards,
+	COALESCE(key_id, ''), wrapped_key, created_at`
+
+// rowScanner - строка результата запроса (*sql.Row или *sql.Rows).
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// GetFileMetadata возвращает метаданные файла по UUID вместе с манифестом его содержимого.
 func (s *Storage) GetFileMetadata(ctx context.Context, id uuid.UUID) (*models.MetadataItem, error) {
-	query := "SELECT * FROM metadata WHERE uuid = $1"
+	query := "SELECT " + fileColumns + " FROM file f JOIN blob b ON b.id = f.blob_id WHERE f.uuid = $1"
 
 	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.GetFileMetadata")
 	defer span.End()
 
-	var item models.MetadataItem
-
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
-		&item.UUID,
-		&item.Checksum,
-		&item.FileName,
-		&item.ContentType,
-		pq.Array(&item.BucketIDs),
-		&item.CreatedAt,
-	)
+	item, err := scanFile(s.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return &item, nil
+	return item, nil
 }
 
-// PutFileMetadata сохраняет метаданные файла в БД - возвращает новый UUID файла.
-func (s *Storage) PutFileMetadata(ctx context.Context, source *models.MetadataItem) (uuid.UUID, error) {
-	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.PutFileMetadata")
-	defer span.End()
+// ListFiles возвращает до limit файлов, отобранных по условиям filter, в порядке filter.Sort
+// (при равных значениях - в порядке UUID). Если after задан, список продолжается после этой позиции.
+// Поле сортировки filter.Sort должно быть проверено вызывающим.
+func (s *Storage) ListFiles(
+	ctx context.Context,
+	filter *models.FileFilter,
+	after *models.FileCursor,
+	limit int,
+) ([]*models.FileInfo, error) {
+	var sortColumn string
+	var afterValue any
+	switch filter.Sort {
+	case models.FileSortFileName:
+		// Имена сравниваются побайтно: так для префиксного поиска и сортировки используется индекс file_filename_idx.
+		sortColumn = `f.filename COLLATE "C"`
+		if after != nil {
+			afterValue = after.FileName
+		}
+	case models.FileSortSize:
+		sortColumn = "b.size"
+		if after != nil {
+			afterValue = after.Size
+		}
+	default:
+		sortColumn = "f.created_at"
+		if after != nil {
+			afterValue = after.CreatedAt
+		}
+	}
 
-	// Генерация нового UUID.
-	newUUID, err := uuid.NewUUID()
-	if err != nil {
-		return uuid.Nil, err
+	conditions := make([]string, 0)
+	args := make([]any, 0)
+	addCondition := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if filter.FileNamePrefix != "" {
+		addCondition(`f.filename COLLATE "C" LIKE ?`, escapeLike(filter.FileNamePrefix)+"%")
+	}
+	if filter.ContentType != "" {
+		addCondition("f.content_type = ?", filter.ContentType)
+	}
+	if !filter.CreatedFrom.IsZero() {
+		addCondition("f.created_at >= ?", filter.CreatedFrom.UTC())
+	}
+	if !filter.CreatedTo.IsZero() {
+		addCondition("f.created_at < ?", filter.CreatedTo.UTC())
+	}
+	if filter.MinSize > 0 {
+		addCondition("b.size >= ?", filter.MinSize)
+	}
+	if filter.MaxSize > 0 {
+		addCondition("b.size <= ?", filter.MaxSize)
+	}
+	if filter.Owner != "" {
+		addCondition("f.owner_key = ?", filter.Owner)
+	}
+
+	order, compare := "ASC", ">"
+	if filter.Desc {
+		order, compare = "DESC", "<"
+	}
+	if after != nil {
+		args = append(args, afterValue, after.UUID)
+		conditions = append(conditions, fmt.Sprintf(
+			"(%s, f.uuid) %s ($%d, $%d)", sortColumn, compare, len(args)-1, len(args),
+		))
 	}
 
-	// Подготовка запроса INSERT
 	query := `
-		INSERT INTO metadata (uuid, checksum, filename, content_type, bucket_ids)
-		VALUES ($1, $2, $3, $4, $5)
-		ON CONFLICT (checksum) DO UPDATE
-		SET uuid = $1, filename = $3, content_type = $4, bucket_ids = $5
-		RETURNING uuid;
+		SELECT f.uuid, f.filename, f.content_type, b.size, b.checksum, f.created_at
+		FROM file f JOIN blob b ON b.id = f.blob_id
 	`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY %s %s, f.uuid %s LIMIT $%d", sortColumn, order, order, len(args))
 
-	// Выполнение запроса
-	err = s.db.QueryRowContext(
-		ctx,
-		query,
-		newUUID,
-		source.Checksum,
-		source.FileName,
-		source.ContentType,
-		pq.Array(source.BucketIDs),
-	).Scan(&newUUID)
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.ListFiles")
+	defer span.End()
 
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return uuid.Nil, err
+		return nil, err
 	}
+	defer rows.Close()
 
-	return newUUID, nil
+	items := make([]*models.FileInfo, 0, limit)
+
+	for rows.Next() {
+		var item models.FileInfo
+
+		err := rows.Scan(&item.UUID, &item.FileName, &item.ContentType, &item.Size, &item.Checksum, &item.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, &item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
 }
 
-// DeleteFileMetadata удаляет метаданные файла по UUID.
-func (s *Storage) DeleteFileMetadata(ctx context.Context, id uuid.UUID) error {
-	query := "DELETE FROM metadata WHERE uuid = $1"
+// GetBlob возвращает содержимое по ID (поля файла в результате не заполнены).
+func (s *Storage) GetBlob(ctx context.Context, id uuid.UUID) (*models.MetadataItem, error) {
+	query := "SELECT " + blobColumns + " FROM blob WHERE id = $1"
 
-	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.DeleteFileMetadata")
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.GetBlob")
 	defer span.End()
 
-	_, err := s.db.ExecContext(ctx, query, id)
+	item, err := scanBlob(s.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return item, nil
 }
 
-// GetBucketsInfo возвращает информацию о всех активных бакетах.
-func (s *Storage) GetBucketsInfo(ctx context.Context) ([]*models.ServerBucketInfo, error) {
-	query := `SELECT id, address FROM bucket WHERE active_sign = true order by id`
+// GetBlobsPage возвращает до limit записей содержимого с ID больше after в порядке ID
+// (поля файла в результате не заполнены). Используется для обхода всего хранимого содержимого страницами.
+func (s *Storage) GetBlobsPage(ctx context.Context, after uuid.UUID, limit int) ([]*models.MetadataItem, error) {
+	query := "SELECT " + blobColumns + " FROM blob WHERE id > $1 ORDER BY id LIMIT $2"
 
-	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.GetBucketsInfo")
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.GetBlobsPage")
 	defer span.End()
 
-	rows, err := s.db.QueryContext(ctx, query)
+	rows, err := s.db.QueryContext(ctx, query, after, limit)
 	if err != nil {
 		return nil, err
 	}
-
 	defer rows.Close()
 
-	buckets := make([]*models.ServerBucketInfo, 0)
+	items := make([]*models.MetadataItem, 0, limit)
 
 	for rows.Next() {
-		var bucket models.ServerBucketInfo
-
-		err = rows.Scan(&bucket.ID, &bucket.Address)
+		item, err := scanBlob(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		buckets = append(buckets, &bucket)
+		items = append(items, item)
 	}
 
-	return buckets, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
 }
 
-// GetExpiredCacheFilenames возвращает информацию о файлах из кэша, которые просрочены.
-func (s *Storage) GetExpiredCacheFilenames(ctx context.Context, current time.Time) ([]models.CacheItem, error) {
-	query := "SELECT filename, checksum FROM cache WHERE expired_at <= $1"
+// GetBlobKeysPage возвращает до limit ключей данных содержимого с ID больше after, зашифрованных
+// не мастер-ключом keyID, в порядке ID содержимого. Содержимое без шифрования не возвращается.
+func (s *Storage) GetBlobKeysPage(ctx context.Context, keyID string, after uuid.UUID, limit int) ([]*models.BlobKey, error) {
+	query := `
+		SELECT id, key_id, wrapped_key FROM blob
+		WHERE key_id IS NOT NULL AND key_id <> $1 AND id > $2
+		ORDER BY id
+		LIMIT $3
+	`
 
-	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.GetExpiredCacheFilenames")
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.GetBlobKeysPage")
 	defer span.End()
 
-	rows, err := s.db.QueryContext(ctx, query, current)
+	rows, err := s.db.QueryContext(ctx, query, keyID, after, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	cacheItems := make([]models.CacheItem, 0)
+	items := make([]*models.BlobKey, 0, limit)
 
 	for rows.Next() {
-		var fileName, checksum string
+		var item models.BlobKey
 
-		if err := rows.Scan(&fileName, &checksum); err != nil {
+		if err := rows.Scan(&item.BlobID, &item.KeyID, &item.WrappedKey); err != nil {
 			return nil, err
 		}
 
-		cacheItems = append(cacheItems, models.CacheItem{
-			Checksum: checksum,
-			FileName: fileName,
-		})
+		items = append(items, &item)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return cacheItems, nil
+	return items, nil
 }
 
-// DeleteExpiredCacheFiles удаляет файлы из кэша, которые просрочены.
-func (s *Storage) DeleteExpiredCacheFiles(ctx context.Context, items []models.CacheItem) error {
-	query := "DELETE FROM cache WHERE checksum = $1"
+// UpdateBlobKey заменяет ключ данных содержимого key.BlobID, зашифрованный мастер-ключом oldKeyID,
+// тем же ключом, зашифрованным мастер-ключом key.KeyID.
+// Если содержимого нет или его ключ уже заменён, возвращается ErrNotFound.
+func (s *Storage) UpdateBlobKey(ctx context.Context, oldKeyID string, key *models.BlobKey) error {
+	query := `UPDATE blob SET key_id = $3, wrapped_key = $4 WHERE id = $1 AND key_id = $2`
 
-	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.DeleteExpiredCacheFiles")
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.UpdateBlobKey")
 	defer span.End()
 
-	for _, item := range items {
-		_, err := s.db.ExecContext(ctx, query, item.Checksum)
-		if err != nil {
-			return err
-		}
+	result, err := s.db.ExecContext(ctx, query, key.BlobID, oldKeyID, key.KeyID, key.WrappedKey)
+	if err != nil {
+		return err
+	}
 
-		// Удаление файла из кэша.
-		err = processes.DeleteFile(item.FileName)
-		if err != nil {
-			return err
-		}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// scanFile читает метаданные файла из строки запроса с полями fileColumns.
+func scanFile(row rowScanner) (*models.MetadataItem, error) {
+	var item models.MetadataItem
+	var manifest []byte
+
+	err := row.Scan(
+		&item.UUID,
+		&item.BlobID,
+		&item.Checksum,
+		&item.FileName,
+		&item.ContentType,
+		&item.Owner,
+		pq.Array(&item.BucketIDs),
+		&manifest,
+		&item.Size,
+		&item.DataShards,
+		&item.ParityShards,
+		&item.KeyID,
+		&item.WrappedKey,
+		&item.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(manifest, &item.Parts); err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// scanBlob читает содержимое из строки запроса с полями blobColumns.
+func scanBlob(row rowScanner) (*models.MetadataItem, error) {
+	var item models.MetadataItem
+	var manifest []byte
+
+	err := row.Scan(
+		&item.BlobID,
+		&item.Checksum,
+		pq.Array(&item.BucketIDs),
+		&manifest,
+		&item.Size,
+		&item.DataShards,
+		&item.ParityShards,
+		&item.KeyID,
+		&item.WrappedKey,
+		&item.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(manifest, &item.Parts); err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// PutFileMetadata сохраняет файл в БД и возвращает его новый UUID.
+// Содержимое хранится один раз для всех файлов с одинаковой контрольной суммой: если оно уже есть,
+// файл ссылается на него (счётчик ссылок увеличивается), а в source записываются ID, манифест
+// и схема кодирования сохранённого содержимого (и его ключ данных). Иначе содержимое создаётся с манифестом из source.
+func (s *Storage) PutFileMetadata(ctx context.Context, source *models.MetadataItem) (uuid.UUID, error) {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.PutFileMetadata")
+	defer span.End()
+
+	// Генерация нового UUID.
+	newUUID, err := uuid.NewUUID()
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	manifest, err := json.Marshal(source.Parts)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := `
+		INSERT INTO blob (
+			id, checksum, bucket_ids, manifest, size, data_shards, parity_shards, key_id, wrapped_key, refcount
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, 1)
+		ON CONFLICT (checksum) DO UPDATE
+		SET refcount = blob.refcount + 1
+		RETURNING id, bucket_ids, manifest, size, data_shards, parity_shards, COALESCE(key_id, ''), wrapped_key;
+	`
+
+	err = tx.QueryRowContext(
+		ctx,
+		query,
+		uuid.New(),
+		source.Checksum,
+		pq.Array(source.BucketIDs),
+		manifest,
+		source.Size,
+		source.DataShards,
+		source.ParityShards,
+		source.KeyID,
+		source.WrappedKey,
+	).Scan(
+		&source.BlobID,
+		pq.Array(&source.BucketIDs),
+		&manifest,
+		&source.Size,
+		&source.DataShards,
+		&source.ParityShards,
+		&source.KeyID,
+		&source.WrappedKey,
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if err = json.Unmarshal(manifest, &source.Parts); err != nil {
+		return uuid.Nil, err
+	}
+
+	query = `
+		INSERT INTO file (uuid, blob_id, filename, content_type, owner_key)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+		RETURNING created_at;
+	`
+
+	err = tx.QueryRowContext(
+		ctx,
+		query,
+		newUUID,
+		source.BlobID,
+		source.FileName,
+		source.ContentType,
+		source.Owner,
+	).Scan(&source.CreatedAt)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return uuid.Nil, err
+	}
+	source.UUID = newUUID
+
+	return newUUID, nil
+}
+
+// PutManifest сохраняет манифест содержимого (например, с контрольными суммами частей после их записи в бакеты).
+// Список бакетов bucket_ids обновляется по манифесту.
+func (s *Storage) PutManifest(ctx context.Context, blobID uuid.UUID, parts []models.PartItem) error {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.PutManifest")
+	defer span.End()
+
+	manifest, err := json.Marshal(parts)
+	if err != nil {
+		return err
+	}
+
+	bucketIDs := make([]int64, 0, len(parts))
+	for _, part := range parts {
+		bucketIDs = append(bucketIDs, part.Locations()...)
+	}
+
+	query := `UPDATE blob SET manifest = $2, bucket_ids = $3 WHERE id = $1`
+
+	result, err := s.db.ExecContext(ctx, query, blobID, manifest, pq.Array(bucketIDs))
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
 	}
 
 	return nil
 }
+
+// MovePart переносит копию части index содержимого из бакета from в бакет to: в одной транзакции меняет бакет копии
+// в манифесте (и bucket_ids), ставит старую копию части в очередь на удаление (таблица pending_delete)
+// и убирает из очереди копию в бакете to, если она там осталась.
+// Если содержимое удалено, возвращает ErrNotFound; если копия части уже не хранится в бакете from - ErrManifestChanged.
+func (s *Storage) MovePart(ctx context.Context, id uuid.UUID, index int, from, to int64) error {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.MovePart")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// Блокируем запись, чтобы манифест не изменился между чтением и обновлением.
+	var manifest []byte
+	err = tx.QueryRowContext(ctx, "SELECT manifest FROM blob WHERE id = $1 FOR UPDATE", id).Scan(&manifest)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var parts []models.PartItem
+	if err = json.Unmarshal(manifest, &parts); err != nil {
+		return err
+	}
+	if index < 0 || index >= len(parts) {
+		return ErrManifestChanged
+	}
+
+	bucketIDs := make([]int64, 0, len(parts))
+	for _, part := range parts {
+		bucketIDs = append(bucketIDs, part.Locations()...)
+	}
+	if slices.Contains(bucketIDs, to) {
+		return ErrManifestChanged
+	}
+
+	part := &parts[index]
+	switch replica := slices.Index(part.Replicas, from); {
+	case part.BucketID == from:
+		part.BucketID = to
+	case replica >= 0:
+		part.Replicas[replica] = to
+	default:
+		return ErrManifestChanged
+	}
+	bucketIDs[slices.Index(bucketIDs, from)] = to
+
+	manifest, err = json.Marshal(parts)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE blob SET manifest = $2, bucket_ids = $3 WHERE id = $1", id, manifest, pq.Array(bucketIDs))
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO pending_delete (blob_id, bucket_id)
+		VALUES ($1, $2)
+		ON CONFLICT (blob_id, bucket_id) DO NOTHING;
+	`
+	if _, err = tx.ExecContext(ctx, query, id, from); err != nil {
+		return err
+	}
+	// Часть могла раньше лежать в бакете to и остаться в очереди на удаление: иначе повторная попытка
+	// удалила бы только что перенесённую копию.
+	if _, err = tx.ExecContext(ctx, deletePendingDeleteQuery, id, to); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// TryLock пытается взять сессионную рекомендательную блокировку Postgres с ключом key.
+// Если блокировка взята, возвращает функцию её освобождения, иначе - nil.
+// Используется, чтобы фоновую задачу выполнял только один экземпляр service_a.
+func (s *Storage) TryLock(ctx context.Context, key int64) (func(), error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var locked bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked)
+	if err != nil || !locked {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key)
+		_ = conn.Close()
+	}, nil
+}
+
+// Lock берёт сессионную рекомендательную блокировку Postgres с ключом key, дожидаясь её освобождения
+// другими сессиями, и возвращает функцию её освобождения.
+// Используется, чтобы одно и то же содержимое записывал в бакеты только один запрос.
+func (s *Storage) Lock(ctx context.Context, key int64) (func(), error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key)
+		_ = conn.Close()
+	}, nil
+}
+
+// DeleteFileMetadata удаляет файл и уменьшает счётчик ссылок на его содержимое.
+// Когда на содержимое больше не ссылается ни один файл, удаляются запись о содержимом и запись в кэше,
+// а части в бакетах ставятся в очередь на удаление (таблица pending_delete) и возвращаются вызывающему.
+// Всё выполняется в одной транзакции, поэтому части не могут остаться без учёта.
+// Возвращает имя файла в кэше (пустая строка, если файла в кэше нет или содержимое ещё используется).
+func (s *Storage) DeleteFileMetadata(ctx context.Context, id uuid.UUID) (string, []models.PendingDeleteItem, error) {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.DeleteFileMetadata")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var blobID uuid.UUID
+	err = tx.QueryRowContext(ctx, "DELETE FROM file WHERE uuid = $1 RETURNING blob_id", id).Scan(&blobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, ErrNotFound
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	var refcount int
+	var checksum string
+	var bucketIDs []int64
+	err = tx.QueryRowContext(
+		ctx,
+		"UPDATE blob SET refcount = refcount - 1 WHERE id = $1 RETURNING refcount, checksum, bucket_ids",
+		blobID,
+	).Scan(&refcount, &checksum, pq.Array(&bucketIDs))
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Содержимое ещё используется другими файлами.
+	if refcount > 0 {
+		return "", nil, tx.Commit()
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM blob WHERE id = $1", blobID); err != nil {
+		return "", nil, err
+	}
+
+	var fileName string
+	err = tx.QueryRowContext(ctx, "DELETE FROM cache WHERE checksum = $1 RETURNING filename", checksum).Scan(&fileName)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", nil, err
+	}
+
+	query := `
+		INSERT INTO pending_delete (blob_id, bucket_id)
+		VALUES ($1, $2)
+		ON CONFLICT (blob_id, bucket_id) DO NOTHING;
+	`
+	items := make([]models.PendingDeleteItem, 0, len(bucketIDs))
+	for _, bucketID := range bucketIDs {
+		_, err = tx.ExecContext(ctx, query, blobID, bucketID)
+		if err != nil {
+			return "", nil, err
+		}
+		items = append(items, models.PendingDeleteItem{BlobID: blobID, BucketID: bucketID})
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", nil, err
+	}
+
+	return fileName, items, nil
+}
+
+// GetPendingDeletes возвращает части файлов, время повторной попытки удаления которых наступило.
+func (s *Storage) GetPendingDeletes(ctx context.Context, current time.Time, limit int) ([]models.PendingDeleteItem, error) {
+	query := `
+		SELECT blob_id, bucket_id, attempts, last_error, next_attempt_at
+		FROM pending_delete
+		WHERE next_attempt_at <= $1
+		ORDER BY next_attempt_at
+		LIMIT $2
+	`
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.GetPendingDeletes")
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, current, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]models.PendingDeleteItem, 0)
+
+	for rows.Next() {
+		var item models.PendingDeleteItem
+
+		err = rows.Scan(&item.BlobID, &item.BucketID, &item.Attempts, &item.LastError, &item.NextAttemptAt)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// UpdatePendingDelete сохраняет результат неудачной попытки удаления части файла.
+func (s *Storage) UpdatePendingDelete(ctx context.Context, item *models.PendingDeleteItem) error {
+	query := `
+		UPDATE pending_delete
+		SET attempts = $3, last_error = $4, next_attempt_at = $5
+		WHERE blob_id = $1 AND bucket_id = $2
+	`
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.UpdatePendingDelete")
+	defer span.End()
+
+	_, err := s.db.ExecContext(ctx, query, item.BlobID, item.BucketID, item.Attempts, item.LastError, item.NextAttemptAt)
+
+	return err
+}
+
+// deletePendingDeleteQuery убирает часть содержимого из очереди на удаление.
+const deletePendingDeleteQuery = "DELETE FROM pending_delete WHERE blob_id = $1 AND bucket_id = $2"
+
+// DeletePendingDelete убирает часть содержимого из очереди на удаление: после успешного удаления части
+// или перед повторной записью части в тот же бакет.
+func (s *Storage) DeletePendingDelete(ctx context.Context, blobID uuid.UUID, bucketID int64) error {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.DeletePendingDelete")
+	defer span.End()
+
+	_, err := s.db.ExecContext(ctx, deletePendingDeleteQuery, blobID, bucketID)
+
+	return err
+}
+
+// GetBucketsInfo возвращает информацию о всех активных бакетах.
+func (s *Storage) GetBucketsInfo(ctx context.Context) ([]*models.ServerBucketInfo, error) {
+	query := `SELECT id, address FROM bucket WHERE active_sign = true order by id`
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.GetBucketsInfo")
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	buckets := make([]*models.ServerBucketInfo, 0)
+
+	for rows.Next() {
+		var bucket models.ServerBucketInfo
+
+		err = rows.Scan(&bucket.ID, &bucket.Address)
+		if err != nil {
+			return nil, err
+		}
+
+		buckets = append(buckets, &bucket)
+	}
+
+	return buckets, nil
+}
+
+// PutBucket добавляет бакет (или обновляет адрес и активирует существующий)
+// и уведомляет об изменении списка бакетов через канал BucketChangedChannel.
+func (s *Storage) PutBucket(ctx context.Context, item *models.ServerBucketInfo) error {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.PutBucket")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO bucket (id, address, active_sign)
+		VALUES ($1, $2, true)
+		ON CONFLICT (id) DO UPDATE
+		SET address = EXCLUDED.address, active_sign = true
+	`
+	if _, err = tx.ExecContext(ctx, query, item.ID, item.Address); err != nil {
+		return err
+	}
+
+	// Уведомление доставляется слушателям после фиксации транзакции.
+	if _, err = tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, BucketChangedChannel, strconv.FormatInt(item.ID, 10)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// NewBucketListener возвращает слушателя уведомлений об изменении списка бакетов.
+// Уведомления приходят в канал Notify; после переподключения в него приходит nil.
+func (s *Storage) NewBucketListener() (*pq.Listener, error) {
+	listener := pq.NewListener(s.connectString, listenerMinReconnect, listenerMaxReconnect, nil)
+	if err := listener.Listen(BucketChangedChannel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// GetExpiredCacheFilenames возвращает информацию о файлах из кэша, которые просрочены.
+func (s *Storage) GetExpiredCacheFilenames(ctx context.Context, current time.Time) ([]models.CacheItem, error) {
+	query := "SELECT filename, checksum FROM cache WHERE expired_at <= $1"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.GetExpiredCacheFilenames")
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, current)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cacheItems := make([]models.CacheItem, 0)
+
+	for rows.Next() {
+		var fileName, checksum string
+
+		if err := rows.Scan(&fileName, &checksum); err != nil {
+			return nil, err
+		}
+
+		cacheItems = append(cacheItems, models.CacheItem{
+			Checksum: checksum,
+			FileName: fileName,
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cacheItems, nil
+}
+
+// DeleteExpiredCacheFiles удаляет файлы из кэша, которые просрочены.
+func (s *Storage) DeleteExpiredCacheFiles(ctx context.Context, items []models.CacheItem) error {
+	query := "DELETE FROM cache WHERE checksum = $1"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.DeleteExpiredCacheFiles")
+	defer span.End()
+
+	for _, item := range items {
+		_, err := s.db.ExecContext(ctx, query, item.Checksum)
+		if err != nil {
+			return err
+		}
+
+		// Удаление файла из кэша.
+		err = processes.DeleteFile(item.FileName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateUpload создаёт загрузку файла по частям и возвращает её новый UUID.
+func (s *Storage) CreateUpload(ctx context.Context, source *models.UploadInfo) (uuid.UUID, error) {
+	query := `
+		INSERT INTO upload (id, filename, content_type, owner_key)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		RETURNING created_at, updated_at;
+	`
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.CreateUpload")
+	defer span.End()
+
+	newUUID, err := uuid.NewUUID()
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	err = s.db.QueryRowContext(ctx, query, newUUID, source.FileName, source.ContentType, source.Owner).
+		Scan(&source.CreatedAt, &source.UpdatedAt)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	source.ID = newUUID
+
+	return newUUID, nil
+}
+
+// GetUpload возвращает загрузку файла по частям и её части в порядке номеров.
+func (s *Storage) GetUpload(ctx context.Context, id uuid.UUID) (*models.UploadInfo, error) {
+	query := `
+		SELECT id, filename, content_type, COALESCE(owner_key, ''), completing, created_at, updated_at
+		FROM upload
+		WHERE id = $1
+	`
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.GetUpload")
+	defer span.End()
+
+	var item models.UploadInfo
+
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&item.ID,
+		&item.FileName,
+		&item.ContentType,
+		&item.Owner,
+		&item.Completing,
+		&item.CreatedAt,
+		&item.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	item.Parts, err = s.getUploadParts(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// getUploadParts возвращает части загрузки в порядке номеров.
+func (s *Storage) getUploadParts(ctx context.Context, uploadID uuid.UUID) ([]models.UploadPartItem, error) {
+	query := `
+		SELECT part_number, size, checksum, filename
+		FROM upload_part
+		WHERE upload_id = $1
+		ORDER BY part_number
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parts := make([]models.UploadPartItem, 0)
+
+	for rows.Next() {
+		var part models.UploadPartItem
+
+		if err := rows.Scan(&part.PartNumber, &part.Size, &part.Checksum, &part.FileName); err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, part)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return parts, nil
+}
+
+// lockUpload блокирует запись загрузки до конца транзакции и возвращает ErrNotFound, если загрузки нет,
+// или ErrUploadCompleting, если загрузка собирается в файл.
+func lockUpload(ctx context.Context, tx *sql.Tx, id uuid.UUID) error {
+	var completing bool
+
+	err := tx.QueryRowContext(ctx, "SELECT completing FROM upload WHERE id = $1 FOR NO KEY UPDATE", id).Scan(&completing)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if completing {
+		return ErrUploadCompleting
+	}
+
+	return nil
+}
+
+// PutUploadPart сохраняет часть загрузки. Если часть с таким номером уже была загружена, она заменяется,
+// и возвращается имя файла заменённой части (его нужно удалить), иначе - пустая строка.
+// Части нельзя менять, пока загрузка собирается в файл (ErrUploadCompleting).
+func (s *Storage) PutUploadPart(ctx context.Context, uploadID uuid.UUID, part *models.UploadPartItem) (string, error) {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.PutUploadPart")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err = lockUpload(ctx, tx, uploadID); err != nil {
+		return "", err
+	}
+
+	var oldFileName string
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT filename FROM upload_part WHERE upload_id = $1 AND part_number = $2",
+		uploadID,
+		part.PartNumber,
+	).Scan(&oldFileName)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	query := `
+		INSERT INTO upload_part (upload_id, part_number, size, checksum, filename)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (upload_id, part_number) DO UPDATE
+		SET size = EXCLUDED.size, checksum = EXCLUDED.checksum, filename = EXCLUDED.filename,
+			created_at = timezone('utc'::text, now());
+	`
+
+	_, err = tx.ExecContext(ctx, query, uploadID, part.PartNumber, part.Size, part.Checksum, part.FileName)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE upload SET updated_at = timezone('utc'::text, now()) WHERE id = $1", uploadID)
+	if err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return oldFileName, nil
+}
+
+// StartCompleteUpload отмечает, что загрузка собирается в файл, и возвращает её вместе с частями.
+// Пока отметка не снята (CancelCompleteUpload) или загрузка не удалена, части нельзя менять,
+// а повторная сборка возвращает ErrUploadCompleting.
+func (s *Storage) StartCompleteUpload(ctx context.Context, id uuid.UUID) (*models.UploadInfo, error) {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.StartCompleteUpload")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err = lockUpload(ctx, tx, id); err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE upload
+		SET completing = true, updated_at = timezone('utc'::text, now())
+		WHERE id = $1
+	`
+
+	if _, err = tx.ExecContext(ctx, query, id); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetUpload(ctx, id)
+}
+
+// CancelCompleteUpload снимает отметку о сборке загрузки в файл, например, если сборка не удалась:
+// загрузку можно продолжить или собрать повторно.
+func (s *Storage) CancelCompleteUpload(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE upload
+		SET completing = false, updated_at = timezone('utc'::text, now())
+		WHERE id = $1
+	`
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.CancelCompleteUpload")
+	defer span.End()
+
+	_, err := s.db.ExecContext(ctx, query, id)
+
+	return err
+}
+
+// DeleteUpload удаляет загрузку и её части и возвращает имена файлов частей (их нужно удалить).
+// completing - собирается ли загрузка в файл: прервать можно только загрузку, которая не собирается
+// (иначе ErrUploadCompleting), а после сборки удаляется загрузка с отметкой о сборке.
+func (s *Storage) DeleteUpload(ctx context.Context, id uuid.UUID, completing bool) ([]string, error) {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.DeleteUpload")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var current bool
+	err = tx.QueryRowContext(ctx, "SELECT completing FROM upload WHERE id = $1 FOR UPDATE", id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if current && !completing {
+		return nil, ErrUploadCompleting
+	}
+
+	fileNames, err := deleteUploads(ctx, tx, []uuid.UUID{id})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return fileNames, nil
+}
+
+// DeleteExpiredUploads удаляет загрузки, которые не менялись с момента before, вместе с их частями
+// и возвращает имена файлов частей (их нужно удалить).
+func (s *Storage) DeleteExpiredUploads(ctx context.Context, before time.Time) ([]string, error) {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.DeleteExpiredUploads")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// Загрузки, части которых сейчас сохраняются, пропускаем.
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM upload WHERE updated_at <= $1 FOR UPDATE SKIP LOCKED", before)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	fileNames, err := deleteUploads(ctx, tx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return fileNames, nil
+}
+
+// deleteUploads удаляет загрузки ids вместе с частями в транзакции tx и возвращает имена файлов частей.
+func deleteUploads(ctx context.Context, tx *sql.Tx, ids []uuid.UUID) ([]string, error) {
+	fileNames := make([]string, 0)
+	if len(ids) == 0 {
+		return fileNames, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, "DELETE FROM upload_part WHERE upload_id = ANY($1) RETURNING filename", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var fileName string
+		if err = rows.Scan(&fileName); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		fileNames = append(fileNames, fileName)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM upload WHERE id = ANY($1)", pq.Array(ids)); err != nil {
+		return nil, err
+	}
+
+	return fileNames, nil
+}
+
+// CreateNamespace создаёт пространство имён или возвращает ErrAlreadyExists, если оно уже есть.
+func (s *Storage) CreateNamespace(ctx context.Context, item *models.NamespaceItem) error {
+	query := `
+		INSERT INTO namespace (name)
+		VALUES ($1)
+		ON CONFLICT (name) DO NOTHING
+		RETURNING versioning, created_at;
+	`
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.CreateNamespace")
+	defer span.End()
+
+	err := s.db.QueryRowContext(ctx, query, item.Name).Scan(&item.Versioning, &item.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAlreadyExists
+	}
+
+	return err
+}
+
+// GetNamespace возвращает пространство имён или ErrNamespaceNotFound.
+func (s *Storage) GetNamespace(ctx context.Context, name string) (*models.NamespaceItem, error) {
+	query := "SELECT name, versioning, created_at FROM namespace WHERE name = $1"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.GetNamespace")
+	defer span.End()
+
+	var item models.NamespaceItem
+
+	err := s.db.QueryRowContext(ctx, query, name).Scan(&item.Name, &item.Versioning, &item.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNamespaceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// EnableVersioning включает версионирование пространства имён name и возвращает его.
+// Текущее содержимое объектов, записанных без версионирования, сохраняется их первыми версиями.
+// Если пространства имён нет, возвращается ErrNamespaceNotFound.
+func (s *Storage) EnableVersioning(ctx context.Context, name string) (*models.NamespaceItem, error) {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.EnableVersioning")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// Блокировка записи пространства имён ждёт завершения одновременных записей объектов (FOR SHARE в PutObject).
+	var item models.NamespaceItem
+	err = tx.QueryRowContext(
+		ctx,
+		"UPDATE namespace SET versioning = true WHERE name = $1 RETURNING name, versioning, created_at",
+		name,
+	).Scan(&item.Name, &item.Versioning, &item.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNamespaceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO object_version (id, namespace, key, file_uuid, created_at)
+		SELECT gen_random_uuid(), o.namespace, o.key, o.file_uuid, o.updated_at
+		FROM object o
+		WHERE o.namespace = $1 AND NOT EXISTS (SELECT 1 FROM object_version v WHERE v.file_uuid = o.file_uuid)
+		ORDER BY o.key;
+	`
+	if _, err = tx.ExecContext(ctx, query, name); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// lockNamespace блокирует пространство имён до конца транзакции и сообщает, включено ли в нём версионирование.
+// Блокировка не даёт удалить пространство имён или включить версионирование, пока меняются его объекты.
+func lockNamespace(ctx context.Context, tx *sql.Tx, name string) (bool, error) {
+	var versioning bool
+
+	err := tx.QueryRowContext(ctx, "SELECT versioning FROM namespace WHERE name = $1 FOR SHARE", name).Scan(&versioning)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrNamespaceNotFound
+	}
+
+	return versioning, err
+}
+
+// insertObjectVersion добавляет версию объекта с файлом fileID (uuid.Nil - маркер удаления) и возвращает её ID.
+func insertObjectVersion(
+	ctx context.Context,
+	tx *sql.Tx,
+	namespace, key string,
+	fileID uuid.UUID,
+	createdAt time.Time,
+) (string, error) {
+	var file any
+	if fileID != uuid.Nil {
+		file = fileID
+	}
+
+	id := uuid.New()
+	query := `
+		INSERT INTO object_version (id, namespace, key, file_uuid, created_at)
+		VALUES ($1, $2, $3, $4, $5);
+	`
+	if _, err := tx.ExecContext(ctx, query, id, namespace, key, file, createdAt); err != nil {
+		return "", err
+	}
+
+	return id.String(), nil
+}
+
+// objectColumns - поля объекта и его содержимого в порядке, который ожидает scanObject.
+const objectColumns = "o.namespace, o.key, o.file_uuid, COALESCE(v.id::text, ''), b.size, b.checksum, f.content_type, o.updated_at"
+
+// objectTables - таблицы объекта и его содержимого для запросов с полями objectColumns.
+const objectTables = "object o JOIN file f ON f.uuid = o.file_uuid JOIN blob b ON b.id = f.blob_id " +
+	"LEFT JOIN object_version v ON v.file_uuid = o.file_uuid"
+
+// scanObject читает объект из строки запроса с полями objectColumns.
+func scanObject(row rowScanner) (*models.ObjectItem, error) {
+	var item models.ObjectItem
+
+	err := row.Scan(
+		&item.Namespace,
+		&item.Key,
+		&item.FileID,
+		&item.VersionID,
+		&item.Size,
+		&item.Checksum,
+		&item.ContentType,
+		&item.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// PutObject связывает ключ source.Key в пространстве имён source.Namespace с файлом source.FileID
+// и записывает в source время изменения. Если ключ уже был связан с другим файлом, возвращается UUID
+// этого файла (его нужно удалить), иначе - uuid.Nil. Если в пространстве имён включено версионирование,
+// запись сохраняется новой версией (её ID записывается в source), а прежний файл остаётся в своей версии.
+// Если пространства имён нет, возвращается ErrNamespaceNotFound,
+// а если содержимое объекта (или его отсутствие) не удовлетворяет условию ifMatch - ErrPreconditionFailed.
+func (s *Storage) PutObject(ctx context.Context, source *models.ObjectItem, ifMatch models.IfMatch) (uuid.UUID, error) {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.PutObject")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	versioning, err := lockNamespace(ctx, tx, source.Namespace)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	var oldID uuid.UUID
+	for {
+		// Блокируем существующий объект, чтобы одновременная запись того же ключа получила
+		// уже новый файл и удалила именно его, а не тот же старый.
+		var checksum string
+		err = tx.QueryRowContext(
+			ctx,
+			"SELECT o.file_uuid, b.checksum FROM "+objectTables+" WHERE o.namespace = $1 AND o.key = $2 FOR UPDATE OF o",
+			source.Namespace,
+			source.Key,
+		).Scan(&oldID, &checksum)
+		if err == nil {
+			if !ifMatch.Matches(checksum) {
+				return uuid.Nil, ErrPreconditionFailed
+			}
+
+			query := `
+				UPDATE object
+				SET file_uuid = $3, updated_at = timezone('utc'::text, now())
+				WHERE namespace = $1 AND key = $2
+				RETURNING updated_at;
+			`
+			err = tx.QueryRowContext(ctx, query, source.Namespace, source.Key, source.FileID).Scan(&source.UpdatedAt)
+			break
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, err
+		}
+		if !ifMatch.Matches("") {
+			return uuid.Nil, ErrPreconditionFailed
+		}
+
+		query := `
+			INSERT INTO object (namespace, key, file_uuid)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (namespace, key) DO NOTHING
+			RETURNING updated_at;
+		`
+		err = tx.QueryRowContext(ctx, query, source.Namespace, source.Key, source.FileID).Scan(&source.UpdatedAt)
+		// Объект с таким ключом только что добавлен другим запросом - заменяем его.
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		oldID = uuid.Nil
+		break
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if versioning {
+		source.VersionID, err = insertObjectVersion(ctx, tx, source.Namespace, source.Key, source.FileID, source.UpdatedAt)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		oldID = uuid.Nil
+	}
+
+	if err = tx.Commit(); err != nil {
+		return uuid.Nil, err
+	}
+
+	return oldID, nil
+}
+
+// DeleteObjectVersioned удаляет объект с ключом key из пространства имён namespace с включённым версионированием:
+// объект перестаёт быть текущим, а его версии и файлы сохраняются. Удаление записывается маркером удаления,
+// который возвращается. Если объекта нет, возвращается ErrNotFound, а если его содержимое не удовлетворяет
+// условию ifMatch - ErrPreconditionFailed.
+func (s *Storage) DeleteObjectVersioned(
+	ctx context.Context,
+	namespace, key string,
+	ifMatch models.IfMatch,
+) (*models.ObjectVersion, error) {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.DeleteObjectVersioned")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err = lockNamespace(ctx, tx, namespace); err != nil {
+		return nil, err
+	}
+
+	var checksum string
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT b.checksum FROM "+objectTables+" WHERE o.namespace = $1 AND o.key = $2 FOR UPDATE OF o",
+		namespace,
+		key,
+	).Scan(&checksum)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ifMatch.Matches(checksum) {
+		return nil, ErrPreconditionFailed
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM object WHERE namespace = $1 AND key = $2", namespace, key); err != nil {
+		return nil, err
+	}
+
+	marker := &models.ObjectVersion{Namespace: namespace, Key: key, DeleteMarker: true, IsLatest: true}
+	err = tx.QueryRowContext(ctx, "SELECT timezone('utc'::text, now())").Scan(&marker.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	marker.VersionID, err = insertObjectVersion(ctx, tx, namespace, key, uuid.Nil, marker.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return marker, nil
+}
+
+// objectVersionColumns - поля версии объекта и её содержимого в порядке, который ожидает scanObjectVersion.
+// Последняя версия объекта - версия с наибольшим seq.
+const objectVersionColumns = `
+	v.id, v.namespace, v.key, v.file_uuid, COALESCE(b.size, 0), COALESCE(b.checksum, ''),
+	COALESCE(f.content_type, ''), v.created_at,
+	v.seq = (SELECT max(l.seq) FROM object_version l WHERE l.namespace = v.namespace AND l.key = v.key)
+`
+
+// objectVersionTables - таблицы версии объекта и её содержимого для запросов с полями objectVersionColumns.
+const objectVersionTables = "object_version v LEFT JOIN file f ON f.uuid = v.file_uuid LEFT JOIN blob b ON b.id = f.blob_id"
+
+// scanObjectVersion читает версию объекта из строки запроса с полями objectVersionColumns.
+func scanObjectVersion(row rowScanner) (*models.ObjectVersion, error) {
+	var item models.ObjectVersion
+	var fileID uuid.NullUUID
+
+	err := row.Scan(
+		&item.VersionID,
+		&item.Namespace,
+		&item.Key,
+		&fileID,
+		&item.Size,
+		&item.Checksum,
+		&item.ContentType,
+		&item.CreatedAt,
+		&item.IsLatest,
+	)
+	if err != nil {
+		return nil, err
+	}
+	item.FileID = fileID.UUID
+	item.DeleteMarker = !fileID.Valid
+
+	return &item, nil
+}
+
+// GetObjectVersion возвращает версию id объекта с ключом key в пространстве имён namespace или ErrNotFound.
+func (s *Storage) GetObjectVersion(ctx context.Context, namespace, key string, id uuid.UUID) (*models.ObjectVersion, error) {
+	query := "SELECT " + objectVersionColumns + " FROM " + objectVersionTables +
+		" WHERE v.id = $1 AND v.namespace = $2 AND v.key = $3"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.GetObjectVersion")
+	defer span.End()
+
+	item, err := scanObjectVersion(s.db.QueryRowContext(ctx, query, id, namespace, key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// ListObjectVersions возвращает версии объекта с ключом key в пространстве имён namespace, от последней к первой.
+func (s *Storage) ListObjectVersions(ctx context.Context, namespace, key string) ([]*models.ObjectVersion, error) {
+	query := "SELECT " + objectVersionColumns + " FROM " + objectVersionTables + `
+		WHERE v.namespace = $1 AND v.key = $2
+		ORDER BY v.seq DESC
+	`
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.ListObjectVersions")
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, namespace, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*models.ObjectVersion, 0)
+
+	for rows.Next() {
+		item, err := scanObjectVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// CopyFile создаёт новый файл с тем же содержимым, именем и типом, что у файла id, и возвращает его UUID.
+// Содержимое не копируется: новый файл ссылается на него, и счётчик ссылок увеличивается.
+func (s *Storage) CopyFile(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.CopyFile")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// Блокировка не даёт удалить файл (и его содержимое), пока на содержимое не сослался новый файл.
+	var blobID uuid.UUID
+	err = tx.QueryRowContext(ctx, "SELECT blob_id FROM file WHERE uuid = $1 FOR KEY SHARE", id).Scan(&blobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, ErrNotFound
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE blob SET refcount = refcount + 1 WHERE id = $1", blobID); err != nil {
+		return uuid.Nil, err
+	}
+
+	newID := uuid.New()
+	query := `
+		INSERT INTO file (uuid, blob_id, filename, content_type, owner_key)
+		SELECT $1, blob_id, filename, content_type, owner_key FROM file WHERE uuid = $2;
+	`
+	if _, err = tx.ExecContext(ctx, query, newID, id); err != nil {
+		return uuid.Nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return uuid.Nil, err
+	}
+
+	return newID, nil
+}
+
+// GetObject возвращает объект с ключом key в пространстве имён namespace или ErrNotFound.
+func (s *Storage) GetObject(ctx context.Context, namespace, key string) (*models.ObjectItem, error) {
+	query := "SELECT " + objectColumns + " FROM " + objectTables + " WHERE o.namespace = $1 AND o.key = $2"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.GetObject")
+	defer span.End()
+
+	item, err := scanObject(s.db.QueryRowContext(ctx, query, namespace, key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// ListObjects возвращает до limit объектов пространства имён namespace с ключами, которые начинаются
+// с prefix и больше after, в порядке ключей (ключи сравниваются побайтно).
+func (s *Storage) ListObjects(ctx context.Context, namespace, prefix, after string, limit int) ([]*models.ObjectItem, error) {
+	query := "SELECT " + objectColumns + " FROM " + objectTables + `
+		WHERE o.namespace = $1 AND o.key > $2 AND o.key LIKE $3
+		ORDER BY o.key
+		LIMIT $4
+	`
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.ListObjects")
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, namespace, after, escapeLike(prefix)+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*models.ObjectItem, 0, limit)
+
+	for rows.Next() {
+		item, err := scanObject(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE (экранирующий символ по умолчанию - обратная косая черта).
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// lifecycleRuleColumns - поля правила жизненного цикла в порядке, который ожидает scanLifecycleRules.
+const lifecycleRuleColumns = "namespace, prefix, COALESCE(expire_days, 0), expire_at, COALESCE(keep_versions, 0)"
+
+// scanLifecycleRules читает правила жизненного цикла из результата запроса с полями lifecycleRuleColumns.
+func scanLifecycleRules(rows *sql.Rows) ([]*models.LifecycleRule, error) {
+	defer rows.Close()
+
+	items := make([]*models.LifecycleRule, 0)
+
+	for rows.Next() {
+		var item models.LifecycleRule
+		var expireAt sql.NullTime
+
+		err := rows.Scan(&item.Namespace, &item.Prefix, &item.ExpireDays, &expireAt, &item.KeepVersions)
+		if err != nil {
+			return nil, err
+		}
+		if expireAt.Valid {
+			item.ExpireAt = &expireAt.Time
+		}
+
+		items = append(items, &item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// SetLifecycleRules заменяет правила жизненного цикла пространства имён namespace на rules.
+// Если пространства имён нет, возвращается ErrNamespaceNotFound.
+func (s *Storage) SetLifecycleRules(ctx context.Context, namespace string, rules []*models.LifecycleRule) error {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.SetLifecycleRules")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err = lockNamespace(ctx, tx, namespace); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM lifecycle_rule WHERE namespace = $1", namespace); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO lifecycle_rule (namespace, prefix, expire_days, expire_at, keep_versions)
+		VALUES ($1, $2, NULLIF($3, 0), $4, NULLIF($5, 0));
+	`
+	for _, rule := range rules {
+		_, err = tx.ExecContext(ctx, query, namespace, rule.Prefix, rule.ExpireDays, rule.ExpireAt, rule.KeepVersions)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetLifecycleRules возвращает правила жизненного цикла пространства имён namespace в порядке добавления.
+func (s *Storage) GetLifecycleRules(ctx context.Context, namespace string) ([]*models.LifecycleRule, error) {
+	query := "SELECT " + lifecycleRuleColumns + " FROM lifecycle_rule WHERE namespace = $1 ORDER BY id"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.GetLifecycleRules")
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanLifecycleRules(rows)
+}
+
+// ListLifecycleRules возвращает правила жизненного цикла всех пространств имён.
+func (s *Storage) ListLifecycleRules(ctx context.Context) ([]*models.LifecycleRule, error) {
+	query := "SELECT " + lifecycleRuleColumns + " FROM lifecycle_rule ORDER BY id"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.ListLifecycleRules")
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanLifecycleRules(rows)
+}
+
+// ListExpiredObjects возвращает до limit объектов пространства имён namespace с ключами, которые начинаются
+// с prefix, изменённых раньше before, от давно изменённых к недавним.
+func (s *Storage) ListExpiredObjects(
+	ctx context.Context,
+	namespace, prefix string,
+	before time.Time,
+	limit int,
+) ([]*models.ObjectItem, error) {
+	query := "SELECT " + objectColumns + " FROM " + objectTables + `
+		WHERE o.namespace = $1 AND o.key LIKE $2 AND o.updated_at < $3
+		ORDER BY o.updated_at
+		LIMIT $4
+	`
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.ListExpiredObjects")
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, namespace, escapeLike(prefix)+"%", before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*models.ObjectItem, 0, limit)
+
+	for rows.Next() {
+		item, err := scanObject(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// ListExcessVersions возвращает до limit версий объектов пространства имён namespace с ключами, которые
+// начинаются с prefix, кроме keep последних версий каждого объекта, от старых к новым.
+func (s *Storage) ListExcessVersions(
+	ctx context.Context,
+	namespace, prefix string,
+	keep, limit int,
+) ([]*models.ObjectVersion, error) {
+	query := "SELECT " + objectVersionColumns + " FROM " + objectVersionTables + `
+		JOIN (
+			SELECT id, row_number() OVER (PARTITION BY key ORDER BY seq DESC) AS n
+			FROM object_version
+			WHERE namespace = $1 AND key LIKE $2
+		) r ON r.id = v.id
+		WHERE r.n > $3
+		ORDER BY v.seq
+		LIMIT $4
+	`
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.ListExcessVersions")
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, namespace, escapeLike(prefix)+"%", keep, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*models.ObjectVersion, 0, limit)
+
+	for rows.Next() {
+		item, err := scanObjectVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// DeleteDeleteMarker удаляет маркер удаления id. Версии с содержимым удаляются вместе с их файлом
+// (DeleteFileMetadata), так как запись версии ссылается на файл с ON DELETE CASCADE.
+func (s *Storage) DeleteDeleteMarker(ctx context.Context, id string) error {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.DeleteDeleteMarker")
+	defer span.End()
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM object_version WHERE id = $1 AND file_uuid IS NULL", id)
+
+	return err
+}
+
+// apiKeyColumns - поля ключа API в порядке, который ожидает scanAPIKey.
+const apiKeyColumns = "id, secret, scopes, namespaces, created_at"
+
+// scanAPIKey читает ключ API из строки запроса с полями apiKeyColumns.
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var item models.APIKey
+
+	err := row.Scan(&item.ID, &item.Secret, pq.Array(&item.Scopes), pq.Array(&item.Namespaces), &item.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// CreateAPIKey сохраняет ключ API и записывает в item время создания.
+// Если ключ с таким ID уже есть, возвращается ErrAlreadyExists.
+func (s *Storage) CreateAPIKey(ctx context.Context, item *models.APIKey) error {
+	query := `
+		INSERT INTO api_key (id, secret, scopes, namespaces)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO NOTHING
+		RETURNING created_at;
+	`
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.CreateAPIKey")
+	defer span.End()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		item.ID,
+		item.Secret,
+		pq.Array(item.Scopes),
+		pq.Array(item.Namespaces),
+	).Scan(&item.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAlreadyExists
+	}
+
+	return err
+}
+
+// GetAPIKey возвращает ключ API вместе с секретом или ErrNotFound.
+func (s *Storage) GetAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_key WHERE id = $1"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.GetAPIKey")
+	defer span.End()
+
+	item, err := scanAPIKey(s.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// ListAPIKeys возвращает все ключи API (вместе с секретами) в порядке создания.
+func (s *Storage) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_key ORDER BY created_at, id"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.ListAPIKeys")
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*models.APIKey, 0)
+
+	for rows.Next() {
+		item, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// DeleteAPIKey удаляет ключ API или возвращает ErrNotFound. Файлы ключа остаются, их владелец не меняется.
+func (s *Storage) DeleteAPIKey(ctx context.Context, id string) error {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.DeleteAPIKey")
+	defer span.End()
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM api_key WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CreatePresignedUpload сохраняет разрешение на загрузку файла по подписанной ссылке.
+func (s *Storage) CreatePresignedUpload(ctx context.Context, item *models.PresignedUpload) error {
+	query := `
+		INSERT INTO presigned_upload (id, owner_key, max_size, content_type, expires_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+		RETURNING created_at;
+	`
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.CreatePresignedUpload")
+	defer span.End()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		item.ID,
+		item.Owner,
+		item.MaxSize,
+		item.ContentType,
+		item.ExpiresAt,
+	).Scan(&item.CreatedAt)
+}
+
+// ConsumePresignedUpload удаляет и возвращает разрешение на загрузку, действующее на момент current,
+// поэтому по одной ссылке можно загрузить только один файл. Если разрешения нет, оно уже использовано
+// или истекло, возвращается ErrNotFound.
+func (s *Storage) ConsumePresignedUpload(ctx context.Context, id string, current time.Time) (*models.PresignedUpload, error) {
+	query := `
+		DELETE FROM presigned_upload
+		WHERE id = $1 AND expires_at > $2
+		RETURNING id, COALESCE(owner_key, ''), max_size, content_type, expires_at, created_at;
+	`
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.ConsumePresignedUpload")
+	defer span.End()
+
+	var item models.PresignedUpload
+	err := s.db.QueryRowContext(ctx, query, id, current).Scan(
+		&item.ID,
+		&item.Owner,
+		&item.MaxSize,
+		&item.ContentType,
+		&item.ExpiresAt,
+		&item.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// RestorePresignedUpload возвращает использованное разрешение на загрузку, если файл по нему не сохранён,
+// чтобы загрузку по той же ссылке можно было повторить.
+func (s *Storage) RestorePresignedUpload(ctx context.Context, item *models.PresignedUpload) error {
+	query := `
+		INSERT INTO presigned_upload (id, owner_key, max_size, content_type, expires_at, created_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6)
+		ON CONFLICT (id) DO NOTHING;
+	`
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.RestorePresignedUpload")
+	defer span.End()
+
+	_, err := s.db.ExecContext(
+		ctx,
+		query,
+		item.ID,
+		item.Owner,
+		item.MaxSize,
+		item.ContentType,
+		item.ExpiresAt,
+		item.CreatedAt,
+	)
+
+	return err
+}
+
+// DeleteExpiredPresignedUploads удаляет разрешения на загрузку, истёкшие к моменту before,
+// и возвращает их количество.
+func (s *Storage) DeleteExpiredPresignedUploads(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "Storage.DeleteExpiredPresignedUploads")
+	defer span.End()
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM presigned_upload WHERE expires_at <= $1", before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,66 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"karma8/internal/app/repository"
+	"karma8/internal/models"
+	"karma8/internal/testhelpers/postgres"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStorage(t *testing.T) *repository.Storage {
+	t.Helper()
+
+	testDB, err := postgres.NewTestDatabase(t)
+	if err != nil {
+		t.Skipf("This test is excluded from unit tests: %v", err)
+	}
+	t.Cleanup(func() { testDB.Close(t) })
+
+	storage, err := repository.New(testDB.ConnectString(t))
+	require.NoError(t, err)
+
+	return storage
+}
+
+func TestMovePartClearsPendingDelete(t *testing.T) {
+	storage := newTestStorage(t)
+	ctx := context.Background()
+
+	metadata := &models.MetadataItem{
+		Checksum:    "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		FileName:    "report.csv",
+		ContentType: "text/csv",
+		BucketIDs:   []int64{1},
+		Parts:       []models.PartItem{{Index: 0, BucketID: 1, Length: 4}},
+		Size:        4,
+		DataShards:  1,
+	}
+	_, err := storage.PutFileMetadata(ctx, metadata)
+	require.NoError(t, err)
+
+	pendingBuckets := func() []int64 {
+		items, err := storage.GetPendingDeletes(ctx, time.Now().UTC().Add(time.Hour), 10)
+		require.NoError(t, err)
+
+		bucketIDs := make([]int64, 0, len(items))
+		for _, item := range items {
+			assert.Equal(t, metadata.BlobID, item.BlobID)
+			bucketIDs = append(bucketIDs, item.BucketID)
+		}
+
+		return bucketIDs
+	}
+
+	require.NoError(t, storage.MovePart(ctx, metadata.BlobID, 0, 1, 2))
+	assert.Equal(t, []int64{1}, pendingBuckets())
+
+	// Часть возвращается в бакет 1, старая копия которого ещё не удалена: бакет 1 убирается из очереди.
+	require.NoError(t, storage.MovePart(ctx, metadata.BlobID, 0, 2, 1))
+	assert.Equal(t, []int64{2}, pendingBuckets())
+}
@@ -2,7 +2,14 @@ package repository
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
 
 	trccontext "karma8/internal/lib/context"
 	"karma8/internal/models"
@@ -11,6 +18,19 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+const (
+	// bucketChunkSize - размер блока, которым часть файла записывается в Redis.
+	bucketChunkSize = 1 << 20
+	// bucketUploadTTL - время жизни временного ключа незавершённой записи части файла.
+	bucketUploadTTL = time.Hour
+	// checksumKeySuffix - суффикс ключа, в котором хранится контрольная сумма части файла.
+	checksumKeySuffix = ".sha256"
+	// uploadKeyInfix - часть имени временного ключа незавершённой записи части файла.
+	uploadKeyInfix = ".upload."
+	// statsScanCount - количество ключей, запрашиваемых за одну итерацию SCAN при подсчёте статистики.
+	statsScanCount = 1000
+)
+
 type StorageRedis struct {
 	db *redis.Client
 }
@@ -81,25 +101,165 @@ func (s *StorageRedis) GetBucketsInfo() ([]*models.ServerBucketInfo, error) {
 	return nil, nil
 }
 
-// PutBucketItem сохраняет часть файла в бакете.
-func (s *StorageRedis) PutBucketItem(ctx context.Context, id string, source []byte) error {
+// PutBucketItem сохраняет часть файла в бакете и возвращает её контрольную сумму SHA-256.
+// Часть читается из source блоками по bucketChunkSize и дописывается во временный ключ,
+// который после успешной записи атомарно переименовывается в id; рядом сохраняется контрольная сумма.
+func (s *StorageRedis) PutBucketItem(ctx context.Context, id string, source io.Reader) (string, error) {
 	ctx, span := trccontext.WithTelemetrySpan(ctx, "StorageRedis.PutBucketItem")
 	defer span.End()
 
-	err := s.db.Set(ctx, id, source, 0).Err()
+	tmpKey := id + uploadKeyInfix + uuid.NewString()
+
+	// Временный ключ удалится сам, если запись прервётся.
+	err := s.db.Set(ctx, tmpKey, "", bucketUploadTTL).Err()
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	source = io.TeeReader(source, hash)
 
-	return err
+	buf := make([]byte, bucketChunkSize)
+	for {
+		n, readErr := io.ReadFull(source, buf)
+		if n > 0 {
+			if err = s.db.Append(ctx, tmpKey, string(buf[:n])).Err(); err != nil {
+				break
+			}
+		}
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			err = readErr
+			break
+		}
+	}
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+
+	if err == nil {
+		_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Rename(ctx, tmpKey, id)
+			pipe.Persist(ctx, id)
+			pipe.Set(ctx, id+checksumKeySuffix, checksum, 0)
+			return nil
+		})
+	}
+	if err != nil {
+		_ = s.db.Del(context.WithoutCancel(ctx), tmpKey).Err()
+		return "", err
+	}
+
+	return checksum, nil
 }
 
-// GetBucketItem возвращает часть файла из бакета по ID.
-func (s *StorageRedis) GetBucketItem(ctx context.Context, id string) ([]byte, error) {
+// GetBucketItem возвращает часть файла из бакета по ID и её контрольную сумму,
+// сохранённую при записи (пустую, если часть записана без контрольной суммы).
+func (s *StorageRedis) GetBucketItem(ctx context.Context, id string) ([]byte, string, error) {
 	ctx, span := trccontext.WithTelemetrySpan(ctx, "StorageRedis.GetBucketItem")
 	defer span.End()
 
-	val, err := s.db.Get(ctx, id).Bytes()
+	var data, checksum *redis.StringCmd
+	_, err := s.db.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		data = pipe.Get(ctx, id)
+		checksum = pipe.Get(ctx, id+checksumKeySuffix)
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, "", err
+	}
+
+	val, err := data.Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	sum, err := checksum.Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, "", err
+	}
+
+	return val, sum, nil
+}
+
+// GetBucketStats возвращает статистику бакета: память, занятую ключами базы (MEMORY USAGE),
+// количество частей файлов и ограничение памяти Redis (INFO memory).
+// Ключи перебираются командой SCAN, поэтому подсчёт не блокирует Redis, но занимает время.
+func (s *StorageRedis) GetBucketStats(ctx context.Context) (*models.BucketStats, error) {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "StorageRedis.GetBucketStats")
+	defer span.End()
+
+	var stats models.BucketStats
+
+	var cursor uint64
+	for {
+		keys, next, err := s.db.Scan(ctx, cursor, "*", statsScanCount).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		usage := make([]*redis.IntCmd, len(keys))
+		_, err = s.db.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range keys {
+				usage[i] = pipe.MemoryUsage(ctx, key)
+			}
+			return nil
+		})
+		// Ключ мог быть удалён между SCAN и MEMORY USAGE.
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+
+		for i, key := range keys {
+			stats.UsedBytes += usage[i].Val()
+			if !strings.HasSuffix(key, checksumKeySuffix) && !strings.Contains(key, uploadKeyInfix) {
+				stats.Parts++
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	info, err := s.db.Info(ctx, "memory").Result()
 	if err != nil {
 		return nil, err
 	}
+	stats.MaxBytes = parseInfoInt(info, "maxmemory")
+
+	return &stats, nil
+}
+
+// parseInfoInt возвращает целое значение поля name из ответа команды INFO (0, если поля нет).
+func parseInfoInt(info string, name string) int64 {
+	for _, line := range strings.Split(info, "\r\n") {
+		value, ok := strings.CutPrefix(line, name+":")
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return 0
+		}
+
+		return n
+	}
+
+	return 0
+}
+
+// DeleteBucketItem удаляет часть файла из бакета по ID.
+// Удаление отсутствующей части не считается ошибкой.
+func (s *StorageRedis) DeleteBucketItem(ctx context.Context, id string) error {
+	ctx, span := trccontext.WithTelemetrySpan(ctx, "StorageRedis.DeleteBucketItem")
+	defer span.End()
 
-	return val, nil
+	return s.db.Del(ctx, id, id+checksumKeySuffix).Err()
 }
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/models"
+)
+
+const (
+	// apiKeyIDPrefix - префикс ID ключей API, созданных через API (отличает их от ключа администратора из конфига).
+	apiKeyIDPrefix = "K8"
+	// apiKeyIDBytes и apiKeySecretBytes - количество случайных байт в ID и секрете ключа API.
+	apiKeyIDBytes     = 10
+	apiKeySecretBytes = 30
+)
+
+// apiKeyScopes - допустимые области действия ключей API.
+var apiKeyScopes = []string{models.ScopeRead, models.ScopeWrite, models.ScopeDelete, models.ScopeAdmin}
+
+// validateAPIKeyRequest проверяет области действия и пространства имён нового ключа API.
+func validateAPIKeyRequest(request *models.CreateAPIKeyRequest) error {
+	if len(request.Scopes) == 0 {
+		return fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKey)
+	}
+	for _, scope := range request.Scopes {
+		if !slices.Contains(apiKeyScopes, scope) {
+			return fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIKey, scope)
+		}
+	}
+	for _, namespace := range request.Namespaces {
+		if err := validateNamespace(namespace); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidAPIKey, err)
+		}
+	}
+
+	return nil
+}
+
+// sortedUnique возвращает отсортированные значения values без повторов (пустой список, а не nil, если значений нет).
+func sortedUnique(values []string) []string {
+	result := slices.Clone(values)
+	if result == nil {
+		result = make([]string, 0)
+	}
+	slices.Sort(result)
+
+	return slices.Compact(result)
+}
+
+// randomString возвращает n случайных байт, закодированных encode.
+func randomString(n int, encode func([]byte) string) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return encode(buf), nil
+}
+
+// CreateAPIKey создаёт ключ API с областями действия и пространствами имён из request и возвращает его
+// вместе с секретом. Секрет больше нигде не возвращается.
+func (s *ServiceA) CreateAPIKey(ctx context.Context, request *models.CreateAPIKeyRequest) (*models.APIKey, error) {
+	const op = "serviceA.CreateAPIKey"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	if err := validateAPIKeyRequest(request); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := randomString(apiKeyIDBytes, func(b []byte) string { return apiKeyIDPrefix + strings.ToUpper(hex.EncodeToString(b)) })
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	secret, err := randomString(apiKeySecretBytes, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	key := &models.APIKey{
+		ID:         id,
+		Secret:     secret,
+		Scopes:     sortedUnique(request.Scopes),
+		Namespaces: sortedUnique(request.Namespaces),
+	}
+	if err = s.storage.CreateAPIKey(ctx, key); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return key, nil
+}
+
+// GetAPIKey возвращает ключ API вместе с секретом для проверки запроса или ErrNotFound.
+func (s *ServiceA) GetAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	const op = "serviceA.GetAPIKey"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	key, err := s.storage.GetAPIKey(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys возвращает ключи API без секретов.
+func (s *ServiceA) ListAPIKeys(ctx context.Context) (*models.APIKeyList, error) {
+	const op = "serviceA.ListAPIKeys"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	keys, err := s.storage.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, key := range keys {
+		key.Secret = ""
+	}
+
+	return &models.APIKeyList{Keys: keys}, nil
+}
+
+// DeleteAPIKey удаляет ключ API: запросы с ним больше не принимаются. Если ключа нет, возвращается ErrNotFound.
+func (s *ServiceA) DeleteAPIKey(ctx context.Context, id string) error {
+	const op = "serviceA.DeleteAPIKey"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	if err := s.storage.DeleteAPIKey(ctx, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -1,41 +1,91 @@
 package services
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"mime/multipart"
+	"net"
 	"net/http"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	trccontext "karma8/internal/lib/context"
-	"karma8/internal/lib/logger/sl"
 	"karma8/internal/lib/middleware"
+	"karma8/internal/lib/serviceauth"
 	"karma8/internal/models"
 
 	"github.com/google/uuid"
 )
 
-const requestPath = "/api/filepart"
+const (
+	// HeaderChecksum - заголовок с контрольной суммой SHA-256 части файла.
+	HeaderChecksum = "X-Checksum-Sha256"
+
+	requestPath = "/api/filepart"
+	statsPath   = "/api/stats"
+	// bucketTimeout - таймаут установки соединения и ожидания ответа бакета.
+	// Общий таймаут запроса не задаётся, так как части больших файлов передаются потоком.
+	bucketTimeout = 10 * time.Second
+	// maxErrorBodySize - максимальный размер читаемого тела ответа бакета с ошибкой.
+	maxErrorBodySize = 4 << 10
+)
 
 type Bucket struct {
-	log    *slog.Logger
-	client *http.Client
-	path   string
-	ID     int64
+	log     *slog.Logger
+	client  *http.Client
+	path    string
+	address string
+	ID      int64
+
+	// used - занятый объём бакета в байтах по последней статистике
+	// с учётом частей, отправленных в бакет после её получения.
+	used atomic.Int64
+	// statsOK - удалось ли получить статистику бакета при последнем обновлении.
+	statsOK atomic.Bool
+}
+
+// NewBucketClient создаёт HTTP-клиент для запросов к бакетам. Если задан tlsConfig, он используется
+// для соединений с бакетами по https (в том числе с клиентским сертификатом); если задан secret,
+// каждый запрос подписывается общим секретом (заголовок serviceauth.HeaderToken).
+func NewBucketClient(tlsConfig *tls.Config, secret string) *http.Client {
+	var transport http.RoundTripper = &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   bucketTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   bucketTimeout,
+		ResponseHeaderTimeout: bucketTimeout,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   16,
+	}
+	if secret != "" {
+		transport = &serviceauth.Transport{Base: transport, Secret: secret}
+	}
+
+	return &http.Client{Transport: transport}
 }
 
-func NewBucket(log *slog.Logger, path string, id int64) *Bucket {
+// NewBucket создаёт клиент бакета с адресом path. Если client не задан, используется клиент без TLS и подписи.
+func NewBucket(log *slog.Logger, path string, id int64, client *http.Client) *Bucket {
+	if client == nil {
+		client = NewBucketClient(nil, "")
+	}
+
 	return &Bucket{
-		log: log,
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		path: path + requestPath,
-		ID:   id,
+		log:     log,
+		client:  client,
+		path:    path + requestPath,
+		address: path,
+		ID:      id,
 	}
 }
 
@@ -50,96 +100,261 @@ func (s *Bucket) GetBucketsInfo() ([]*models.ServerBucketInfo, error) {
 	return result, nil
 }
 
-// SendToBucket отправляет файл в бакет.
-func (s *Bucket) SendToBucket(ctx context.Context, item *models.BucketItem, id uuid.UUID) error {
-	// Создаем буфер для записи данных формы.
-	var body bytes.Buffer
-	writer := multipart.NewWriter(&body)
+// SendToBucket отправляет часть файла в бакет и возвращает её контрольную сумму SHA-256.
+// Тело запроса формируется на лету из source, поэтому часть файла не буферизуется в памяти.
+// Контрольная сумма вычисляется при отправке и сверяется с той, которую вернул бакет.
+func (s *Bucket) SendToBucket(ctx context.Context, id uuid.UUID, source io.Reader) (string, error) {
+	body, writer := io.Pipe()
+	defer body.Close()
+
+	form := multipart.NewWriter(writer)
+	hash := sha256.New()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		writer.CloseWithError(writeBucketForm(form, id, io.TeeReader(source, hash)))
+	}()
+
+	// Создаем HTTP запрос с методом PUT и устанавливаем заголовки
+	request, err := http.NewRequestWithContext(ctx, "PUT", s.path, body)
+	if err != nil {
+		return "", err
+	}
+
+	request.Header.Set("Content-Type", form.FormDataContentType())
+
+	requestID, ok := trccontext.RequestIDFromContext(ctx)
+	if !ok {
+		requestID = "UNKNOWN"
+	}
+	request.Header.Set(middleware.HeaderRequestID, requestID)
+
+	// Отправляем запрос
+	response, err := s.client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	// Обрабатываем ошибочный ответ.
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error in SendToBucket: %d", response.StatusCode)
+	}
+
+	// Бакет принял часть целиком, значит форма уже записана и контрольная сумма вычислена.
+	<-done
+	checksum := hex.EncodeToString(hash.Sum(nil))
+
+	stored := response.Header.Get(HeaderChecksum)
+	if stored != "" && stored != checksum {
+		return "", fmt.Errorf("error in SendToBucket: checksum mismatch: %w", ErrCorrupted)
+	}
+
+	return checksum, nil
+}
 
+// writeBucketForm записывает в форму ID файла и содержимое части файла.
+func writeBucketForm(form *multipart.Writer, id uuid.UUID, source io.Reader) error {
 	// Добавляем поле ID.
-	_ = writer.WriteField("id", id.String())
+	if err := form.WriteField("id", id.String()); err != nil {
+		return err
+	}
 
 	// Добавляем бинарные данные в теле формы.
-	part, err := writer.CreateFormFile("file", "file")
+	part, err := form.CreateFormFile("file", "file")
 	if err != nil {
 		return err
 	}
-	_, err = part.Write(item.Source)
-	if err != nil {
+	if _, err = io.Copy(part, source); err != nil {
 		return err
 	}
+
 	// Закрываем тело формы
-	_ = writer.Close()
+	return form.Close()
+}
 
-	// Создаем HTTP запрос с методом PUT и устанавливаем заголовки
-	request, err := http.NewRequestWithContext(ctx, "PUT", s.path, &body)
+// GetFromBucket открывает на чтение диапазон [offset, offset+length) части файла в бакете
+// и возвращает контрольную сумму всей части, которую сообщил бакет (пустую, если бакет её не знает).
+// Данные не буферизуются: вызывающий читает их из тела ответа и обязан закрыть его.
+func (s *Bucket) GetFromBucket(ctx context.Context, id uuid.UUID, offset, length int64) (io.ReadCloser, string, error) {
+	url := fmt.Sprintf(s.path+"/%s", id)
+
+	request, err := http.NewRequestWithContext(ctx, "GET", url, http.NoBody)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 
-	request.Header.Set("Content-Type", writer.FormDataContentType())
+	requestID, ok := trccontext.RequestIDFromContext(ctx)
+	if !ok {
+		requestID = "UNKNOWN"
+	}
+	// Set the request-id header
+	request.Header.Set(middleware.HeaderRequestID, requestID)
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
 
-	// Отправляем запрос
 	response, err := s.client.Do(request)
 	if err != nil {
-		return err
+		return nil, "", &BucketError{BucketID: s.ID, Err: requestError(err)}
+	}
+
+	checksum := response.Header.Get(HeaderChecksum)
+	body := bucketBody{ReadCloser: response.Body, bucketID: s.ID}
+
+	switch {
+	case response.StatusCode == http.StatusPartialContent:
+		return body, checksum, nil
+	case response.StatusCode == http.StatusOK && offset == 0:
+		// Бакет проигнорировал Range и отдаёт часть целиком.
+		return readCloser{
+			Reader: io.LimitReader(body, length),
+			Closer: body,
+		}, checksum, nil
+	default:
+		defer response.Body.Close()
+		return nil, "", &BucketError{BucketID: s.ID, Err: responseError(response)}
+	}
+}
+
+// HeadFromBucket запрашивает у бакета размер части файла и контрольную сумму её данных.
+// Если части в бакете нет, возвращает ErrPartNotFound.
+func (s *Bucket) HeadFromBucket(ctx context.Context, id uuid.UUID) (int64, string, error) {
+	url := fmt.Sprintf(s.path+"/%s", id)
+
+	request, err := http.NewRequestWithContext(ctx, "HEAD", url, http.NoBody)
+	if err != nil {
+		return 0, "", err
+	}
+
+	requestID, ok := trccontext.RequestIDFromContext(ctx)
+	if !ok {
+		requestID = "UNKNOWN"
+	}
+	request.Header.Set(middleware.HeaderRequestID, requestID)
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return 0, "", &BucketError{BucketID: s.ID, Err: requestError(err)}
 	}
 	defer response.Body.Close()
 
-	// Обрабатываем ошибочный ответ.
 	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("error in SendToBucket: %d", response.StatusCode)
+		return 0, "", &BucketError{BucketID: s.ID, Err: responseError(response)}
 	}
 
-	return nil
+	return response.ContentLength, response.Header.Get(HeaderChecksum), nil
 }
 
-// GetFromBucket получает части файла из бакета.
-func (s *Bucket) GetFromBucket(ctx context.Context, id uuid.UUID, results map[int64][]byte, mutex *sync.Mutex) {
-	url := fmt.Sprintf(s.path+"/%s", id)
+// requestError приводит ошибку выполнения запроса к бакету к ErrBucketTimeout или ErrBucketUnreachable.
+// Отмена запроса вызывающим не считается ошибкой бакета.
+func requestError(err error) error {
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return err
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("%w: %w", ErrBucketTimeout, err)
+	default:
+		return fmt.Errorf("%w: %w", ErrBucketUnreachable, err)
+	}
+}
+
+// responseError приводит ошибочный ответ бакета к одной из ошибок бакета по коду ответа
+// и коду ошибки из тела ответа (models.ResponseError).
+func responseError(response *http.Response) error {
+	var body models.ResponseError
+	_ = json.NewDecoder(io.LimitReader(response.Body, maxErrorBodySize)).Decode(&body)
+
+	switch {
+	case response.StatusCode == http.StatusNotFound:
+		return ErrPartNotFound
+	case body.Code == models.ErrorCodeCorrupted:
+		return ErrCorrupted
+	case response.StatusCode == http.StatusGatewayTimeout || response.StatusCode == http.StatusRequestTimeout:
+		return fmt.Errorf("%w: status %d", ErrBucketTimeout, response.StatusCode)
+	default:
+		return fmt.Errorf("%w: status %d", ErrBucketUnreachable, response.StatusCode)
+	}
+}
+
+// bucketBody - тело ответа бакета, ошибки чтения которого приводятся к ошибкам бакета.
+type bucketBody struct {
+	io.ReadCloser
+	bucketID int64
+}
 
-	// Create a new HTTP request
-	req, err := http.NewRequest("GET", url, nil)
+func (b bucketBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = &BucketError{BucketID: b.bucketID, Err: requestError(err)}
+	}
+
+	return n, err
+}
+
+// readCloser объединяет Reader и Closer разных объектов.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// GetStats возвращает статистику использования бакета.
+func (s *Bucket) GetStats(ctx context.Context) (*models.BucketStats, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", s.address+statsPath, http.NoBody)
 	if err != nil {
-		s.log.Error("GetFromBucket", "error creating request", err)
-		return
+		return nil, err
 	}
 
 	requestID, ok := trccontext.RequestIDFromContext(ctx)
 	if !ok {
 		requestID = "UNKNOWN"
 	}
-	// Set the request-id header
-	req.Header.Set(middleware.HeaderRequestID, requestID)
+	request.Header.Set(middleware.HeaderRequestID, requestID)
 
-	// Perform the HTTP request
-	response, err := http.DefaultClient.Do(req)
+	response, err := s.client.Do(request)
 	if err != nil {
-		s.log.Error("GetFromBucket", sl.Err(err))
-		return
+		return nil, &BucketError{BucketID: s.ID, Err: requestError(err)}
 	}
 	defer response.Body.Close()
 
-	// Check the response status code
 	if response.StatusCode != http.StatusOK {
-		s.log.Error("error status GetFromBucket",
-			sl.Err(err),
-			"status_code", response.StatusCode,
-		)
-		return
+		return nil, &BucketError{BucketID: s.ID, Err: responseError(response)}
+	}
+
+	var stats models.BucketStats
+	if err = json.NewDecoder(response.Body).Decode(&stats); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// DeleteFromBucket удаляет часть файла из бакета.
+func (s *Bucket) DeleteFromBucket(ctx context.Context, id uuid.UUID) error {
+	url := fmt.Sprintf(s.path+"/%s", id)
+
+	request, err := http.NewRequestWithContext(ctx, "DELETE", url, http.NoBody)
+	if err != nil {
+		return err
 	}
 
-	// Read data from the response body
-	data, err := io.ReadAll(response.Body)
+	requestID, ok := trccontext.RequestIDFromContext(ctx)
+	if !ok {
+		requestID = "UNKNOWN"
+	}
+	request.Header.Set(middleware.HeaderRequestID, requestID)
+
+	response, err := s.client.Do(request)
 	if err != nil {
-		s.log.Error("error io.ReadAll GetFromBucket",
-			sl.Err(err),
-		)
-		return
+		return err
 	}
+	defer response.Body.Close()
 
-	// Save data to the map using the mutex
-	mutex.Lock()
-	results[s.ID] = data
-	mutex.Unlock()
+	// Обрабатываем ошибочный ответ.
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("error in DeleteFromBucket: %d", response.StatusCode)
+	}
+
+	return nil
 }
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"karma8/internal/app/repository"
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/lib/encryption"
+	"karma8/internal/lib/logger/sl"
+	"karma8/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// keyRotationPageSize - количество ключей данных, читаемых за один запрос при перешифровании.
+const keyRotationPageSize = 100
+
+// newDataKey создаёт ключ данных для нового содержимого и возвращает его, зашифрованный текущим мастер-ключом.
+func (s *ServiceA) newDataKey(ctx context.Context) (string, []byte, error) {
+	dataKey, err := encryption.GenerateDataKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return s.keys.WrapKey(ctx, dataKey)
+}
+
+// blobCipher возвращает шифр содержимого metadata или nil, если содержимое хранится без шифрования.
+func (s *ServiceA) blobCipher(ctx context.Context, metadata *models.MetadataItem) (*encryption.Cipher, error) {
+	if metadata.KeyID == "" {
+		return nil, nil
+	}
+	if s.keys == nil {
+		return nil, fmt.Errorf("%w: content is encrypted, but encryption is disabled", ErrKeyUnavailable)
+	}
+
+	dataKey, err := s.keys.UnwrapKey(ctx, metadata.KeyID, metadata.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeyUnavailable, err)
+	}
+
+	// ID содержимого входит в тег каждого сегмента: части одного содержимого нельзя выдать за части другого.
+	return encryption.NewCipher(dataKey, metadata.BlobID[:])
+}
+
+// storedSize возвращает размер содержимого в том виде, в котором оно разложено по частям в бакетах.
+func storedSize(metadata *models.MetadataItem) int64 {
+	if metadata.KeyID != "" {
+		return encryption.EncryptedSize(metadata.Size)
+	}
+
+	return metadata.Size
+}
+
+// RotateDataKeys перешифровывает текущим мастер-ключом ключи данных, зашифрованные другими мастер-ключами.
+// Сами ключи данных и части в бакетах не меняются. Когда ключей, зашифрованных старым мастер-ключом,
+// не осталось (Failed равно 0), его можно удалить у поставщика ключей.
+func (s *ServiceA) RotateDataKeys(ctx context.Context) (*models.KeyRotation, error) {
+	const op = "serviceA.RotateDataKeys"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	if s.keys == nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrEncryptionDisabled)
+	}
+
+	result := &models.KeyRotation{KeyID: s.keys.CurrentKeyID()}
+	after := uuid.Nil
+	for {
+		items, err := s.storage.GetBlobKeysPage(ctx, result.KeyID, after, keyRotationPageSize)
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", op, err)
+		}
+
+		for _, item := range items {
+			after = item.BlobID
+			if err := s.rotateDataKey(ctx, item); err != nil {
+				s.log.Error("rotateDataKey", "blobID", item.BlobID.String(), "keyID", item.KeyID, sl.Err(err))
+				result.Failed++
+
+				continue
+			}
+			result.Rotated++
+		}
+
+		if len(items) < keyRotationPageSize {
+			return result, nil
+		}
+	}
+}
+
+// rotateDataKey перешифровывает ключ данных item текущим мастер-ключом.
+func (s *ServiceA) rotateDataKey(ctx context.Context, item *models.BlobKey) error {
+	dataKey, err := s.keys.UnwrapKey(ctx, item.KeyID, item.WrappedKey)
+	if err != nil {
+		return err
+	}
+
+	keyID, wrapped, err := s.keys.WrapKey(ctx, dataKey)
+	if err != nil {
+		return err
+	}
+
+	err = s.storage.UpdateBlobKey(ctx, item.KeyID, &models.BlobKey{BlobID: item.BlobID, KeyID: keyID, WrappedKey: wrapped})
+	// Содержимое удалено или его ключ уже перешифрован другим экземпляром service_a.
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// RotateKeys запускает периодическое перешифрование ключей данных текущим мастер-ключом.
+func (s *ServiceA) RotateKeys(d time.Duration) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.runRotateKeys(context.Background())
+	}
+}
+
+// runRotateKeys перешифровывает ключи данных, если этого не делает другой экземпляр service_a.
+func (s *ServiceA) runRotateKeys(ctx context.Context) {
+	unlock, err := s.storage.TryLock(ctx, keyRotationLockKey)
+	if err != nil {
+		s.log.Error("RotateKeys TryLock", sl.Err(err))
+		return
+	}
+	if unlock == nil {
+		// Ключи перешифровывает другой экземпляр service_a.
+		return
+	}
+	defer unlock()
+
+	result, err := s.RotateDataKeys(ctx)
+	if err != nil {
+		s.log.Error("RotateDataKeys", sl.Err(err))
+		return
+	}
+	if result.Rotated > 0 || result.Failed > 0 {
+		s.log.Info("RotateKeys", "keyID", result.KeyID, "rotated", result.Rotated, "failed", result.Failed)
+	}
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"karma8/internal/app/repository"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotFound - файл не найден.
+	ErrNotFound = repository.ErrNotFound
+	// ErrCorrupted - контрольная сумма данных не совпала с сохранённой: данные повреждены.
+	ErrCorrupted = errors.New("data is corrupted")
+	// ErrPartNotFound - бакет не нашёл часть файла.
+	ErrPartNotFound = errors.New("file part not found")
+	// ErrBucketUnreachable - бакет недоступен или ответил ошибкой.
+	ErrBucketUnreachable = errors.New("bucket is unreachable")
+	// ErrBucketTimeout - бакет не ответил вовремя.
+	ErrBucketTimeout = errors.New("bucket timeout")
+	// ErrInvalidBucket - некорректные параметры нового бакета.
+	ErrInvalidBucket = errors.New("invalid bucket")
+	// ErrInvalidUpload - некорректные параметры загрузки файла по частям или её части.
+	ErrInvalidUpload = errors.New("invalid upload")
+	// ErrInvalidAPIKey - некорректные параметры нового ключа API.
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	// ErrInvalidPresign - некорректные параметры подписанной ссылки.
+	ErrInvalidPresign = errors.New("invalid presigned URL request")
+	// ErrUploadCompleting - загрузка файла по частям уже собирается в файл.
+	ErrUploadCompleting = repository.ErrUploadCompleting
+	// ErrInvalidNamespace - некорректное имя пространства имён.
+	ErrInvalidNamespace = errors.New("invalid namespace name")
+	// ErrNamespaceNotFound - пространство имён не найдено.
+	ErrNamespaceNotFound = repository.ErrNamespaceNotFound
+	// ErrNamespaceExists - пространство имён с таким именем уже есть.
+	ErrNamespaceExists = repository.ErrAlreadyExists
+	// ErrInvalidObjectKey - некорректный ключ объекта.
+	ErrInvalidObjectKey = errors.New("invalid object key")
+	// ErrInvalidVersionID - некорректный ID версии объекта.
+	ErrInvalidVersionID = errors.New("invalid version id")
+	// ErrDeleteMarker - версия объекта является маркером удаления и не имеет содержимого.
+	ErrDeleteMarker = errors.New("version is a delete marker")
+	// ErrInvalidLifecycleRule - некорректное правило жизненного цикла объектов.
+	ErrInvalidLifecycleRule = errors.New("invalid lifecycle rule")
+	// ErrPreconditionFailed - текущее содержимое объекта или файла не удовлетворяет условию If-Match.
+	ErrPreconditionFailed = repository.ErrPreconditionFailed
+	// ErrInvalidFileFilter - некорректные условия или курсор списка файлов.
+	ErrInvalidFileFilter = errors.New("invalid file filter")
+	// ErrEncryptionDisabled - шифрование содержимого выключено (не задан файл мастер-ключей).
+	ErrEncryptionDisabled = errors.New("encryption is disabled")
+	// ErrKeyUnavailable - не удалось расшифровать ключ данных содержимого.
+	ErrKeyUnavailable = errors.New("data key is unavailable")
+)
+
+// BucketError - ошибка работы с частью файла в бакете.
+// Err - одна из ошибок ErrPartNotFound, ErrBucketUnreachable, ErrBucketTimeout, ErrCorrupted
+// или другая ошибка запроса.
+type BucketError struct {
+	BucketID int64
+	Err      error
+}
+
+func (e *BucketError) Error() string {
+	return fmt.Sprintf("bucket %d: %s", e.BucketID, e.Err)
+}
+
+func (e *BucketError) Unwrap() error {
+	return e.Err
+}
+
+// PartialDeleteError - ошибка частичного удаления файла: метаданные удалены,
+// но части файла в некоторых бакетах удалить не удалось. Они останутся в очереди
+// pending_delete и будут удалены повторными попытками.
+type PartialDeleteError struct {
+	ID        uuid.UUID
+	BucketIDs []int64
+}
+
+func (e *PartialDeleteError) Error() string {
+	return fmt.Sprintf("file %s: parts in buckets %v are pending deletion", e.ID, e.BucketIDs)
+}
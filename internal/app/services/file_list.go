@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/models"
+)
+
+const (
+	// DefaultFileListLimit - размер страницы списка файлов по умолчанию.
+	DefaultFileListLimit = 100
+	// MaxFileListLimit - максимальный размер страницы списка файлов.
+	MaxFileListLimit = 1000
+)
+
+// ListFiles возвращает страницу списка файлов, отобранных по условиям filter.
+// Если filter.Cursor задан, список продолжается с позиции, на которой закончилась предыдущая страница;
+// курсор действителен только для той же сортировки.
+func (s *ServiceA) ListFiles(ctx context.Context, filter *models.FileFilter) (*models.FileList, error) {
+	const op = "serviceA.ListFiles"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	if err := validateFileFilter(filter); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	after, err := decodeFileCursor(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Запрашиваем на одну запись больше, чтобы узнать, есть ли продолжение списка.
+	files, err := s.storage.ListFiles(ctx, filter, after, filter.Limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	list := &models.FileList{Files: files}
+	if len(files) > filter.Limit {
+		list.Files = files[:filter.Limit]
+		list.NextCursor = encodeFileCursor(filter, list.Files[filter.Limit-1])
+	}
+
+	return list, nil
+}
+
+// validateFileFilter проверяет условия списка файлов и подставляет значения по умолчанию.
+func validateFileFilter(filter *models.FileFilter) error {
+	switch filter.Sort {
+	case "":
+		filter.Sort = models.FileSortCreatedAt
+	case models.FileSortCreatedAt, models.FileSortFileName, models.FileSortSize:
+	default:
+		return fmt.Errorf("%w: unknown sort field %q", ErrInvalidFileFilter, filter.Sort)
+	}
+
+	switch {
+	case filter.Limit < 0 || filter.Limit > MaxFileListLimit:
+		return fmt.Errorf("%w: limit must be from 1 to %d", ErrInvalidFileFilter, MaxFileListLimit)
+	case filter.Limit == 0:
+		filter.Limit = DefaultFileListLimit
+	}
+
+	if filter.MinSize < 0 || filter.MaxSize < 0 {
+		return fmt.Errorf("%w: size must not be negative", ErrInvalidFileFilter)
+	}
+
+	return nil
+}
+
+// encodeFileCursor возвращает курсор списка файлов, который указывает на позицию после файла last.
+func encodeFileCursor(filter *models.FileFilter, last *models.FileInfo) string {
+	cursor := models.FileCursor{Sort: filter.Sort, Desc: filter.Desc, UUID: last.UUID}
+	switch filter.Sort {
+	case models.FileSortFileName:
+		cursor.FileName = last.FileName
+	case models.FileSortSize:
+		cursor.Size = last.Size
+	default:
+		cursor.CreatedAt = last.CreatedAt
+	}
+
+	data, _ := json.Marshal(cursor)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeFileCursor возвращает позицию в списке файлов из filter.Cursor (nil, если курсор не задан).
+func decodeFileCursor(filter *models.FileFilter) (*models.FileCursor, error) {
+	if filter.Cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(filter.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidFileFilter)
+	}
+
+	var cursor models.FileCursor
+	if err = json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidFileFilter)
+	}
+
+	if cursor.Sort != filter.Sort || cursor.Desc != filter.Desc {
+		return nil, fmt.Errorf("%w: cursor was issued for another sort order", ErrInvalidFileFilter)
+	}
+
+	return &cursor, nil
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+)
+
+// partReader - открытый на чтение диапазон части файла известной длины.
+type partReader struct {
+	io.ReadCloser
+	length int64
+}
+
+// partsReader последовательно читает открытые диапазоны частей файла.
+// Если часть закончилась раньше ожидаемого, возвращается io.ErrUnexpectedEOF,
+// чтобы усечённый файл не был отдан как целый.
+type partsReader struct {
+	parts   []partReader
+	current int
+	read    int64
+}
+
+func newPartsReader(parts []partReader) *partsReader {
+	return &partsReader{parts: parts}
+}
+
+func (r *partsReader) Read(p []byte) (int, error) {
+	for r.current < len(r.parts) {
+		part := r.parts[r.current]
+
+		remaining := part.length - r.read
+		if remaining == 0 {
+			r.current++
+			r.read = 0
+
+			continue
+		}
+		if int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+
+		n, err := part.Read(p)
+		r.read += int64(n)
+
+		if errors.Is(err, io.EOF) {
+			if r.read < part.length {
+				return n, io.ErrUnexpectedEOF
+			}
+			err = nil
+		}
+
+		return n, err
+	}
+
+	return 0, io.EOF
+}
+
+// Close закрывает все части файла.
+func (r *partsReader) Close() error {
+	var errs []error
+	for _, part := range r.parts {
+		errs = append(errs, part.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// fileSectionReader - диапазон файла из кэша на диске.
+type fileSectionReader struct {
+	*io.SectionReader
+	file *os.File
+}
+
+func (r fileSectionReader) Close() error {
+	return r.file.Close()
+}
+
+// zeroReader - бесконечный поток нулевых байт. Используется для дополнения коротких частей с данными
+// до размера части чётности при восстановлении части файла.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+
+	return len(p), nil
+}
+
+func (zeroReader) Close() error {
+	return nil
+}
+
+// multiCloser закрывает сразу несколько потоков.
+type multiCloser []io.Closer
+
+func (c multiCloser) Close() error {
+	var errs []error
+	for _, closer := range c {
+		errs = append(errs, closer.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// checksumReader проверяет контрольную сумму SHA-256 потока длины length.
+// Если сумма не совпала, последний блок данных не отдаётся, а возвращается ErrCorrupted,
+// чтобы повреждённые данные не были переданы целиком.
+type checksumReader struct {
+	io.ReadCloser
+	hash      hash.Hash
+	expected  string
+	remaining int64
+	err       error
+}
+
+func newChecksumReader(source io.ReadCloser, expected string, length int64) *checksumReader {
+	return &checksumReader{
+		ReadCloser: source,
+		hash:       sha256.New(),
+		expected:   expected,
+		remaining:  length,
+	}
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+	r.remaining -= int64(n)
+
+	if r.remaining == 0 {
+		if hex.EncodeToString(r.hash.Sum(nil)) != r.expected {
+			r.err = ErrCorrupted
+			return 0, r.err
+		}
+
+		return n, io.EOF
+	}
+
+	return n, err
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"io"
 	"log/slog"
 	"time"
 
@@ -24,3 +25,56 @@ type IService interface {
 	health.LivenessChecker
 	health.ReadinessChecker
 }
+
+// IServiceA - методы, которые есть только у сервиса A.
+type IServiceA interface {
+	IService
+
+	GetFileMetadata(ctx context.Context, id uuid.UUID) (*models.MetadataItem, error)
+	ListFiles(ctx context.Context, filter *models.FileFilter) (*models.FileList, error)
+	OpenFile(ctx context.Context, metadata *models.MetadataItem, offset, length int64) (io.ReadCloser, error)
+	RetryPendingDeletes(d time.Duration)
+	RegisterBucket(ctx context.Context, item *models.ServerBucketInfo) error
+	WatchBuckets(d time.Duration)
+	RefreshBucketStats(d time.Duration)
+	Rebalance(d time.Duration)
+	GetRebalanceStatus() models.RebalanceStatus
+	Scrub(d time.Duration)
+	GetScrubStatus() models.ScrubStatus
+	CreateUpload(ctx context.Context, fileName, contentType string) (uuid.UUID, error)
+	GetUpload(ctx context.Context, id uuid.UUID) (*models.UploadInfo, error)
+	PutUploadPart(ctx context.Context, id uuid.UUID, partNumber int, source io.Reader) (*models.UploadPartItem, error)
+	CompleteUpload(ctx context.Context, id uuid.UUID) (uuid.UUID, error)
+	AbortUpload(ctx context.Context, id uuid.UUID) error
+	ExpireUploads(d time.Duration)
+	CreateNamespace(ctx context.Context, name string) (*models.NamespaceItem, error)
+	GetNamespace(ctx context.Context, name string) (*models.NamespaceItem, error)
+	PutObject(ctx context.Context, namespace, key string, source *models.FileItem, ifMatch models.IfMatch) (*models.ObjectItem, error)
+	GetObject(ctx context.Context, namespace, key string) (*models.ObjectItem, error)
+	DeleteObject(ctx context.Context, namespace, key string, ifMatch models.IfMatch) (*models.ObjectVersion, error)
+	EnableVersioning(ctx context.Context, name string) (*models.NamespaceItem, error)
+	GetObjectVersion(ctx context.Context, namespace, key, versionID string) (*models.ObjectVersion, error)
+	ListObjectVersions(ctx context.Context, namespace, key string) (*models.ObjectVersionList, error)
+	RestoreObjectVersion(ctx context.Context, namespace, key, versionID string) (*models.ObjectItem, error)
+	ListObjects(ctx context.Context, namespace, prefix, delimiter, after string, limit int) (*models.ObjectList, error)
+	PutLifecycleRules(ctx context.Context, namespace string, config *models.LifecycleConfiguration) (*models.LifecycleConfiguration, error)
+	GetLifecycleRules(ctx context.Context, namespace string) (*models.LifecycleConfiguration, error)
+	ApplyLifecycle(d time.Duration)
+	CreateAPIKey(ctx context.Context, request *models.CreateAPIKeyRequest) (*models.APIKey, error)
+	GetAPIKey(ctx context.Context, id string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context) (*models.APIKeyList, error)
+	DeleteAPIKey(ctx context.Context, id string) error
+	CreatePresignedUpload(ctx context.Context, request *models.PresignRequest) (*models.PresignedUpload, error)
+	ConsumePresignedUpload(ctx context.Context, id string) (*models.PresignedUpload, error)
+	RestorePresignedUpload(ctx context.Context, upload *models.PresignedUpload) error
+	RotateDataKeys(ctx context.Context) (*models.KeyRotation, error)
+	RotateKeys(d time.Duration)
+}
+
+// IServiceB - методы, которые есть только у сервиса B.
+type IServiceB interface {
+	IService
+
+	GetStats(ctx context.Context) (*models.BucketStats, error)
+	CheckFileItem(ctx context.Context, id uuid.UUID) (int64, string, error)
+}
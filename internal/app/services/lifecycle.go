@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/lib/logger/sl"
+	"karma8/internal/models"
+)
+
+const (
+	// maxLifecycleRules - максимальное количество правил жизненного цикла пространства имён.
+	maxLifecycleRules = 100
+	// lifecyclePageSize - количество объектов или версий, читаемых за один запрос при применении правил.
+	lifecyclePageSize = 100
+)
+
+// validateLifecycleRules проверяет правила жизненного цикла: у каждого правила должно быть хотя бы одно действие.
+func validateLifecycleRules(rules []*models.LifecycleRule) error {
+	if len(rules) > maxLifecycleRules {
+		return fmt.Errorf("%w: at most %d rules are allowed", ErrInvalidLifecycleRule, maxLifecycleRules)
+	}
+
+	for i, rule := range rules {
+		switch {
+		case rule == nil:
+			return fmt.Errorf("%w: rule %d is empty", ErrInvalidLifecycleRule, i)
+		case len(rule.Prefix) > MaxObjectKeyLength || !utf8.ValidString(rule.Prefix):
+			return fmt.Errorf("%w: rule %d: prefix must be valid UTF-8 up to %d bytes long",
+				ErrInvalidLifecycleRule, i, MaxObjectKeyLength)
+		case rule.ExpireDays < 0 || rule.KeepVersions < 0:
+			return fmt.Errorf("%w: rule %d: expire_days and keep_versions must be positive", ErrInvalidLifecycleRule, i)
+		case rule.ExpireDays == 0 && rule.ExpireAt == nil && rule.KeepVersions == 0:
+			return fmt.Errorf("%w: rule %d has no action", ErrInvalidLifecycleRule, i)
+		}
+	}
+
+	return nil
+}
+
+// PutLifecycleRules заменяет правила жизненного цикла объектов пространства имён namespace и возвращает их.
+// Пустой список правил удаляет все правила. Если пространства имён нет, возвращается ErrNamespaceNotFound.
+func (s *ServiceA) PutLifecycleRules(
+	ctx context.Context,
+	namespace string,
+	config *models.LifecycleConfiguration,
+) (*models.LifecycleConfiguration, error) {
+	const op = "serviceA.PutLifecycleRules"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	if err := validateLifecycleRules(config.Rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, rule := range config.Rules {
+		// Время в БД хранится в UTC без часового пояса.
+		if rule.ExpireAt != nil {
+			expireAt := rule.ExpireAt.UTC()
+			rule.ExpireAt = &expireAt
+		}
+	}
+
+	if err := s.storage.SetLifecycleRules(ctx, namespace, config.Rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return s.GetLifecycleRules(ctx, namespace)
+}
+
+// GetLifecycleRules возвращает правила жизненного цикла объектов пространства имён namespace.
+// Если пространства имён нет, возвращается ErrNamespaceNotFound.
+func (s *ServiceA) GetLifecycleRules(ctx context.Context, namespace string) (*models.LifecycleConfiguration, error) {
+	const op = "serviceA.GetLifecycleRules"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	if _, err := s.storage.GetNamespace(ctx, namespace); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rules, err := s.storage.GetLifecycleRules(ctx, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &models.LifecycleConfiguration{Rules: rules}, nil
+}
+
+// ApplyLifecycle запускает периодическое применение правил жизненного цикла: удаление объектов,
+// срок хранения которых истёк, и безвозвратное удаление старых версий объектов.
+func (s *ServiceA) ApplyLifecycle(d time.Duration) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.runApplyLifecycle(context.Background(), time.Now().UTC())
+	}
+}
+
+// runApplyLifecycle применяет все правила жизненного цикла на момент current.
+func (s *ServiceA) runApplyLifecycle(ctx context.Context, current time.Time) {
+	unlock, err := s.storage.TryLock(ctx, lifecycleLockKey)
+	if err != nil {
+		s.log.Error("ApplyLifecycle TryLock", sl.Err(err))
+		return
+	}
+	if unlock == nil {
+		// Правила применяет другой экземпляр service_a.
+		return
+	}
+	defer unlock()
+
+	rules, err := s.storage.ListLifecycleRules(ctx)
+	if err != nil {
+		s.log.Error("ListLifecycleRules", sl.Err(err))
+		return
+	}
+
+	var expired, purged int
+	for _, rule := range rules {
+		expired += s.expireObjects(ctx, rule, current)
+		if rule.KeepVersions > 0 {
+			purged += s.purgeVersions(ctx, rule)
+		}
+	}
+
+	if expired > 0 || purged > 0 {
+		s.log.Info("ApplyLifecycle", "expired", expired, "purged", purged)
+	}
+}
+
+// lifecycleCutoff возвращает момент, изменённые до которого объекты истекли по правилу rule к моменту current,
+// или нулевое время, если таких объектов нет.
+func lifecycleCutoff(rule *models.LifecycleRule, current time.Time) time.Time {
+	var cutoff time.Time
+	if rule.ExpireDays > 0 {
+		cutoff = current.AddDate(0, 0, -rule.ExpireDays)
+	}
+	if rule.ExpireAt != nil && !current.Before(*rule.ExpireAt) && rule.ExpireAt.After(cutoff) {
+		cutoff = *rule.ExpireAt
+	}
+
+	return cutoff
+}
+
+// expireObjects удаляет объекты, истёкшие по правилу rule к моменту current, и возвращает их количество.
+// Объекты удаляются как через API: в пространстве имён с версионированием создаётся маркер удаления.
+func (s *ServiceA) expireObjects(ctx context.Context, rule *models.LifecycleRule, current time.Time) int {
+	cutoff := lifecycleCutoff(rule, current)
+	if cutoff.IsZero() {
+		return 0
+	}
+
+	var count int
+	for {
+		items, err := s.storage.ListExpiredObjects(ctx, rule.Namespace, rule.Prefix, cutoff, lifecyclePageSize)
+		if err != nil {
+			s.log.Error("ListExpiredObjects", "namespace", rule.Namespace, sl.Err(err))
+			return count
+		}
+
+		var deleted int
+		for _, item := range items {
+			// Условие по содержимому не даёт удалить объект, перезаписанный после чтения списка.
+			_, err = s.DeleteObject(ctx, item.Namespace, item.Key, models.IfMatch{item.Checksum})
+			var partialErr *PartialDeleteError
+			switch {
+			case err == nil, errors.As(err, &partialErr):
+				deleted++
+			case errors.Is(err, ErrNotFound), errors.Is(err, ErrPreconditionFailed):
+			default:
+				s.log.Error("ApplyLifecycle DeleteObject", "namespace", item.Namespace, "key", item.Key, sl.Err(err))
+			}
+		}
+		count += deleted
+
+		if len(items) < lifecyclePageSize || deleted == 0 {
+			return count
+		}
+	}
+}
+
+// purgeVersions безвозвратно удаляет версии объектов сверх rule.KeepVersions последних и возвращает их количество.
+// Последняя версия объекта не удаляется никогда, поэтому файл текущего содержимого объекта остаётся.
+func (s *ServiceA) purgeVersions(ctx context.Context, rule *models.LifecycleRule) int {
+	var count int
+	for {
+		items, err := s.storage.ListExcessVersions(ctx, rule.Namespace, rule.Prefix, rule.KeepVersions, lifecyclePageSize)
+		if err != nil {
+			s.log.Error("ListExcessVersions", "namespace", rule.Namespace, sl.Err(err))
+			return count
+		}
+
+		var deleted int
+		for _, item := range items {
+			if item.DeleteMarker {
+				err = s.storage.DeleteDeleteMarker(ctx, item.VersionID)
+			} else {
+				// Запись версии удаляется вместе с её файлом.
+				err = s.DeleteFileItem(ctx, item.FileID)
+			}
+
+			var partialErr *PartialDeleteError
+			switch {
+			case err == nil, errors.As(err, &partialErr):
+				deleted++
+			case errors.Is(err, ErrNotFound):
+			default:
+				s.log.Error("ApplyLifecycle purge version", "namespace", item.Namespace, "key", item.Key,
+					"version", item.VersionID, sl.Err(err))
+			}
+		}
+		count += deleted
+
+		if len(items) < lifecyclePageSize || deleted == 0 {
+			return count
+		}
+	}
+}
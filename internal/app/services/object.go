@@ -0,0 +1,322 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"karma8/internal/app/processes"
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/lib/logger/sl"
+	"karma8/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxObjectKeyLength - максимальная длина ключа объекта в байтах (как в S3).
+	MaxObjectKeyLength = 1024
+	// maxKeyRune - символ, который больше любого символа ключа: cp + maxKeyRune больше всех ключей с префиксом cp.
+	maxKeyRune = "\U0010FFFF"
+)
+
+// namespaceNameRe - имя пространства имён по правилам имён бакетов S3: от 3 до 63 символов,
+// строчные латинские буквы, цифры, точки и дефисы; в начале и в конце - буква или цифра.
+var namespaceNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// validateNamespace проверяет имя пространства имён.
+func validateNamespace(name string) error {
+	if !namespaceNameRe.MatchString(name) || strings.Contains(name, "..") {
+		return fmt.Errorf("%w: %q", ErrInvalidNamespace, name)
+	}
+
+	return nil
+}
+
+// validateObjectKey проверяет ключ объекта.
+func validateObjectKey(key string) error {
+	if key == "" || len(key) > MaxObjectKeyLength || !utf8.ValidString(key) {
+		return fmt.Errorf("%w: key must be valid UTF-8 from 1 to %d bytes long", ErrInvalidObjectKey, MaxObjectKeyLength)
+	}
+
+	return nil
+}
+
+// objectFileName возвращает имя файла объекта: последний сегмент ключа, обрезанный до размера поля filename в БД.
+func objectFileName(key string) string {
+	name := []rune(path.Base(key))
+	if len(name) > maxUploadFileNameLength {
+		name = name[len(name)-maxUploadFileNameLength:]
+	}
+
+	return string(name)
+}
+
+// CreateNamespace создаёт пространство имён объектов и возвращает его.
+// Если пространство имён с таким именем уже есть, возвращается ErrNamespaceExists.
+func (s *ServiceA) CreateNamespace(ctx context.Context, name string) (*models.NamespaceItem, error) {
+	const op = "serviceA.CreateNamespace"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	if err := validateNamespace(name); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	namespace := &models.NamespaceItem{Name: name}
+	if err := s.storage.CreateNamespace(ctx, namespace); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return namespace, nil
+}
+
+// GetNamespace возвращает пространство имён объектов или ErrNamespaceNotFound.
+func (s *ServiceA) GetNamespace(ctx context.Context, name string) (*models.NamespaceItem, error) {
+	const op = "serviceA.GetNamespace"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	namespace, err := s.storage.GetNamespace(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return namespace, nil
+}
+
+// PutObject сохраняет содержимое source как объект с ключом key в пространстве имён namespace.
+// Содержимое сохраняется новым файлом; если объект с таким ключом уже был, он заменяется, а его прежний файл удаляется.
+// Если текущее содержимое объекта не удовлетворяет условию ifMatch, объект не меняется и возвращается ErrPreconditionFailed.
+func (s *ServiceA) PutObject(
+	ctx context.Context,
+	namespace, key string,
+	source *models.FileItem,
+	ifMatch models.IfMatch,
+) (*models.ObjectItem, error) {
+	const op = "serviceA.PutObject"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	if err := validateObjectKey(key); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Не принимаем данные для несуществующего пространства имён.
+	if _, err := s.storage.GetNamespace(ctx, namespace); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	checksum, size, err := processes.WriteFileStream(source.Content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	newID, err := s.storeFile(ctx, checksum, size, objectFileName(key), source.FileContentType)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	object := &models.ObjectItem{
+		Namespace:   namespace,
+		Key:         key,
+		FileID:      newID,
+		Size:        size,
+		Checksum:    checksum,
+		ContentType: source.FileContentType,
+	}
+
+	oldID, err := s.storage.PutObject(ctx, object, ifMatch)
+	if err != nil {
+		s.rollbackFile(ctx, newID)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if oldID != uuid.Nil {
+		s.deleteObjectFile(ctx, oldID)
+	}
+
+	return object, nil
+}
+
+// GetObject возвращает объект с ключом key в пространстве имён namespace.
+// Если объекта нет, возвращается ErrNotFound, а если нет пространства имён - ErrNamespaceNotFound.
+func (s *ServiceA) GetObject(ctx context.Context, namespace, key string) (*models.ObjectItem, error) {
+	const op = "serviceA.GetObject"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	object, err := s.storage.GetObject(ctx, namespace, key)
+	if errors.Is(err, ErrNotFound) {
+		if _, nsErr := s.storage.GetNamespace(ctx, namespace); nsErr != nil {
+			err = nsErr
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return object, nil
+}
+
+// DeleteObject удаляет объект с ключом key из пространства имён namespace.
+// Без версионирования объект удаляется вместе с его файлом, и возвращается описание удалённой версии
+// без ID (FileID - ID удалённого файла); если часть файла удалить не удалось, вместе с ним возвращается
+// PartialDeleteError. С версионированием файлы сохраняются в версиях, а возвращается новый маркер удаления.
+// Если объекта нет, возвращается ErrNotFound, а если нет пространства имён - ErrNamespaceNotFound.
+// Если содержимое объекта не удовлетворяет условию ifMatch (в том числе если объект заменён во время удаления),
+// возвращается ErrPreconditionFailed.
+func (s *ServiceA) DeleteObject(
+	ctx context.Context,
+	namespace, key string,
+	ifMatch models.IfMatch,
+) (*models.ObjectVersion, error) {
+	const op = "serviceA.DeleteObject"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	ns, err := s.storage.GetNamespace(ctx, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if ns.Versioning {
+		marker, err := s.storage.DeleteObjectVersioned(ctx, namespace, key, ifMatch)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return marker, nil
+	}
+
+	object, err := s.storage.GetObject(ctx, namespace, key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !ifMatch.Matches(object.Checksum) {
+		return nil, fmt.Errorf("%s: %w", op, ErrPreconditionFailed)
+	}
+
+	deleted := &models.ObjectVersion{
+		Namespace:   namespace,
+		Key:         key,
+		FileID:      object.FileID,
+		Size:        object.Size,
+		Checksum:    object.Checksum,
+		ContentType: object.ContentType,
+		CreatedAt:   object.UpdatedAt,
+	}
+
+	// Запись объекта удаляется вместе с файлом. Если файл уже удалён (например, одновременным запросом
+	// или заменой объекта), объекта с этим файлом тоже нет.
+	err = s.DeleteFileItem(ctx, object.FileID)
+	if errors.Is(err, ErrNotFound) && ifMatch != nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrPreconditionFailed)
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return deleted, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deleted, nil
+}
+
+// deleteObjectFile удаляет прежний файл объекта после замены объекта новым содержимым.
+// Ошибки только записываются в журнал: части, которые не удалось удалить, удаляются повторными попытками.
+func (s *ServiceA) deleteObjectFile(ctx context.Context, id uuid.UUID) {
+	err := s.DeleteFileItem(context.WithoutCancel(ctx), id)
+
+	var partialErr *PartialDeleteError
+	if err != nil && !errors.Is(err, ErrNotFound) && !errors.As(err, &partialErr) {
+		s.log.Error("deleteObjectFile", "id", id.String(), sl.Err(err))
+	}
+}
+
+// ListObjects возвращает до limit записей списка объектов пространства имён namespace с ключами,
+// которые начинаются с prefix и больше after, в порядке ключей.
+// Если delimiter задан, объекты, в ключах которых после prefix есть delimiter, заменяются в списке
+// общим префиксом ключа до delimiter включительно (одна запись на префикс).
+func (s *ServiceA) ListObjects(
+	ctx context.Context,
+	namespace, prefix, delimiter, after string,
+	limit int,
+) (*models.ObjectList, error) {
+	const op = "serviceA.ListObjects"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	if _, err := s.storage.GetNamespace(ctx, namespace); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	list := &models.ObjectList{
+		Objects:        make([]*models.ObjectItem, 0),
+		CommonPrefixes: make([]string, 0),
+	}
+
+	// Если список продолжается с общего префикса (или ключа внутри него), пропускаем все ключи с этим префиксом.
+	cursor := after
+	if cp := commonPrefix(after, prefix, delimiter); cp != "" {
+		cursor = max(cursor, cp+maxKeyRune)
+	}
+
+	for {
+		count := len(list.Objects) + len(list.CommonPrefixes)
+		// Запрашиваем на одну запись больше, чтобы узнать, есть ли продолжение списка.
+		pageSize := limit - count + 1
+
+		items, err := s.storage.ListObjects(ctx, namespace, prefix, cursor, pageSize)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		skipped := false
+		for _, item := range items {
+			if len(list.Objects)+len(list.CommonPrefixes) == limit {
+				list.IsTruncated = true
+				return list, nil
+			}
+
+			if cp := commonPrefix(item.Key, prefix, delimiter); cp != "" {
+				// Остальные ключи с этим префиксом пропускаем следующим запросом.
+				list.CommonPrefixes = append(list.CommonPrefixes, cp)
+				list.NextAfter = cp
+				cursor = cp + maxKeyRune
+				skipped = true
+
+				break
+			}
+
+			list.Objects = append(list.Objects, item)
+			list.NextAfter = item.Key
+			cursor = item.Key
+		}
+
+		if !skipped && len(items) < pageSize {
+			return list, nil
+		}
+	}
+}
+
+// commonPrefix возвращает общий префикс ключа key до delimiter включительно, если после prefix
+// в ключе есть delimiter, иначе - пустую строку.
+func commonPrefix(key, prefix, delimiter string) string {
+	if delimiter == "" || !strings.HasPrefix(key, prefix) {
+		return ""
+	}
+
+	i := strings.Index(key[len(prefix):], delimiter)
+	if i < 0 {
+		return ""
+	}
+
+	return key[:len(prefix)+i+len(delimiter)]
+}
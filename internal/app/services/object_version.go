@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// EnableVersioning включает версионирование пространства имён name: после этого каждая запись объекта
+// создаёт новую неизменяемую версию, а удаление - маркер удаления. Выключить версионирование нельзя.
+func (s *ServiceA) EnableVersioning(ctx context.Context, name string) (*models.NamespaceItem, error) {
+	const op = "serviceA.EnableVersioning"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	namespace, err := s.storage.EnableVersioning(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return namespace, nil
+}
+
+// GetObjectVersion возвращает версию versionID объекта с ключом key в пространстве имён namespace.
+// Если версии нет, возвращается ErrNotFound, а если нет пространства имён - ErrNamespaceNotFound.
+func (s *ServiceA) GetObjectVersion(ctx context.Context, namespace, key, versionID string) (*models.ObjectVersion, error) {
+	const op = "serviceA.GetObjectVersion"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	id, err := uuid.Parse(versionID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %q", op, ErrInvalidVersionID, versionID)
+	}
+
+	if _, err = s.storage.GetNamespace(ctx, namespace); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	version, err := s.storage.GetObjectVersion(ctx, namespace, key, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return version, nil
+}
+
+// ListObjectVersions возвращает версии объекта с ключом key в пространстве имён namespace, от последней к первой.
+// Если объект записан без версионирования, список пуст.
+func (s *ServiceA) ListObjectVersions(ctx context.Context, namespace, key string) (*models.ObjectVersionList, error) {
+	const op = "serviceA.ListObjectVersions"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	if _, err := s.storage.GetNamespace(ctx, namespace); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	versions, err := s.storage.ListObjectVersions(ctx, namespace, key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &models.ObjectVersionList{Versions: versions}, nil
+}
+
+// RestoreObjectVersion делает содержимое версии versionID текущим содержимым объекта: записывает его
+// новой версией, как при PutObject. Содержимое не копируется - новый файл ссылается на содержимое версии.
+// Маркер удаления восстановить нельзя (ErrDeleteMarker).
+func (s *ServiceA) RestoreObjectVersion(ctx context.Context, namespace, key, versionID string) (*models.ObjectItem, error) {
+	const op = "serviceA.RestoreObjectVersion"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	version, err := s.GetObjectVersion(ctx, namespace, key, versionID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if version.DeleteMarker {
+		return nil, fmt.Errorf("%s: %w", op, ErrDeleteMarker)
+	}
+
+	newID, err := s.storage.CopyFile(ctx, version.FileID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	object := &models.ObjectItem{
+		Namespace:   namespace,
+		Key:         key,
+		FileID:      newID,
+		Size:        version.Size,
+		Checksum:    version.Checksum,
+		ContentType: version.ContentType,
+	}
+
+	oldID, err := s.storage.PutObject(ctx, object, nil)
+	if err != nil {
+		s.rollbackFile(ctx, newID)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if oldID != uuid.Nil {
+		s.deleteObjectFile(ctx, oldID)
+	}
+
+	return object, nil
+}
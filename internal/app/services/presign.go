@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/models"
+)
+
+const (
+	// DefaultPresignTTL и MaxPresignTTL - срок действия подписанной ссылки по умолчанию и максимальный.
+	DefaultPresignTTL = 15 * time.Minute
+	MaxPresignTTL     = 7 * 24 * time.Hour
+	// presignUploadIDBytes - количество случайных байт в ID разрешения на загрузку.
+	presignUploadIDBytes = 16
+)
+
+// PresignExpiresAt возвращает время истечения ссылки со сроком действия expiresIn секунд от момента current
+// (DefaultPresignTTL, если срок не задан) с точностью до секунды.
+func PresignExpiresAt(expiresIn int64, current time.Time) (time.Time, error) {
+	if expiresIn == 0 {
+		return current.Add(DefaultPresignTTL).UTC().Truncate(time.Second), nil
+	}
+	if expiresIn < 0 || expiresIn > int64(MaxPresignTTL/time.Second) {
+		return time.Time{}, fmt.Errorf("%w: expires_in must be between 1 and %d seconds",
+			ErrInvalidPresign, int64(MaxPresignTTL/time.Second))
+	}
+
+	return current.Add(time.Duration(expiresIn) * time.Second).UTC().Truncate(time.Second), nil
+}
+
+// normalizePresignContentType проверяет допустимый тип содержимого (type/subtype или type/*)
+// и возвращает его в нижнем регистре без параметров.
+func normalizePresignContentType(contentType string) (string, error) {
+	if contentType == "" {
+		return "", nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("%w: content_type: %w", ErrInvalidPresign, err)
+	}
+	kind, subtype, ok := strings.Cut(mediaType, "/")
+	if !ok || kind == "*" || subtype == "" {
+		return "", fmt.Errorf("%w: content_type must be type/subtype or type/*", ErrInvalidPresign)
+	}
+
+	return mediaType, nil
+}
+
+// CreatePresignedUpload создаёт разрешение на однократную загрузку файла размером не больше request.MaxSize
+// с типом содержимого request.ContentType. Владельцем загруженного файла станет ключ API запроса.
+func (s *ServiceA) CreatePresignedUpload(ctx context.Context, request *models.PresignRequest) (*models.PresignedUpload, error) {
+	const op = "serviceA.CreatePresignedUpload"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	if request.MaxSize <= 0 {
+		return nil, fmt.Errorf("%s: %w: max_size must be positive", op, ErrInvalidPresign)
+	}
+	expiresAt, err := PresignExpiresAt(request.ExpiresIn, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	contentType, err := normalizePresignContentType(request.ContentType)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := randomString(presignUploadIDBytes, hex.EncodeToString)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	owner, _ := trccontext.APIKeyIDFromContext(ctx)
+
+	upload := &models.PresignedUpload{
+		ID:          id,
+		Owner:       owner,
+		MaxSize:     request.MaxSize,
+		ContentType: contentType,
+		ExpiresAt:   expiresAt,
+	}
+	if err = s.storage.CreatePresignedUpload(ctx, upload); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return upload, nil
+}
+
+// ConsumePresignedUpload использует разрешение на загрузку id: после этого загрузить файл по той же ссылке нельзя.
+// Если разрешения нет, оно уже использовано или истекло, возвращается ErrNotFound.
+func (s *ServiceA) ConsumePresignedUpload(ctx context.Context, id string) (*models.PresignedUpload, error) {
+	const op = "serviceA.ConsumePresignedUpload"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	upload, err := s.storage.ConsumePresignedUpload(ctx, id, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return upload, nil
+}
+
+// RestorePresignedUpload возвращает разрешение на загрузку upload, использованное запросом, который не сохранил файл:
+// загрузку по той же ссылке можно повторить, пока ссылка действует.
+func (s *ServiceA) RestorePresignedUpload(ctx context.Context, upload *models.PresignedUpload) error {
+	const op = "serviceA.RestorePresignedUpload"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	if err := s.storage.RestorePresignedUpload(ctx, upload); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"karma8/internal/app/repository"
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/lib/logger/sl"
+	"karma8/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// rebalancePageSize - количество записей blob, читаемых за один запрос.
+	rebalancePageSize = 100
+	// rebalanceThreshold - допустимое отклонение заполненности бакета от средней (доля средней).
+	rebalanceThreshold = 0.1
+	// rebalanceBytesPerSecond - ограничение скорости переноса частей, чтобы не мешать обычной работе бакетов.
+	rebalanceBytesPerSecond = 8 << 20
+	// rebalancePartTimeout - таймаут переноса одной части.
+	rebalancePartTimeout = 10 * time.Minute
+)
+
+// Rebalance запускает периодический перенос частей файлов из самых заполненных бакетов в наименее заполненные,
+// чтобы новые бакеты принимали на себя и ранее загруженные файлы.
+func (s *ServiceA) Rebalance(d time.Duration) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.runRebalance(context.Background())
+	}
+}
+
+// GetRebalanceStatus возвращает состояние переноса частей файлов между бакетами.
+func (s *ServiceA) GetRebalanceStatus() models.RebalanceStatus {
+	s.rebalanceMu.Lock()
+	defer s.rebalanceMu.Unlock()
+
+	return s.rebalance
+}
+
+// updateRebalanceStatus изменяет состояние переноса частей под блокировкой.
+func (s *ServiceA) updateRebalanceStatus(update func(status *models.RebalanceStatus)) {
+	s.rebalanceMu.Lock()
+	defer s.rebalanceMu.Unlock()
+
+	update(&s.rebalance)
+}
+
+// runRebalance выполняет один проход переноса частей: обходит все файлы и переносит части
+// из переполненных бакетов, пока заполненность бакетов не выровняется.
+func (s *ServiceA) runRebalance(ctx context.Context) {
+	const op = "serviceA.runRebalance"
+
+	unlock, err := s.storage.TryLock(ctx, partsLockKey)
+	if err != nil {
+		s.log.Error("Rebalance TryLock", sl.Err(err))
+		return
+	}
+	if unlock == nil {
+		s.log.Debug("Rebalance is running on another instance")
+		return
+	}
+	defer unlock()
+
+	// Заполненность бакетов должна быть актуальной, иначе части будут перенесены не туда.
+	s.runRefreshBucketStats()
+
+	s.updateRebalanceStatus(func(status *models.RebalanceStatus) {
+		*status = models.RebalanceStatus{
+			Running:   true,
+			StartedAt: time.Now().UTC(),
+		}
+	})
+	defer s.updateRebalanceStatus(func(status *models.RebalanceStatus) {
+		status.Running = false
+		status.FinishedAt = time.Now().UTC()
+	})
+
+	after := uuid.Nil
+	for {
+		items, err := s.storage.GetBlobsPage(ctx, after, rebalancePageSize)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", op, err)
+			s.log.Error("Rebalance GetBlobsPage", sl.Err(err))
+			s.updateRebalanceStatus(func(status *models.RebalanceStatus) {
+				status.LastError = err.Error()
+			})
+
+			return
+		}
+		if len(items) == 0 {
+			break
+		}
+
+		for _, metadata := range items {
+			if !s.rebalanceFile(ctx, metadata) {
+				// Бакеты выровнены - дальше обходить файлы не нужно.
+				return
+			}
+		}
+
+		after = items[len(items)-1].BlobID
+	}
+}
+
+// rebalanceFile переносит части файла из переполненных бакетов и возвращает false,
+// если переполненных бакетов не осталось.
+func (s *ServiceA) rebalanceFile(ctx context.Context, metadata *models.MetadataItem) bool {
+	s.updateRebalanceStatus(func(status *models.RebalanceStatus) {
+		status.FilesScanned++
+	})
+
+	// Файл, части которого ещё записываются в бакеты, не трогаем.
+	if slices.ContainsFunc(metadata.Parts, func(part models.PartItem) bool { return part.Checksum == "" }) {
+		return true
+	}
+
+	for index, part := range metadata.Parts {
+		for _, bucketID := range part.Locations() {
+			if !s.rebalancePart(ctx, metadata, index, bucketID) {
+				return true
+			}
+		}
+	}
+
+	_, _, ok := s.rebalanceBounds()
+
+	return ok
+}
+
+// rebalancePart переносит копию части index файла из бакета bucketID, если он переполнен,
+// и возвращает false, если файл удалён или изменён и переносить его части дальше не нужно.
+func (s *ServiceA) rebalancePart(ctx context.Context, metadata *models.MetadataItem, index int, bucketID int64) bool {
+	part := metadata.Parts[index]
+
+	from, to, ok := s.selectMove(metadata, bucketID, part.Length)
+	if !ok {
+		return true
+	}
+
+	start := time.Now()
+	err := s.movePart(ctx, metadata, index, from, to)
+	if err != nil {
+		s.log.Error("Rebalance movePart",
+			"blobID", metadata.BlobID.String(),
+			"shard", index,
+			"from", from.ID,
+			"to", to.ID,
+			sl.Err(err),
+		)
+		s.updateRebalanceStatus(func(status *models.RebalanceStatus) {
+			status.PartsFailed++
+			status.LastError = err.Error()
+		})
+
+		// Файл удалён или изменён - его остальные части не переносим.
+		return !errors.Is(err, ErrNotFound) && !errors.Is(err, repository.ErrManifestChanged)
+	}
+
+	movePartLocation(&metadata.Parts[index], from.ID, to.ID)
+	s.updateRebalanceStatus(func(status *models.RebalanceStatus) {
+		status.PartsMoved++
+		status.BytesMoved += part.Length
+	})
+
+	// Ограничиваем скорость переноса.
+	pause := time.Duration(float64(part.Length)/rebalanceBytesPerSecond*float64(time.Second)) - time.Since(start)
+	if pause > 0 {
+		time.Sleep(pause)
+	}
+
+	return true
+}
+
+// movePartLocation заменяет бакет from копии части на бакет to.
+func movePartLocation(part *models.PartItem, from, to int64) {
+	if part.BucketID == from {
+		part.BucketID = to
+		return
+	}
+	if i := slices.Index(part.Replicas, from); i >= 0 {
+		part.Replicas[i] = to
+	}
+}
+
+// rebalanceBounds возвращает бакеты, участвующие в переносе (статистика которых получена),
+// и среднюю заполненность бакетов. ok = false, если заполненность всех бакетов близка к средней.
+func (s *ServiceA) rebalanceBounds() ([]*Bucket, int64, bool) {
+	s.mu.RLock()
+	buckets := make([]*Bucket, 0, len(s.buckets))
+	for _, bucket := range s.buckets {
+		if bucket.statsOK.Load() {
+			buckets = append(buckets, bucket)
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(buckets) < 2 {
+		return buckets, 0, false
+	}
+
+	var total int64
+	for _, bucket := range buckets {
+		total += bucket.used.Load()
+	}
+	average := total / int64(len(buckets))
+	limit := int64(float64(average) * (1 + rebalanceThreshold))
+
+	for _, bucket := range buckets {
+		if bucket.used.Load() > limit {
+			return buckets, average, true
+		}
+	}
+
+	return buckets, average, false
+}
+
+// selectMove выбирает, нужно ли переносить копию части файла длины length из бакета bucketID:
+// копия переносится из переполненного бакета в наименее заполненный бакет, в котором ещё нет частей
+// этого файла, если после переноса новый бакет останется менее заполненным, чем старый.
+func (s *ServiceA) selectMove(metadata *models.MetadataItem, bucketID int64, length int64) (*Bucket, *Bucket, bool) {
+	buckets, average, ok := s.rebalanceBounds()
+	if !ok {
+		return nil, nil, false
+	}
+
+	from := s.getBucket(bucketID)
+	if from == nil || !from.statsOK.Load() {
+		return nil, nil, false
+	}
+	fromUsed := from.used.Load()
+	if fromUsed <= int64(float64(average)*(1+rebalanceThreshold)) {
+		return nil, nil, false
+	}
+
+	// В каждом бакете может храниться только одна часть файла: части хранятся по ID содержимого (blob).
+	candidates := make([]*Bucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		if !slices.ContainsFunc(metadata.Parts, func(p models.PartItem) bool { return slices.Contains(p.Locations(), bucket.ID) }) {
+			candidates = append(candidates, bucket)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil, false
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].used.Load() < candidates[j].used.Load()
+	})
+
+	to := candidates[0]
+	if to.used.Load()+length >= fromUsed-length {
+		return nil, nil, false
+	}
+
+	return from, to, true
+}
+
+// movePart переносит копию части index файла из бакета from в бакет to: копирует часть (с проверкой контрольной суммы),
+// меняет бакет копии в манифесте и затем удаляет старую копию.
+func (s *ServiceA) movePart(ctx context.Context, metadata *models.MetadataItem, index int, from, to *Bucket) error {
+	const op = "serviceA.movePart"
+
+	ctx, cancel := context.WithTimeout(ctx, rebalancePartTimeout)
+	defer cancel()
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	part := metadata.Parts[index]
+
+	body, err := s.getShardRange(ctx, metadata, index, 0, part.Length)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer body.Close()
+
+	checksum, err := to.SendToBucket(ctx, metadata.BlobID, body)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if part.Checksum != "" && checksum != part.Checksum {
+		s.dropPartCopy(ctx, metadata.BlobID, to)
+		return fmt.Errorf("%s: %w", op, &BucketError{BucketID: from.ID, Err: ErrCorrupted})
+	}
+	to.used.Add(part.Length)
+
+	// Манифест меняется только если часть всё ещё хранится в бакете from;
+	// иначе новая копия не нужна.
+	err = s.storage.MovePart(ctx, metadata.BlobID, index, from.ID, to.ID)
+	if err != nil {
+		s.dropPartCopy(ctx, metadata.BlobID, to)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Старая копия уже в очереди на удаление: если удалить её сейчас не удастся, удаление будет повторено в фоне.
+	failed := s.deleteParts(ctx, []models.PendingDeleteItem{{BlobID: metadata.BlobID, BucketID: from.ID}})
+	if len(failed) == 0 {
+		from.used.Add(-part.Length)
+	}
+
+	return nil
+}
+
+// dropPartCopy удаляет из бакета копию части, которая не попала в манифест.
+func (s *ServiceA) dropPartCopy(ctx context.Context, blobID uuid.UUID, bucket *Bucket) {
+	if err := bucket.DeleteFromBucket(context.WithoutCancel(ctx), blobID); err != nil {
+		s.log.Error("Rebalance DeleteFromBucket",
+			"blobID", blobID.String(),
+			"bucketID", bucket.ID,
+			sl.Err(err),
+		)
+	}
+}
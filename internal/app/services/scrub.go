@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/lib/logger/sl"
+	"karma8/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// scrubPageSize - количество записей blob, читаемых за один запрос.
+	scrubPageSize = 100
+	// scrubPartTimeout - таймаут проверки или восстановления одной части.
+	scrubPartTimeout = 10 * time.Minute
+)
+
+// Scrub запускает периодическую проверку целостности частей файлов: все копии всех частей
+// запрашиваются у бакетов (HEAD), отсутствующие и повреждённые копии восстанавливаются.
+func (s *ServiceA) Scrub(d time.Duration) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.runScrub(context.Background())
+	}
+}
+
+// GetScrubStatus возвращает состояние проверки целостности частей файлов.
+func (s *ServiceA) GetScrubStatus() models.ScrubStatus {
+	s.scrubMu.Lock()
+	defer s.scrubMu.Unlock()
+
+	return s.scrub
+}
+
+// updateScrubStatus изменяет состояние проверки целостности под блокировкой.
+func (s *ServiceA) updateScrubStatus(update func(status *models.ScrubStatus)) {
+	s.scrubMu.Lock()
+	defer s.scrubMu.Unlock()
+
+	update(&s.scrub)
+}
+
+// runScrub выполняет один проход проверки: обходит все файлы страницами и проверяет их части.
+func (s *ServiceA) runScrub(ctx context.Context) {
+	const op = "serviceA.runScrub"
+
+	unlock, err := s.storage.TryLock(ctx, partsLockKey)
+	if err != nil {
+		s.log.Error("Scrub TryLock", sl.Err(err))
+		return
+	}
+	if unlock == nil {
+		s.log.Debug("Scrub is running on another instance")
+		return
+	}
+	defer unlock()
+
+	s.updateScrubStatus(func(status *models.ScrubStatus) {
+		*status = models.ScrubStatus{
+			Running:   true,
+			StartedAt: time.Now().UTC(),
+		}
+	})
+	defer s.updateScrubStatus(func(status *models.ScrubStatus) {
+		status.Running = false
+		status.FinishedAt = time.Now().UTC()
+	})
+
+	after := uuid.Nil
+	for {
+		items, err := s.storage.GetBlobsPage(ctx, after, scrubPageSize)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", op, err)
+			s.log.Error("Scrub GetBlobsPage", sl.Err(err))
+			s.updateScrubStatus(func(status *models.ScrubStatus) {
+				status.LastError = err.Error()
+			})
+
+			return
+		}
+		if len(items) == 0 {
+			return
+		}
+
+		for _, metadata := range items {
+			s.scrubFile(ctx, metadata)
+		}
+
+		after = items[len(items)-1].BlobID
+	}
+}
+
+// scrubFile проверяет все копии частей файла и восстанавливает отсутствующие и повреждённые.
+func (s *ServiceA) scrubFile(ctx context.Context, metadata *models.MetadataItem) {
+	s.updateScrubStatus(func(status *models.ScrubStatus) {
+		status.FilesScanned++
+	})
+
+	// Файл, части которого ещё записываются в бакеты, не проверяем.
+	if slices.ContainsFunc(metadata.Parts, func(part models.PartItem) bool { return part.Checksum == "" }) {
+		return
+	}
+
+	var repaired int64
+	var errs []error
+
+	for index, part := range metadata.Parts {
+		for _, bucketID := range part.Locations() {
+			ok, err := s.checkPart(ctx, metadata, index, bucketID)
+			if ok || err != nil {
+				// Бакет недоступен - копию проверим при следующем проходе.
+				continue
+			}
+
+			done, err := s.repairPart(ctx, metadata, index, bucketID)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if done {
+				repaired++
+			}
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		s.log.Error("Scrub repairPart", "blobID", metadata.BlobID.String(), sl.Err(err))
+	}
+	if repaired > 0 {
+		s.log.Info("Scrub repaired parts", "blobID", metadata.BlobID.String(), "count", repaired)
+	}
+
+	s.updateScrubStatus(func(status *models.ScrubStatus) {
+		status.PartsRepaired += repaired
+		if repaired > 0 {
+			status.FilesRepaired++
+		}
+		if len(errs) > 0 {
+			status.FilesUnrecoverable++
+			status.LastError = errs[len(errs)-1].Error()
+		}
+	})
+}
+
+// checkPart проверяет копию части index файла в бакете bucketID: ok = true, если копия есть,
+// и её размер и контрольная сумма совпадают с манифестом. Если бакет недоступен, возвращается ошибка.
+func (s *ServiceA) checkPart(ctx context.Context, metadata *models.MetadataItem, index int, bucketID int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, scrubPartTimeout)
+	defer cancel()
+
+	part := metadata.Parts[index]
+
+	bucket := s.getBucket(bucketID)
+	if bucket == nil {
+		return false, &BucketError{BucketID: bucketID, Err: fmt.Errorf("%w: bucket is not active", ErrBucketUnreachable)}
+	}
+
+	size, checksum, err := bucket.HeadFromBucket(ctx, metadata.BlobID)
+	if errors.Is(err, ErrPartNotFound) {
+		s.log.Warn("Scrub part is missing", "blobID", metadata.BlobID.String(), "shard", index, "bucketID", bucketID)
+		return false, nil
+	}
+	if err != nil {
+		s.log.Error("Scrub HeadFromBucket", "blobID", metadata.BlobID.String(), "bucketID", bucketID, sl.Err(err))
+		return false, err
+	}
+
+	if size != part.Length || checksum != part.Checksum {
+		s.log.Warn("Scrub part is corrupted", "blobID", metadata.BlobID.String(), "shard", index, "bucketID", bucketID)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// repairPart заново записывает копию части index файла в бакет bucketID: данные берутся из другой копии части,
+// а если все копии недоступны - восстанавливаются по остальным частям и частям чётности.
+// Возвращает false, если копия больше не нужна (файл удалён или копия перенесена в другой бакет).
+func (s *ServiceA) repairPart(ctx context.Context, metadata *models.MetadataItem, index int, bucketID int64) (bool, error) {
+	const op = "serviceA.repairPart"
+
+	ctx, cancel := context.WithTimeout(ctx, scrubPartTimeout)
+	defer cancel()
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	// Файл мог быть удалён или изменён после начала прохода - тогда копия не нужна.
+	metadata, err := s.storage.GetBlob(ctx, metadata.BlobID)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	if index >= len(metadata.Parts) || !slices.Contains(metadata.Parts[index].Locations(), bucketID) {
+		return false, nil
+	}
+
+	coding, err := checkManifest(metadata)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	bucket := s.getBucket(bucketID)
+	if bucket == nil {
+		return false, fmt.Errorf("%s: bucket %d is not active", op, bucketID)
+	}
+
+	// Старая копия содержимого в этом бакете могла остаться в очереди на удаление (например, часть была
+	// перенесена из бакета и вернулась в него): иначе повторная попытка удалила бы восстановленную копию.
+	if err = s.storage.DeletePendingDelete(ctx, metadata.BlobID, bucketID); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	part := metadata.Parts[index]
+
+	body, err := s.openShardRange(ctx, metadata, coding, index, 0, part.Length)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	defer body.Close()
+
+	checksum, err := bucket.SendToBucket(ctx, metadata.BlobID, body)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	if checksum != part.Checksum {
+		return false, fmt.Errorf("%s: %w", op, &BucketError{BucketID: bucketID, Err: ErrCorrupted})
+	}
+
+	return true, nil
+}
@@ -1,61 +1,120 @@
 package services
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"karma8/internal/app/processes"
 	"karma8/internal/app/repository"
 	trccontext "karma8/internal/lib/context"
+	"karma8/internal/lib/encryption"
+	"karma8/internal/lib/logger/sl"
 	"karma8/internal/models"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"golang.org/x/sync/errgroup"
 )
 
 type ServiceA struct {
 	log     *slog.Logger
 	storage *repository.Storage
+	coding  processes.ErasureCoding
+	// replicas - количество копий каждой части файла.
+	replicas int
+	// client - HTTP-клиент для запросов к бакетам.
+	client *http.Client
+	// keys - поставщик мастер-ключей; если он задан, новое содержимое хранится в бакетах зашифрованным.
+	keys encryption.KeyProvider
+
+	// mu защищает список бакетов, который обновляется во время работы сервиса.
+	mu      sync.RWMutex
 	buckets []*Bucket
 
-	mu sync.Mutex
+	// rebalanceMu защищает состояние переноса частей между бакетами.
+	rebalanceMu sync.Mutex
+	rebalance   models.RebalanceStatus
+
+	// scrubMu защищает состояние проверки целостности частей.
+	scrubMu sync.Mutex
+	scrub   models.ScrubStatus
 }
 
+const (
+	// pendingDeleteBatch - количество частей, обрабатываемых за один проход повторного удаления.
+	pendingDeleteBatch = 100
+	// pendingDeleteBaseDelay - задержка перед первой повторной попыткой удаления части.
+	pendingDeleteBaseDelay = 30 * time.Second
+	// pendingDeleteMaxDelay - максимальная задержка между повторными попытками удаления части.
+	pendingDeleteMaxDelay = time.Hour
+	// partsLockKey - ключ рекомендательной блокировки Postgres для фоновых задач, меняющих копии частей
+	// в бакетах (перенос и восстановление): их одновременно выполняет только один экземпляр service_a.
+	partsLockKey = 0x6b61726d61380001
+	// lifecycleLockKey - ключ рекомендательной блокировки Postgres для применения правил жизненного цикла объектов.
+	lifecycleLockKey = 0x6b61726d61380002
+	// keyRotationLockKey - ключ рекомендательной блокировки Postgres для перешифрования ключей данных.
+	keyRotationLockKey = 0x6b61726d61380003
+)
+
 var (
 	maxDateTime = time.Date(9999, 12, 31, 23, 59, 59, 999999999, time.UTC)
 )
 
-func NewServiceA(log *slog.Logger, connectString string) (IService, error) {
+// NewServiceA создаёт сервис A; запросы к бакетам выполняются клиентом client (см. NewBucketClient).
+// Если задан поставщик мастер-ключей keys, содержимое новых файлов шифруется перед записью в бакеты.
+func NewServiceA(
+	log *slog.Logger,
+	connectString string,
+	coding processes.ErasureCoding,
+	replicas int,
+	client *http.Client,
+	keys encryption.KeyProvider,
+) (IServiceA, error) {
 	const op = "serviceA.NewServiceA"
 
-	storage, err := repository.New(connectString)
-	if err != nil {
+	if err := coding.Validate(); err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	if replicas < 1 {
+		return nil, fmt.Errorf("%s: %w", op, errors.New("replicas must be at least 1"))
+	}
 
-	bucketsInfo, err := storage.GetBucketsInfo(context.Background())
+	storage, err := repository.New(connectString)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	n := len(bucketsInfo)
-	buckets := make([]*Bucket, n)
+	s := &ServiceA{
+		log:      log,
+		storage:  storage,
+		coding:   coding,
+		replicas: replicas,
+		client:   client,
+		keys:     keys,
+	}
 
-	for i, bucketInfo := range bucketsInfo {
-		buckets[i] = NewBucket(log, bucketInfo.Address, bucketInfo.ID)
+	if err = s.refreshBuckets(context.Background()); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &ServiceA{
-		log:     log,
-		storage: storage,
-		buckets: buckets,
-	}, nil
+	return s, nil
 }
 
-// GetFileItem возвращает файл по его ID.
+// GetFileItem возвращает файл по его ID (содержимое файла целиком загружается в память).
 func (s *ServiceA) GetFileItem(ctx context.Context, id uuid.UUID) (*models.FileItem, error) {
 	const op = "serviceA.GetFileItem"
 
@@ -67,32 +126,69 @@ func (s *ServiceA) GetFileItem(ctx context.Context, id uuid.UUID) (*models.FileI
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Проверяем наличие файла в кэше.
-	fileName := s.storage.GetCacheItem(ctx, metadata.Checksum)
-	if fileName != "" {
-		// Если файл есть в кэше, то возвращаем его.
-		data, err := processes.ReadFile(fileName)
-		if err != nil {
-			return nil, fmt.Errorf("%s: %w", op, err)
-		}
-		return &models.FileItem{
-			FileName:        fileName,
-			FileContentType: metadata.ContentType,
-			FileContent:     data,
-		}, nil
+	reader, err := s.OpenFile(ctx, metadata, 0, metadata.Size)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	defer reader.Close()
 
-	data, err := s.GetFileFromBuckets(ctx, metadata.UUID)
+	data, err := io.ReadAll(reader)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+
 	return &models.FileItem{
+		ID:              id.String(),
 		FileName:        metadata.FileName,
 		FileContentType: metadata.ContentType,
 		FileContent:     data,
 	}, nil
 }
 
+// GetFileMetadata возвращает метаданные файла по его ID.
+func (s *ServiceA) GetFileMetadata(ctx context.Context, id uuid.UUID) (*models.MetadataItem, error) {
+	const op = "serviceA.GetFileMetadata"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	metadata, err := s.storage.GetFileMetadata(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return metadata, nil
+}
+
+// OpenFile открывает на чтение диапазон [offset, offset+length) файла.
+// Если файл есть в кэше, он читается из кэша, иначе части файла читаются потоком из бакетов.
+func (s *ServiceA) OpenFile(ctx context.Context, metadata *models.MetadataItem, offset, length int64) (io.ReadCloser, error) {
+	const op = "serviceA.OpenFile"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	// Проверяем наличие файла в кэше.
+	fileName := s.storage.GetCacheItem(ctx, metadata.Checksum)
+	if fileName != "" {
+		// Открытый файл остаётся доступным для чтения, даже если очистка кэша удалит его.
+		file, err := os.Open(processes.GetFileNameWithPathCache(fileName))
+		if err == nil {
+			return fileSectionReader{
+				SectionReader: io.NewSectionReader(file, offset, length),
+				file:          file,
+			}, nil
+		}
+	}
+
+	reader, err := s.GetFileFromBuckets(ctx, metadata, offset, length)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return reader, nil
+}
+
 // PutFileItem сохраняет файл на сервере и возвращает его ID.
 func (s *ServiceA) PutFileItem(ctx context.Context, source *models.FileItem) (uuid.UUID, error) {
 	const op = "serviceA.PutFileItem"
@@ -100,29 +196,69 @@ func (s *ServiceA) PutFileItem(ctx context.Context, source *models.FileItem) (uu
 	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
 	defer span.End()
 
-	path := processes.GetFileNameWithPathCache(source.FileName)
-	checksum, err := processes.CalculateChecksum(path)
+	// Сохраняем файл в кэш, вычисляя контрольную сумму на лету.
+	checksum, size, err := processes.WriteFileStream(source.Content)
 	if err != nil {
 		return uuid.UUID{}, fmt.Errorf("%s: %w", op, err)
 	}
 
+	newID, err := s.storeFile(ctx, checksum, size, source.FileName, source.FileContentType)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return newID, nil
+}
+
+// storeFile сохраняет файл, уже записанный в кэш под именем checksum: метаданные и части в бакетах.
+// Возвращает ID нового файла.
+func (s *ServiceA) storeFile(ctx context.Context, checksum string, size int64, fileName, contentType string) (uuid.UUID, error) {
+	const op = "serviceA.storeFile"
+
+	path := processes.GetFileNameWithPathCache(checksum)
+
+	// Владелец файла - ключ API, которым аутентифицирован запрос (если аутентификация включена).
+	owner, _ := trccontext.APIKeyIDFromContext(ctx)
+
 	metadata := &models.MetadataItem{
-		UUID:        uuid.UUID{},
-		Checksum:    checksum,
-		FileName:    source.FileName,
-		ContentType: source.FileContentType,
-		BucketIDs:   s.GetBucketsIDs(),
+		UUID:         uuid.UUID{},
+		Checksum:     checksum,
+		FileName:     fileName,
+		ContentType:  contentType,
+		Owner:        owner,
+		BucketIDs:    []int64{},
+		Parts:        []models.PartItem{},
+		Size:         size,
+		DataShards:   s.coding.DataShards,
+		ParityShards: s.coding.ParityShards,
+	}
+	// Пустое содержимое не записывается в бакеты: у него пустой манифест.
+	if size > 0 {
+		if err := s.layoutParts(ctx, metadata); err != nil {
+			return uuid.UUID{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	// Загрузки одинакового содержимого выполняются по очереди: части в бакеты записывает только первая,
+	// а следующие дожидаются её окончания и ссылаются на записанное содержимое. Если первая загрузка
+	// не удалась, её содержимое удаляется, и следующая загрузка записывает его заново.
+	unlock, err := s.storage.Lock(ctx, contentLockKey(checksum))
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("%s: %w", op, err)
 	}
-	// Сохраняем метаданные в БД.
+	defer unlock()
+
+	// Сохраняем метаданные в БД. Если такое содержимое уже хранится, файл ссылается на него,
+	// а в metadata записываются манифест и ключ данных сохранённого содержимого.
 	newID, err := s.storage.PutFileMetadata(ctx, metadata)
 	if err != nil {
 		return uuid.UUID{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Сохраняем файл в кэш.
+	// Сохраняем информацию о файле в кэше.
 	cache := &models.CacheItem{
 		Checksum:  checksum,
-		FileName:  source.FileName,
+		FileName:  checksum,
 		ExpiredAt: time.Now().UTC().Add(3 * time.Minute), // TODO: в настройки.
 	}
 	err = s.storage.PutCacheItem(ctx, cache)
@@ -130,17 +266,428 @@ func (s *ServiceA) PutFileItem(ctx context.Context, source *models.FileItem) (uu
 		return uuid.UUID{}, fmt.Errorf("%s: %w", op, err)
 	}
 
+	// Содержимое уже записано в бакеты при загрузке такого же файла.
+	if !slices.ContainsFunc(metadata.Parts, func(part models.PartItem) bool { return part.Checksum == "" }) {
+		return newID, nil
+	}
+
 	// Раскладываем файл по корзинам (buckets).
-	err = s.PutFileIntoBuckets(ctx, newID, path)
+	err = s.PutFileIntoBuckets(ctx, metadata, path)
+	if err == nil {
+		// Сохраняем манифест с контрольными суммами частей для проверки при чтении.
+		err = s.storage.PutManifest(ctx, metadata.BlobID, metadata.Parts)
+	}
 	if err != nil {
+		s.rollbackFile(ctx, newID)
 		return uuid.UUID{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return newID, nil
 }
 
-// DeleteFileItem удаляет файл по его ID.
-func (s *ServiceA) DeleteFileItem(_ context.Context, _ uuid.UUID) error {
+// contentLockKey возвращает ключ рекомендательной блокировки Postgres для записи содержимого
+// с контрольной суммой checksum.
+func contentLockKey(checksum string) int64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(checksum))
+
+	return int64(hash.Sum64())
+}
+
+// layoutParts составляет манифест содержимого metadata: выбирает бакеты для всех копий частей с данными
+// и частей чётности (каждая копия - в своём бакете) и, если задан поставщик мастер-ключей, ключ данных.
+func (s *ServiceA) layoutParts(ctx context.Context, metadata *models.MetadataItem) error {
+	shards := s.coding.Shards()
+	buckets, err := s.selectBuckets(metadata.Checksum, shards*s.replicas)
+	if err != nil {
+		return err
+	}
+
+	// Содержимое шифруется собственным ключом данных, если задан поставщик мастер-ключей:
+	// части раскладываются по зашифрованному содержимому.
+	stored := metadata.Size
+	if s.keys != nil {
+		metadata.KeyID, metadata.WrappedKey, err = s.newDataKey(ctx)
+		if err != nil {
+			return err
+		}
+		stored = encryption.EncryptedSize(metadata.Size)
+	}
+
+	// Расположение частей в файле и бакеты, в которых хранятся их копии.
+	layout := s.coding.Layout(stored)
+	metadata.Parts = make([]models.PartItem, len(layout))
+	metadata.BucketIDs = make([]int64, 0, len(buckets))
+	for i, part := range layout {
+		metadata.Parts[i] = models.PartItem{
+			Index:    i,
+			BucketID: buckets[i].ID,
+			Offset:   part.Offset,
+			Length:   part.Length,
+		}
+		for r := 1; r < s.replicas; r++ {
+			metadata.Parts[i].Replicas = append(metadata.Parts[i].Replicas, buckets[r*shards+i].ID)
+		}
+		metadata.BucketIDs = append(metadata.BucketIDs, metadata.Parts[i].Locations()...)
+	}
+
+	return nil
+}
+
+// rollbackFile удаляет файл, содержимое которого не удалось записать в бакеты.
+// Если на содержимое больше никто не ссылается, уже записанные части удаляются из бакетов.
+func (s *ServiceA) rollbackFile(ctx context.Context, id uuid.UUID) {
+	err := s.DeleteFileItem(context.WithoutCancel(ctx), id)
+
+	var partialErr *PartialDeleteError
+	if err != nil && !errors.As(err, &partialErr) {
+		s.log.Error("rollbackFile", "id", id.String(), sl.Err(err))
+	}
+}
+
+// DeleteFileItem удаляет файл по его ID. Если на его содержимое больше не ссылается ни один файл,
+// удаляются также запись и файл в кэше и части содержимого в бакетах.
+// Если часть удалить не удалось, возвращается PartialDeleteError, а удаление будет повторено в фоне.
+func (s *ServiceA) DeleteFileItem(ctx context.Context, id uuid.UUID) error {
+	const op = "serviceA.DeleteFileItem"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	// Удаляем метаданные и, если содержимое больше не используется, ставим его части в очередь на удаление.
+	fileName, items, err := s.storage.DeleteFileMetadata(ctx, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Удаляем файл из кэша.
+	if fileName != "" {
+		_ = processes.DeleteFile(fileName)
+	}
+
+	// Удаляем части содержимого из бакетов.
+	failed := s.deleteParts(ctx, items)
+	if len(failed) > 0 {
+		return fmt.Errorf("%s: %w", op, &PartialDeleteError{ID: id, BucketIDs: failed})
+	}
+
+	return nil
+}
+
+// deleteParts удаляет части содержимого из бакетов и возвращает ID бакетов, в которых удалить части не удалось.
+func (s *ServiceA) deleteParts(ctx context.Context, items []models.PendingDeleteItem) []int64 {
+	var eg errgroup.Group
+	var mu sync.Mutex
+	failed := make([]int64, 0)
+
+	for i := range items {
+		item := &items[i]
+		eg.Go(func() error {
+			if err := s.deletePart(ctx, item); err != nil {
+				s.log.Error("deletePart",
+					"blobID", item.BlobID.String(),
+					"bucketID", item.BucketID,
+					"attempts", item.Attempts,
+					sl.Err(err),
+				)
+
+				mu.Lock()
+				failed = append(failed, item.BucketID)
+				mu.Unlock()
+			}
+
+			return nil
+		})
+	}
+
+	_ = eg.Wait()
+
+	sort.Slice(failed, func(i, j int) bool {
+		return failed[i] < failed[j]
+	})
+
+	return failed
+}
+
+// deletePart удаляет часть содержимого из бакета и убирает её из очереди на удаление.
+// При ошибке увеличивает счётчик попыток и назначает время следующей попытки.
+func (s *ServiceA) deletePart(ctx context.Context, item *models.PendingDeleteItem) error {
+	var err error
+
+	bucket := s.getBucket(item.BucketID)
+	if bucket == nil {
+		err = fmt.Errorf("bucket %d is not active", item.BucketID)
+	} else {
+		err = bucket.DeleteFromBucket(ctx, item.BlobID)
+	}
+
+	if err == nil {
+		return s.storage.DeletePendingDelete(ctx, item.BlobID, item.BucketID)
+	}
+
+	item.Attempts++
+	item.LastError = err.Error()
+	item.NextAttemptAt = time.Now().UTC().Add(pendingDeleteDelay(item.Attempts))
+
+	if updateErr := s.storage.UpdatePendingDelete(ctx, item); updateErr != nil {
+		s.log.Error("UpdatePendingDelete", sl.Err(updateErr))
+	}
+
+	return err
+}
+
+// pendingDeleteDelay возвращает задержку перед следующей попыткой удаления (экспоненциально растущую).
+func pendingDeleteDelay(attempts int) time.Duration {
+	delay := pendingDeleteBaseDelay
+	for i := 1; i < attempts && delay < pendingDeleteMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > pendingDeleteMaxDelay {
+		delay = pendingDeleteMaxDelay
+	}
+
+	return delay
+}
+
+// RetryPendingDeletes запускает периодическое повторное удаление частей файлов из бакетов.
+func (s *ServiceA) RetryPendingDeletes(d time.Duration) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.runRetryPendingDeletes(time.Now().UTC())
+	}
+}
+
+// runRetryPendingDeletes повторяет удаление частей файлов, время которых наступило.
+func (s *ServiceA) runRetryPendingDeletes(current time.Time) {
+	ctx := context.Background()
+
+	items, err := s.storage.GetPendingDeletes(ctx, current, pendingDeleteBatch)
+	if err != nil {
+		s.log.Error("GetPendingDeletes", sl.Err(err))
+		return
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	failed := s.deleteParts(ctx, items)
+	s.log.Debug("RetryPendingDeletes",
+		"count", len(items),
+		"failed", len(failed),
+	)
+}
+
+// RegisterBucket добавляет новый бакет (или меняет адрес существующего) и сразу начинает его использовать.
+// Остальные экземпляры сервиса A узнают о бакете через уведомление bucket_changed.
+func (s *ServiceA) RegisterBucket(ctx context.Context, item *models.ServerBucketInfo) error {
+	const op = "serviceA.RegisterBucket"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	if err := validateBucket(item); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.storage.PutBucket(ctx, item); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.refreshBuckets(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// validateBucket проверяет ID и адрес нового бакета.
+func validateBucket(item *models.ServerBucketInfo) error {
+	if item.ID <= 0 {
+		return fmt.Errorf("%w: bucket id must be positive", ErrInvalidBucket)
+	}
+
+	address, err := url.Parse(item.Address)
+	if err != nil || (address.Scheme != "http" && address.Scheme != "https") || address.Host == "" {
+		return fmt.Errorf("%w: bucket address must be an http(s) URL", ErrInvalidBucket)
+	}
+
+	return nil
+}
+
+// WatchBuckets обновляет список бакетов по уведомлениям bucket_changed из Postgres,
+// а также периодически с интервалом d (на случай потери уведомлений).
+func (s *ServiceA) WatchBuckets(d time.Duration) {
+	var notify <-chan *pq.Notification
+
+	listener, err := s.storage.NewBucketListener()
+	if err != nil {
+		s.log.Error("NewBucketListener", sl.Err(err))
+	} else {
+		defer listener.Close()
+		notify = listener.Notify
+	}
+
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-notify:
+		}
+
+		if err := s.refreshBuckets(context.Background()); err != nil {
+			s.log.Error("refreshBuckets", sl.Err(err))
+		}
+	}
+}
+
+// refreshBuckets перечитывает список активных бакетов из БД.
+// Клиенты бакетов, адрес которых не изменился, сохраняются.
+func (s *ServiceA) refreshBuckets(ctx context.Context) error {
+	bucketsInfo, err := s.storage.GetBucketsInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := make(map[int64]*Bucket, len(s.buckets))
+	for _, bucket := range s.buckets {
+		current[bucket.ID] = bucket
+	}
+
+	buckets := make([]*Bucket, len(bucketsInfo))
+	for i, bucketInfo := range bucketsInfo {
+		bucket, ok := current[bucketInfo.ID]
+		if !ok || bucket.path != bucketInfo.Address+requestPath {
+			bucket = NewBucket(s.log, bucketInfo.Address, bucketInfo.ID, s.client)
+			s.log.Info("bucket added", "bucketID", bucket.ID, "address", bucketInfo.Address)
+		}
+		buckets[i] = bucket
+		delete(current, bucketInfo.ID)
+	}
+	for id := range current {
+		s.log.Info("bucket removed", "bucketID", id)
+	}
+
+	s.buckets = buckets
+
+	return nil
+}
+
+// selectBuckets выбирает count наименее заполненных бакетов для частей файла с контрольной суммой checksum,
+// чтобы бакеты (в том числе новые) заполнялись равномерно. Бакеты, статистику которых получить не удалось,
+// выбираются в последнюю очередь. При равной заполненности порядок бакетов сдвигается по контрольной сумме,
+// чтобы части разных файлов распределялись по разным бакетам.
+func (s *ServiceA) selectBuckets(checksum string, count int) ([]*Bucket, error) {
+	s.mu.RLock()
+	candidates := slices.Clone(s.buckets)
+	s.mu.RUnlock()
+
+	n := len(candidates)
+	if n < count {
+		return nil, fmt.Errorf("not enough buckets: %d of %d", n, count)
+	}
+
+	var start int
+	if hash, err := strconv.ParseUint(checksum[:min(8, len(checksum))], 16, 32); err == nil {
+		start = int(hash % uint64(n))
+	}
+
+	type candidate struct {
+		bucket *Bucket
+		ok     bool
+		used   int64
+		rank   int
+	}
+
+	ranked := make([]candidate, n)
+	for i, bucket := range candidates {
+		ranked[i] = candidate{
+			bucket: bucket,
+			ok:     bucket.statsOK.Load(),
+			used:   bucket.used.Load(),
+			rank:   (i - start + n) % n,
+		}
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.ok != b.ok {
+			return a.ok
+		}
+		if a.used != b.used {
+			return a.used < b.used
+		}
+		return a.rank < b.rank
+	})
+
+	buckets := make([]*Bucket, count)
+	for i := range buckets {
+		buckets[i] = ranked[i].bucket
+	}
+
+	return buckets, nil
+}
+
+// RefreshBucketStats сразу и затем периодически с интервалом d обновляет статистику заполненности бакетов.
+func (s *ServiceA) RefreshBucketStats(d time.Duration) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+
+	for {
+		s.runRefreshBucketStats()
+		<-ticker.C
+	}
+}
+
+// runRefreshBucketStats запрашивает статистику у всех бакетов параллельно.
+func (s *ServiceA) runRefreshBucketStats() {
+	s.mu.RLock()
+	buckets := slices.Clone(s.buckets)
+	s.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, bucket := range buckets {
+		bucket := bucket
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), bucketTimeout)
+			defer cancel()
+
+			stats, err := bucket.GetStats(ctx)
+			if err != nil {
+				bucket.statsOK.Store(false)
+				s.log.Error("GetStats", "bucketID", bucket.ID, sl.Err(err))
+
+				return
+			}
+
+			bucket.used.Store(stats.UsedBytes)
+			bucket.statsOK.Store(true)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// getBucket возвращает бакет по его ID (nil, если активного бакета с таким ID нет).
+func (s *ServiceA) getBucket(id int64) *Bucket {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, bucket := range s.buckets {
+		if bucket.ID == id {
+			return bucket
+		}
+	}
+
 	return nil
 }
 
@@ -164,6 +711,9 @@ func (s *ServiceA) GetFileNameFromCache(ctx context.Context, id uuid.UUID) strin
 
 // GetBucketsIDs возвращает ID всех бакетов.
 func (s *ServiceA) GetBucketsIDs() []int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	n := len(s.buckets)
 	bucketIDs := make([]int64, n)
 
@@ -179,33 +729,148 @@ func (s *ServiceA) Close() error {
 	return s.storage.Close()
 }
 
-// PutFileIntoBuckets раскладывает файл по бакетам.
-func (s *ServiceA) PutFileIntoBuckets(ctx context.Context, id uuid.UUID, path string) error {
+// PutFileIntoBuckets раскладывает файл по бакетам из манифеста: части с данными передаются
+// диапазонами файла из кэша, а части чётности вычисляются на лету и передаются потоком.
+// Зашифрованное содержимое (metadata.KeyID) шифруется на лету, части чётности вычисляются по шифртексту.
+// Каждая часть записывается во все бакеты своих копий; запись успешна, только если записаны все копии.
+// Контрольные суммы переданных частей записываются в манифест (metadata.Parts).
+func (s *ServiceA) PutFileIntoBuckets(ctx context.Context, metadata *models.MetadataItem, path string) error {
 	const op = "serviceA.PutFileIntoBuckets"
 
 	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
 	defer span.End()
 
-	items, err := processes.SplitFile(path, s.GetBucketsIDs())
+	coding, err := checkManifest(metadata)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
-	var eg errgroup.Group
 
-	// Обработка каждого элемента в отдельной горутине.
-	for i, item := range items {
-		item := item // создаем копию переменной item, чтобы избежать замыкания на изменяемой переменной в горутине
-		i := i
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	size := fileInfo.Size()
+	if size != metadata.Size {
+		return fmt.Errorf("%s: %w", op, errors.New("file size does not match metadata"))
+	}
+
+	cipher, err := s.blobCipher(ctx, metadata)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Источник частей - файл в кэше или его зашифрованное содержимое.
+	source := io.ReaderAt(file)
+	if cipher != nil {
+		source = cipher.EncryptReaderAt(file, size)
+		size = encryption.EncryptedSize(size)
+	}
+
+	eg, ctx := errgroup.WithContext(ctx)
+
+	// Каждая копия части передаётся в свой бакет из своего источника.
+	type upload struct {
+		index    int
+		replica  int
+		bucketID int64
+		source   io.Reader
+		// pipe - канал, из которого читается копия части чётности.
+		pipe *io.PipeReader
+	}
+	uploads := make([]upload, 0, len(metadata.Parts)*s.replicas)
+
+	// Части с данными читаются прямо из файла в кэше.
+	for i, part := range metadata.Parts[:coding.DataShards] {
+		for r, bucketID := range part.Locations() {
+			section := io.Reader(io.NewSectionReader(source, part.Offset, part.Length))
+			if cipher != nil {
+				// Сегменты шифруются заново при каждом чтении, поэтому часть читается крупными блоками.
+				section = bufio.NewReaderSize(section, 4*encryption.SegmentSize)
+			}
+			uploads = append(uploads, upload{
+				index:    i,
+				replica:  r,
+				bucketID: bucketID,
+				source:   section,
+			})
+		}
+	}
+
+	// Части чётности вычисляются в отдельной горутине и передаются в бакеты через каналы (pipe):
+	// каждая часть чётности записывается сразу во все каналы своих копий.
+	var parityWriters []*io.PipeWriter
+	writers := make([]io.Writer, coding.ParityShards)
+	for j, part := range metadata.Parts[coding.DataShards:] {
+		replicaWriters := make([]io.Writer, 0, len(part.Locations()))
+		for r, bucketID := range part.Locations() {
+			reader, writer := io.Pipe()
+			parityWriters = append(parityWriters, writer)
+			replicaWriters = append(replicaWriters, writer)
+			uploads = append(uploads, upload{
+				index:    coding.DataShards + j,
+				replica:  r,
+				bucketID: bucketID,
+				source:   reader,
+				pipe:     reader,
+			})
+		}
+		writers[j] = io.MultiWriter(replicaWriters...)
+	}
+	if coding.ParityShards > 0 {
 		eg.Go(func() error {
-			s.mu.Lock()
-			defer s.mu.Unlock()
+			err := processes.EncodeParity(source, size, coding, writers)
+			for _, writer := range parityWriters {
+				writer.CloseWithError(err)
+			}
+
+			return err
+		})
+	}
 
-			s.buckets[i].log.Debug("SendToBucket",
-				"id", id.String(),
-				"bucketID", s.buckets[i].ID,
-				"address", s.buckets[i].path,
+	// Каждая копия части передаётся потоком в отдельной горутине.
+	checksums := make([][]string, len(metadata.Parts))
+	for i, part := range metadata.Parts {
+		checksums[i] = make([]string, len(part.Locations()))
+	}
+	for _, item := range uploads {
+		item := item // создаем копию переменной, чтобы избежать замыкания на изменяемой переменной в горутине
+		eg.Go(func() error {
+			bucket := s.getBucket(item.bucketID)
+			if bucket == nil {
+				err := fmt.Errorf("bucket %d is not active", item.bucketID)
+				if item.pipe != nil {
+					item.pipe.CloseWithError(err)
+				}
+
+				return err
+			}
+
+			bucket.log.Debug("SendToBucket",
+				"blobID", metadata.BlobID.String(),
+				"bucketID", bucket.ID,
+				"address", bucket.path,
+				"shard", item.index,
+				"replica", item.replica,
 			)
-			return s.buckets[i].SendToBucket(ctx, &item, id)
+			checksum, err := bucket.SendToBucket(ctx, metadata.BlobID, item.source)
+			checksums[item.index][item.replica] = checksum
+			if err == nil {
+				// Учитываем часть в заполненности бакета до следующего обновления статистики.
+				bucket.used.Add(metadata.Parts[item.index].Length)
+			}
+
+			// Если бакет не дочитал часть чётности, закрываем канал, чтобы не блокировать вычисление.
+			if item.pipe != nil {
+				item.pipe.CloseWithError(errors.Join(err, io.ErrClosedPipe))
+			}
+
+			return err
 		})
 	}
 
@@ -214,58 +879,340 @@ func (s *ServiceA) PutFileIntoBuckets(ctx context.Context, id uuid.UUID, path st
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	// Все копии части должны совпадать.
+	for i, part := range metadata.Parts {
+		for r, bucketID := range part.Locations() {
+			if checksums[i][r] != checksums[i][0] {
+				return fmt.Errorf("%s: %w", op, &BucketError{BucketID: bucketID, Err: ErrCorrupted})
+			}
+		}
+		metadata.Parts[i].Checksum = checksums[i][0]
+	}
+
 	return nil
 }
 
-// GetFileFromBuckets собирает файл из бакетов.
-func (s *ServiceA) GetFileFromBuckets(ctx context.Context, id uuid.UUID) ([]byte, error) {
+// checkManifest проверяет, что манифест файла соответствует схеме кодирования и размеру файла
+// (для зашифрованного содержимого - размеру шифртекста), и возвращает схему кодирования.
+func checkManifest(metadata *models.MetadataItem) (processes.ErasureCoding, error) {
+	coding := processes.ErasureCoding{DataShards: metadata.DataShards, ParityShards: metadata.ParityShards}
+	if err := coding.Validate(); err != nil {
+		return coding, err
+	}
+	if len(metadata.Parts) != coding.Shards() {
+		return coding, fmt.Errorf("manifest has %d parts, expected %d", len(metadata.Parts), coding.Shards())
+	}
+
+	// Части с данными должны идти подряд и покрывать файл целиком,
+	// а все копии частей храниться в разных бакетах (в бакете часть хранится по UUID файла).
+	var size int64
+	bucketIDs := make(map[int64]struct{}, len(metadata.Parts))
+	for i, part := range metadata.Parts {
+		if part.Index != i || part.Length < 0 || i < coding.DataShards && part.Offset != size {
+			return coding, fmt.Errorf("manifest part %d is invalid", i)
+		}
+		for _, bucketID := range part.Locations() {
+			if _, ok := bucketIDs[bucketID]; ok {
+				return coding, fmt.Errorf("manifest part %d: bucket %d is used twice", i, bucketID)
+			}
+			bucketIDs[bucketID] = struct{}{}
+		}
+		if i < coding.DataShards {
+			size += part.Length
+		}
+	}
+	if size != storedSize(metadata) {
+		return coding, fmt.Errorf("manifest parts size %d does not match stored size %d", size, storedSize(metadata))
+	}
+
+	return coding, nil
+}
+
+// GetFileFromBuckets открывает на чтение диапазон [offset, offset+length) файла, собирая его из бакетов.
+// Запросы ко всем бакетам, части которых пересекаются с диапазоном, выполняются параллельно,
+// а данные отдаются потоком по порядку частей, не накапливаясь в памяти.
+// Если часть не удалось открыть, возвращаются объединённые ошибки всех частей (см. BucketError).
+// Недоступные или повреждённые части с данными восстанавливаются по остальным частям и частям чётности.
+// Части, прочитанные целиком, и файл, прочитанный целиком, сверяются с контрольными суммами;
+// при несовпадении чтение завершается ошибкой ErrCorrupted.
+// Зашифрованное содержимое читается целыми сегментами, которые расшифровываются и проверяются по мере чтения.
+func (s *ServiceA) GetFileFromBuckets(
+	ctx context.Context,
+	metadata *models.MetadataItem,
+	offset, length int64,
+) (io.ReadCloser, error) {
 	const op = "serviceA.GetFileFromBuckets"
 
 	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
 	defer span.End()
 
+	// Пустое содержимое в бакетах не хранится.
+	if metadata.Size == 0 && len(metadata.Parts) == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+
+	// Файл собирается по манифесту, а не по текущему списку бакетов.
+	coding, err := checkManifest(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	cipher, err := s.blobCipher(ctx, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Диапазон хранимого содержимого: для зашифрованного - сегменты, в которых лежит диапазон файла.
+	start, end := offset, offset+length
+	if cipher != nil {
+		var storedLength int64
+		start, storedLength = encryption.EncryptedRange(metadata.Size, offset, length)
+		end = start + storedLength
+	}
+
+	layout := metadata.Parts[:coding.DataShards]
+	parts := make([]partReader, 0, len(layout))
+	errs := make([]error, len(layout))
+
+	var wg sync.WaitGroup
+
+	// Запуск горутин для каждого бакета, часть которого пересекается с диапазоном.
+	for i, part := range layout {
+		partStart := max(start, part.Offset)
+		partEnd := min(end, part.Offset+part.Length)
+		if partStart >= partEnd {
+			continue
+		}
+
+		index := i
+		partOffset := partStart - part.Offset
+		parts = append(parts, partReader{length: partEnd - partStart})
+		reader := &parts[len(parts)-1]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reader.ReadCloser, errs[index] = s.openShardRange(ctx, metadata, coding, index, partOffset, reader.length)
+		}()
+	}
+
+	// Ожидание ответов всех бакетов; ошибки всех недоступных частей объединяются.
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		for _, part := range parts {
+			if part.ReadCloser != nil {
+				part.Close()
+			}
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	reader := io.ReadCloser(newPartsReader(parts))
+	if cipher != nil {
+		reader = readCloser{
+			Reader: cipher.DecryptReader(reader, metadata.Size, offset, length),
+			Closer: reader,
+		}
+	}
+	if offset == 0 && length == metadata.Size {
+		reader = newChecksumReader(reader, metadata.Checksum, length)
+	}
+
+	return reader, nil
+}
+
+// openShardRange открывает диапазон [offset, offset+length) части index файла.
+// Если бакет с частью недоступен, часть восстанавливается по остальным частям.
+func (s *ServiceA) openShardRange(
+	ctx context.Context,
+	metadata *models.MetadataItem,
+	coding processes.ErasureCoding,
+	index int,
+	offset, length int64,
+) (io.ReadCloser, error) {
+	body, err := s.getShardRange(ctx, metadata, index, offset, length)
+	if err == nil {
+		return body, nil
+	}
+	if coding.ParityShards == 0 {
+		return nil, err
+	}
+
+	s.log.Warn("shard is unavailable, reconstructing",
+		"blobID", metadata.BlobID.String(),
+		"shard", index,
+		sl.Err(err),
+	)
+
+	body, reconstructErr := s.reconstructShardRange(ctx, metadata, coding, index, offset, length)
+	if reconstructErr != nil {
+		return nil, errors.Join(err, reconstructErr)
+	}
+
+	return body, nil
+}
+
+// getShardRange запрашивает диапазон [offset, offset+length) части index файла у бакетов её копий:
+// сначала у основного, а если он недоступен, не ответил вовремя или вернул не ту часть - у следующего.
+// Если не удалось открыть ни одну копию, возвращаются объединённые ошибки всех копий.
+func (s *ServiceA) getShardRange(
+	ctx context.Context,
+	metadata *models.MetadataItem,
+	index int,
+	offset, length int64,
+) (io.ReadCloser, error) {
+	locations := metadata.Parts[index].Locations()
+	errs := make([]error, 0, len(locations))
+
+	for replica, bucketID := range locations {
+		body, err := s.getReplicaRange(ctx, metadata, index, bucketID, offset, length)
+		if err == nil {
+			return body, nil
+		}
+		errs = append(errs, err)
+
+		// Запрос отменён вызывающим - остальные копии не запрашиваем.
+		if ctx.Err() != nil {
+			break
+		}
+		if replica < len(locations)-1 {
+			s.log.Warn("replica is unavailable, trying next",
+				"blobID", metadata.BlobID.String(),
+				"shard", index,
+				"bucketID", bucketID,
+				sl.Err(err),
+			)
+		}
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// getReplicaRange запрашивает диапазон [offset, offset+length) копии части index файла у бакета bucketID.
+func (s *ServiceA) getReplicaRange(
+	ctx context.Context,
+	metadata *models.MetadataItem,
+	index int,
+	bucketID int64,
+	offset, length int64,
+) (io.ReadCloser, error) {
+	bucket := s.getBucket(bucketID)
+	if bucket == nil {
+		return nil, &BucketError{BucketID: bucketID, Err: fmt.Errorf("%w: bucket is not active", ErrBucketUnreachable)}
+	}
+
+	bucket.log.Debug("GetFromBucket",
+		"blobID", metadata.BlobID.String(),
+		"bucketID", bucket.ID,
+		"address", bucket.path,
+		"shard", index,
+		"offset", offset,
+		"length", length,
+	)
+
+	body, checksum, err := bucket.GetFromBucket(ctx, metadata.BlobID, offset, length)
+	if err != nil {
+		return nil, err
+	}
+
+	// Части, запись которых не завершена, не проверяются.
+	part := metadata.Parts[index]
+	if part.Checksum == "" {
+		return body, nil
+	}
+
+	// Бакет хранит часть с другой контрольной суммой - это не та часть или она повреждена.
+	if checksum != "" && checksum != part.Checksum {
+		body.Close()
+		return nil, &BucketError{BucketID: bucketID, Err: ErrCorrupted}
+	}
+
+	// Часть, запрошенная целиком, проверяется по мере чтения.
+	if offset == 0 && length == part.Length {
+		return newChecksumReader(body, part.Checksum, length), nil
+	}
+
+	return body, nil
+}
+
+// reconstructShardRange восстанавливает диапазон [offset, offset+length) части index файла
+// по тем же диапазонам остальных частей. Части с данными короче диапазона дополняются нулями,
+// как при вычислении частей чётности.
+func (s *ServiceA) reconstructShardRange(
+	ctx context.Context,
+	metadata *models.MetadataItem,
+	coding processes.ErasureCoding,
+	index int,
+	offset, length int64,
+) (io.ReadCloser, error) {
+	sources := make([]io.ReadCloser, coding.Shards())
+
 	var eg errgroup.Group
 	var mu sync.Mutex
-	results := make(map[int64][]byte)
+	var errs []error
+
+	for i := range sources {
+		if i == index {
+			continue
+		}
+
+		// Сколько байт диапазона есть в части: части чётности имеют максимальный размер.
+		available := max(0, min(length, metadata.Parts[i].Length-offset))
+		if available == 0 {
+			sources[i] = zeroReader{}
+			continue
+		}
 
-	// Запуск горутин для каждого бакета.
-	for i, bucket := range s.buckets {
-		bucket := bucket
 		i := i
 		eg.Go(func() error {
-			s.mu.Lock()
-			defer s.mu.Unlock()
-
-			bucket.GetFromBucket(ctx, id, results, &mu)
+			body, err := s.getShardRange(ctx, metadata, i, offset, available)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
 
-			var res string
-			if len(results[s.buckets[i].ID]) > 0 {
-				res = string(results[s.buckets[i].ID][:10]) + "..."
+				return nil
 			}
 
-			s.buckets[i].log.Debug("GetFromBucket",
-				"id", id.String(),
-				"bucketID", s.buckets[i].ID,
-				"address", s.buckets[i].path,
-				"data", res,
-			)
+			sources[i] = newPartsReader([]partReader{
+				{ReadCloser: body, length: available},
+				{ReadCloser: zeroReader{}, length: length - available},
+			})
 
 			return nil
 		})
 	}
 
-	// Ожидание завершения всех горутин и проверка ошибок.
-	if err := eg.Wait(); err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+	_ = eg.Wait()
+
+	// Для восстановления достаточно DataShards частей, лишние закрываем.
+	readers := make([]io.Reader, coding.Shards())
+	closers := make(multiCloser, 0, coding.DataShards)
+	for i, source := range sources {
+		if source == nil {
+			continue
+		}
+		if len(closers) == coding.DataShards {
+			source.Close()
+			continue
+		}
+
+		readers[i] = source
+		closers = append(closers, source)
 	}
 
-	// Объединение результатов в нужном порядке.
-	var finalData []byte
-	for _, bucket := range s.buckets {
-		finalData = append(finalData, results[bucket.ID]...)
+	reader, err := processes.NewShardReader(coding, readers, index, length)
+	if err != nil {
+		closers.Close()
+
+		return nil, errors.Join(append(errs, err)...)
 	}
 
-	return finalData, nil
+	return readCloser{
+		Reader: reader,
+		Closer: closers,
+	}, nil
 }
 
 // ClearCache запускает периодическую очистку кэша.
@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
 	"karma8/internal/app/health"
+	"karma8/internal/app/processes"
 	"karma8/internal/app/repository"
 	trccontext "karma8/internal/lib/context"
 	"karma8/internal/models"
@@ -14,6 +16,9 @@ import (
 	"github.com/google/uuid"
 )
 
+// statsTTL - время, в течение которого статистика бакета отдаётся без пересчёта.
+const statsTTL = 10 * time.Second
+
 type ServiceB struct {
 	log     *slog.Logger
 	storage *repository.StorageRedis
@@ -22,9 +27,14 @@ type ServiceB struct {
 	health.ReadinessChecker
 
 	buckets []*Bucket
+
+	// statsMu защищает закэшированную статистику бакета.
+	statsMu   sync.Mutex
+	stats     *models.BucketStats
+	statsTime time.Time
 }
 
-func NewServiceB(log *slog.Logger, connectString string, redisDB int) (IService, error) {
+func NewServiceB(log *slog.Logger, connectString string, redisDB int) (IServiceB, error) {
 	const op = "serviceB.NewServiceB"
 
 	storage, err := repository.NewRedis(connectString, redisDB)
@@ -41,7 +51,7 @@ func NewServiceB(log *slog.Logger, connectString string, redisDB int) (IService,
 	buckets := make([]*Bucket, n)
 
 	for i, bucketInfo := range bucketsInfo {
-		buckets[i] = NewBucket(log, bucketInfo.Address, bucketInfo.ID)
+		buckets[i] = NewBucket(log, bucketInfo.Address, bucketInfo.ID, nil)
 	}
 
 	return &ServiceB{
@@ -59,19 +69,41 @@ func (s *ServiceB) GetFileItem(ctx context.Context, id uuid.UUID) (*models.FileI
 	defer span.End()
 
 	// Получаем часть файла из БД.
-	data, err := s.storage.GetBucketItem(ctx, id.String())
+	data, checksum, err := s.storage.GetBucketItem(ctx, id.String())
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
+	// Проверяем, что часть не повреждена при хранении.
+	if checksum != "" && processes.CalculateChecksumBytes(data) != checksum {
+		return nil, fmt.Errorf("%s: %w", op, ErrCorrupted)
+	}
+
 	item := &models.FileItem{
 		ID:          id.String(),
 		FileContent: data,
+		Checksum:    checksum,
 	}
 
 	return item, nil
 }
 
+// CheckFileItem возвращает размер части файла и контрольную сумму её данных, вычисленную заново.
+// Если данные повреждены при хранении, контрольная сумма не совпадёт с сохранённой при записи.
+func (s *ServiceB) CheckFileItem(ctx context.Context, id uuid.UUID) (int64, string, error) {
+	const op = "serviceB.CheckFileItem"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	data, _, err := s.storage.GetBucketItem(ctx, id.String())
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return int64(len(data)), processes.CalculateChecksumBytes(data), nil
+}
+
 // PutFileItem сохраняет файл в БД и возвращает его ID.
 func (s *ServiceB) PutFileItem(ctx context.Context, source *models.FileItem) (uuid.UUID, error) {
 	const op = "serviceB.PutFileItem"
@@ -85,19 +117,57 @@ func (s *ServiceB) PutFileItem(ctx context.Context, source *models.FileItem) (uu
 	}
 
 	// Сохраняем часть файла в БД.
-	err = s.storage.PutBucketItem(ctx, source.ID, source.FileContent)
+	checksum, err := s.storage.PutBucketItem(ctx, source.ID, source.Content)
 	if err != nil {
 		return uuid.UUID{}, fmt.Errorf("%s: %w", op, err)
 	}
+	source.Checksum = checksum
 
 	return parsedUUID, nil
 }
 
-// DeleteFileItem удаляет файл по его ID.
-func (s *ServiceB) DeleteFileItem(_ context.Context, _ uuid.UUID) error {
+// DeleteFileItem удаляет часть файла по её ID.
+func (s *ServiceB) DeleteFileItem(ctx context.Context, id uuid.UUID) error {
+	const op = "serviceB.DeleteFileItem"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	// Удаляем часть файла из БД.
+	err := s.storage.DeleteBucketItem(ctx, id.String())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
 	return nil
 }
 
+// GetStats возвращает статистику использования бакета.
+// Подсчёт перебирает все ключи Redis, поэтому результат кэшируется на statsTTL.
+func (s *ServiceB) GetStats(ctx context.Context) (*models.BucketStats, error) {
+	const op = "serviceB.GetStats"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	if s.stats != nil && time.Since(s.statsTime) < statsTTL {
+		return s.stats, nil
+	}
+
+	stats, err := s.storage.GetBucketStats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.stats = stats
+	s.statsTime = time.Now()
+
+	return stats, nil
+}
+
 // GetBucketsInfo возвращает информацию об активных бакетах.
 func (s *ServiceB) GetBucketsInfo() ([]*models.ServerBucketInfo, error) {
 	return nil, nil
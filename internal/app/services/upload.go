@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"karma8/internal/app/processes"
+	trccontext "karma8/internal/lib/context"
+	"karma8/internal/lib/logger/sl"
+	"karma8/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxUploadPartNumber - максимальный номер части загрузки файла по частям.
+	MaxUploadPartNumber = 10000
+	// maxUploadFileNameLength - максимальная длина имени файла (размер поля filename в БД).
+	maxUploadFileNameLength = 255
+	// uploadTTL - время, через которое незавершённая загрузка, которая не менялась, прерывается.
+	uploadTTL = 24 * time.Hour
+)
+
+// CreateUpload создаёт загрузку файла по частям и возвращает её ID.
+func (s *ServiceA) CreateUpload(ctx context.Context, fileName, contentType string) (uuid.UUID, error) {
+	const op = "serviceA.CreateUpload"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	if fileName == "" || len(fileName) > maxUploadFileNameLength {
+		return uuid.Nil, fmt.Errorf("%s: %w: filename must be 1 to %d bytes long", op, ErrInvalidUpload, maxUploadFileNameLength)
+	}
+	if len(contentType) > maxUploadFileNameLength {
+		return uuid.Nil, fmt.Errorf("%s: %w: content type is too long", op, ErrInvalidUpload)
+	}
+
+	// Владелец загрузки - ключ API, которым аутентифицирован запрос (если аутентификация включена).
+	owner, _ := trccontext.APIKeyIDFromContext(ctx)
+
+	newID, err := s.storage.CreateUpload(ctx, &models.UploadInfo{
+		FileName:    fileName,
+		ContentType: contentType,
+		Owner:       owner,
+	})
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return newID, nil
+}
+
+// GetUpload возвращает загрузку файла по частям и уже загруженные части,
+// чтобы клиент мог продолжить прерванную загрузку.
+func (s *ServiceA) GetUpload(ctx context.Context, id uuid.UUID) (*models.UploadInfo, error) {
+	const op = "serviceA.GetUpload"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	upload, err := s.storage.GetUpload(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return upload, nil
+}
+
+// PutUploadPart сохраняет часть partNumber загрузки id. Часть записывается потоком в каталог загрузок service_a;
+// повторная загрузка части с тем же номером заменяет её.
+func (s *ServiceA) PutUploadPart(ctx context.Context, id uuid.UUID, partNumber int, source io.Reader) (*models.UploadPartItem, error) {
+	const op = "serviceA.PutUploadPart"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	if partNumber < 1 || partNumber > MaxUploadPartNumber {
+		return nil, fmt.Errorf("%s: %w: part number must be from 1 to %d", op, ErrInvalidUpload, MaxUploadPartNumber)
+	}
+
+	// Не принимаем данные для несуществующей или уже собираемой загрузки.
+	upload, err := s.storage.GetUpload(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if upload.Completing {
+		return nil, fmt.Errorf("%s: %w", op, ErrUploadCompleting)
+	}
+
+	fileName, checksum, size, err := processes.WriteUploadPart(source, id.String())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	part := &models.UploadPartItem{
+		PartNumber: partNumber,
+		Size:       size,
+		Checksum:   checksum,
+		FileName:   fileName,
+	}
+
+	oldFileName, err := s.storage.PutUploadPart(ctx, id, part)
+	if err != nil {
+		s.deleteUploadParts([]string{fileName})
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if oldFileName != "" {
+		s.deleteUploadParts([]string{oldFileName})
+	}
+
+	return part, nil
+}
+
+// CompleteUpload собирает части загрузки по порядку номеров в файл и возвращает ID нового файла.
+// Номера частей должны идти подряд начиная с 1. Если сохранить файл не удалось, загрузку можно собрать повторно.
+func (s *ServiceA) CompleteUpload(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	const op = "serviceA.CompleteUpload"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	upload, err := s.storage.StartCompleteUpload(ctx, id)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	newID, err := s.completeUpload(ctx, upload)
+	if err != nil {
+		if cancelErr := s.storage.CancelCompleteUpload(context.WithoutCancel(ctx), id); cancelErr != nil {
+			s.log.Error("CompleteUpload CancelCompleteUpload", "uploadID", id.String(), sl.Err(cancelErr))
+		}
+
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Файл сохранён - загрузка больше не нужна. Если удалить её не удалось, она будет удалена по истечении uploadTTL.
+	fileNames, err := s.storage.DeleteUpload(context.WithoutCancel(ctx), id, true)
+	if err != nil {
+		s.log.Error("CompleteUpload DeleteUpload", "uploadID", id.String(), sl.Err(err))
+	}
+	s.deleteUploadParts(fileNames)
+
+	return newID, nil
+}
+
+// completeUpload проверяет номера частей загрузки, записывает части одним потоком в кэш и сохраняет файл.
+func (s *ServiceA) completeUpload(ctx context.Context, upload *models.UploadInfo) (uuid.UUID, error) {
+	if len(upload.Parts) == 0 {
+		return uuid.Nil, fmt.Errorf("%w: upload has no parts", ErrInvalidUpload)
+	}
+
+	fileNames := make([]string, len(upload.Parts))
+	for i, part := range upload.Parts {
+		if part.PartNumber != i+1 {
+			return uuid.Nil, fmt.Errorf("%w: part %d is missing", ErrInvalidUpload, i+1)
+		}
+		fileNames[i] = part.FileName
+	}
+
+	reader := processes.OpenUploadParts(fileNames)
+	defer reader.Close()
+
+	var content io.Reader = reader
+
+	contentType := upload.ContentType
+	if contentType == "" {
+		var err error
+		contentType, content, err = processes.SniffContentType(reader)
+		if err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	checksum, size, err := processes.WriteFileStream(content)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// Владельцем файла становится владелец загрузки, а не ключ, которым загрузка завершена.
+	if upload.Owner != "" {
+		ctx = trccontext.WithAPIKeyID(ctx, upload.Owner)
+	}
+
+	return s.storeFile(ctx, checksum, size, upload.FileName, contentType)
+}
+
+// AbortUpload прерывает загрузку файла по частям и удаляет загруженные части.
+// Загрузку, которая собирается в файл, прервать нельзя (ErrUploadCompleting).
+func (s *ServiceA) AbortUpload(ctx context.Context, id uuid.UUID) error {
+	const op = "serviceA.AbortUpload"
+
+	ctx, span := trccontext.WithTelemetrySpan(ctx, op)
+	defer span.End()
+
+	fileNames, err := s.storage.DeleteUpload(ctx, id, false)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	s.deleteUploadParts(fileNames)
+
+	return nil
+}
+
+// ExpireUploads запускает периодическое прерывание загрузок файлов по частям, которые не менялись дольше uploadTTL.
+func (s *ServiceA) ExpireUploads(d time.Duration) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.runExpireUploads(time.Now().UTC())
+	}
+}
+
+// runExpireUploads удаляет загрузки, которые не менялись дольше uploadTTL к моменту current, и их части,
+// а также разрешения на загрузку по подписанным ссылкам, истёкшие к моменту current.
+func (s *ServiceA) runExpireUploads(current time.Time) {
+	fileNames, err := s.storage.DeleteExpiredUploads(context.Background(), current.Add(-uploadTTL))
+	if err != nil {
+		s.log.Error("DeleteExpiredUploads", sl.Err(err))
+		return
+	}
+	s.deleteUploadParts(fileNames)
+
+	if len(fileNames) > 0 {
+		s.log.Debug("ExpireUploads deleted parts", "count", len(fileNames))
+	}
+
+	count, err := s.storage.DeleteExpiredPresignedUploads(context.Background(), current)
+	if err != nil {
+		s.log.Error("DeleteExpiredPresignedUploads", sl.Err(err))
+		return
+	}
+	if count > 0 {
+		s.log.Debug("ExpireUploads deleted presigned uploads", "count", count)
+	}
+}
+
+// deleteUploadParts удаляет файлы частей загрузок из каталога загрузок.
+func (s *ServiceA) deleteUploadParts(fileNames []string) {
+	for _, fileName := range fileNames {
+		if err := processes.DeleteUploadPart(fileName); err != nil {
+			s.log.Error("DeleteUploadPart", "fileName", fileName, sl.Err(err))
+		}
+	}
+}
@@ -2,6 +2,7 @@ package web
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -19,13 +20,14 @@ type HTTPServer struct {
 	server *http.Server
 }
 
-// New creates new HTTP server app.
-func New(log *slog.Logger, port int, router *mux.Router) (*HTTPServer, error) {
+// New creates new HTTP server app. If tlsConfig is not nil, the server accepts HTTPS connections only.
+func New(log *slog.Logger, port int, router *mux.Router, tlsConfig *tls.Config) (*HTTPServer, error) {
 	cfgAddress := fmt.Sprintf(":%d", port)
 
 	srv := &http.Server{
-		Addr:    cfgAddress,
-		Handler: router,
+		Addr:      cfgAddress,
+		Handler:   router,
+		TLSConfig: tlsConfig,
 	}
 
 	return &HTTPServer{
@@ -36,7 +38,14 @@ func New(log *slog.Logger, port int, router *mux.Router) (*HTTPServer, error) {
 
 func (s *HTTPServer) Start() {
 	go func() {
-		if err := s.server.ListenAndServe(); err != nil {
+		var err error
+		if s.server.TLSConfig != nil {
+			// Certificates are already loaded into TLSConfig.
+			err = s.server.ListenAndServeTLS("", "")
+		} else {
+			err = s.server.ListenAndServe()
+		}
+		if err != nil {
 			if !errors.Is(err, http.ErrServerClosed) {
 				s.log.Error("failed to start server", "error", err)
 				panic(err)
@@ -47,7 +56,7 @@ func (s *HTTPServer) Start() {
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
-	s.log.Info("started http server", "port", s.server.Addr)
+	s.log.Info("started http server", "port", s.server.Addr, "tls", s.server.TLSConfig != nil)
 
 	<-done
 	s.log.Info("stopping http server")
@@ -6,6 +6,8 @@ import (
 	"strconv"
 	"strings"
 
+	"karma8/internal/lib/serviceauth"
+
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
@@ -17,6 +19,43 @@ type Config struct {
 	RedisDB        int    `yaml:"redis_db" env-default:"1"`
 	UseTracing     bool   `yaml:"use_tracing"`
 	TracingAddress string `yaml:"tracing_address" env-default:""`
+	DataShards     int    `yaml:"data_shards" env-default:"4"`
+	ParityShards   int    `yaml:"parity_shards" env-default:"2"`
+	// Replicas - количество копий каждой части файла (в разных бакетах).
+	Replicas int `yaml:"replicas" env-default:"1"`
+	// S3AccessKey и S3SecretKey - ключи подписи запросов к S3-совместимому API (API выключен, если ключ доступа пуст);
+	// S3Region - регион в подписи запросов.
+	S3AccessKey string `yaml:"s3_access_key" env-default:""`
+	S3SecretKey string `yaml:"s3_secret_key" env-default:""`
+	S3Region    string `yaml:"s3_region" env-default:"us-east-1"`
+	// APIAdminKey и APIAdminSecret - ключ администратора REST API (аутентификация запросов к REST API выключена,
+	// если ключ пуст); остальные ключи создаются через API и хранятся в БД.
+	APIAdminKey    string `yaml:"api_admin_key" env-default:""`
+	APIAdminSecret string `yaml:"api_admin_secret" env-default:""`
+	// TLSCertFile и TLSKeyFile - сертификат и ключ для соединений service_a с service_b: в service_b - сертификат
+	// сервера (TLS выключен, если не задан), в service_a - клиентский сертификат для запросов к бакетам;
+	// TLSCAFile - сертификат УЦ, которым проверяется сертификат другой стороны (в service_b - обязательный
+	// клиентский сертификат).
+	TLSCertFile string `yaml:"tls_cert_file" env-default:""`
+	TLSKeyFile  string `yaml:"tls_key_file" env-default:""`
+	TLSCAFile   string `yaml:"tls_ca_file" env-default:""`
+	// ServiceSecret - общий секрет подписи запросов service_a к service_b (подпись не проверяется, если секрет пуст).
+	ServiceSecret string `yaml:"service_secret" env-default:""`
+	// PresignSecret - секрет подписи ссылок на скачивание и загрузку файлов без ключа API
+	// (подписанные ссылки выключены, если секрет пуст).
+	PresignSecret string `yaml:"presign_secret" env-default:""`
+	// EncryptionKeyFile - файл мастер-ключей, которыми шифруются ключи данных содержимого файлов
+	// (содержимое хранится в бакетах без шифрования, если файл не задан).
+	EncryptionKeyFile string `yaml:"encryption_key_file" env-default:""`
+}
+
+// ServiceTLS возвращает пути к файлам сертификатов для соединений service_a с service_b.
+func (c *Config) ServiceTLS() serviceauth.TLSFiles {
+	return serviceauth.TLSFiles{
+		CertFile: c.TLSCertFile,
+		KeyFile:  c.TLSKeyFile,
+		CAFile:   c.TLSCAFile,
+	}
 }
 
 func MustLoad(name string) *Config {
@@ -49,5 +88,13 @@ func MustLoad(name string) *Config {
 		}
 	}
 
+	// Ключи S3-совместимого API можно не хранить в файле конфигурации.
+	if accessKey := os.Getenv(strings.ToUpper(name) + "_S3_ACCESS_KEY"); accessKey != "" {
+		cfg.S3AccessKey = accessKey
+	}
+	if secretKey := os.Getenv(strings.ToUpper(name) + "_S3_SECRET_KEY"); secretKey != "" {
+		cfg.S3SecretKey = secretKey
+	}
+
 	return &cfg
 }
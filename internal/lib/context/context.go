@@ -12,6 +12,7 @@ type (
 	ctxKeyRequestID       struct{}
 	ctxKeyAppInstanceName struct{}
 	ctxKeyTelemetry       struct{}
+	ctxKeyAPIKeyID        struct{}
 
 	Data struct {
 		JobID              string
@@ -117,6 +118,20 @@ func AppInstanceNameFromContext(ctx context.Context) (appInstanceName string, ok
 	return
 }
 
+// API key ID.
+
+func WithAPIKeyID(ctx context.Context, keyID string) context.Context {
+	return context.WithValue(ctx, ctxKeyAPIKeyID{}, keyID)
+}
+
+func APIKeyIDFromContext(ctx context.Context) (keyID string, ok bool) {
+	if ctx == nil {
+		return
+	}
+	keyID, ok = ctx.Value(ctxKeyAPIKeyID{}).(string)
+	return
+}
+
 func WithTelemetry(ctx context.Context, service telemetry.Service) context.Context {
 	if service == nil || ctx == nil {
 		return ctx
@@ -0,0 +1,256 @@
+// Package encryption реализует конвертное шифрование содержимого файлов: содержимое шифруется
+// собственным ключом данных (AES-256-GCM), а ключ данных хранится зашифрованным мастер-ключом
+// поставщика ключей (KeyProvider).
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// KeySize - размер ключа данных и мастер-ключа в байтах (AES-256).
+	KeySize = 32
+	// SegmentSize - размер сегмента открытого текста. Содержимое шифруется сегментами, у каждого свой тег
+	// аутентификации, поэтому любой диапазон файла расшифровывается без чтения всего содержимого.
+	SegmentSize = 64 << 10
+	// TagSize - размер тега аутентификации сегмента.
+	TagSize = 16
+
+	// sealedSegmentSize - размер зашифрованного сегмента (кроме, возможно, последнего).
+	sealedSegmentSize = SegmentSize + TagSize
+)
+
+var (
+	// ErrUnknownKey - у поставщика нет мастер-ключа с таким ID.
+	ErrUnknownKey = errors.New("unknown master key")
+	// ErrDecrypt - зашифрованные данные повреждены или зашифрованы другим ключом.
+	ErrDecrypt = errors.New("cannot decrypt data")
+)
+
+// KeyProvider - поставщик мастер-ключей, которыми шифруются ключи данных.
+// Мастер-ключи не покидают поставщика: он только шифрует и расшифровывает ключи данных.
+type KeyProvider interface {
+	// CurrentKeyID возвращает ID мастер-ключа, которым шифруются новые ключи данных.
+	CurrentKeyID() string
+	// WrapKey шифрует ключ данных текущим мастер-ключом и возвращает ID этого мастер-ключа.
+	WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+	// UnwrapKey расшифровывает ключ данных мастер-ключом keyID.
+	// Если мастер-ключа нет, возвращается ErrUnknownKey.
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// GenerateDataKey создаёт случайный ключ данных.
+func GenerateDataKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// EncryptedSize возвращает размер зашифрованного содержимого, открытый текст которого имеет размер size.
+func EncryptedSize(size int64) int64 {
+	segments := (size + SegmentSize - 1) / SegmentSize
+
+	return size + segments*TagSize
+}
+
+// EncryptedRange возвращает диапазон зашифрованного содержимого (смещение и длину), в котором лежат сегменты
+// с диапазоном [offset, offset+length) открытого текста размера size.
+func EncryptedRange(size, offset, length int64) (int64, int64) {
+	if length <= 0 {
+		return 0, 0
+	}
+
+	first := offset / SegmentSize
+	last := (offset + length - 1) / SegmentSize
+	start := first * sealedSegmentSize
+	end := min(EncryptedSize(size), (last+1)*sealedSegmentSize)
+
+	return start, end - start
+}
+
+// Cipher шифрует и расшифровывает одно содержимое его ключом данных.
+// Номер сегмента входит в nonce, а aad (например, ID содержимого) - в тег каждого сегмента, поэтому сегменты
+// нельзя переставить внутри содержимого или подменить сегментами другого содержимого.
+type Cipher struct {
+	aead cipher.AEAD
+	aad  []byte
+}
+
+// NewCipher создаёт Cipher с ключом данных dataKey и дополнительными данными aad.
+func NewCipher(dataKey, aad []byte) (*Cipher, error) {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cipher{aead: aead, aad: aad}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes long, got %d", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// nonce возвращает nonce сегмента: ключ данных у каждого содержимого свой, поэтому номера сегмента достаточно.
+// Повторное шифрование того же сегмента даёт тот же результат, что нужно для вычисления частей чётности
+// и повторной записи частей.
+func (c *Cipher) nonce(segment int64) []byte {
+	nonce := make([]byte, c.aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], uint64(segment))
+
+	return nonce
+}
+
+// EncryptReaderAt возвращает зашифрованное содержимое source, открытый текст которого имеет размер size.
+// Размер результата - EncryptedSize(size). Каждый вызов ReadAt шифрует затронутые сегменты заново,
+// поэтому читать его выгодно блоками не меньше SegmentSize; ReadAt можно вызывать одновременно.
+func (c *Cipher) EncryptReaderAt(source io.ReaderAt, size int64) io.ReaderAt {
+	return &encryptedReaderAt{cipher: c, source: source, size: size}
+}
+
+type encryptedReaderAt struct {
+	cipher *Cipher
+	source io.ReaderAt
+	size   int64
+}
+
+func (r *encryptedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	total := EncryptedSize(r.size)
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= total {
+		return 0, io.EOF
+	}
+
+	buffer := make([]byte, sealedSegmentSize)
+
+	var n int
+	for n < len(p) && off < total {
+		segment := off / sealedSegmentSize
+		start := segment * SegmentSize
+		length := min(SegmentSize, r.size-start)
+
+		read, err := r.source.ReadAt(buffer[:length], start)
+		if int64(read) < length {
+			if err == nil || errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+
+			return n, err
+		}
+
+		sealed := r.cipher.aead.Seal(buffer[:0], r.cipher.nonce(segment), buffer[:length], r.cipher.aad)
+		copied := copy(p[n:], sealed[off-segment*sealedSegmentSize:])
+		n += copied
+		off += int64(copied)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// DecryptReader возвращает диапазон [offset, offset+length) открытого текста размера size.
+// source - зашифрованные сегменты из диапазона EncryptedRange(size, offset, length).
+// Если сегмент не проходит проверку, чтение завершается ошибкой ErrDecrypt.
+func (c *Cipher) DecryptReader(source io.Reader, size, offset, length int64) io.Reader {
+	return &decryptReader{
+		cipher:    c,
+		source:    source,
+		size:      size,
+		segment:   offset / SegmentSize,
+		skip:      offset % SegmentSize,
+		remaining: max(0, length),
+	}
+}
+
+type decryptReader struct {
+	cipher *Cipher
+	source io.Reader
+	size   int64
+	// segment - номер следующего сегмента, skip - сколько байт в его начале не входят в диапазон.
+	segment int64
+	skip    int64
+	// remaining - сколько байт диапазона ещё не расшифровано.
+	remaining int64
+
+	buffer []byte
+	// plain - расшифрованные, но ещё не прочитанные байты текущего сегмента.
+	plain []byte
+	err   error
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.remaining == 0 {
+			return 0, io.EOF
+		}
+		r.err = r.nextSegment()
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+
+	return n, nil
+}
+
+// nextSegment читает и расшифровывает следующий сегмент.
+func (r *decryptReader) nextSegment() error {
+	start := r.segment * SegmentSize
+	if start >= r.size {
+		return io.ErrUnexpectedEOF
+	}
+	length := min(SegmentSize, r.size-start) + TagSize
+
+	if r.buffer == nil {
+		r.buffer = make([]byte, sealedSegmentSize)
+	}
+	sealed := r.buffer[:length]
+	if _, err := io.ReadFull(r.source, sealed); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return err
+	}
+
+	plain, err := r.cipher.aead.Open(sealed[:0], r.cipher.nonce(r.segment), sealed, r.cipher.aad)
+	if err != nil {
+		return fmt.Errorf("%w: segment %d", ErrDecrypt, r.segment)
+	}
+	r.segment++
+
+	plain = plain[r.skip:]
+	r.skip = 0
+	if int64(len(plain)) > r.remaining {
+		plain = plain[:r.remaining]
+	}
+	r.remaining -= int64(len(plain))
+	r.plain = plain
+
+	return nil
+}
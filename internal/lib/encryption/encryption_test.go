@@ -0,0 +1,171 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCipher(t *testing.T, aad string) *Cipher {
+	t.Helper()
+
+	key, err := GenerateDataKey()
+	require.NoError(t, err)
+	c, err := NewCipher(key, []byte(aad))
+	require.NoError(t, err)
+
+	return c
+}
+
+// encrypt шифрует data целиком, читая зашифрованное содержимое блоками по chunk байт.
+func encrypt(t *testing.T, c *Cipher, data []byte, chunk int) []byte {
+	t.Helper()
+
+	size := EncryptedSize(int64(len(data)))
+	reader := io.NewSectionReader(c.EncryptReaderAt(bytes.NewReader(data), int64(len(data))), 0, size)
+
+	var sealed bytes.Buffer
+	_, err := io.CopyBuffer(&sealed, struct{ io.Reader }{reader}, make([]byte, chunk))
+	require.NoError(t, err)
+	require.Equal(t, size, int64(sealed.Len()))
+
+	return sealed.Bytes()
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	c := newTestCipher(t, "blob")
+
+	for _, size := range []int{1, SegmentSize - 1, SegmentSize, 3*SegmentSize + 100} {
+		data := make([]byte, size)
+		_, err := rand.Read(data)
+		require.NoError(t, err)
+
+		// Результат не зависит от того, какими блоками читается зашифрованное содержимое.
+		sealed := encrypt(t, c, data, 4<<10)
+		assert.Equal(t, sealed, encrypt(t, c, data, 256<<10))
+		assert.False(t, bytes.Contains(sealed, data[:min(size, 64)]))
+
+		ranges := [][2]int64{
+			{0, int64(size)},
+			{0, 1},
+			{int64(size) - 1, 1},
+			{int64(size) / 3, int64(size) / 2},
+			{int64(size) / 2, 0},
+		}
+		for _, r := range ranges {
+			offset, length := r[0], r[1]
+			start, sealedLength := EncryptedRange(int64(size), offset, length)
+
+			plain, err := io.ReadAll(c.DecryptReader(
+				bytes.NewReader(sealed[start:start+sealedLength]), int64(size), offset, length,
+			))
+			require.NoError(t, err, "size %d, range %d+%d", size, offset, length)
+			assert.Equal(t, data[offset:offset+length], plain, "size %d, range %d+%d", size, offset, length)
+		}
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	dataKey, err := GenerateDataKey()
+	require.NoError(t, err)
+	c, err := NewCipher(dataKey, []byte("blob"))
+	require.NoError(t, err)
+
+	data := bytes.Repeat([]byte("secret "), SegmentSize/2)
+	size := int64(len(data))
+	sealed := encrypt(t, c, data, SegmentSize)
+
+	read := func(c *Cipher, sealed []byte) error {
+		_, err := io.ReadAll(c.DecryptReader(bytes.NewReader(sealed), size, 0, size))
+		return err
+	}
+
+	corrupted := bytes.Clone(sealed)
+	corrupted[SegmentSize+TagSize+10] ^= 1
+	assert.ErrorIs(t, read(c, corrupted), ErrDecrypt)
+
+	// Сегменты нельзя переставить.
+	swapped := append(bytes.Clone(sealed[sealedSegmentSize:2*sealedSegmentSize]), sealed[:sealedSegmentSize]...)
+	swapped = append(swapped, sealed[2*sealedSegmentSize:]...)
+	assert.ErrorIs(t, read(c, swapped), ErrDecrypt)
+
+	// Тот же ключ данных с другими дополнительными данными (содержимое с другим ID) не расшифровывает.
+	other, err := NewCipher(dataKey, []byte("other blob"))
+	require.NoError(t, err)
+	assert.ErrorIs(t, read(other, sealed), ErrDecrypt)
+
+	assert.ErrorIs(t, read(c, sealed[:len(sealed)-1]), io.ErrUnexpectedEOF)
+}
+
+func TestKeyFile(t *testing.T) {
+	key := func() string {
+		data := make([]byte, KeySize)
+		_, err := rand.Read(data)
+		require.NoError(t, err)
+
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	ctx := context.Background()
+
+	oldFile := "# master keys\nk1 " + key() + "\n"
+	old, err := ParseKeyFile(strings.NewReader(oldFile))
+	require.NoError(t, err)
+	assert.Equal(t, "k1", old.CurrentKeyID())
+
+	dataKey, err := GenerateDataKey()
+	require.NoError(t, err)
+	keyID, wrapped, err := old.WrapKey(ctx, dataKey)
+	require.NoError(t, err)
+	assert.Equal(t, "k1", keyID)
+	assert.False(t, bytes.Contains(wrapped, dataKey))
+
+	unwrapped, err := old.UnwrapKey(ctx, keyID, wrapped)
+	require.NoError(t, err)
+	assert.Equal(t, dataKey, unwrapped)
+
+	_, err = old.UnwrapKey(ctx, "k2", wrapped)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	tampered := bytes.Clone(wrapped)
+	tampered[len(tampered)-1] ^= 1
+	_, err = old.UnwrapKey(ctx, keyID, tampered)
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	t.Run("rotation", func(t *testing.T) {
+		// Новый ключ добавлен в конец файла: он становится текущим, а старый остаётся для расшифровки.
+		rotated, err := ParseKeyFile(strings.NewReader(oldFile + "k2 " + key() + "\n"))
+		require.NoError(t, err)
+		assert.Equal(t, "k2", rotated.CurrentKeyID())
+
+		unwrapped, err := rotated.UnwrapKey(ctx, keyID, wrapped)
+		require.NoError(t, err)
+		assert.Equal(t, dataKey, unwrapped)
+
+		newKeyID, rewrapped, err := rotated.WrapKey(ctx, unwrapped)
+		require.NoError(t, err)
+		assert.Equal(t, "k2", newKeyID)
+		_, err = old.UnwrapKey(ctx, newKeyID, rewrapped)
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, content := range []string{
+			"",
+			"# no keys\n",
+			"k1\n",
+			"k1 not-base64!\n",
+			"k1 " + base64.StdEncoding.EncodeToString([]byte("short")) + "\n",
+			"k1 " + key() + "\nk1 " + key() + "\n",
+		} {
+			_, err := ParseKeyFile(strings.NewReader(content))
+			assert.Error(t, err, content)
+		}
+	})
+}
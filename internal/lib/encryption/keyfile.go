@@ -0,0 +1,124 @@
+package encryption
+
+import (
+	"bufio"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxKeyIDLength - максимальная длина ID мастер-ключа (столбец blob.key_id).
+const maxKeyIDLength = 64
+
+// LocalKeyFile - поставщик мастер-ключей из локального файла. Каждая строка файла - ключ в формате
+// "<ID> <ключ в base64>" (32 байта); пустые строки и строки, начинающиеся с #, пропускаются.
+// Текущий ключ - последний в файле. Для ротации новый ключ добавляется в конец файла, а старые остаются,
+// пока зашифрованные ими ключи данных не перешифрованы новым.
+type LocalKeyFile struct {
+	keys    map[string]cipher.AEAD
+	current string
+}
+
+// LoadKeyFile читает мастер-ключи из файла path.
+func LoadKeyFile(path string) (*LocalKeyFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keys, err := ParseKeyFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return keys, nil
+}
+
+// ParseKeyFile читает мастер-ключи в формате LocalKeyFile из source.
+func ParseKeyFile(source io.Reader) (*LocalKeyFile, error) {
+	keys := &LocalKeyFile{keys: make(map[string]cipher.AEAD)}
+
+	scanner := bufio.NewScanner(source)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected \"<id> <base64 key>\"", line)
+		}
+		id := fields[0]
+		if len(id) > maxKeyIDLength {
+			return nil, fmt.Errorf("line %d: key ID is longer than %d bytes", line, maxKeyIDLength)
+		}
+		if _, ok := keys.keys[id]; ok {
+			return nil, fmt.Errorf("line %d: key %q is defined twice", line, id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		keys.keys[id] = aead
+		keys.current = id
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if keys.current == "" {
+		return nil, errors.New("no keys")
+	}
+
+	return keys, nil
+}
+
+// CurrentKeyID возвращает ID последнего ключа файла.
+func (k *LocalKeyFile) CurrentKeyID() string {
+	return k.current
+}
+
+// WrapKey шифрует ключ данных текущим мастер-ключом: результат - случайный nonce и зашифрованный ключ.
+// ID мастер-ключа входит в тег, поэтому ключ данных нельзя расшифровать, подменив keyID.
+func (k *LocalKeyFile) WrapKey(_ context.Context, dataKey []byte) (string, []byte, error) {
+	aead := k.keys[k.current]
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(dataKey)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", nil, err
+	}
+
+	return k.current, aead.Seal(nonce, nonce, dataKey, []byte(k.current)), nil
+}
+
+// UnwrapKey расшифровывает ключ данных, зашифрованный WrapKey мастер-ключом keyID.
+func (k *LocalKeyFile) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	nonce, sealed := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, sealed, []byte(keyID))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return dataKey, nil
+}
@@ -0,0 +1,88 @@
+// Package presign реализует подписанные ссылки с ограниченным сроком действия: подпись HMAC-SHA256
+// и время истечения передаются в параметрах запроса, поэтому по ссылке можно обратиться без ключа API.
+package presign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// QueryExpires - параметр со временем истечения ссылки в секундах Unix.
+	QueryExpires = "expires"
+	// QuerySignature - параметр с подписью ссылки.
+	QuerySignature = "signature"
+	// QueryUpload - параметр с ID разрешения на загрузку файла.
+	QueryUpload = "upload"
+)
+
+var (
+	// ErrMalformed - параметры подписи ссылки отсутствуют или некорректны.
+	ErrMalformed = errors.New("malformed presigned URL")
+	// ErrSignatureMismatch - подпись ссылки не совпала.
+	ErrSignatureMismatch = errors.New("presigned URL signature does not match")
+	// ErrExpired - срок действия ссылки истёк.
+	ErrExpired = errors.New("presigned URL is expired")
+)
+
+// Signer подписывает и проверяет ссылки секретом сервиса.
+type Signer struct {
+	secret []byte
+}
+
+// NewSigner создаёт Signer с секретом secret.
+func NewSigner(secret string) *Signer {
+	return &Signer{secret: []byte(secret)}
+}
+
+// Query возвращает параметры ссылки на запрос с методом method к пути path (и разрешением на загрузку upload,
+// если оно есть), действующей до expires.
+func (s *Signer) Query(method, path, upload string, expires time.Time) url.Values {
+	timestamp := strconv.FormatInt(expires.Unix(), 10)
+
+	query := url.Values{}
+	if upload != "" {
+		query.Set(QueryUpload, upload)
+	}
+	query.Set(QueryExpires, timestamp)
+	query.Set(QuerySignature, s.sign(method, path, upload, timestamp))
+
+	return query
+}
+
+// Verify проверяет подпись и срок действия ссылки с параметрами query на запрос с методом method к пути path
+// на момент now.
+func (s *Signer) Verify(method, path string, query url.Values, now time.Time) error {
+	timestamp, signature := query.Get(QueryExpires), query.Get(QuerySignature)
+	if timestamp == "" || signature == "" {
+		return ErrMalformed
+	}
+
+	expires, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrMalformed
+	}
+
+	expected := s.sign(method, path, query.Get(QueryUpload), timestamp)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrSignatureMismatch
+	}
+
+	if now.Unix() >= expires {
+		return ErrExpired
+	}
+
+	return nil
+}
+
+func (s *Signer) sign(method, path, upload, timestamp string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(method + "\n" + path + "\n" + upload + "\n" + timestamp))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
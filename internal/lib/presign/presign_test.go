@@ -0,0 +1,65 @@
+package presign
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	signer := NewSigner("presign-secret")
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	path := "/api/file/0d7d9a52-41a5-4c47-8f0a-d8f1c9e3b1a0"
+
+	download := signer.Query("GET", path, "", now.Add(time.Hour))
+	upload := signer.Query("PUT", "/api/file", "3f2a", now.Add(time.Hour))
+
+	with := func(query url.Values, key, value string) url.Values {
+		changed := url.Values{}
+		for k, v := range query {
+			changed[k] = append([]string(nil), v...)
+		}
+		changed.Set(key, value)
+
+		return changed
+	}
+
+	tests := []struct {
+		name   string
+		signer *Signer
+		method string
+		path   string
+		query  url.Values
+		now    time.Time
+		err    error
+	}{
+		{name: "download", method: "GET", path: path, query: download, now: now},
+		{name: "upload", method: "PUT", path: "/api/file", query: upload, now: now},
+		{name: "no signature", method: "GET", path: path, query: url.Values{QueryExpires: {"1"}}, now: now, err: ErrMalformed},
+		{name: "bad expires", method: "GET", path: path, query: with(download, QueryExpires, "soon"), now: now, err: ErrMalformed},
+		{name: "extended expires", method: "GET", path: path, query: with(download, QueryExpires, "99999999999"), now: now, err: ErrSignatureMismatch},
+		{name: "other file", method: "GET", path: "/api/file/other", query: download, now: now, err: ErrSignatureMismatch},
+		{name: "other method", method: "DELETE", path: path, query: download, now: now, err: ErrSignatureMismatch},
+		{name: "other upload", method: "PUT", path: "/api/file", query: with(upload, QueryUpload, "4f2a"), now: now, err: ErrSignatureMismatch},
+		{name: "other secret", signer: NewSigner("other"), method: "GET", path: path, query: download, now: now, err: ErrSignatureMismatch},
+		{name: "expired", method: "GET", path: path, query: download, now: now.Add(time.Hour), err: ErrExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := signer
+			if tt.signer != nil {
+				verifier = tt.signer
+			}
+
+			err := verifier.Verify(tt.method, tt.path, tt.query, tt.now)
+			if tt.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package serviceauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "test-service-secret"
+
+func TestVerifyToken(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	path := "/api/filepart/0d7d9a52-41a5-4c47-8f0a-d8f1c9e3b1a0"
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		err    error
+	}{
+		{name: "valid", method: "GET", path: path, token: Token(testSecret, "GET", path, now)},
+		{name: "clock skew within limit", method: "GET", path: path, token: Token(testSecret, "GET", path, now.Add(4*time.Minute))},
+		{name: "missing", method: "GET", path: path, err: ErrMissingToken},
+		{name: "malformed", method: "GET", path: path, token: "signature", err: ErrMalformedToken},
+		{name: "bad timestamp", method: "GET", path: path, token: "now.abc", err: ErrMalformedToken},
+		{name: "wrong secret", method: "GET", path: path, token: Token("other", "GET", path, now), err: ErrTokenMismatch},
+		{name: "other method", method: "DELETE", path: path, token: Token(testSecret, "GET", path, now), err: ErrTokenMismatch},
+		{name: "other path", method: "GET", path: "/api/stats", token: Token(testSecret, "GET", path, now), err: ErrTokenMismatch},
+		{name: "expired", method: "GET", path: path, token: Token(testSecret, "GET", path, now.Add(-10*time.Minute)), err: ErrTokenExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, http.NoBody)
+			if tt.token != "" {
+				r.Header.Set(HeaderToken, tt.token)
+			}
+
+			err := Verify(testSecret, r, now)
+			if tt.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestTransportSignsRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := Verify(testSecret, r, time.Now()); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	client := &http.Client{Transport: &Transport{Base: http.DefaultTransport, Secret: testSecret}}
+	request, err := http.NewRequest("PUT", server.URL+"/api/filepart", http.NoBody)
+	require.NoError(t, err)
+
+	response, err := client.Do(request)
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	// Исходный запрос не меняется.
+	assert.Empty(t, request.Header.Get(HeaderToken))
+
+	response, err = http.Get(server.URL + "/api/stats")
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeCertificate(t, dir, "ca", nil, nil)
+	writeCertificate(t, dir, "server", ca, caKey)
+	writeCertificate(t, dir, "client", ca, caKey)
+	// Сертификат, выпущенный другим УЦ.
+	otherCA, otherKey := writeCertificate(t, dir, "other-ca", nil, nil)
+	writeCertificate(t, dir, "other", otherCA, otherKey)
+
+	files := func(name string) TLSFiles {
+		return TLSFiles{
+			CertFile: filepath.Join(dir, name+".pem"),
+			KeyFile:  filepath.Join(dir, name+"-key.pem"),
+			CAFile:   filepath.Join(dir, "ca.pem"),
+		}
+	}
+
+	serverConfig, err := ServerConfig(files("server"))
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, serverConfig.ClientAuth)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = serverConfig
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	get := func(config *tls.Config) (string, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		response, err := client.Get(server.URL + "/api/stats")
+		if err != nil {
+			return "", err
+		}
+		defer response.Body.Close()
+
+		body := make([]byte, 64)
+		n, _ := response.Body.Read(body)
+
+		return string(body[:n]), nil
+	}
+
+	t.Run("client certificate", func(t *testing.T) {
+		config, err := ClientConfig(files("client"))
+		require.NoError(t, err)
+
+		name, err := get(config)
+		require.NoError(t, err)
+		assert.Equal(t, "client", name)
+	})
+
+	t.Run("no client certificate", func(t *testing.T) {
+		config, err := ClientConfig(TLSFiles{CAFile: filepath.Join(dir, "ca.pem")})
+		require.NoError(t, err)
+
+		_, err = get(config)
+		assert.Error(t, err)
+	})
+
+	t.Run("certificate of other CA", func(t *testing.T) {
+		config, err := ClientConfig(files("other"))
+		require.NoError(t, err)
+
+		_, err = get(config)
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown server CA", func(t *testing.T) {
+		other := files("client")
+		other.CAFile = filepath.Join(dir, "other-ca.pem")
+		config, err := ClientConfig(other)
+		require.NoError(t, err)
+
+		_, err = get(config)
+		assert.Error(t, err)
+	})
+}
+
+func TestConfigDisabled(t *testing.T) {
+	config, err := ServerConfig(TLSFiles{})
+	require.NoError(t, err)
+	assert.Nil(t, config)
+
+	config, err = ClientConfig(TLSFiles{})
+	require.NoError(t, err)
+	assert.Nil(t, config)
+
+	_, err = ServerConfig(TLSFiles{CAFile: "ca.pem"})
+	assert.Error(t, err)
+}
+
+// writeCertificate создаёт в dir сертификат <name>.pem и ключ <name>-key.pem, подписанные УЦ parent
+// (или самоподписанный сертификат УЦ, если parent не задан).
+func writeCertificate(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+		template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+"-key.pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return cert, key
+}
@@ -0,0 +1,234 @@
+package sigv4
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxChunkSize - максимальный размер подписанного блока aws-chunked: блок проверяется целиком до отдачи данных.
+	maxChunkSize = 16 << 20
+	// maxChunkHeaderSize - максимальная длина строки заголовка блока или трейлера.
+	maxChunkHeaderSize = 4 << 10
+)
+
+// chunkSigner проверяет подписи блоков aws-chunked: подпись каждого блока зависит от подписи предыдущего,
+// для первого блока - от подписи запроса.
+type chunkSigner struct {
+	key       []byte
+	amzDate   string
+	scope     string
+	signature string
+}
+
+// verify проверяет подпись блока data и запоминает её для следующего блока.
+func (s *chunkSigner) verify(data []byte, signature string) error {
+	hash := sha256.Sum256(data)
+	toSign := strings.Join([]string{
+		Algorithm + "-PAYLOAD",
+		s.amzDate,
+		s.scope,
+		s.signature,
+		EmptyPayloadHash,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	expected := hex.EncodeToString(hmacSHA256(s.key, toSign))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrSignatureMismatch
+	}
+	s.signature = expected
+
+	return nil
+}
+
+// chunkedReader декодирует тело в формате aws-chunked:
+// <размер в hex>[;chunk-signature=<подпись>]\r\n<данные>\r\n ... 0[;chunk-signature=<подпись>]\r\n[трейлеры]\r\n.
+// Если signer задан, подписи блоков проверяются, и данные блока отдаются только после проверки.
+type chunkedReader struct {
+	body   io.Closer
+	reader *bufio.Reader
+	signer *chunkSigner
+
+	// decodedLength - длина декодированного тела из x-amz-decoded-content-length.
+	decodedLength int64
+	read          int64
+
+	// current - непрочитанные данные текущего подписанного блока; remaining - остаток неподписанного блока.
+	current   []byte
+	remaining int64
+	done      bool
+	err       error
+}
+
+func newChunkedReader(r *http.Request, signer *chunkSigner) (*chunkedReader, error) {
+	decodedLength, err := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+	if err != nil || decodedLength < 0 {
+		return nil, fmt.Errorf("%w: invalid X-Amz-Decoded-Content-Length header", ErrMalformed)
+	}
+	r.ContentLength = decodedLength
+
+	return &chunkedReader{
+		body:          r.Body,
+		reader:        bufio.NewReader(r.Body),
+		signer:        signer,
+		decodedLength: decodedLength,
+	}, nil
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	for r.err == nil && len(r.current) == 0 && r.remaining == 0 && !r.done {
+		r.err = r.nextChunk()
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	var n int
+	switch {
+	case len(r.current) > 0:
+		n = copy(p, r.current)
+		r.current = r.current[n:]
+	case r.remaining > 0:
+		var err error
+		n, err = r.reader.Read(p[:min(int64(len(p)), r.remaining)])
+		r.remaining -= int64(n)
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			r.err = err
+		}
+		if r.err == nil && r.remaining == 0 {
+			r.err = r.readCRLF()
+		}
+	default:
+		return 0, io.EOF
+	}
+
+	r.read += int64(n)
+	if r.read > r.decodedLength {
+		r.err = fmt.Errorf("%w: body is longer than X-Amz-Decoded-Content-Length", ErrMalformed)
+	}
+
+	return n, nil
+}
+
+func (r *chunkedReader) Close() error {
+	return r.body.Close()
+}
+
+// nextChunk читает заголовок следующего блока; для подписанного блока читает и проверяет весь блок.
+func (r *chunkedReader) nextChunk() error {
+	line, err := r.readLine()
+	if err != nil {
+		return err
+	}
+
+	sizeValue, extension, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(sizeValue, 16, 64)
+	if err != nil || size < 0 {
+		return fmt.Errorf("%w: invalid chunk size", ErrMalformed)
+	}
+
+	if r.signer == nil {
+		if size == 0 {
+			return r.finish()
+		}
+		r.remaining = size
+
+		return nil
+	}
+
+	signature, ok := strings.CutPrefix(extension, "chunk-signature=")
+	if !ok {
+		return fmt.Errorf("%w: chunk signature is required", ErrMalformed)
+	}
+	if size > maxChunkSize {
+		return fmt.Errorf("%w: chunk is too large", ErrMalformed)
+	}
+
+	data := make([]byte, size)
+	if _, err = io.ReadFull(r.reader, data); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	if err = r.readCRLF(); err != nil && size > 0 {
+		return err
+	}
+	if err = r.signer.verify(data, signature); err != nil {
+		return err
+	}
+
+	if size == 0 {
+		r.done = true
+		return r.checkLength()
+	}
+	r.current = data
+
+	return nil
+}
+
+// finish читает трейлеры после последнего блока (они не проверяются) и пустую строку в конце тела.
+func (r *chunkedReader) finish() error {
+	for {
+		line, err := r.readLine()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			break
+		}
+	}
+	r.done = true
+
+	return r.checkLength()
+}
+
+// checkLength проверяет, что длина декодированного тела совпала с x-amz-decoded-content-length.
+func (r *chunkedReader) checkLength() error {
+	if r.read != r.decodedLength {
+		return fmt.Errorf("%w: body length does not match X-Amz-Decoded-Content-Length", ErrMalformed)
+	}
+
+	return nil
+}
+
+// readLine читает строку, завершённую \r\n (без \r\n).
+func (r *chunkedReader) readLine() (string, error) {
+	line, err := r.reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) || len(line) > maxChunkHeaderSize {
+		return "", fmt.Errorf("%w: chunk header is too long", ErrMalformed)
+	}
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(line) == 0 {
+			return "", io.EOF
+		}
+		return "", io.ErrUnexpectedEOF
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(string(line), "\n"), "\r"), nil
+}
+
+// readCRLF читает \r\n после данных блока.
+func (r *chunkedReader) readCRLF() error {
+	line, err := r.readLine()
+	if err != nil {
+		return err
+	}
+	if line != "" {
+		return fmt.Errorf("%w: chunk data is longer than its size", ErrMalformed)
+	}
+
+	return nil
+}
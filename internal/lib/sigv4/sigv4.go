@@ -0,0 +1,406 @@
+// Package sigv4 реализует подпись запросов AWS Signature Version 4 (заголовок Authorization),
+// которой подписывают запросы S3-клиенты (aws-cli, rclone, SDK).
+package sigv4
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Algorithm - алгоритм подписи в заголовке Authorization.
+	Algorithm = "AWS4-HMAC-SHA256"
+	// UnsignedPayload - значение x-amz-content-sha256, если тело запроса не подписывается.
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+	// StreamingPayload - тело передаётся в формате aws-chunked, каждый блок подписан.
+	StreamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	// StreamingUnsignedPayloadTrailer - тело передаётся в формате aws-chunked без подписи блоков,
+	// после последнего блока идут заголовки-трейлеры (например, контрольная сумма).
+	StreamingUnsignedPayloadTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+	// EmptyPayloadHash - SHA-256 пустого тела запроса.
+	EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	// HeaderDate и HeaderContentSHA256 - заголовки с временем подписи и хешем тела запроса.
+	HeaderDate          = "X-Amz-Date"
+	HeaderContentSHA256 = "X-Amz-Content-Sha256"
+
+	timeFormat = "20060102T150405Z"
+	dateFormat = "20060102"
+	// maxClockSkew - допустимое расхождение времени подписи и времени сервера.
+	maxClockSkew = 15 * time.Minute
+)
+
+var (
+	// ErrMissingAuth - запрос не подписан.
+	ErrMissingAuth = errors.New("request is not signed")
+	// ErrMalformed - заголовок Authorization или заголовки подписи некорректны.
+	ErrMalformed = errors.New("malformed authorization")
+	// ErrUnknownAccessKey - ключ доступа не найден.
+	ErrUnknownAccessKey = errors.New("unknown access key")
+	// ErrSignatureMismatch - подпись запроса не совпала.
+	ErrSignatureMismatch = errors.New("signature does not match")
+	// ErrTimeSkewed - время подписи слишком отличается от времени сервера.
+	ErrTimeSkewed = errors.New("request time is too skewed")
+	// ErrContentSHA256Mismatch - хеш тела запроса не совпал с x-amz-content-sha256.
+	ErrContentSHA256Mismatch = errors.New("content SHA-256 does not match")
+	// ErrUnsupportedPayload - способ передачи тела запроса не поддерживается.
+	ErrUnsupportedPayload = errors.New("unsupported payload signing")
+)
+
+// SecretLookup возвращает секретный ключ для ключа доступа accessKey
+// или ErrUnknownAccessKey, если такого ключа нет.
+type SecretLookup func(ctx context.Context, accessKey string) (string, error)
+
+// StaticCredentials возвращает SecretLookup для одной пары ключей.
+func StaticCredentials(accessKey, secretKey string) SecretLookup {
+	return func(_ context.Context, key string) (string, error) {
+		if accessKey == "" || !hmac.Equal([]byte(key), []byte(accessKey)) {
+			return "", ErrUnknownAccessKey
+		}
+
+		return secretKey, nil
+	}
+}
+
+// Verifier проверяет подпись запросов для региона Region и сервиса Service (например, "s3").
+type Verifier struct {
+	Region  string
+	Service string
+	Lookup  SecretLookup
+	// Now - текущее время (для тестов); по умолчанию time.Now.
+	Now func() time.Time
+}
+
+// authorization - разобранный заголовок Authorization.
+type authorization struct {
+	accessKey     string
+	date          string
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+}
+
+// scope возвращает область действия подписи: дата/регион/сервис/aws4_request.
+func (a *authorization) scope() string {
+	return strings.Join([]string{a.date, a.region, a.service, "aws4_request"}, "/")
+}
+
+// Verify проверяет подпись запроса r и возвращает ключ доступа, которым он подписан.
+// Тело запроса заменяется потоком, который проверяет хеш тела (x-amz-content-sha256) при чтении
+// и возвращает ErrContentSHA256Mismatch в конце потока, если хеш не совпал; тело в формате aws-chunked
+// декодируется (подписи блоков проверяются), а r.ContentLength становится длиной декодированного тела.
+func (v *Verifier) Verify(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", ErrMissingAuth
+	}
+
+	auth, err := parseAuthorization(header)
+	if err != nil {
+		return "", err
+	}
+	if auth.region != v.Region || auth.service != v.Service {
+		return "", fmt.Errorf("%w: credential scope %s does not match %s/%s", ErrMalformed, auth.scope(), v.Region, v.Service)
+	}
+
+	amzDate := r.Header.Get(HeaderDate)
+	if amzDate == "" {
+		return "", fmt.Errorf("%w: %s header is required", ErrMalformed, HeaderDate)
+	}
+	signedAt, err := time.Parse(timeFormat, amzDate)
+	if err != nil || signedAt.Format(dateFormat) != auth.date {
+		return "", fmt.Errorf("%w: invalid %s header", ErrMalformed, HeaderDate)
+	}
+
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+	if skew := now().Sub(signedAt); skew > maxClockSkew || skew < -maxClockSkew {
+		return "", ErrTimeSkewed
+	}
+
+	payloadHash := r.Header.Get(HeaderContentSHA256)
+	if payloadHash == "" {
+		return "", fmt.Errorf("%w: %s header is required", ErrMalformed, HeaderContentSHA256)
+	}
+
+	secretKey, err := v.Lookup(r.Context(), auth.accessKey)
+	if err != nil {
+		return "", err
+	}
+
+	signingKey := SigningKey(secretKey, auth.date, auth.region, auth.service)
+	canonical := canonicalRequest(r, auth.signedHeaders, payloadHash)
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign(amzDate, auth.scope(), canonical)))
+	if !hmac.Equal([]byte(signature), []byte(auth.signature)) {
+		return "", ErrSignatureMismatch
+	}
+
+	switch {
+	case payloadHash == UnsignedPayload:
+	case payloadHash == StreamingPayload:
+		chunked, err := newChunkedReader(r, &chunkSigner{
+			key:       signingKey,
+			amzDate:   amzDate,
+			scope:     auth.scope(),
+			signature: signature,
+		})
+		if err != nil {
+			return "", err
+		}
+		r.Body = chunked
+	case payloadHash == StreamingUnsignedPayloadTrailer:
+		chunked, err := newChunkedReader(r, nil)
+		if err != nil {
+			return "", err
+		}
+		r.Body = chunked
+	case isSHA256Hex(payloadHash):
+		r.Body = &hashingReader{ReadCloser: r.Body, hash: sha256.New(), want: payloadHash}
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedPayload, payloadHash)
+	}
+
+	return auth.accessKey, nil
+}
+
+// parseAuthorization разбирает заголовок вида
+// AWS4-HMAC-SHA256 Credential=AK/20260101/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-date, Signature=...
+func parseAuthorization(header string) (*authorization, error) {
+	params, ok := strings.CutPrefix(header, Algorithm+" ")
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported algorithm", ErrMalformed)
+	}
+
+	values := make(map[string]string, 3)
+	for _, param := range strings.Split(params, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid parameter %q", ErrMalformed, param)
+		}
+		values[name] = value
+	}
+
+	credential := strings.Split(values["Credential"], "/")
+	if len(credential) != 5 || credential[0] == "" || credential[4] != "aws4_request" {
+		return nil, fmt.Errorf("%w: invalid credential", ErrMalformed)
+	}
+	if values["SignedHeaders"] == "" || values["Signature"] == "" {
+		return nil, fmt.Errorf("%w: signed headers and signature are required", ErrMalformed)
+	}
+
+	signedHeaders := strings.Split(values["SignedHeaders"], ";")
+	if !sort.StringsAreSorted(signedHeaders) || !containsString(signedHeaders, "host") {
+		return nil, fmt.Errorf("%w: invalid signed headers", ErrMalformed)
+	}
+
+	return &authorization{
+		accessKey:     credential[0],
+		date:          credential[1],
+		region:        credential[2],
+		service:       credential[3],
+		signedHeaders: signedHeaders,
+		signature:     values["Signature"],
+	}, nil
+}
+
+// Sign подписывает запрос r (заголовки X-Amz-Date, X-Amz-Content-Sha256 и Authorization) так же,
+// как это делают S3-клиенты. Подписываются заголовки Host, Content-Type, Content-MD5 и все заголовки X-Amz-*.
+// payloadHash - SHA-256 тела запроса в hex или UnsignedPayload.
+func Sign(r *http.Request, accessKey, secretKey, region, service string, now time.Time, payloadHash string) {
+	amzDate := now.UTC().Format(timeFormat)
+	date := now.UTC().Format(dateFormat)
+
+	r.Header.Set(HeaderDate, amzDate)
+	r.Header.Set(HeaderContentSHA256, payloadHash)
+
+	signedHeaders := []string{"host"}
+	for name := range r.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" || lower == "content-md5" {
+			signedHeaders = append(signedHeaders, lower)
+		}
+	}
+	sort.Strings(signedHeaders)
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	canonical := canonicalRequest(r, signedHeaders, payloadHash)
+	signature := hmacSHA256(SigningKey(secretKey, date, region, service), stringToSign(amzDate, scope, canonical))
+
+	r.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		Algorithm,
+		accessKey,
+		scope,
+		strings.Join(signedHeaders, ";"),
+		hex.EncodeToString(signature),
+	))
+}
+
+// SigningKey возвращает ключ подписи для даты date (ГГГГММДД), региона и сервиса.
+func SigningKey(secretKey, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+
+	return hmacSHA256(key, "aws4_request")
+}
+
+// canonicalRequest возвращает каноническое представление запроса для подписи.
+func canonicalRequest(r *http.Request, signedHeaders []string, payloadHash string) string {
+	return strings.Join([]string{
+		r.Method,
+		canonicalURI(r.URL),
+		canonicalQuery(r.URL.Query()),
+		canonicalHeaders(r, signedHeaders),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// stringToSign возвращает строку, которая подписывается ключом подписи.
+func stringToSign(amzDate, scope, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+
+	return strings.Join([]string{Algorithm, amzDate, scope, hex.EncodeToString(hash[:])}, "\n")
+}
+
+// canonicalURI возвращает путь запроса, закодированный по правилам S3 (каждый сегмент кодируется один раз).
+func canonicalURI(u *url.URL) string {
+	if u.Path == "" {
+		return "/"
+	}
+
+	return URIEncode(u.Path, false)
+}
+
+// canonicalQuery возвращает параметры запроса, отсортированные по имени и значению.
+func canonicalQuery(query url.Values) string {
+	params := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, URIEncode(name, true)+"="+URIEncode(value, true))
+		}
+	}
+	sort.Strings(params)
+
+	return strings.Join(params, "&")
+}
+
+// canonicalHeaders возвращает подписываемые заголовки: имя в нижнем регистре, значения без лишних пробелов.
+func canonicalHeaders(r *http.Request, signedHeaders []string) string {
+	var b strings.Builder
+
+	for _, name := range signedHeaders {
+		var values []string
+		switch name {
+		case "host":
+			values = []string{r.Host}
+			if r.Host == "" {
+				values = []string{r.URL.Host}
+			}
+		case "content-length":
+			values = r.Header.Values(name)
+			if len(values) == 0 && r.ContentLength >= 0 {
+				values = []string{fmt.Sprint(r.ContentLength)}
+			}
+		default:
+			values = r.Header.Values(name)
+		}
+
+		// Values возвращает срез из заголовков запроса, поэтому значения не меняются на месте.
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(trimmed, ","))
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
+
+// URIEncode кодирует строку по правилам AWS: не кодируются только буквы, цифры и символы -_.~,
+// символ / не кодируется, если encodeSlash = false.
+func URIEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&0x0f])
+		}
+	}
+
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+func isSHA256Hex(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+
+	return err == nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hashingReader - тело запроса, хеш которого сверяется с ожидаемым в конце потока.
+type hashingReader struct {
+	io.ReadCloser
+	hash interface {
+		io.Writer
+		Sum(b []byte) []byte
+	}
+	want string
+}
+
+func (r *hashingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+
+	if errors.Is(err, io.EOF) && hex.EncodeToString(r.hash.Sum(nil)) != r.want {
+		return n, ErrContentSHA256Mismatch
+	}
+
+	return n, err
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"io"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,18 +15,72 @@ type FileItem struct {
 	FileName        string `json:"file_name"`
 	FileContentType string `json:"file_content_type"`
 	FileContent     []byte `json:"file_content"`
-}
-
-// BucketItem - структура для хранения элемента корзины.
-type BucketItem struct {
-	ID     int64  `json:"id"`
-	Source []byte `json:"source"`
+	// Content - поток содержимого файла при загрузке (читается один раз).
+	Content io.Reader `json:"-"`
+	// Checksum - контрольная сумма SHA-256 содержимого (для частей файла в бакетах).
+	Checksum string `json:"-"`
 }
 
 // ServerBucketInfo - структура для хранения информации о сервере корзины.
+// swagger:model
 type ServerBucketInfo struct {
 	ID      int64  `json:"id"`
-	Address string `json:"string"`
+	Address string `json:"address"`
+}
+
+// BucketStats - статистика использования бакета (экземпляра service_b).
+// MaxBytes - ограничение памяти Redis (0, если не задано).
+// swagger:model
+type BucketStats struct {
+	UsedBytes int64 `json:"used_bytes"`
+	Parts     int64 `json:"parts"`
+	MaxBytes  int64 `json:"max_bytes"`
+}
+
+// RebalanceStatus - состояние и прогресс переноса частей файлов между бакетами.
+// Счётчики относятся к текущему (или последнему завершённому) проходу.
+// swagger:model
+type RebalanceStatus struct {
+	Running      bool      `json:"running"`
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+	FilesScanned int64     `json:"files_scanned"`
+	PartsMoved   int64     `json:"parts_moved"`
+	BytesMoved   int64     `json:"bytes_moved"`
+	PartsFailed  int64     `json:"parts_failed"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+// ScrubStatus - состояние и счётчики проверки целостности частей файлов в бакетах.
+// FilesRepaired - файлы, у которых восстановлена хотя бы одна копия части;
+// FilesUnrecoverable - файлы, недостающие части которых восстановить не удалось.
+// Счётчики относятся к текущему (или последнему завершённому) проходу.
+// swagger:model
+type ScrubStatus struct {
+	Running            bool      `json:"running"`
+	StartedAt          time.Time `json:"started_at"`
+	FinishedAt         time.Time `json:"finished_at"`
+	FilesScanned       int64     `json:"files_scanned"`
+	FilesRepaired      int64     `json:"files_repaired"`
+	FilesUnrecoverable int64     `json:"files_unrecoverable"`
+	PartsRepaired      int64     `json:"parts_repaired"`
+	LastError          string    `json:"last_error,omitempty"`
+}
+
+// KeyRotation - результат перешифрования ключей данных текущим мастер-ключом KeyID:
+// Rotated - количество перешифрованных ключей, Failed - ключи, которые перешифровать не удалось.
+// swagger:model
+type KeyRotation struct {
+	KeyID   string `json:"key_id"`
+	Rotated int    `json:"rotated"`
+	Failed  int    `json:"failed"`
+}
+
+// BlobKey - зашифрованный ключ данных содержимого BlobID (поля blob.key_id и blob.wrapped_key).
+type BlobKey struct {
+	BlobID     uuid.UUID `db:"id"`
+	KeyID      string    `db:"key_id"`
+	WrappedKey []byte    `db:"wrapped_key"`
 }
 
 // CacheItem - структура для работы с таблицей cache в базе данных.
@@ -33,23 +90,379 @@ type CacheItem struct {
 	ExpiredAt time.Time `json:"expired_at" db:"expired_at"`
 }
 
-// MetadataItem - структура для таблицы metadata.
+// MetadataItem - метаданные файла (таблица file) вместе с его содержимым (таблица blob).
+// Одно содержимое (BlobID) может быть общим для нескольких файлов с одинаковой контрольной суммой;
+// части содержимого хранятся в бакетах по BlobID.
+// swagger:model
 type MetadataItem struct {
 	UUID        uuid.UUID `db:"uuid" json:"uuid"`
+	BlobID      uuid.UUID `db:"blob_id" json:"blob_id"`
 	Checksum    string    `db:"checksum" json:"checksum"`
 	FileName    string    `db:"filename" json:"filename"`
 	ContentType string    `db:"content_type" json:"content_type"`
-	BucketIDs   []int64   `db:"bucket_ids" json:"bucket_ids"`
+	// Owner - ID ключа API, которым загружен файл (пусто, если файл загружен без аутентификации).
+	Owner     string  `db:"owner_key" json:"owner,omitempty"`
+	BucketIDs []int64 `db:"bucket_ids" json:"bucket_ids"`
+	// Parts - манифест: части файла по порядку (сначала части с данными, затем части чётности).
+	Parts []PartItem `db:"manifest" json:"parts"`
+	Size  int64      `db:"size" json:"size"`
+	// DataShards и ParityShards - схема кодирования Рида-Соломона, которой файл разложен по BucketIDs.
+	DataShards   int `db:"data_shards" json:"data_shards"`
+	ParityShards int `db:"parity_shards" json:"parity_shards"`
+	// KeyID - ID мастер-ключа, которым зашифрован ключ данных WrappedKey; части такого содержимого хранятся
+	// в бакетах зашифрованными. Пустой KeyID - содержимое хранится без шифрования.
+	KeyID      string    `db:"key_id" json:"key_id,omitempty"`
+	WrappedKey []byte    `db:"wrapped_key" json:"-"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+// PartItem - часть файла в манифесте (blob.manifest).
+// BucketID - бакет основной копии части, Replicas - бакеты остальных копий (если копий больше одной);
+// Offset - смещение части с данными в файле (для частей чётности 0);
+// Checksum - контрольная сумма SHA-256 части (пустая, пока часть не записана в бакет).
+// swagger:model
+type PartItem struct {
+	Index    int     `json:"index"`
+	BucketID int64   `json:"bucket_id"`
+	Replicas []int64 `json:"replicas,omitempty"`
+	Offset   int64   `json:"offset"`
+	Length   int64   `json:"length"`
+	Checksum string  `json:"checksum"`
+}
+
+// Locations возвращает все бакеты, в которых хранятся копии части: сначала основной, затем остальные.
+func (p PartItem) Locations() []int64 {
+	return append([]int64{p.BucketID}, p.Replicas...)
+}
+
+// PendingDeleteItem - структура для таблицы pending_delete (часть содержимого, ожидающая удаления из бакета).
+type PendingDeleteItem struct {
+	BlobID        uuid.UUID `db:"blob_id" json:"blob_id"`
+	BucketID      int64     `db:"bucket_id" json:"bucket_id"`
+	Attempts      int       `db:"attempts" json:"attempts"`
+	LastError     string    `db:"last_error" json:"last_error"`
+	NextAttemptAt time.Time `db:"next_attempt_at" json:"next_attempt_at"`
+}
+
+// CreateUploadRequest - запрос на создание загрузки файла по частям.
+// Если ContentType не задан, тип содержимого определяется по первым байтам файла при завершении загрузки.
+// swagger:model
+type CreateUploadRequest struct {
+	FileName    string `json:"filename"`
+	ContentType string `json:"content_type"`
+}
+
+// UploadInfo - загрузка файла по частям (таблица upload) и уже загруженные части.
+// swagger:model
+type UploadInfo struct {
+	ID          uuid.UUID `db:"id" json:"id"`
+	FileName    string    `db:"filename" json:"filename"`
+	ContentType string    `db:"content_type" json:"content_type"`
+	// Owner - ID ключа API, которым создана загрузка (пусто, если загрузка создана без аутентификации).
+	// Загрузкой может пользоваться только её владелец или ключ с областью admin; владелец загрузки
+	// становится владельцем собранного файла.
+	Owner string `db:"owner_key" json:"owner,omitempty"`
+	// Completing - загрузка собирается в файл, части менять нельзя.
+	Completing bool             `db:"completing" json:"completing"`
+	CreatedAt  time.Time        `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time        `db:"updated_at" json:"updated_at"`
+	Parts      []UploadPartItem `json:"parts"`
+}
+
+// UploadPartItem - загруженная часть файла (таблица upload_part).
+// FileName - имя файла части в каталоге загрузок service_a.
+// swagger:model
+type UploadPartItem struct {
+	PartNumber int    `db:"part_number" json:"part_number"`
+	Size       int64  `db:"size" json:"size"`
+	Checksum   string `db:"checksum" json:"checksum"`
+	FileName   string `db:"filename" json:"-"`
+}
+
+// NamespaceItem - пространство имён объектов (таблица namespace; бакет в терминах S3).
+// Versioning - каждая запись и удаление объекта сохраняют его прежние версии.
+// swagger:model
+type NamespaceItem struct {
+	Name       string    `db:"name" json:"name"`
+	Versioning bool      `db:"versioning" json:"versioning"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+// ObjectItem - объект: файл с ключом Key в пространстве имён Namespace (таблица object)
+// и сведения о его содержимом. VersionID - версия объекта (пустая, если объект записан без версионирования).
+// swagger:model
+type ObjectItem struct {
+	Namespace   string    `db:"namespace" json:"namespace"`
+	Key         string    `db:"key" json:"key"`
+	FileID      uuid.UUID `db:"file_uuid" json:"file_id"`
+	VersionID   string    `db:"version_id" json:"version_id,omitempty"`
+	Size        int64     `db:"size" json:"size"`
+	Checksum    string    `db:"checksum" json:"checksum"`
+	ContentType string    `db:"content_type" json:"content_type"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// ObjectVersion - версия объекта (таблица object_version) и сведения о её содержимом.
+// У маркера удаления (DeleteMarker) нет файла: FileID - uuid.Nil, поля содержимого пустые.
+// IsLatest - версия является текущим состоянием объекта.
+// swagger:model
+type ObjectVersion struct {
+	VersionID    string    `db:"id" json:"version_id"`
+	Namespace    string    `db:"namespace" json:"namespace"`
+	Key          string    `db:"key" json:"key"`
+	FileID       uuid.UUID `db:"file_uuid" json:"file_id"`
+	DeleteMarker bool      `json:"delete_marker"`
+	IsLatest     bool      `json:"is_latest"`
+	Size         int64     `db:"size" json:"size"`
+	Checksum     string    `db:"checksum" json:"checksum"`
+	ContentType  string    `db:"content_type" json:"content_type"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
+// ObjectVersionList - версии объекта, от последней к первой.
+// swagger:model
+type ObjectVersionList struct {
+	Versions []*ObjectVersion `json:"versions"`
+}
+
+// LifecycleRule - правило жизненного цикла объектов пространства имён (таблица lifecycle_rule).
+// Правило действует на объекты с ключами, которые начинаются с Prefix (пустой префикс - все объекты
+// пространства имён, полный ключ - один объект). Нулевые значения действий означают, что действия нет:
+// ExpireDays - объект удаляется через столько дней после последнего изменения;
+// ExpireAt - в этот момент удаляются объекты, изменённые до него;
+// KeepVersions - хранятся столько последних версий объекта, более старые удаляются безвозвратно.
+// swagger:model
+type LifecycleRule struct {
+	Namespace    string     `db:"namespace" json:"-"`
+	Prefix       string     `db:"prefix" json:"prefix"`
+	ExpireDays   int        `db:"expire_days" json:"expire_days,omitempty"`
+	ExpireAt     *time.Time `db:"expire_at" json:"expire_at,omitempty"`
+	KeepVersions int        `db:"keep_versions" json:"keep_versions,omitempty"`
+}
+
+// LifecycleConfiguration - правила жизненного цикла пространства имён.
+// swagger:model
+type LifecycleConfiguration struct {
+	Rules []*LifecycleRule `json:"rules"`
+}
+
+// ObjectList - страница списка объектов пространства имён.
+// CommonPrefixes - общие префиксы ключей до разделителя, которые заменяют в списке объекты с такими ключами;
+// NextAfter - последний ключ или префикс страницы, с которого продолжается список, если IsTruncated.
+type ObjectList struct {
+	Objects        []*ObjectItem `json:"objects"`
+	CommonPrefixes []string      `json:"common_prefixes"`
+	IsTruncated    bool          `json:"is_truncated"`
+	NextAfter      string        `json:"next_after"`
+}
+
+// Поля сортировки списка файлов (FileFilter.Sort).
+const (
+	FileSortCreatedAt = "created_at"
+	FileSortFileName  = "filename"
+	FileSortSize      = "size"
+)
+
+// FileFilter - условия отбора и порядок списка файлов.
+// Пустые и нулевые поля не ограничивают список: CreatedFrom и MinSize - нижние границы включительно,
+// CreatedTo - верхняя граница не включительно, MaxSize - верхняя граница включительно.
+// Cursor - продолжение списка (FileList.NextCursor предыдущей страницы с теми же условиями).
+type FileFilter struct {
+	FileNamePrefix string
+	ContentType    string
+	CreatedFrom    time.Time
+	CreatedTo      time.Time
+	MinSize        int64
+	MaxSize        int64
+	Sort           string
+	Desc           bool
+	Cursor         string
+	Limit          int
+	// Owner - ID ключа API: если задан, в список попадают только файлы этого ключа.
+	Owner string
+}
+
+// FileCursor - позиция в списке файлов: сортировка списка, значение поля сортировки и UUID
+// последнего файла страницы (UUID упорядочивает файлы с одинаковым значением поля сортировки).
+type FileCursor struct {
+	Sort      string    `json:"s"`
+	Desc      bool      `json:"d,omitempty"`
+	CreatedAt time.Time `json:"c,omitempty"`
+	FileName  string    `json:"f,omitempty"`
+	Size      int64     `json:"z,omitempty"`
+	UUID      uuid.UUID `json:"u"`
+}
+
+// FileInfo - запись списка файлов: метаданные файла без манифеста содержимого.
+// swagger:model
+type FileInfo struct {
+	UUID        uuid.UUID `db:"uuid" json:"uuid"`
+	FileName    string    `db:"filename" json:"filename"`
+	ContentType string    `db:"content_type" json:"content_type"`
+	Size        int64     `db:"size" json:"size"`
+	Checksum    string    `db:"checksum" json:"checksum"`
 	CreatedAt   time.Time `db:"created_at" json:"created_at"`
 }
 
+// FileList - страница списка файлов. NextCursor пуст, если страница последняя.
+// swagger:model
+type FileList struct {
+	Files      []*FileInfo `json:"files"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// Области действия (scopes) ключей API.
+const (
+	ScopeRead   = "read"
+	ScopeWrite  = "write"
+	ScopeDelete = "delete"
+	ScopeAdmin  = "admin"
+)
+
+// APIKey - ключ REST API (таблица api_key) с разрешёнными операциями Scopes.
+// Namespaces - пространства имён, к которым есть доступ (пустой список - все).
+// Secret возвращается только при создании ключа.
+// swagger:model
+type APIKey struct {
+	ID         string    `db:"id" json:"id"`
+	Secret     string    `db:"secret" json:"secret,omitempty"`
+	Scopes     []string  `db:"scopes" json:"scopes"`
+	Namespaces []string  `db:"namespaces" json:"namespaces"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+// HasScope сообщает, разрешена ли ключу операция scope. Ключу с областью admin разрешено всё.
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope) || slices.Contains(k.Scopes, ScopeAdmin)
+}
+
+// AllowsNamespace сообщает, есть ли у ключа доступ к пространству имён namespace.
+func (k *APIKey) AllowsNamespace(namespace string) bool {
+	return len(k.Namespaces) == 0 || slices.Contains(k.Namespaces, namespace) || slices.Contains(k.Scopes, ScopeAdmin)
+}
+
+// CanAccessFile сообщает, есть ли у ключа доступ к файлу владельца owner: к своим файлам и, для ключа
+// с областью admin, ко всем файлам (в том числе к файлам без владельца, загруженным без аутентификации).
+func (k *APIKey) CanAccessFile(owner string) bool {
+	return (owner != "" && owner == k.ID) || slices.Contains(k.Scopes, ScopeAdmin)
+}
+
+// CreateAPIKeyRequest - запрос на создание ключа API.
+// swagger:model
+type CreateAPIKeyRequest struct {
+	Scopes     []string `json:"scopes"`
+	Namespaces []string `json:"namespaces"`
+}
+
+// APIKeyList - ключи API (без секретов).
+// swagger:model
+type APIKeyList struct {
+	Keys []*APIKey `json:"keys"`
+}
+
+// PresignRequest - запрос на создание подписанной ссылки: ExpiresIn - срок действия в секундах (0 - по умолчанию);
+// для ссылки на загрузку MaxSize - максимальный размер файла в байтах и ContentType - допустимый тип
+// содержимого (type/subtype или type/*, пусто - любой).
+// swagger:model
+type PresignRequest struct {
+	ExpiresIn   int64  `json:"expires_in,omitempty"`
+	MaxSize     int64  `json:"max_size,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// PresignedURL - подписанная ссылка, по которой можно выполнить запрос Method без ключа API до ExpiresAt.
+// swagger:model
+type PresignedURL struct {
+	URL         string    `json:"url"`
+	Method      string    `json:"method"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	MaxSize     int64     `json:"max_size,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+}
+
+// PresignedUpload - разрешение на однократную загрузку файла по подписанной ссылке (таблица presigned_upload).
+// Owner - ключ API, создавший ссылку: он записывается владельцем загруженного файла.
+type PresignedUpload struct {
+	ID          string    `db:"id"`
+	Owner       string    `db:"owner_key"`
+	MaxSize     int64     `db:"max_size"`
+	ContentType string    `db:"content_type"`
+	ExpiresAt   time.Time `db:"expires_at"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// AllowsContentType сообщает, можно ли загрузить по разрешению файл с типом содержимого contentType
+// (параметры типа, например charset, не учитываются).
+func (u *PresignedUpload) AllowsContentType(contentType string) bool {
+	if u.ContentType == "" {
+		return true
+	}
+
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if prefix, ok := strings.CutSuffix(u.ContentType, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+
+	return mediaType == u.ContentType
+}
+
+// IfMatch - условие изменения объекта или файла из заголовка If-Match: контрольные суммы SHA-256
+// допустимого текущего содержимого или "*" (любое содержимое). nil - условия нет.
+type IfMatch []string
+
+// Matches сообщает, выполнено ли условие для текущего содержимого с контрольной суммой checksum.
+// Если содержимого нет, checksum - пустая строка, и условие (кроме nil) не выполнено.
+func (m IfMatch) Matches(checksum string) bool {
+	if m == nil {
+		return true
+	}
+	if checksum == "" {
+		return false
+	}
+
+	for _, value := range m {
+		if value == "*" || value == checksum {
+			return true
+		}
+	}
+
+	return false
+}
+
 // ResponseSuccess - структура для возврата ответа об успешном сохранении файла.
 // swagger:model
 type ResponseSuccess struct {
 	ID string `json:"id"`
 }
 
+// ResponsePendingDelete - структура для возврата ответа о частичном удалении файла.
+// Части файла в перечисленных бакетах будут удалены повторными попытками.
+// swagger:model
+type ResponsePendingDelete struct {
+	ID               string  `json:"id"`
+	PendingBucketIDs []int64 `json:"pending_bucket_ids"`
+}
+
+// Коды ошибок в ResponseError.
+const (
+	ErrorCodeBadRequest          = "bad_request"
+	ErrorCodeNotFound            = "not_found"
+	ErrorCodeRangeNotSatisfiable = "range_not_satisfiable"
+	ErrorCodeCorrupted           = "corrupted"
+	ErrorCodeBucketUnreachable   = "bucket_unreachable"
+	ErrorCodeBucketTimeout       = "bucket_timeout"
+	ErrorCodeConflict            = "conflict"
+	ErrorCodePreconditionFailed  = "precondition_failed"
+	ErrorCodeUnauthorized        = "unauthorized"
+	ErrorCodeForbidden           = "forbidden"
+	ErrorCodeTooLarge            = "too_large"
+	ErrorCodeUnsupportedMedia    = "unsupported_media_type"
+	ErrorCodeInternal            = "internal_error"
+)
+
 // ResponseError - структура для возврата ответа об ошибке.
+// swagger:model
 type ResponseError struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
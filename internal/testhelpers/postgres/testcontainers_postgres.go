@@ -23,7 +23,7 @@ type TestContainerDatabase struct {
 	instance testcontainers.Container
 }
 
-func newTestContainerDatabase(t *testing.T) *TestContainerDatabase {
+func newTestContainerDatabase() (*TestContainerDatabase, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
 	req := testcontainers.ContainerRequest{
@@ -41,10 +41,12 @@ func newTestContainerDatabase(t *testing.T) *TestContainerDatabase {
 		ContainerRequest: req,
 		Started:          true,
 	})
-	require.NoError(t, err)
+	if err != nil {
+		return nil, err
+	}
 	return &TestContainerDatabase{
 		instance: postgres,
-	}
+	}, nil
 }
 
 func (db *TestContainerDatabase) Port(t *testing.T) int {
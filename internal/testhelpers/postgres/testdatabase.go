@@ -21,7 +21,11 @@ type TestDatabase struct {
 }
 
 func NewTestDatabase(t *testing.T) (*TestDatabase, error) {
-	containerDB := newTestContainerDatabase(t)
+	// Без Docker контейнер не запускается: ошибка возвращается, чтобы тесты могли пропустить проверки с БД.
+	containerDB, err := newTestContainerDatabase()
+	if err != nil {
+		return nil, err
+	}
 	// connectString := "host=localhost port=5432 dbname=postgres user=postgres password=postgres client_encoding=UTF8 sslmode=disable"
 	connectString := containerDB.ConnectionString(t)
 
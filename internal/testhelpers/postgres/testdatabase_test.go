@@ -4,11 +4,12 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewTestDatabase(t *testing.T) {
 	got, err := NewTestDatabase(t)
-	assert.NoError(t, err)
+	require.NoError(t, err)
 	err = got.DB().Ping()
 	assert.NoError(t, err)
 }
@@ -3,15 +3,26 @@ package tests
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"karma8/internal/app"
+	"karma8/internal/app/handler"
+	"karma8/internal/config"
 	"karma8/internal/lib/logger/sl"
+	"karma8/internal/lib/serviceauth"
+	"karma8/internal/lib/sigv4"
 	"karma8/internal/models"
 	"karma8/internal/testhelpers/postgres"
 	"karma8/internal/testhelpers/redis"
@@ -22,6 +33,46 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// Ключи подписи запросов к S3-совместимому API тестового сервиса.
+const (
+	s3AccessKey = "test-access-key"
+	s3SecretKey = "test-secret-key"
+	s3Region    = "us-east-1"
+)
+
+// serviceSecret - общий секрет подписи запросов тестового service_a к бакетам.
+const serviceSecret = "test-service-secret"
+
+// presignSecret - секрет подписи ссылок тестового service_a.
+const presignSecret = "test-presign-secret"
+
+// encryptionKeys - файл мастер-ключей тестового service_a: содержимое файлов хранится в бакетах зашифрованным.
+const encryptionKeys = "test-key VaWBGGmDxYgESXHL7I9xj1zR9+HzJOwIWI88hq/s2Qc=\n"
+
+// Ключ администратора REST API тестового service_a.
+const (
+	apiAdminKey    = "test-admin"
+	apiAdminSecret = "test-admin-secret"
+)
+
+// apiClient - клиент для запросов к REST API service_a с ключом администратора.
+var apiClient = &http.Client{Transport: &apiKeyTransport{base: http.DefaultTransport}}
+
+// apiKeyTransport добавляет к запросам ключ администратора REST API.
+type apiKeyTransport struct {
+	base http.RoundTripper
+}
+
+func (t *apiKeyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set(handler.HeaderAPIKey, apiAdminKey+":"+apiAdminSecret)
+
+	return t.base.RoundTrip(r)
+}
+
+// bucketClient - клиент для запросов к бакетам напрямую (с подписью, как у service_a).
+var bucketClient = &http.Client{Transport: &serviceauth.Transport{Base: http.DefaultTransport, Secret: serviceSecret}}
+
 func TestHappyPath(t *testing.T) {
 	t.Helper()
 	// Подготовим тестовые данные.
@@ -55,18 +106,48 @@ not your IP address,HN,Benin,Fredyshire,-70.41275040993187,60.19866111663936,204
 
 	log := sl.SetupLogger("nop")
 
+	keyFile := filepath.Join(t.TempDir(), "keys")
+	require.NoError(t, os.WriteFile(keyFile, []byte(encryptionKeys), 0o600))
+
 	serviceNameA := "service_a_test"
-	applicationA, err := app.NewServiceA(log, testDB.ConnectString(t), httpPort, true, tracingAddress, serviceNameA)
+	applicationA, err := app.NewServiceA(log, &config.Config{
+		DBConnect:         testDB.ConnectString(t),
+		Port:              httpPort,
+		DataShards:        4,
+		ParityShards:      2,
+		Replicas:          1,
+		S3AccessKey:       s3AccessKey,
+		S3SecretKey:       s3SecretKey,
+		S3Region:          s3Region,
+		APIAdminKey:       apiAdminKey,
+		APIAdminSecret:    apiAdminSecret,
+		ServiceSecret:     serviceSecret,
+		PresignSecret:     presignSecret,
+		EncryptionKeyFile: keyFile,
+		UseTracing:        true,
+		TracingAddress:    tracingAddress,
+	}, serviceNameA)
 	defer applicationA.Stop()
 	assert.NoError(t, err)
 
 	go applicationA.Start()
 
 	serviceNameB := "service_b_test"
+	// bucketConfig - настройки бакета с номером n (порт и БД Redis у каждого бакета свои).
+	bucketConfig := func(n int) *config.Config {
+		return &config.Config{
+			DBConnect:      testRedis.ConnectString(t),
+			Port:           httpPort + n,
+			RedisDB:        n,
+			ServiceSecret:  serviceSecret,
+			UseTracing:     true,
+			TracingAddress: tracingAddress,
+		}
+	}
 
 	applicationB := make([]*app.App, 6)
 	for i := 0; i < 6; i++ {
-		applicationB[i], err = app.NewServiceB(log, testRedis.ConnectString(t), httpPort+1+i, i+1, true, tracingAddress, serviceNameB)
+		applicationB[i], err = app.NewServiceB(log, bucketConfig(i+1), serviceNameB)
 		defer applicationB[i].Stop()
 		assert.NoError(t, err)
 
@@ -86,6 +167,535 @@ not your IP address,HN,Benin,Fredyshire,-70.41275040993187,60.19866111663936,204
 	assert.Equal(t, http.StatusOK, response.StatusCode)
 
 	// Сохраним файл на сервер.
+	newID := putFile(t, baseURL, testFile)
+
+	// Получим файл с сервера (из кеша).
+	getFile(t, baseURL, newID, testFile)
+
+	// Очистим файловый кеш.
+	err = applicationA.ClearCacheAll()
+	assert.NoError(t, err)
+
+	// Получим файл с сервера (из Redis)
+	getFile(t, baseURL, newID, testFile)
+
+	// Получим диапазон байт файла, захватывающий несколько частей (из Redis).
+	getFileRange(t, baseURL, newID, testFile, 50, 350)
+
+	// Размер и метаданные файла доступны без загрузки содержимого.
+	response, err = apiClient.Head(baseURL + "/api/file/" + newID)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, int64(len(testFile)), response.ContentLength)
+
+	response, err = apiClient.Get(baseURL + "/api/file/" + newID + "/meta")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var metadata models.MetadataItem
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&metadata))
+	assert.Equal(t, newID, metadata.UUID.String())
+	assert.Equal(t, int64(len(testFile)), metadata.Size)
+	assert.NotEmpty(t, metadata.Parts)
+	assert.Equal(t, "test-key", metadata.KeyID)
+
+	// Запустим ещё один бакет и зарегистрируем его без перезапуска service_a.
+	applicationB7, err := app.NewServiceB(log, bucketConfig(7), serviceNameB)
+	defer applicationB7.Stop()
+	assert.NoError(t, err)
+
+	go applicationB7.Start()
+
+	assert.Equal(t, http.StatusOK, registerBucket(t, baseURL, 7, fmt.Sprintf("http://localhost:%d", httpPort+7)))
+	assert.Equal(t, http.StatusBadRequest, registerBucket(t, baseURL, 8, "localhost"))
+
+	// Файл, загруженный до изменения списка бакетов, читается по манифесту.
+	getFile(t, baseURL, newID, testFile)
+
+	// Административный API доступен только с ключом администратора.
+	response, err = http.Get(baseURL + "/api/admin/rebalance")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+	// Состояние переноса частей между бакетами доступно через административный API.
+	response, err = apiClient.Get(baseURL + "/api/admin/rebalance")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	// Состояние проверки частей доступно через административный API.
+	response, err = apiClient.Get(baseURL + "/api/admin/scrub")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	// Части хранятся в бакетах по ID содержимого (blob), а не по ID файла.
+	var blobID string
+	err = testDB.DB().QueryRow("SELECT blob_id FROM file WHERE uuid = $1", newID).Scan(&blobID)
+	require.NoError(t, err)
+
+	// Файл загружен до добавления седьмого бакета, поэтому его части есть во всех шести первых бакетах:
+	// бакет сообщает размер и контрольную сумму хранимой части.
+	response, err = bucketClient.Head(fmt.Sprintf("http://localhost:%d/api/filepart/%s", httpPort+1, blobID))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.NotEmpty(t, response.Header.Get("X-Checksum-Sha256"))
+
+	// Части хранятся в бакетах зашифрованными: ни одна из них не содержит данных файла.
+	for i := 1; i <= 6; i++ {
+		response, err = bucketClient.Get(fmt.Sprintf("http://localhost:%d/api/filepart/%s", httpPort+i, blobID))
+		require.NoError(t, err)
+		defer response.Body.Close()
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		part, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		assert.NotEmpty(t, part)
+		assert.False(t, bytes.Contains(part, []byte("ip_address")), "bucket %d", i)
+		assert.False(t, bytes.Contains(part, []byte("Nepal")), "bucket %d", i)
+	}
+
+	// Ключи данных уже зашифрованы текущим мастер-ключом: перешифровывать нечего.
+	response, err = apiClient.Post(baseURL+"/api/admin/encryption/rotate", "application/json", http.NoBody)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var rotation models.KeyRotation
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&rotation))
+	assert.Equal(t, models.KeyRotation{KeyID: "test-key"}, rotation)
+
+	// Без подписи общим секретом бакет запрос не принимает.
+	response, err = http.Head(fmt.Sprintf("http://localhost:%d/api/filepart/%s", httpPort+1, blobID))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+	// Повторная загрузка того же содержимого создаёт новый файл, который ссылается на то же содержимое.
+	dupID := putFile(t, baseURL, testFile)
+	assert.NotEqual(t, newID, dupID)
+
+	var dupBlobID string
+	var refcount int
+	err = testDB.DB().QueryRow(
+		"SELECT b.id, b.refcount FROM file f JOIN blob b ON b.id = f.blob_id WHERE f.uuid = $1", dupID,
+	).Scan(&dupBlobID, &refcount)
+	require.NoError(t, err)
+	assert.Equal(t, blobID, dupBlobID)
+	assert.Equal(t, 2, refcount)
+
+	// Оба файла доступны.
+	getFile(t, baseURL, newID, testFile)
+	getFile(t, baseURL, dupID, testFile)
+
+	// Оба файла есть в списке файлов: по одному на странице, новые сначала.
+	page := listFiles(t, baseURL, "filename_prefix=file&order=desc&limit=1")
+	require.Len(t, page.Files, 1)
+	assert.Equal(t, dupID, page.Files[0].UUID.String())
+	assert.Equal(t, int64(len(testFile)), page.Files[0].Size)
+	require.NotEmpty(t, page.NextCursor)
+
+	page = listFiles(t, baseURL, "filename_prefix=file&order=desc&limit=1&cursor="+page.NextCursor)
+	require.Len(t, page.Files, 1)
+	assert.Equal(t, newID, page.Files[0].UUID.String())
+	assert.Empty(t, page.NextCursor)
+
+	page = listFiles(t, baseURL, fmt.Sprintf("min_size=%d", len(testFile)+1))
+	assert.Empty(t, page.Files)
+
+	// По подписанной ссылке файл скачивается без ключа API.
+	presigned := presignURL(t, baseURL, "/api/file/"+newID+"/presign", `{"expires_in": 60}`)
+	assert.Equal(t, http.MethodGet, presigned.Method)
+	response, err = http.Get(presigned.URL)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	got, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, testFile, got)
+
+	// Ссылка с изменённым сроком действия не принимается.
+	response, err = http.Get(strings.Replace(presigned.URL, "expires=", "expires=9", 1))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+
+	// По подписанной ссылке на загрузку можно загрузить только один файл с допустимым размером и типом.
+	presigned = presignURL(t, baseURL, "/api/file/presign", `{"max_size": 1024, "content_type": "text/*"}`)
+	assert.Equal(t, http.MethodPut, presigned.Method)
+	status, _ := putFormFile(t, presigned.URL, []byte("uploaded by a presigned URL\n"))
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = putFormFile(t, presigned.URL, []byte("uploaded by a presigned URL\n"))
+	assert.Equal(t, http.StatusForbidden, status)
+
+	presigned = presignURL(t, baseURL, "/api/file/presign", `{"max_size": 8}`)
+	status, _ = putFormFile(t, presigned.URL, []byte("larger than eight bytes\n"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+
+	// Удалим файл с сервера.
+	deleteFile(t, baseURL, newID)
+
+	// Удалённый файл больше не доступен.
+	response, err = apiClient.Get(fmt.Sprintf(baseURL+"/api/file/%s", newID))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	// Файл с тем же содержимым по-прежнему доступен, в том числе из бакетов.
+	err = applicationA.ClearCacheAll()
+	assert.NoError(t, err)
+	getFile(t, baseURL, dupID, testFile)
+
+	// После удаления последнего файла удаляются и части содержимого в бакетах.
+	deleteFile(t, baseURL, dupID)
+
+	response, err = bucketClient.Head(fmt.Sprintf("http://localhost:%d/api/filepart/%s", httpPort+1, blobID))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	// Загрузим файл по частям; части отправляются не по порядку, вторая часть отправляется повторно.
+	uploadID := createUpload(t, baseURL, `{"filename": "upload.csv"}`)
+	assert.Equal(t, http.StatusOK, putUploadPart(t, baseURL, uploadID, 3, testFile[400:]))
+	assert.Equal(t, http.StatusOK, putUploadPart(t, baseURL, uploadID, 1, testFile[:100]))
+
+	// Вторая часть не загружена - собрать файл нельзя, загрузка сохраняется.
+	status, _ = completeUpload(t, baseURL, uploadID)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	assert.Equal(t, http.StatusOK, putUploadPart(t, baseURL, uploadID, 2, testFile[100:200]))
+	assert.Equal(t, http.StatusOK, putUploadPart(t, baseURL, uploadID, 2, testFile[100:400]))
+	assert.Equal(t, http.StatusBadRequest, putUploadPart(t, baseURL, uploadID, 0, testFile))
+
+	// Загруженные части можно узнать, чтобы продолжить прерванную загрузку.
+	response, err = apiClient.Get(baseURL + "/api/uploads/" + uploadID)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	var upload models.UploadInfo
+	err = json.NewDecoder(response.Body).Decode(&upload)
+	require.NoError(t, err)
+	require.Len(t, upload.Parts, 3)
+	assert.Equal(t, int64(300), upload.Parts[1].Size)
+
+	status, uploadedID := completeUpload(t, baseURL, uploadID)
+	assert.Equal(t, http.StatusOK, status)
+	getFile(t, baseURL, uploadedID, testFile)
+
+	// Собранная загрузка удаляется.
+	assert.Equal(t, http.StatusNotFound, putUploadPart(t, baseURL, uploadID, 1, testFile))
+
+	// Прерванная загрузка удаляется вместе с частями.
+	abortID := createUpload(t, baseURL, `{"filename": "abort.csv"}`)
+	assert.Equal(t, http.StatusOK, putUploadPart(t, baseURL, abortID, 1, testFile))
+
+	request, err := http.NewRequest("DELETE", baseURL+"/api/uploads/"+abortID, http.NoBody)
+	require.NoError(t, err)
+	response, err = apiClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	status, _ = completeUpload(t, baseURL, abortID)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	deleteFile(t, baseURL, uploadedID)
+
+	// Объекты по ключам в пространстве имён.
+	assert.Equal(t, http.StatusOK, apiRequest(t, baseURL, "PUT", "/api/ns/finance", nil).StatusCode)
+	assert.Equal(t, http.StatusConflict, apiRequest(t, baseURL, "PUT", "/api/ns/finance", nil).StatusCode)
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, baseURL, "PUT", "/api/ns/missing/objects/a.csv", testFile).StatusCode)
+
+	response = apiRequest(t, baseURL, "PUT", "/api/ns/finance/objects/reports/2026/q3.csv", testFile)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var object models.ObjectItem
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&object))
+	assert.Equal(t, "reports/2026/q3.csv", object.Key)
+	getFile(t, baseURL, object.FileID.String(), testFile)
+
+	response = apiRequest(t, baseURL, "GET", "/api/ns/finance/objects/reports/2026/q3.csv", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	data, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, testFile, data)
+
+	// Содержимое не изменилось - повторно не отдаётся.
+	request, err = http.NewRequest("GET", baseURL+"/api/ns/finance/objects/reports/2026/q3.csv", http.NoBody)
+	require.NoError(t, err)
+	request.Header.Set("If-None-Match", `"`+object.Checksum+`"`)
+	response, err = apiClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusNotModified, response.StatusCode)
+
+	// Перезапись с устаревшим ETag отклоняется.
+	request, err = http.NewRequest("PUT", baseURL+"/api/ns/finance/objects/reports/2026/q3.csv", bytes.NewReader([]byte("stale")))
+	require.NoError(t, err)
+	request.Header.Set("If-Match", `"stale"`)
+	response, err = apiClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusPreconditionFailed, response.StatusCode)
+
+	// Перезапись объекта заменяет содержимое и удаляет прежний файл.
+	request, err = http.NewRequest("PUT", baseURL+"/api/ns/finance/objects/reports/2026/q3.csv", bytes.NewReader([]byte("replaced")))
+	require.NoError(t, err)
+	request.Header.Set("If-Match", `"`+object.Checksum+`"`)
+	response, err = apiClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	response = apiRequest(t, baseURL, "GET", "/api/ns/finance/objects/reports/2026/q3.csv", nil)
+	data, err = io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "replaced", string(data))
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, baseURL, "GET", "/api/file/"+object.FileID.String(), nil).StatusCode)
+
+	assert.Equal(t, http.StatusOK, apiRequest(t, baseURL, "DELETE", "/api/ns/finance/objects/reports/2026/q3.csv", nil).StatusCode)
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, baseURL, "GET", "/api/ns/finance/objects/reports/2026/q3.csv", nil).StatusCode)
+
+	// Версии объекта: перезапись и удаление сохраняют прежнее содержимое.
+	assert.Equal(t, http.StatusOK, apiRequest(t, baseURL, "PUT", "/api/ns/finance/versioning", nil).StatusCode)
+	response = apiRequest(t, baseURL, "PUT", "/api/ns/finance/objects/ledger.csv", testFile)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var first models.ObjectItem
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&first))
+	require.NotEmpty(t, first.VersionID)
+	assert.Equal(t, http.StatusOK, apiRequest(t, baseURL, "PUT", "/api/ns/finance/objects/ledger.csv", []byte("second")).StatusCode)
+	assert.Equal(t, http.StatusOK, apiRequest(t, baseURL, "DELETE", "/api/ns/finance/objects/ledger.csv", nil).StatusCode)
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, baseURL, "GET", "/api/ns/finance/objects/ledger.csv", nil).StatusCode)
+
+	response = apiRequest(t, baseURL, "GET", "/api/ns/finance/versions/ledger.csv", nil)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var versions models.ObjectVersionList
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&versions))
+	require.Len(t, versions.Versions, 3)
+	assert.True(t, versions.Versions[0].DeleteMarker)
+	assert.True(t, versions.Versions[0].IsLatest)
+	assert.Equal(t, first.VersionID, versions.Versions[2].VersionID)
+	assert.Equal(t, http.StatusNotFound,
+		apiRequest(t, baseURL, "GET", "/api/ns/finance/objects/ledger.csv?version="+versions.Versions[0].VersionID, nil).StatusCode)
+
+	response = apiRequest(t, baseURL, "GET", "/api/ns/finance/objects/ledger.csv?version="+first.VersionID, nil)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	data, err = io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, testFile, data)
+
+	// Восстановленная версия становится текущим содержимым объекта.
+	assert.Equal(t, http.StatusOK,
+		apiRequest(t, baseURL, "POST", "/api/ns/finance/restore/ledger.csv?version="+first.VersionID, nil).StatusCode)
+	response = apiRequest(t, baseURL, "GET", "/api/ns/finance/objects/ledger.csv", nil)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	data, err = io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, testFile, data)
+
+	// Правила жизненного цикла объектов.
+	assert.Equal(t, http.StatusBadRequest,
+		apiRequest(t, baseURL, "PUT", "/api/ns/finance/lifecycle", []byte(`{"rules": [{"prefix": "tmp/"}]}`)).StatusCode)
+	assert.Equal(t, http.StatusNotFound,
+		apiRequest(t, baseURL, "PUT", "/api/ns/missing/lifecycle", []byte(`{"rules": []}`)).StatusCode)
+	assert.Equal(t, http.StatusOK, apiRequest(t, baseURL, "PUT", "/api/ns/finance/lifecycle",
+		[]byte(`{"rules": [{"prefix": "tmp/", "expire_days": 7}, {"prefix": "", "keep_versions": 3}]}`)).StatusCode)
+
+	response = apiRequest(t, baseURL, "GET", "/api/ns/finance/lifecycle", nil)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var lifecycle models.LifecycleConfiguration
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&lifecycle))
+	require.Len(t, lifecycle.Rules, 2)
+	assert.Equal(t, "tmp/", lifecycle.Rules[0].Prefix)
+	assert.Equal(t, 7, lifecycle.Rules[0].ExpireDays)
+	assert.Equal(t, 3, lifecycle.Rules[1].KeepVersions)
+
+	// Работа с объектами через S3-совместимый API.
+	response = s3Request(t, baseURL, "PUT", "/reports", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	for _, key := range []string{"/2026/q1.csv", "/2026/q2.csv", "/readme.txt"} {
+		response = s3Request(t, baseURL, "PUT", "/reports"+key, testFile)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	}
+
+	response = s3Request(t, baseURL, "GET", "/reports/2026/q1.csv", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	data, err = io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, testFile, data)
+
+	// Объекты с разделителем в ключе после префикса объединяются в общий префикс.
+	response = s3Request(t, baseURL, "GET", "/reports?list-type=2&delimiter=%2F", nil)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var list s3ListResult
+	require.NoError(t, xml.NewDecoder(response.Body).Decode(&list))
+	assert.Equal(t, []string{"readme.txt"}, list.Keys)
+	assert.Equal(t, []string{"2026/"}, list.Prefixes)
+
+	// Перезапись объекта заменяет его содержимое.
+	response = s3Request(t, baseURL, "PUT", "/reports/2026/q1.csv", []byte("replaced"))
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	response = s3Request(t, baseURL, "GET", "/reports/2026/q1.csv", nil)
+	data, err = io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "replaced", string(data))
+
+	response = s3Request(t, baseURL, "DELETE", "/reports/2026/q1.csv", nil)
+	assert.Equal(t, http.StatusNoContent, response.StatusCode)
+	response = s3Request(t, baseURL, "HEAD", "/reports/2026/q1.csv", nil)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	// Пустые объекты (например, метки каталогов "dir/") сохраняются без частей в бакетах.
+	response = s3Request(t, baseURL, "PUT", "/reports/2027/", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	response = s3Request(t, baseURL, "GET", "/reports/2027/", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	data, err = io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+}
+
+// listFiles возвращает страницу списка файлов с параметрами запроса query.
+func listFiles(t *testing.T, baseURL string, query string) models.FileList {
+	t.Helper()
+
+	response, err := apiClient.Get(baseURL + "/api/files?" + query)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	var list models.FileList
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&list))
+
+	return list
+}
+
+// apiRequest отправляет запрос к API service_a.
+func apiRequest(t *testing.T, baseURL string, method string, path string, body []byte) *http.Response {
+	t.Helper()
+
+	request, err := http.NewRequest(method, baseURL+path, bytes.NewReader(body))
+	require.NoError(t, err)
+
+	response, err := apiClient.Do(request)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = response.Body.Close() })
+
+	return response
+}
+
+// presignURL создаёт подписанную ссылку запросом POST path с телом body.
+func presignURL(t *testing.T, baseURL string, path string, body string) models.PresignedURL {
+	t.Helper()
+
+	response := apiRequest(t, baseURL, "POST", path, []byte(body))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	var presigned models.PresignedURL
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&presigned))
+
+	return presigned
+}
+
+// putFormFile загружает файл data в multipart-форме запросом PUT url и возвращает код и тело ответа.
+func putFormFile(t *testing.T, url string, data []byte) (int, []byte) {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "presigned.txt")
+	require.NoError(t, err)
+	_, err = part.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	request, err := http.NewRequest("PUT", url, &body)
+	require.NoError(t, err)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	got, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	return response.StatusCode, got
+}
+
+// s3ListResult - ключи и общие префиксы из ответа ListObjectsV2.
+type s3ListResult struct {
+	Keys     []string `xml:"Contents>Key"`
+	Prefixes []string `xml:"CommonPrefixes>Prefix"`
+}
+
+// s3Request отправляет запрос к S3-совместимому API, подписанный ключами тестового сервиса.
+func s3Request(t *testing.T, baseURL string, method string, path string, body []byte) *http.Response {
+	t.Helper()
+
+	request, err := http.NewRequest(method, baseURL+"/s3"+path, bytes.NewReader(body))
+	require.NoError(t, err)
+
+	hash := sha256.Sum256(body)
+	sigv4.Sign(request, s3AccessKey, s3SecretKey, s3Region, "s3", time.Now(), hex.EncodeToString(hash[:]))
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = response.Body.Close() })
+
+	return response
+}
+
+func createUpload(t *testing.T, baseURL string, body string) string {
+	t.Helper()
+
+	response, err := apiClient.Post(baseURL+"/api/uploads", "application/json", bytes.NewReader([]byte(body)))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	var result models.ResponseSuccess
+	err = json.NewDecoder(response.Body).Decode(&result)
+	require.NoError(t, err)
+
+	return result.ID
+}
+
+func putUploadPart(t *testing.T, baseURL string, uploadID string, n int, data []byte) int {
+	t.Helper()
+
+	url := fmt.Sprintf("%s/api/uploads/%s/parts/%d", baseURL, uploadID, n)
+
+	request, err := http.NewRequest("PUT", url, bytes.NewReader(data))
+	require.NoError(t, err)
+	request.Header.Set("Content-Type", "application/octet-stream")
+
+	response, err := apiClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	return response.StatusCode
+}
+
+func completeUpload(t *testing.T, baseURL string, uploadID string) (int, string) {
+	t.Helper()
+
+	response, err := apiClient.Post(baseURL+"/api/uploads/"+uploadID+"/complete", "application/json", http.NoBody)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	var result models.ResponseSuccess
+	if response.StatusCode == http.StatusOK {
+		err = json.NewDecoder(response.Body).Decode(&result)
+		require.NoError(t, err)
+	}
+
+	return response.StatusCode, result.ID
+}
+
+func putFile(t *testing.T, baseURL string, testFile []byte) string {
+	t.Helper()
+
 	url := baseURL + "/api/file"
 
 	// Создаем буфер для записи данных формы.
@@ -104,46 +714,86 @@ not your IP address,HN,Benin,Fredyshire,-70.41275040993187,60.19866111663936,204
 
 	// Создаем HTTP запрос с методом PUT и устанавливаем заголовки
 	request, err := http.NewRequest("PUT", url, &body)
-	assert.NoError(t, err)
+	require.NoError(t, err)
 
 	request.Header.Set("Content-Type", writer.FormDataContentType())
 
 	// Отправляем запрос
-	response, err = http.DefaultClient.Do(request)
+	response, err := apiClient.Do(request)
 	require.NoError(t, err)
-	defer func() {
-		if response != nil {
-			response.Body.Close()
-		}
-	}()
+	defer response.Body.Close()
 
 	assert.Equal(t, http.StatusOK, response.StatusCode)
 
 	got, err := io.ReadAll(response.Body)
 	assert.NoError(t, err)
 
-	var newID string
-	if http.StatusOK == response.StatusCode {
-		var gotResult models.ResponseSuccess
-
-		err = json.Unmarshal(got, &gotResult)
-		assert.NoError(t, err)
-		assert.NotNil(t, gotResult)
-		newID = gotResult.ID
-		t.Logf("ID: %s", newID)
-	} else {
-		t.Errorf("Error: %s", got)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("Error: %s", got)
 	}
 
-	// Получим файл с сервера (из кеша).
-	getFile(t, baseURL, newID, testFile)
+	var gotResult models.ResponseSuccess
+	err = json.Unmarshal(got, &gotResult)
+	assert.NoError(t, err)
+	t.Logf("ID: %s", gotResult.ID)
 
-	// Очистим файловый кеш.
-	err = applicationA.ClearCacheAll()
+	return gotResult.ID
+}
+
+func registerBucket(t *testing.T, baseURL string, id int64, address string) int {
+	t.Helper()
+
+	body, err := json.Marshal(models.ServerBucketInfo{ID: id, Address: address})
+	require.NoError(t, err)
+
+	response, err := apiClient.Post(baseURL+"/api/admin/buckets", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	return response.StatusCode
+}
+
+func getFileRange(t *testing.T, baseURL string, id string, testFile []byte, start, end int) {
+	t.Helper()
+
+	url := fmt.Sprintf(baseURL+"/api/file/%s", id)
+
+	request, err := http.NewRequest("GET", url, http.NoBody)
+	require.NoError(t, err)
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	response, err := apiClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	// Проверяем код ответа и заголовки.
+	assert.Equal(t, http.StatusPartialContent, response.StatusCode)
+	assert.Equal(t, fmt.Sprintf("bytes %d-%d/%d", start, end, len(testFile)), response.Header.Get("Content-Range"))
+
+	// Читаем данные из тела ответа.
+	data, err := io.ReadAll(response.Body)
 	assert.NoError(t, err)
 
-	// Получим файл с сервера (из Redis)
-	getFile(t, baseURL, newID, testFile)
+	diff := cmp.Diff(testFile[start:end+1], data)
+	if diff != "" {
+		t.Fatal("file range result mismatch\n", diff)
+	}
+}
+
+func deleteFile(t *testing.T, baseURL string, id string) {
+	t.Helper()
+
+	url := fmt.Sprintf(baseURL+"/api/file/%s", id)
+
+	request, err := http.NewRequest("DELETE", url, http.NoBody)
+	require.NoError(t, err)
+
+	response, err := apiClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	// Все части файла должны быть удалены сразу.
+	assert.Equal(t, http.StatusOK, response.StatusCode)
 }
 
 func getFile(t *testing.T, baseURL string, id string, testFile []byte) {
@@ -152,7 +802,7 @@ func getFile(t *testing.T, baseURL string, id string, testFile []byte) {
 	// Получим файл с сервера (из кеша).
 	url := fmt.Sprintf(baseURL+"/api/file/%s", id)
 
-	response, err := http.Get(url)
+	response, err := apiClient.Get(url)
 	assert.NoError(t, err)
 	defer response.Body.Close()
 